@@ -0,0 +1,52 @@
+package s3mover
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// validateAccessPoint validates the access point ARN as the bucket. A bucket name is not validated here.
+// S3 Object Lambda access points are rejected because they transform only the reads.
+func validateAccessPoint(bucket string) error {
+	if !arn.IsARN(bucket) {
+		return nil
+	}
+	a, err := arn.Parse(bucket)
+	if err != nil {
+		return fmt.Errorf("invalid bucket ARN %s: %w", bucket, err)
+	}
+	switch {
+	case a.Service == "s3-object-lambda":
+		return fmt.Errorf("S3 Object Lambda access point %s does not support uploads. use the supporting access point of it as the bucket", bucket)
+	case a.Service != "s3":
+		return fmt.Errorf("bucket ARN %s must be of s3", bucket)
+	case strings.HasPrefix(a.Resource, "accesspoint/"), strings.HasPrefix(a.Resource, "outpost/") && strings.Contains(a.Resource, "/accesspoint/"):
+		return nil
+	}
+	return fmt.Errorf("bucket ARN %s must be of an access point", bucket)
+}
+
+// s3Options applies the options of the S3 API for the primary bucket.
+// The requests to an access point ARN are signed for the region of the ARN, not of the configurations.
+func (c *Config) s3Options(o *s3.Options) {
+	if arn.IsARN(c.Bucket) {
+		o.UseARNRegion = true
+	}
+	if c.S3Endpoint != "" {
+		o.BaseEndpoint = aws.String(c.S3Endpoint)
+		// FIPS endpoints can't be used with the custom endpoint
+		o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateDisabled
+	}
+}
+
+// bucketARN returns the ARN of the bucket, or the bucket itself if it is an access point ARN.
+func bucketARN(bucket string) string {
+	if arn.IsARN(bucket) {
+		return bucket
+	}
+	return "arn:aws:s3:::" + bucket
+}
@@ -0,0 +1,61 @@
+package s3mover_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+)
+
+func TestAccessPointValidate(t *testing.T) {
+	for bucket, ok := range map[string]bool{
+		"testbucket": true,
+		"arn:aws:s3:us-west-2:123456789012:accesspoint/uploads":                                 true,
+		"arn:aws:s3-outposts:us-west-2:123456789012:outpost/op-01234567890/accesspoint/uploads": false,
+		"arn:aws:s3:us-west-2:123456789012:outpost/op-01234567890/accesspoint/uploads":          true,
+		"arn:aws:s3-object-lambda:us-west-2:123456789012:accesspoint/validate":                  false,
+		"arn:aws:s3:::testbucket":                  false,
+		"arn:aws:sqs:us-west-2:123456789012:queue": false,
+	} {
+		config := &s3mover.Config{SrcDir: ".", Bucket: bucket, KeyPrefix: "test/accesspoint"}
+		if err := config.Validate(); (err == nil) != ok {
+			t.Errorf("unexpected validation of %s: %v", bucket, err)
+		}
+	}
+	config := &s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/accesspoint", S3Endpoint: "localhost:8080"}
+	if err := config.Validate(); err == nil {
+		t.Error("the endpoint without the scheme must be invalid")
+	}
+}
+
+func TestAccessPointS3Options(t *testing.T) {
+	config := &s3mover.Config{
+		Bucket:     "arn:aws:s3:us-west-2:123456789012:accesspoint/uploads",
+		S3Endpoint: "https://validator.example.com",
+	}
+	var o s3.Options
+	config.S3Options(&o)
+	if !o.UseARNRegion || aws.ToString(o.BaseEndpoint) != config.S3Endpoint {
+		t.Errorf("unexpected options: use arn region %v, endpoint %s", o.UseARNRegion, aws.ToString(o.BaseEndpoint))
+	}
+	config.Bucket = "testbucket"
+	config.S3Endpoint = ""
+	o = s3.Options{}
+	config.S3Options(&o)
+	if o.UseARNRegion || o.BaseEndpoint != nil {
+		t.Errorf("unexpected options of the bucket: %+v", o)
+	}
+}
+
+func TestAccessPointIAMPolicy(t *testing.T) {
+	ap := "arn:aws:s3:us-west-2:123456789012:accesspoint/uploads"
+	config := s3mover.Config{Bucket: ap, KeyPrefix: "test/accesspoint", DedupeOnStartup: true}
+	doc := config.IAMPolicy(s3mover.IAMPolicyOption{})
+	if r := doc.Statement[0].Resource[0]; r != ap+"/object/test/accesspoint/*" {
+		t.Errorf("unexpected resource of the objects: %s", r)
+	}
+	if r := doc.Statement[1].Resource[0]; r != ap {
+		t.Errorf("unexpected resource of the listing: %s", r)
+	}
+}
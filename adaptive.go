@@ -0,0 +1,110 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// adaptiveLimiter reduces the parallelism when the latency or the error rate of the upload requests
+// exceeds the thresholds, not to amplify a brownout of S3 or the network.
+// The parallelism is halved for each interval while unhealthy, and uploading is paused for an interval
+// when it is already 1. It is increased by one for each healthy interval.
+type adaptiveLimiter struct {
+	latency   time.Duration
+	errorRate float64
+
+	mu       sync.Mutex
+	requests int64
+	errors   int64
+	elapsed  time.Duration
+
+	// limit is the max parallels by the adaptive mode. 0 means no limit.
+	limit  int64
+	paused bool
+}
+
+// newAdaptiveLimiter returns nil if neither threshold is specified (disabled).
+func newAdaptiveLimiter(config *Config) *adaptiveLimiter {
+	if config.AdaptiveLatency <= 0 && config.AdaptiveErrorRate <= 0 {
+		return nil
+	}
+	return &adaptiveLimiter{
+		latency:   config.AdaptiveLatency,
+		errorRate: config.AdaptiveErrorRate,
+	}
+}
+
+// observe records the latency and the result of an upload request.
+// The requests canceled by the context are ignored.
+func (a *adaptiveLimiter) observe(d time.Duration, err error) {
+	if a == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests++
+	a.elapsed += d
+	if err != nil {
+		a.errors++
+	}
+}
+
+// adjust evaluates the requests observed since the last call and returns the max parallels limited from n.
+// It returns 0 to pause uploading.
+func (a *adaptiveLimiter) adjust(ctx context.Context, n int64) int64 {
+	if a == nil {
+		return n
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	requests, errs, elapsed := a.requests, a.errors, a.elapsed
+	a.requests, a.errors, a.elapsed = 0, 0, 0
+
+	current := n
+	if a.limit > 0 && a.limit < n {
+		current = a.limit
+	}
+	switch {
+	case a.paused:
+		// no requests while paused. resume with a single upload as a trial
+		a.paused = false
+		a.limit = 1
+		slog.InfoContext(ctx, "resumed by adaptive mode", "max_parallels", a.limit)
+	case requests == 0:
+		// no requests to evaluate
+	case a.unhealthy(requests, errs, elapsed):
+		args := []any{
+			"latency", elapsed / time.Duration(requests),
+			"error_rate", float64(errs) / float64(requests),
+		}
+		if current <= 1 {
+			a.paused = true
+			slog.WarnContext(ctx, "paused by adaptive mode", args...)
+			return 0
+		}
+		a.limit = current / 2
+		slog.WarnContext(ctx, "max parallels reduced by adaptive mode", append(args, "max_parallels", a.limit)...)
+	case a.limit > 0:
+		if a.limit++; a.limit >= n {
+			a.limit = 0
+			slog.InfoContext(ctx, "max parallels recovered by adaptive mode", "max_parallels", n)
+		} else {
+			slog.InfoContext(ctx, "max parallels increased by adaptive mode", "max_parallels", a.limit)
+		}
+	}
+	if a.limit > 0 && a.limit < n {
+		return a.limit
+	}
+	return n
+}
+
+// unhealthy reports whether the average latency or the error rate exceeds the thresholds.
+func (a *adaptiveLimiter) unhealthy(requests, errs int64, elapsed time.Duration) bool {
+	if a.latency > 0 && elapsed/time.Duration(requests) > a.latency {
+		return true
+	}
+	return a.errorRate > 0 && float64(errs)/float64(requests) > a.errorRate
+}
@@ -0,0 +1,62 @@
+package s3mover_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestAdaptive(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:            dir,
+		Bucket:            "testbucket",
+		KeyPrefix:         "test/adaptive",
+		MaxParallels:      4,
+		AdaptiveErrorRate: 0.5,
+		FaultErrorRate:    1,
+	}
+	tr, client := newTestTransporter(t, config)
+	for i := 0; i < 4; i++ {
+		s3movertest.WriteFile(t, dir, fmt.Sprintf("%d.txt", i), []byte("foo"))
+	}
+	apply := func(parallels int64, paused bool) {
+		t.Helper()
+		if err := tr.ApplySchedule(ctx, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if tr.Paused() != paused {
+			t.Errorf("paused must be %v", paused)
+		}
+		if !paused && tr.Parallels() != parallels {
+			t.Errorf("unexpected parallels: %d expected %d", tr.Parallels(), parallels)
+		}
+	}
+
+	// halved for each unhealthy interval, and paused at 1
+	tr.Flush(ctx)
+	apply(2, false)
+	tr.Flush(ctx)
+	apply(1, false)
+	tr.Flush(ctx)
+	apply(0, true)
+	// resumed with 1 after the pause
+	apply(1, false)
+
+	// increased by one for each healthy interval
+	config.FaultErrorRate = 0
+	tr.SetS3Client(client)
+	s3movertest.WriteFile(t, dir, "ok.txt", []byte("ok"))
+	tr.Flush(ctx)
+	apply(2, false)
+	for i := 0; i < 2; i++ {
+		s3movertest.WriteFile(t, dir, fmt.Sprintf("ok%d.txt", i), []byte("ok"))
+		tr.Flush(ctx)
+		apply(int64(3+i), false)
+	}
+}
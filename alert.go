@@ -0,0 +1,149 @@
+package s3mover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// AlertFormatGeneric is the payload format of the alert webhook for generic HTTP endpoints.
+	AlertFormatGeneric = "generic"
+
+	// AlertFormatSlack is the payload format of the alert webhook for Slack incoming webhooks.
+	AlertFormatSlack = "slack"
+
+	// DefaultAlertCooldown is the default minimum interval between alerts of the same kind.
+	DefaultAlertCooldown = 10 * time.Minute
+
+	alertTimeout = 10 * time.Second
+)
+
+// AlertPayload is the body of the generic alert webhook.
+type AlertPayload struct {
+	Host      string    `json:"host"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Time      time.Time `json:"time"`
+}
+
+// alertStatus represents the status of the backlog checked by the alerter.
+type alertStatus struct {
+	Queued            int64
+	OldestAge         time.Duration
+	ConsecutiveErrors int64
+	SinceLastUpload   time.Duration
+}
+
+type alerter struct {
+	config   *Config
+	client   *http.Client
+	host     string
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	now      func() time.Time
+}
+
+func newAlerter(config *Config) *alerter {
+	if config.AlertWebhookURL == "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	return &alerter{
+		config:   config,
+		client:   &http.Client{Timeout: alertTimeout},
+		host:     host,
+		lastSent: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// check fires alerts for the thresholds crossed by st. It returns the payloads of the fired alerts.
+func (a *alerter) check(ctx context.Context, st alertStatus) []AlertPayload {
+	var fired []AlertPayload
+	if th := a.config.AlertQueuedThreshold; th > 0 && st.Queued >= th {
+		if p, ok := a.fire(ctx, "queued", fmt.Sprintf("%d files are queued", st.Queued), float64(st.Queued), float64(th)); ok {
+			fired = append(fired, p)
+		}
+	}
+	if th := a.config.AlertOldestAgeThreshold; th > 0 && st.OldestAge >= th {
+		if p, ok := a.fire(ctx, "oldest_age", fmt.Sprintf("the oldest queued file is %s old", st.OldestAge.Truncate(time.Second)), st.OldestAge.Seconds(), th.Seconds()); ok {
+			fired = append(fired, p)
+		}
+	}
+	if th := a.config.AlertErrorsThreshold; th > 0 && st.ConsecutiveErrors >= th {
+		if p, ok := a.fire(ctx, "errors", fmt.Sprintf("%d consecutive upload errors", st.ConsecutiveErrors), float64(st.ConsecutiveErrors), float64(th)); ok {
+			fired = append(fired, p)
+		}
+	}
+	if th := a.config.AlertStaleThreshold; th > 0 && st.SinceLastUpload >= th {
+		if p, ok := a.fire(ctx, "stale", fmt.Sprintf("no files have been uploaded for %s", st.SinceLastUpload.Truncate(time.Second)), st.SinceLastUpload.Seconds(), th.Seconds()); ok {
+			fired = append(fired, p)
+		}
+	}
+	return fired
+}
+
+func (a *alerter) fire(ctx context.Context, kind, msg string, value, threshold float64) (AlertPayload, bool) {
+	now := a.now()
+	a.mu.Lock()
+	if last, ok := a.lastSent[kind]; ok && now.Sub(last) < a.config.AlertCooldown {
+		a.mu.Unlock()
+		return AlertPayload{}, false
+	}
+	a.lastSent[kind] = now
+	a.mu.Unlock()
+
+	p := AlertPayload{
+		Host:      a.host,
+		Kind:      kind,
+		Message:   msg,
+		Value:     value,
+		Threshold: threshold,
+		Time:      now,
+	}
+	slog.WarnContext(ctx, "alert fired", "kind", kind, "message", msg)
+	go func() {
+		if err := a.send(ctx, p); err != nil {
+			slog.WarnContext(ctx, "failed to send alert", "kind", kind, "error", err.Error())
+		}
+	}()
+	return p, true
+}
+
+func (a *alerter) send(ctx context.Context, p AlertPayload) error {
+	var body any = p
+	if a.config.AlertWebhookFormat == AlertFormatSlack {
+		body = map[string]string{
+			"text": fmt.Sprintf("[s3mover] %s: %s", p.Host, p.Message),
+		}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), alertTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.AlertWebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package s3mover_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestAlerterCheck(t *testing.T) {
+	ctx := context.Background()
+	config := &s3mover.Config{
+		AlertWebhookURL:         "http://127.0.0.1:0/",
+		AlertQueuedThreshold:    10,
+		AlertOldestAgeThreshold: time.Minute,
+		AlertErrorsThreshold:    3,
+		AlertStaleThreshold:     time.Hour,
+		AlertCooldown:           time.Minute,
+	}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	a := s3mover.NewAlerter(config)
+	a.SetNow(func() time.Time { return now })
+
+	if fired := a.Check(ctx, s3mover.AlertStatus{Queued: 9, OldestAge: time.Second, ConsecutiveErrors: 2, SinceLastUpload: time.Minute}); len(fired) != 0 {
+		t.Errorf("expected no alerts, got %v", fired)
+	}
+	fired := a.Check(ctx, s3mover.AlertStatus{Queued: 10, OldestAge: time.Hour, ConsecutiveErrors: 3, SinceLastUpload: 2 * time.Hour})
+	if len(fired) != 4 {
+		t.Fatalf("expected 4 alerts, got %v", fired)
+	}
+	for i, kind := range []string{"queued", "oldest_age", "errors", "stale"} {
+		if fired[i].Kind != kind {
+			t.Errorf("expected %s, got %s", kind, fired[i].Kind)
+		}
+	}
+
+	// in cooldown
+	now = now.Add(30 * time.Second)
+	if fired := a.Check(ctx, s3mover.AlertStatus{Queued: 100}); len(fired) != 0 {
+		t.Errorf("expected no alerts in cooldown, got %v", fired)
+	}
+	now = now.Add(30 * time.Second)
+	if fired := a.Check(ctx, s3mover.AlertStatus{Queued: 100}); len(fired) != 1 {
+		t.Errorf("expected 1 alert after cooldown, got %v", fired)
+	}
+}
+
+func TestAlerterSend(t *testing.T) {
+	for _, format := range []string{s3mover.AlertFormatGeneric, s3mover.AlertFormatSlack} {
+		var body map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+		}))
+		a := s3mover.NewAlerter(&s3mover.Config{
+			AlertWebhookURL:    srv.URL,
+			AlertWebhookFormat: format,
+		})
+		err := a.Send(context.Background(), s3mover.AlertPayload{Kind: "queued", Message: "10 files are queued"})
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch format {
+		case s3mover.AlertFormatSlack:
+			if _, ok := body["text"]; !ok {
+				t.Errorf("slack payload must have text: %v", body)
+			}
+		default:
+			if body["kind"] != "queued" || body["message"] != "10 files are queued" {
+				t.Errorf("unexpected generic payload: %v", body)
+			}
+		}
+	}
+}
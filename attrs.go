@@ -0,0 +1,53 @@
+package s3mover
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+)
+
+// object metadata keys of the file attributes with -preserve-attrs and -preserve-xattrs
+const (
+	MetadataUID         = "uid"
+	MetadataGID         = "gid"
+	MetadataMode        = "mode"
+	MetadataMtime       = "mtime"
+	MetadataXattrPrefix = "xattr-"
+)
+
+// fileMetadata returns the object metadata of the file attributes.
+// The mode is an octal string, the mtime is in RFC3339 with nanoseconds,
+// and the values of the extended attributes are encoded in base64.
+func (tr *Transporter) fileMetadata(path string) (map[string]string, error) {
+	sum, hashed := tr.hashes.get(path)
+	if !tr.config.PreserveAttrs && len(tr.config.PreserveXattrs) == 0 && !hashed {
+		return nil, nil
+	}
+	md := make(map[string]string)
+	if tr.config.PreserveAttrs {
+		st, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		md[MetadataMode] = fmt.Sprintf("%04o", st.Mode().Perm())
+		md[MetadataMtime] = st.ModTime().UTC().Format(time.RFC3339Nano)
+		if uid, gid, ok := fileOwner(st); ok {
+			md[MetadataUID] = fmt.Sprint(uid)
+			md[MetadataGID] = fmt.Sprint(gid)
+		}
+	}
+	for _, name := range tr.config.PreserveXattrs {
+		v, ok, err := getXattr(path, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get xattr %s of %s: %w", name, path, err)
+		}
+		if ok {
+			md[MetadataXattrPrefix+name] = base64.StdEncoding.EncodeToString(v)
+		}
+	}
+	if hashed {
+		md[MetadataSHA256] = sum
+	}
+	return md, nil
+}
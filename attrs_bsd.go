@@ -0,0 +1,8 @@
+//go:build darwin || freebsd || netbsd
+
+package s3mover
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is returned by getxattr(2) when the file doesn't have the attribute.
+const errNoXattr = unix.ENOATTR
@@ -0,0 +1,6 @@
+package s3mover
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is returned by getxattr(2) when the file doesn't have the attribute.
+const errNoXattr = unix.ENODATA
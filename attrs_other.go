@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package s3mover
+
+import (
+	"errors"
+	"os"
+)
+
+func fileOwner(st os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
+
+func getXattr(path, name string) ([]byte, bool, error) {
+	return nil, false, errors.New("extended attributes are not supported on this platform")
+}
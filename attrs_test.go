@@ -0,0 +1,76 @@
+//go:build linux
+
+package s3mover_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+	"golang.org/x/sys/unix"
+)
+
+func TestPreserveAttrs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	path := filepath.Join(dir, "foo.txt")
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 6, 1, 12, 34, 56, 789, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	xattr := true
+	if err := unix.Setxattr(path, "user.origin", []byte("host-a"), 0); err != nil {
+		if !errors.Is(err, unix.ENOTSUP) {
+			t.Fatal(err)
+		}
+		t.Log("user xattrs are not supported:", err)
+		xattr = false
+	}
+
+	config := &s3mover.Config{
+		SrcDir:         dir,
+		Bucket:         "testbucket",
+		KeyPrefix:      "test/attrs",
+		MaxParallels:   1,
+		TimeFormat:     "2006",
+		PreserveAttrs:  true,
+		PreserveXattrs: []string{"user.origin", "user.missing"},
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 1 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	if len(client.Objects) != 1 {
+		t.Fatalf("unexpected objects: %d", len(client.Objects))
+	}
+	for key, obj := range client.Objects {
+		expected := map[string]string{
+			s3mover.MetadataMode:  "0640",
+			s3mover.MetadataMtime: "2024-06-01T12:34:56.000000789Z",
+			s3mover.MetadataUID:   strconv.Itoa(os.Getuid()),
+			s3mover.MetadataGID:   strconv.Itoa(os.Getgid()),
+		}
+		if xattr {
+			expected[s3mover.MetadataXattrPrefix+"user.origin"] = base64.StdEncoding.EncodeToString([]byte("host-a"))
+		}
+		if len(obj.Metadata) != len(expected) {
+			t.Errorf("unexpected metadata of %s: %v", key, obj.Metadata)
+		}
+		for k, v := range expected {
+			if obj.Metadata[k] != v {
+				t.Errorf("unexpected metadata %s of %s: %q expected %q", k, key, obj.Metadata[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package s3mover
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func fileOwner(st os.FileInfo) (uid, gid uint32, ok bool) {
+	if s, ok := st.Sys().(*syscall.Stat_t); ok {
+		return s.Uid, s.Gid, true
+	}
+	return 0, 0, false
+}
+
+// getXattr returns the value of the extended attribute. ok is false if the file doesn't have it.
+func getXattr(path, name string) ([]byte, bool, error) {
+	for {
+		sz, err := unix.Getxattr(path, name, nil)
+		if err != nil {
+			if errors.Is(err, errNoXattr) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		buf := make([]byte, sz)
+		n, err := unix.Getxattr(path, name, buf)
+		if errors.Is(err, unix.ERANGE) {
+			// grown after getting the size
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return buf[:n], true, nil
+	}
+}
@@ -0,0 +1,96 @@
+package s3mover
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AuditEventUploaded = "uploaded"
+	AuditEventShutdown = "shutdown"
+)
+
+// AuditRecord is a line of the audit log.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Path      string    `json:"path"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	VersionID string    `json:"version_id,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	HostID    string    `json:"host_id,omitempty"`
+}
+
+// auditLog appends the records to the file as JSON lines.
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// openAuditLog opens the audit log. It returns nil if path is empty.
+func openAuditLog(path string) (*auditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &auditLog{f: f}, nil
+}
+
+func (a *auditLog) write(rec any) error {
+	if a == nil {
+		return nil
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// uploaded records the uploaded object.
+func (a *auditLog) uploaded(path string, up *uploadResult) error {
+	return a.write(&AuditRecord{
+		Time:      time.Now(),
+		Event:     AuditEventUploaded,
+		Path:      path,
+		Bucket:    up.Bucket,
+		Key:       up.Key,
+		Size:      up.Size,
+		VersionID: up.VersionID,
+		RequestID: up.RequestID,
+		HostID:    up.HostID,
+	})
+}
+
+// shutdown records the summary of the run.
+func (a *auditLog) shutdown(s *ShutdownSummary) error {
+	return a.write(&struct {
+		Time  time.Time `json:"time"`
+		Event string    `json:"event"`
+		*ShutdownSummary
+	}{
+		Time:            time.Now(),
+		Event:           AuditEventShutdown,
+		ShutdownSummary: s,
+	})
+}
+
+func (a *auditLog) close() error {
+	if a == nil {
+		return nil
+	}
+	return a.f.Close()
+}
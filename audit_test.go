@@ -0,0 +1,60 @@
+package s3mover_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// versionedS3Client returns the version ID and the request ID like a versioned bucket.
+type versionedS3Client struct {
+	*s3movertest.MockS3Client
+}
+
+func (c *versionedS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	out, err := c.MockS3Client.PutObject(ctx, input, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	out.VersionId = aws.String("v1")
+	awsmiddleware.SetRequestIDMetadata(&out.ResultMetadata, "REQ123")
+	return out, nil
+}
+
+func TestAuditRequestID(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/audit",
+		MaxParallels: 1,
+		AuditLogPath: auditLog,
+	}
+	tr, _ := newTestTransporter(t, config)
+	tr.SetS3Client(&versionedS3Client{s3movertest.NewMockS3Client()})
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 1 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	b, err := os.ReadFile(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec s3mover.AuditRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.VersionID != "v1" || rec.RequestID != "REQ123" {
+		t.Errorf("unexpected audit record: %+v", rec)
+	}
+}
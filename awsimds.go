@@ -0,0 +1,52 @@
+package s3mover
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+)
+
+// imdsConfigured reports whether any IMDS configurations are specified.
+func (c *Config) imdsConfigured() bool {
+	return c.IMDSDisabled || c.IMDSEndpoint != "" || c.IMDSDisableV1Fallback || c.IMDSTimeout > 0
+}
+
+// imdsOptions applies the IMDS configurations to the options of the IMDS clients,
+// for the credentials of the EC2 instance role and the key variables such as {instance_id}.
+func (c *Config) imdsOptions(o *imds.Options) {
+	if c.IMDSDisabled {
+		o.ClientEnableState = imds.ClientDisabled
+	}
+	if c.IMDSEndpoint != "" {
+		o.Endpoint = c.IMDSEndpoint
+	}
+	if c.IMDSDisableV1Fallback {
+		o.EnableFallback = aws.FalseTernary
+	}
+	if c.IMDSTimeout > 0 {
+		// the default timeout of each operation is 5 seconds, too long when the hop limit drops the responses
+		o.DisableDefaultTimeout = true
+		o.HTTPClient = awshttp.NewBuildableClient().WithTimeout(c.IMDSTimeout)
+	}
+}
+
+// imdsLoadOptions returns the options to load the AWS configurations with the IMDS configurations.
+func (c *Config) imdsLoadOptions() []func(*awsconfig.LoadOptions) error {
+	if !c.imdsConfigured() {
+		return nil
+	}
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithEC2RoleCredentialOptions(func(o *ec2rolecreds.Options) {
+			o.Client = imds.New(imds.Options{}, c.imdsOptions)
+		}),
+	}
+	if c.IMDSDisabled {
+		opts = append(opts, awsconfig.WithEC2IMDSClientEnableState(imds.ClientDisabled))
+	}
+	if c.IMDSEndpoint != "" {
+		opts = append(opts, awsconfig.WithEC2IMDSEndpoint(c.IMDSEndpoint))
+	}
+	return opts
+}
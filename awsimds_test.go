@@ -0,0 +1,53 @@
+package s3mover_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestIMDSOptions(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		// dropped by the hop limit
+		w.WriteHeader(http.StatusForbidden)
+	})
+	mux.HandleFunc("/latest/meta-data/instance-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "i-0123456789abcdef0")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	newConfig := func() *s3mover.Config {
+		c := &s3mover.Config{
+			SrcDir:       t.TempDir(),
+			Bucket:       "testbucket",
+			KeyPrefix:    "test/{instance_id}",
+			MaxParallels: 1,
+			IMDSEndpoint: ts.URL,
+		}
+		if err := c.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// falls back to IMDSv1
+	config := newConfig()
+	if _, err := s3mover.New(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if config.KeyPrefix != "test/i-0123456789abcdef0" {
+		t.Errorf("unexpected prefix: %s", config.KeyPrefix)
+	}
+
+	config = newConfig()
+	config.IMDSDisableV1Fallback = true
+	if _, err := s3mover.New(context.Background(), config); err == nil {
+		t.Errorf("must fail without the fallback to IMDSv1: %s", config.KeyPrefix)
+	}
+}
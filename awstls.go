@@ -0,0 +1,78 @@
+package s3mover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// validateTLS checks the CA bundle and the client certificate can be loaded.
+func (c *Config) validateTLS() error {
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.New("client-cert and client-key must be specified together")
+	}
+	_, err := c.tlsConfig()
+	return err
+}
+
+// tlsConfig returns the TLS configurations with the CA bundle and the client certificate.
+// It returns nil if neither is specified.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.CABundle == "" && c.ClientCert == "" {
+		return nil, nil
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CABundle != "" {
+		b, err := os.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca-bundle: %w", err)
+		}
+		// the CA bundle is added to the system roots, not to break the other endpoints
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in ca-bundle %s", c.CABundle)
+		}
+		tc.RootCAs = pool
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// awsConfigOptions returns the options to load the AWS configurations for the profile, FIPS endpoints, the TLS configurations
+// and the IMDS configurations.
+func (c *Config) awsConfigOptions() ([]func(*awsconfig.LoadOptions) error, error) {
+	opts := c.imdsLoadOptions()
+	if c.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(c.Profile))
+	}
+	if c.UseFIPSEndpoint {
+		opts = append(opts, awsconfig.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	tc, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tc != nil {
+		client := awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			t.TLSClientConfig = tc
+		})
+		opts = append(opts, awsconfig.WithHTTPClient(client))
+	}
+	return opts, nil
+}
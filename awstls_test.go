@@ -0,0 +1,106 @@
+package s3mover_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// writeTLSFiles writes the certificate and the key of the test server as PEM files.
+func writeTLSFiles(t *testing.T, srv *httptest.Server) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cert := srv.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCABundleAndClientCert(t *testing.T) {
+	var puts, clientCerts int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			atomic.AddInt64(&puts, 1)
+		}
+		if len(r.TLS.PeerCertificates) > 0 {
+			atomic.AddInt64(&clientCerts, 1)
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	certFile, keyFile := writeTLSFiles(t, srv)
+
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/tls",
+		MaxParallels: 1,
+		CABundle:     certFile,
+		ClientCert:   certFile,
+		ClientKey:    keyFile,
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := s3mover.New(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 1 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	if puts != 1 || clientCerts != 1 {
+		t.Errorf("expected a put with the client certificate: puts=%d client_certs=%d", puts, clientCerts)
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		config   s3mover.Config
+		expected string
+	}{
+		{s3mover.Config{CABundle: filepath.Join(dir, "missing.pem")}, "failed to read ca-bundle"},
+		{s3mover.Config{CABundle: notPEM}, "no certificates found"},
+		{s3mover.Config{ClientCert: notPEM}, "must be specified together"},
+		{s3mover.Config{ClientCert: notPEM, ClientKey: notPEM}, "failed to load client certificate"},
+	} {
+		config := c.config
+		config.SrcDir, config.Bucket, config.KeyPrefix = ".", "testbucket", "test/tls"
+		if err := config.Validate(); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("expected error %q, got %v", c.expected, err)
+		}
+	}
+}
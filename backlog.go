@@ -0,0 +1,48 @@
+package s3mover
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// BacklogMetrics represents the files queued in the source directory at startup.
+type BacklogMetrics struct {
+	Files            int64     `json:"files"`
+	Bytes            int64     `json:"bytes"`
+	OldestAgeSeconds float64   `json:"oldest_age_seconds"`
+	Time             time.Time `json:"time"`
+}
+
+// setBacklog records the backlog at startup.
+func (m *Metrics) setBacklog(b BacklogMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Backlog = &b
+}
+
+// reportBacklog logs and records the files queued at the first scan, to show the catch-up work after a restart.
+func (tr *Transporter) reportBacklog(ctx context.Context, paths []string, now time.Time) {
+	tr.backlogOnce.Do(func() {
+		b := BacklogMetrics{Files: int64(len(paths)), Time: now}
+		var oldest time.Duration
+		for _, path := range paths {
+			st, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			b.Bytes += st.Size()
+			if d := now.Sub(st.ModTime()); d > oldest {
+				oldest = d
+			}
+		}
+		b.OldestAgeSeconds = oldest.Seconds()
+		tr.metrics.setBacklog(b)
+		slog.InfoContext(ctx, "backlog at startup",
+			slog.Int64("files", b.Files),
+			slog.Int64("bytes", b.Bytes),
+			slog.Duration("oldest_age", oldest.Truncate(time.Second)),
+		)
+	})
+}
@@ -0,0 +1,62 @@
+package s3mover
+
+import (
+	"context"
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// bandwidthLimiter limits the average bytes per second of uploads.
+type bandwidthLimiter struct {
+	limiter *rate.Limiter
+}
+
+// newBandwidthLimiter creates a bandwidthLimiter. 0 means unlimited.
+func newBandwidthLimiter(bytesPerSec int64) *bandwidthLimiter {
+	l := &bandwidthLimiter{limiter: rate.NewLimiter(rate.Inf, 0)}
+	l.setLimit(bytesPerSec)
+	return l
+}
+
+func (l *bandwidthLimiter) setLimit(bytesPerSec int64) {
+	if bytesPerSec <= 0 {
+		l.limiter.SetLimit(rate.Inf)
+		return
+	}
+	// allows bursts of one second
+	burst := bytesPerSec
+	if burst > math.MaxInt32 {
+		burst = math.MaxInt32
+	}
+	l.limiter.SetBurst(int(burst))
+	l.limiter.SetLimit(rate.Limit(bytesPerSec))
+}
+
+// limit returns the bytes per second, or 0 when unlimited.
+func (l *bandwidthLimiter) limit() int64 {
+	lim := l.limiter.Limit()
+	if lim == rate.Inf {
+		return 0
+	}
+	return int64(lim)
+}
+
+// wait blocks until n bytes are allowed to be sent.
+// The bytes are reserved before the upload because the S3 client reads the body more than once for signing.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int64) error {
+	for n > 0 {
+		if l.limiter.Limit() == rate.Inf {
+			return nil
+		}
+		c := n
+		if burst := int64(l.limiter.Burst()); c > burst {
+			c = burst
+		}
+		if err := l.limiter.WaitN(ctx, int(c)); err != nil {
+			return err
+		}
+		n -= c
+	}
+	return nil
+}
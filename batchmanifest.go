@@ -0,0 +1,191 @@
+package s3mover
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// batchManifestInterval is the interval to put the updated manifests.
+const batchManifestInterval = 5 * time.Minute
+
+// batchManifest records the uploaded objects of each day into the CSV files in the format of
+// the manifests of S3 Batch Operations, and puts them under BatchManifestPrefix.
+// The records are spooled in the temporary files, not to hold them in memory.
+type batchManifest struct {
+	prefix string
+	name   string
+	tmpDir string
+
+	mu    sync.Mutex
+	files map[string]*batchManifestFile // by date
+}
+
+type batchManifestFile struct {
+	f     *os.File
+	size  int64
+	dirty bool
+}
+
+// newBatchManifest returns nil if BatchManifestPrefix is empty (disabled).
+// The name of the manifests includes the hostname and the start time, not to overwrite the manifests of
+// the other hosts and the previous runs.
+func newBatchManifest(config *Config, now time.Time) *batchManifest {
+	if config.BatchManifestPrefix == "" {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	return &batchManifest{
+		prefix: strings.Trim(config.BatchManifestPrefix, "/"),
+		name:   fmt.Sprintf("%s-%s.csv", hostname, now.Format("20060102T150405")),
+		tmpDir: config.TempDir,
+		files:  make(map[string]*batchManifestFile),
+	}
+}
+
+// add records the uploaded object at now.
+func (m *batchManifest) add(up *uploadResult, now time.Time) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	date := now.In(TZ).Format("2006-01-02")
+	mf, ok := m.files[date]
+	if !ok {
+		f, err := os.CreateTemp(m.tmpDir, "s3mover-manifest-*.csv")
+		if err != nil {
+			return fmt.Errorf("failed to create batch manifest: %w", err)
+		}
+		mf = &batchManifestFile{f: f}
+		m.files[date] = mf
+	}
+	// the keys in the manifests must be URL-encoded
+	row := []string{up.Bucket, strings.ReplaceAll(url.QueryEscape(up.Key), "+", "%20")}
+	if up.VersionID != "" {
+		row = append(row, up.VersionID)
+	}
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(row)
+	w.Flush()
+	n, err := io.WriteString(mf.f, b.String())
+	mf.size += int64(n)
+	mf.dirty = true
+	if err != nil {
+		return fmt.Errorf("failed to write batch manifest: %w", err)
+	}
+	return nil
+}
+
+// key returns the key of the manifest of the date.
+func (m *batchManifest) key(date string) string {
+	return path.Join(m.prefix, date, m.name)
+}
+
+// flushBatchManifest puts the updated manifests, and removes the manifests of the past days after putting them.
+// The sizes of the manifests are snapshotted under the lock, so the uploads are not blocked while putting them.
+func (tr *Transporter) flushBatchManifest(ctx context.Context, now time.Time) error {
+	m := tr.manifest
+	if m == nil {
+		return nil
+	}
+	type snapshot struct {
+		date string
+		mf   *batchManifestFile
+		size int64
+	}
+	m.mu.Lock()
+	var snapshots []snapshot
+	for date, mf := range m.files {
+		if mf.dirty {
+			snapshots = append(snapshots, snapshot{date: date, mf: mf, size: mf.size})
+			mf.dirty = false
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].date < snapshots[j].date
+	})
+
+	for i, s := range snapshots {
+		key := m.key(s.date)
+		if _, err := tr.s3.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        &tr.config.Bucket,
+			Key:           &key,
+			Body:          io.NewSectionReader(s.mf.f, 0, s.size),
+			ContentLength: aws.Int64(s.size),
+			ContentType:   aws.String("text/csv"),
+		}); err != nil {
+			// retried at the next flush
+			m.mu.Lock()
+			for _, s := range snapshots[i:] {
+				s.mf.dirty = true
+			}
+			m.mu.Unlock()
+			return fmt.Errorf("failed to put batch manifest to s3://%s/%s: %w", tr.config.Bucket, key, err)
+		}
+		slog.DebugContext(ctx, "batch manifest updated", "s3url", fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key), "size", s.size)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	today := now.In(TZ).Format("2006-01-02")
+	for date, mf := range m.files {
+		if date < today && !mf.dirty {
+			mf.f.Close()
+			os.Remove(mf.f.Name())
+			delete(m.files, date)
+		}
+	}
+	return nil
+}
+
+// runBatchManifest puts the updated manifests periodically, and at the shutdown.
+func (tr *Transporter) runBatchManifest(ctx context.Context) error {
+	if tr.manifest == nil || tr.config.Observe {
+		return nil
+	}
+	ctx = slogcontext.WithValue(ctx, "component", "batch-manifest")
+	ticker := time.NewTicker(batchManifestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := tr.flushBatchManifest(context.WithoutCancel(ctx), time.Now()); err != nil {
+				slog.ErrorContext(ctx, err.Error())
+			}
+			tr.manifest.close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := tr.flushBatchManifest(ctx, time.Now()); err != nil {
+			// retried at the next interval
+			slog.WarnContext(ctx, err.Error())
+		}
+	}
+}
+
+// close removes the temporary files.
+func (m *batchManifest) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for date, mf := range m.files {
+		mf.f.Close()
+		os.Remove(mf.f.Name())
+		delete(m.files, date)
+	}
+}
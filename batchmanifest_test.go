@@ -0,0 +1,131 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestBatchManifest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo bar.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "baz.txt", []byte("baz"))
+	config := &s3mover.Config{
+		SrcDir:              dir,
+		Bucket:              "testbucket",
+		KeyPrefix:           "test/manifest",
+		MaxParallels:        1,
+		TimeFormat:          "2006",
+		BatchManifestPrefix: "manifests/",
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 2 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	now := time.Now()
+	if err := tr.FlushBatchManifest(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	prefix := "manifests/" + now.In(s3mover.TZ).Format("2006-01-02") + "/" + hostname + "-"
+	var manifest *s3movertest.MockS3Object
+	for key, obj := range client.Objects {
+		if strings.HasPrefix(key, prefix) && strings.HasSuffix(key, ".csv") {
+			manifest = obj
+		}
+	}
+	if manifest == nil {
+		t.Fatalf("batch manifest not found under %s", prefix)
+	}
+	year := now.In(s3mover.TZ).Format("2006")
+	expected := "testbucket,test%2Fmanifest%2F" + year + "%2Fbaz.txt\n" +
+		"testbucket,test%2Fmanifest%2F" + year + "%2Ffoo%20bar.txt\n"
+	if string(manifest.Content) != expected {
+		t.Errorf("unexpected manifest:\n%s\nexpected:\n%s", manifest.Content, expected)
+	}
+
+	// no updates
+	manifest.Content = nil
+	if err := tr.FlushBatchManifest(ctx, now.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Content != nil {
+		t.Error("the manifest without updates must not be put again")
+	}
+}
+
+// blockingManifestS3Client blocks PutObject of the batch manifests until unblocked.
+type blockingManifestS3Client struct {
+	*s3movertest.MockS3Client
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (c *blockingManifestS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if strings.HasPrefix(*input.Key, "manifests/") {
+		c.started <- struct{}{}
+		<-c.unblock
+	}
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestBatchManifestNotBlocking(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:              dir,
+		Bucket:              "testbucket",
+		KeyPrefix:           "test/manifest",
+		MaxParallels:        1,
+		BatchManifestPrefix: "manifests/",
+	}
+	tr, _ := newTestTransporter(t, config)
+	client := &blockingManifestS3Client{
+		MockS3Client: s3movertest.NewMockS3Client(),
+		started:      make(chan struct{}, 2),
+		unblock:      make(chan struct{}),
+	}
+	tr.SetS3Client(client)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 1 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- tr.FlushBatchManifest(ctx, time.Now())
+	}()
+	<-client.started
+
+	// the uploads are recorded while putting the manifest
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 1 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	close(client.unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.FlushBatchManifest(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var manifest *s3movertest.MockS3Object
+	for key, obj := range client.Objects {
+		if strings.HasPrefix(key, "manifests/") {
+			manifest = obj
+		}
+	}
+	if manifest == nil {
+		t.Fatal("batch manifest not found")
+	}
+	if n := strings.Count(string(manifest.Content), "\n"); n != 2 {
+		t.Errorf("the manifest must be put again with the added record: %s", manifest.Content)
+	}
+}
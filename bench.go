@@ -0,0 +1,240 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const benchDrainTimeout = time.Minute
+
+// BenchOption represents options for Bench.
+type BenchOption struct {
+	// FileSize is the size of each generated file in bytes.
+	FileSize int64
+	// Rate is the number of files generated per second.
+	Rate float64
+	// Duration is the duration of generating files.
+	Duration time.Duration
+	// Mock uses an in-memory S3 client that discards the objects instead of the real bucket.
+	Mock bool
+	// MockLatency is the latency of PutObject of the mock S3 client.
+	MockLatency time.Duration
+}
+
+// BenchResult represents the result of Bench.
+type BenchResult struct {
+	Generated int64         `json:"generated"`
+	Uploaded  int64         `json:"uploaded"`
+	Bytes     int64         `json:"bytes"`
+	Elapsed   time.Duration `json:"elapsed"`
+	Latency   struct {
+		P50 time.Duration `json:"p50"`
+		P90 time.Duration `json:"p90"`
+		P99 time.Duration `json:"p99"`
+		Max time.Duration `json:"max"`
+	} `json:"latency"`
+}
+
+// Bench generates files into a temporary source directory and transports them
+// with the configuration, then reports the achieved throughput and latency.
+func Bench(ctx context.Context, config *Config, opt BenchOption) (*BenchResult, error) {
+	ctx = slogcontext.WithValue(ctx, "component", "bench")
+	if opt.FileSize <= 0 || opt.Rate <= 0 || opt.Duration <= 0 {
+		return nil, fmt.Errorf("size, rate and duration must be positive")
+	}
+	dir, err := os.MkdirTemp(config.SrcDir, "s3mover-bench-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := *config
+	cfg.SrcDir = dir
+	cfg.StatsServerPort = 0
+	cfg.AlertWebhookURL = ""
+	cfg.SentryDSN = ""
+	cfg.GRPCListen = ""
+	cfg.Schedule = ""
+	cfg.KeepAfterUpload = 0
+	cfg.Mirror = false
+	cfg.RevisionSuffix = false
+	cfg.AuditLogPath = ""
+	var tr *Transporter
+	if opt.Mock {
+		tr, err = newTransporter(&cfg, &discardS3Client{latency: opt.MockLatency}, aws.Config{})
+	} else {
+		tr, err = New(ctx, &cfg)
+		if err == nil {
+			err = tr.init(ctx)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	timed := &timedS3Client{S3Client: tr.s3}
+	tr.s3 = timed
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tr.run(runCtx)
+	}()
+
+	slog.InfoContext(ctx, "generating files", "dir", dir, "size", opt.FileSize, "rate", opt.Rate, "duration", opt.Duration)
+	start := time.Now()
+	generated, err := generateBenchFiles(ctx, dir, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// wait for all files to be uploaded
+	drainCtx, drainCancel := context.WithTimeout(ctx, benchDrainTimeout)
+	defer drainCancel()
+drain:
+	for atomic.LoadInt64(&tr.metrics.Objects.Uploaded) < generated {
+		select {
+		case <-drainCtx.Done():
+			slog.WarnContext(ctx, "some files are not uploaded in time")
+			break drain
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	res := timed.result(start)
+	res.Generated = generated
+	res.Uploaded = atomic.LoadInt64(&tr.metrics.Objects.Uploaded)
+	return res, nil
+}
+
+func generateBenchFiles(ctx context.Context, dir string, opt BenchOption) (int64, error) {
+	content := make([]byte, opt.FileSize)
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789 \n"
+	for i := range content {
+		content[i] = chars[rand.Intn(len(chars))]
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / opt.Rate))
+	defer ticker.Stop()
+	timeout := time.After(opt.Duration)
+	var n int64
+	for {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case <-timeout:
+			return n, nil
+		case <-ticker.C:
+		}
+		name := fmt.Sprintf("bench-%08d.txt", n)
+		tmp := filepath.Join(dir, "."+name)
+		if err := os.WriteFile(tmp, content, 0644); err != nil {
+			return n, err
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Print prints the result to w.
+func (r *BenchResult) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "generated\t%d files\n", r.Generated)
+	fmt.Fprintf(tw, "uploaded\t%d files, %d bytes\n", r.Uploaded, r.Bytes)
+	fmt.Fprintf(tw, "elapsed\t%s\n", r.Elapsed.Round(time.Millisecond))
+	if sec := r.Elapsed.Seconds(); sec > 0 {
+		fmt.Fprintf(tw, "throughput\t%.2f files/s, %.2f MB/s\n", float64(r.Uploaded)/sec, float64(r.Bytes)/sec/1000/1000)
+	}
+	fmt.Fprintf(tw, "latency\tp50=%s p90=%s p99=%s max=%s\n", r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	return tw.Flush()
+}
+
+// timedS3Client measures the latency of PutObject.
+type timedS3Client struct {
+	S3Client
+	mu        sync.Mutex
+	latencies []time.Duration
+	bytes     int64
+	last      time.Time
+}
+
+func (c *timedS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	start := time.Now()
+	out, err := c.S3Client.PutObject(ctx, input, optFns...)
+	if err != nil {
+		return out, err
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latencies = append(c.latencies, now.Sub(start))
+	c.bytes += aws.ToInt64(input.ContentLength)
+	c.last = now
+	return out, nil
+}
+
+// result returns the result of the uploads since start.
+func (c *timedS3Client) result(start time.Time) *BenchResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &BenchResult{Bytes: c.bytes}
+	if len(c.latencies) == 0 {
+		return r
+	}
+	r.Elapsed = c.last.Sub(start)
+	ls := append([]time.Duration(nil), c.latencies...)
+	sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
+	percentile := func(p float64) time.Duration {
+		return ls[int(float64(len(ls)-1)*p)]
+	}
+	r.Latency.P50 = percentile(0.5)
+	r.Latency.P90 = percentile(0.9)
+	r.Latency.P99 = percentile(0.99)
+	r.Latency.Max = ls[len(ls)-1]
+	return r
+}
+
+// discardS3Client is an S3 client that discards the objects.
+type discardS3Client struct {
+	latency time.Duration
+}
+
+func (c *discardS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if _, err := io.Copy(io.Discard, input.Body); err != nil {
+		return nil, err
+	}
+	if c.latency > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.latency):
+		}
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *discardS3Client) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (c *discardS3Client) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return &s3.DeleteObjectOutput{}, nil
+}
@@ -0,0 +1,37 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestBenchMock(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:       t.TempDir(),
+		Bucket:       "mock",
+		KeyPrefix:    "bench",
+		MaxParallels: 2,
+	}
+	res, err := s3mover.Bench(context.Background(), config, s3mover.BenchOption{
+		FileSize:    100,
+		Rate:        50,
+		Duration:    200 * time.Millisecond,
+		Mock:        true,
+		MockLatency: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Generated == 0 || res.Uploaded != res.Generated {
+		t.Errorf("unexpected result: %#v", res)
+	}
+	if res.Bytes != res.Uploaded*100 {
+		t.Errorf("unexpected bytes: %d", res.Bytes)
+	}
+	if res.Latency.P50 < time.Millisecond || res.Latency.Max < res.Latency.P99 {
+		t.Errorf("unexpected latency: %#v", res.Latency)
+	}
+}
@@ -0,0 +1,83 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCircuitBreakerCooldown is the default duration to stop uploading after the circuit breaker opens.
+const DefaultCircuitBreakerCooldown = time.Minute
+
+// errCircuitOpen is returned by runOnce while the circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker stops uploading for the cooldown after the consecutive upload errors reach the threshold.
+// After the cooldown, only one file is uploaded as a trial (half-open) until it succeeds.
+type circuitBreaker struct {
+	threshold int64
+	cooldown  time.Duration
+
+	failures  atomic.Int64
+	openUntil atomic.Int64 // unix nano
+}
+
+// newCircuitBreaker returns nil if the threshold is 0 (disabled).
+func newCircuitBreaker(config *Config) *circuitBreaker {
+	if config.CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold: config.CircuitBreakerThreshold,
+		cooldown:  config.CircuitBreakerCooldown,
+	}
+}
+
+// allow reports whether uploads are allowed at now.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	return b == nil || now.UnixNano() >= b.openUntil.Load()
+}
+
+// halfOpen reports whether the cooldown has expired but no uploads succeeded yet.
+func (b *circuitBreaker) halfOpen(now time.Time) bool {
+	return b != nil && b.failures.Load() >= b.threshold && b.allow(now)
+}
+
+// recordCircuit records the result of an upload to the circuit breaker.
+func (tr *Transporter) recordCircuit(ctx context.Context, err error, now time.Time) {
+	b := tr.breaker
+	if b == nil {
+		return
+	}
+	if err == nil {
+		if b.failures.Swap(0) >= b.threshold {
+			slog.InfoContext(ctx, "circuit breaker is closed")
+			tr.setHealth(HealthStatusOK, "")
+		}
+		return
+	}
+	if n := b.failures.Add(1); n >= b.threshold && b.allow(now) {
+		until := now.Add(b.cooldown)
+		b.openUntil.Store(until.UnixNano())
+		slog.WarnContext(ctx, "circuit breaker is open. stop uploading until the cooldown expires",
+			"consecutive_errors", n,
+			"until", until,
+		)
+		tr.setHealth(HealthStatusDegraded, fmt.Sprintf("circuit breaker is open until %s", until.Format(time.RFC3339)))
+	}
+}
+
+// waitCircuit blocks while the circuit breaker is open.
+func (tr *Transporter) waitCircuit(ctx context.Context) error {
+	for !tr.breaker.allow(time.Now()) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(RetryWait):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	config := &s3mover.Config{
+		SrcDir:                  dir,
+		Bucket:                  "testbucket",
+		KeyPrefix:               "test/breaker",
+		MaxParallels:            1,
+		CircuitBreakerThreshold: 2,
+		CircuitBreakerCooldown:  100 * time.Millisecond,
+		FaultErrorRate:          1,
+	}
+	tr, client := newTestTransporter(t, config)
+
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 0 || total != 2 {
+		t.Errorf("unexpected result: processed=%d total=%d err=%v", processed, total, err)
+	}
+	// open
+	if _, total, err := tr.Flush(ctx); err == nil {
+		t.Error("circuit breaker must be open")
+	} else if total != 2 {
+		t.Errorf("queued files must be counted: %d", total)
+	}
+	if h := tr.Health(); h.OK() {
+		t.Errorf("must be degraded: %v", h)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Errored != 2 || m.Objects.Queued != 2 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+
+	// recover the S3
+	config.FaultErrorRate = 0
+	tr.SetS3Client(client)
+	time.Sleep(150 * time.Millisecond)
+
+	// half-open. only one file is tried
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 1 || total != 1 {
+		t.Errorf("unexpected result: processed=%d total=%d err=%v", processed, total, err)
+	}
+	if h := tr.Health(); !h.OK() {
+		t.Errorf("must be healthy: %v", h)
+	}
+	// closed
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 1 || total != 1 {
+		t.Errorf("unexpected result: processed=%d total=%d err=%v", processed, total, err)
+	}
+}
@@ -0,0 +1,40 @@
+package s3mover
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// bufferReady reports whether the queued files should be uploaded by the buffer conditions,
+// BufferMaxFiles, BufferMaxBytes, or BufferMaxAge, whichever is met first like Kinesis Data Firehose.
+// It also returns the reason of the flush. It is always ready without the conditions.
+func (tr *Transporter) bufferReady(paths []string, now time.Time) (bool, string) {
+	c := tr.config
+	if c.BufferMaxFiles == 0 && c.BufferMaxBytes == 0 && c.BufferMaxAge == 0 {
+		return true, ""
+	}
+	if len(paths) == 0 {
+		return false, ""
+	}
+	if c.BufferMaxFiles > 0 && int64(len(paths)) >= c.BufferMaxFiles {
+		return true, fmt.Sprintf("%d files reached buffer-max-files %d", len(paths), c.BufferMaxFiles)
+	}
+	if c.BufferMaxBytes > 0 {
+		var size int64
+		for _, path := range paths {
+			if st, err := os.Stat(path); err == nil {
+				size += st.Size()
+			}
+		}
+		if size >= c.BufferMaxBytes {
+			return true, fmt.Sprintf("%d bytes reached buffer-max-bytes %d", size, c.BufferMaxBytes)
+		}
+	}
+	if c.BufferMaxAge > 0 {
+		if age := oldestAge(paths, now); age >= c.BufferMaxAge {
+			return true, fmt.Sprintf("the oldest file of %s reached buffer-max-age %s", age.Truncate(time.Second), c.BufferMaxAge)
+		}
+	}
+	return false, ""
+}
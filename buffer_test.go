@@ -0,0 +1,64 @@
+package s3mover_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestBufferConditions(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	for name, c := range map[string]struct {
+		config   s3mover.Config
+		files    int
+		oldFile  bool
+		expected int64
+	}{
+		"max files not reached": {s3mover.Config{BufferMaxFiles: 3}, 2, false, 0},
+		"max files reached":     {s3mover.Config{BufferMaxFiles: 3}, 3, false, 3},
+		"max bytes not reached": {s3mover.Config{BufferMaxBytes: 10}, 2, false, 0},
+		"max bytes reached":     {s3mover.Config{BufferMaxBytes: 10}, 4, false, 4},
+		"max age not reached":   {s3mover.Config{BufferMaxAge: time.Minute}, 2, false, 0},
+		"max age reached":       {s3mover.Config{BufferMaxAge: time.Minute}, 2, true, 2},
+		"whichever first":       {s3mover.Config{BufferMaxFiles: 100, BufferMaxAge: time.Minute}, 2, true, 2},
+		"no buffer conditions":  {s3mover.Config{}, 1, false, 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			for i := 0; i < c.files; i++ {
+				// 3 bytes each
+				s3movertest.WriteFile(t, dir, fmt.Sprintf("%d.txt", i), []byte("foo"))
+			}
+			if c.oldFile {
+				if err := os.Chtimes(filepath.Join(dir, "0.txt"), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config := c.config
+			config.SrcDir, config.Bucket, config.KeyPrefix = dir, "testbucket", "test/buffer"
+			config.MaxParallels = 1
+			tr, _ := newTestTransporter(t, &config)
+			processed, _, err := tr.RunOnce(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if processed != c.expected {
+				t.Errorf("expected %d files uploaded, got %d", c.expected, processed)
+			}
+			if q := tr.Metrics().Snapshot().Objects.Queued; q != int64(c.files) {
+				t.Errorf("expected %d files queued, got %d", c.files, q)
+			}
+			// Flush ignores the buffer conditions
+			if processed, _, err := tr.Flush(ctx); err != nil || processed != int64(c.files)-c.expected {
+				t.Errorf("unexpected flush result: %d %v", processed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package s3mover
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SupportBundleLogLines is the number of the recent log lines kept for the support bundle.
+const SupportBundleLogLines = 1000
+
+// MaxSupportBundleFiles is the max number of the pending files listed in the support bundle.
+const MaxSupportBundleFiles = 10000
+
+// recentLogs keeps the recent log lines written by the logger set by SetLoggerWithAttrs.
+var recentLogs = newLogRing(SupportBundleLogLines)
+
+// logRing is a ring buffer of the log lines. Each Write is a line by the slog handlers.
+type logRing struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  int
+	full  bool
+}
+
+func newLogRing(n int) *logRing {
+	return &logRing{lines: make([][]byte, n)}
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = append(r.lines[r.next][:0], p...)
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+	return len(p), nil
+}
+
+// bytes returns the lines in the order written.
+func (r *logRing) bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b bytes.Buffer
+	if r.full {
+		for _, line := range r.lines[r.next:] {
+			b.Write(line)
+		}
+	}
+	for _, line := range r.lines[:r.next] {
+		b.Write(line)
+	}
+	return b.Bytes()
+}
+
+// PendingFile is a file in the source directory listed in the support bundle.
+type PendingFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// SupportRuntime is the runtime information of the process in the support bundle.
+type SupportRuntime struct {
+	Version      string    `json:"version"`
+	GoVersion    string    `json:"go_version"`
+	OS           string    `json:"os"`
+	Arch         string    `json:"arch"`
+	NumCPU       int       `json:"num_cpu"`
+	NumGoroutine int       `json:"num_goroutine"`
+	PID          int       `json:"pid"`
+	Time         time.Time `json:"time"`
+}
+
+// pendingFiles lists the files in the source directory up to MaxSupportBundleFiles.
+func (tr *Transporter) pendingFiles() ([]PendingFile, error) {
+	paths, err := tr.listSrc()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]PendingFile, 0, min(len(paths), MaxSupportBundleFiles))
+	for _, path := range paths {
+		if len(files) >= MaxSupportBundleFiles {
+			break
+		}
+		if st, err := os.Stat(path); err == nil {
+			files = append(files, PendingFile{Path: path, Size: st.Size(), ModTime: st.ModTime()})
+		}
+	}
+	return files, nil
+}
+
+// WriteSupportBundle writes the support bundle to w as a gzipped tarball. It contains the effective configurations
+// redacted, the metrics, the health, the failures, the pending files, the recent logs and the goroutine dump.
+func (tr *Transporter) WriteSupportBundle(w io.Writer, now time.Time) error {
+	rt := &SupportRuntime{
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		NumCPU:       runtime.NumCPU(),
+		NumGoroutine: runtime.NumGoroutine(),
+		PID:          os.Getpid(),
+		Time:         now,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		rt.Version = info.Main.Version
+	}
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return fmt.Errorf("failed to dump goroutines: %w", err)
+	}
+	var pending any
+	if files, err := tr.pendingFiles(); err != nil {
+		pending = map[string]string{"error": err.Error()}
+	} else {
+		pending = files
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	dir := strings.TrimSuffix(SupportBundleName(now), ".tar.gz")
+	add := func(name string, b []byte) error {
+		hdr := &tar.Header{Name: dir + "/" + name, Mode: 0644, Size: int64(len(b)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		v    any
+	}{
+		{"runtime.json", rt},
+		{"config.json", tr.config.Redacted()},
+		{"metrics.json", tr.Metrics().Snapshot()},
+		{"health.json", tr.Health()},
+		{"failures.json", tr.Failures()},
+		{"pending.json", pending},
+	} {
+		b, err := json.MarshalIndent(f.v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", f.name, err)
+		}
+		if err := add(f.name, append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	if err := add("logs.txt", recentLogs.bytes()); err != nil {
+		return err
+	}
+	if err := add("goroutines.txt", goroutines.Bytes()); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// bundleHandler serves the support bundle. The bundle contains the paths, the logs and the stack traces, so it requires
+// the bearer token of IngestToken if specified, or the request from the loopback address otherwise.
+func (tr *Transporter) bundleHandler(w http.ResponseWriter, r *http.Request) {
+	if !tr.debugAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	now := time.Now()
+	var b bytes.Buffer
+	if err := tr.WriteSupportBundle(&b, now); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, SupportBundleName(now)))
+	w.Write(b.Bytes())
+}
+
+func (tr *Transporter) debugAuthorized(r *http.Request) bool {
+	if tr.config.IngestToken != "" {
+		return tr.ingestAuthorized(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// SupportBundleName returns the file name of the support bundle created at now.
+func SupportBundleName(now time.Time) string {
+	return "s3mover-bundle-" + now.Format("20060102T150405") + ".tar.gz"
+}
+
+// FetchSupportBundle fetches the support bundle from the stats server at endpoint, and writes it to w.
+// token is sent as the bearer token if not empty.
+func FetchSupportBundle(ctx context.Context, endpoint, token string, w io.Writer) error {
+	client := &http.Client{Timeout: statsClientTimeout}
+	u := strings.TrimSuffix(endpoint, "/") + "/debug/bundle"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", u, resp.Status)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to read %s: %w", u, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package s3mover_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestSupportBundle(t *testing.T) {
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	logFile, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	s3mover.SetLoggerWithOutput(false, logFile)
+	slog.Info("logged for the support bundle")
+
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.log", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:          dir,
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/bundle",
+		MaxParallels:    1,
+		IngestToken:     "secret",
+		StatsServerPort: 9898,
+	}
+	tr, _ := newTestTransporter(t, config)
+	srv := httptest.NewServer(tr.BundleHandler())
+	defer srv.Close()
+	var b bytes.Buffer
+	if err := s3mover.FetchSupportBundle(context.Background(), srv.URL, "wrong", io.Discard); err == nil {
+		t.Error("the bundle must require the ingest token")
+	}
+	if err := s3mover.FetchSupportBundle(context.Background(), srv.URL, "secret", &b); err != nil {
+		t.Fatal(err)
+	}
+
+	gr, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	ar := tar.NewReader(gr)
+	for {
+		hdr, err := ar.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(hdr.Name, "s3mover-bundle-") {
+			t.Errorf("unexpected name %s", hdr.Name)
+		}
+		if files[filepath.Base(hdr.Name)], err = io.ReadAll(ar); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"runtime.json", "config.json", "metrics.json", "health.json", "failures.json", "pending.json", "logs.txt", "goroutines.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s must be in the bundle", name)
+		}
+	}
+	var c s3mover.Config
+	if err := json.Unmarshal(files["config.json"], &c); err != nil || c.IngestToken != s3mover.RedactedValue {
+		t.Errorf("the config must be redacted: %s %v", files["config.json"], err)
+	}
+	var pending []s3mover.PendingFile
+	if err := json.Unmarshal(files["pending.json"], &pending); err != nil || len(pending) != 1 || pending[0].Path != foo || pending[0].Size != 3 {
+		t.Errorf("unexpected pending files: %s %v", files["pending.json"], err)
+	}
+	if !bytes.Contains(files["logs.txt"], []byte("logged for the support bundle")) {
+		t.Errorf("the recent logs must be in the bundle: %s", files["logs.txt"])
+	}
+	if !bytes.Contains(files["goroutines.txt"], []byte("goroutine ")) {
+		t.Errorf("the goroutine dump must be in the bundle: %.100s", files["goroutines.txt"])
+	}
+}
+
+func TestSupportBundleLoopback(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:       t.TempDir(),
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/bundle",
+		MaxParallels: 1,
+	}
+	tr, _ := newTestTransporter(t, config)
+	for _, c := range []struct {
+		remoteAddr string
+		code       int
+	}{
+		{"127.0.0.1:12345", http.StatusOK},
+		{"[::1]:12345", http.StatusOK},
+		{"192.0.2.1:12345", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/bundle", nil)
+		req.RemoteAddr = c.remoteAddr
+		w := httptest.NewRecorder()
+		tr.BundleHandler()(w, req)
+		if w.Code != c.code {
+			t.Errorf("%s: unexpected status %d, expected %d", c.remoteAddr, w.Code, c.code)
+		}
+	}
+}
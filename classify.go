@@ -0,0 +1,167 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// PermanentErrorRetry retries the permanent errors forever like the transient errors.
+	PermanentErrorRetry = "retry"
+	// PermanentErrorDeadLetter moves the file to the dead-letter directory.
+	PermanentErrorDeadLetter = "dead-letter"
+	// PermanentErrorExit stops the agent with the error.
+	PermanentErrorExit = "exit"
+)
+
+// permanentErrorCodes are the S3 error codes that never succeed by retrying.
+var permanentErrorCodes = map[string]bool{
+	"AccessDenied":        true,
+	"AllAccessDisabled":   true,
+	"AccountProblem":      true,
+	"EntityTooLarge":      true,
+	"InvalidAccessKeyId":  true,
+	"InvalidBucketName":   true,
+	"InvalidStorageClass": true,
+	"KeyTooLongError":     true,
+	"MetadataTooLarge":    true,
+	"NoSuchBucket":        true,
+}
+
+const (
+	// FailFastAuth is the class of the errors of invalid or expired credentials.
+	FailFastAuth = "auth"
+	// FailFastPermission is the class of the errors of denied permissions.
+	FailFastPermission = "permission"
+	// FailFastBucket is the class of the errors of missing or invalid buckets.
+	FailFastBucket = "bucket"
+)
+
+// failFastErrorCodes are the S3 error codes of each class of FailFast.
+var failFastErrorCodes = map[string][]string{
+	FailFastAuth:       {"InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken"},
+	FailFastPermission: {"AccessDenied", "AllAccessDisabled", "AccountProblem"},
+	FailFastBucket:     {"NoSuchBucket", "InvalidBucketName", "PermanentRedirect"},
+}
+
+// failFastClass returns the class of FailFast and the error code of the error, or empty strings.
+func (tr *Transporter) failFastClass(err error) (string, string) {
+	var ae smithy.APIError
+	if !errors.As(err, &ae) {
+		return "", ""
+	}
+	for _, class := range tr.config.FailFast {
+		for _, code := range failFastErrorCodes[class] {
+			if ae.ErrorCode() == code {
+				return class, code
+			}
+		}
+	}
+	return "", ""
+}
+
+// failFast stops the agent if the error is of the classes of FailFast, and reports whether it stops.
+func (tr *Transporter) failFast(ctx context.Context, path string, err error) bool {
+	class, code := tr.failFastClass(err)
+	if class == "" {
+		return false
+	}
+	slog.ErrorContext(ctx, "stop by fail-fast", "class", class, "code", code, "path", path, "error", err.Error())
+	if tr.cancel != nil {
+		tr.cancel(fmt.Errorf("fail-fast by %s error %s: %w", class, code, err))
+	}
+	return true
+}
+
+// IsPermanentError reports whether the error is a permanent S3 error such as AccessDenied,
+// an invalid record in the file, or an invalid key.
+// Timeouts, throttling and 5xx errors are transient.
+func IsPermanentError(err error) bool {
+	var ce *recordError
+	if errors.As(err, &ce) {
+		return true
+	}
+	var ke *keyError
+	if errors.As(err, &ke) {
+		return true
+	}
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		return permanentErrorCodes[ae.ErrorCode()]
+	}
+	return false
+}
+
+// onPermanentError handles the permanent error of path by the policy.
+func (tr *Transporter) onPermanentError(ctx context.Context, path string, err error) {
+	switch tr.config.PermanentErrorPolicy {
+	case PermanentErrorDeadLetter:
+		dst, derr := tr.deadLetter(path)
+		if derr != nil {
+			slog.ErrorContext(ctx, "failed to move file to the dead-letter directory", "path", path, "error", derr.Error())
+			return
+		}
+		tr.metrics.DeadLettered()
+		tr.failures.succeeded(path)
+		slog.ErrorContext(ctx, "moved file to the dead-letter directory by a permanent error",
+			"path", path,
+			"dead_letter", dst,
+			"error", err.Error(),
+		)
+	case PermanentErrorExit:
+		slog.ErrorContext(ctx, "stop by a permanent error", "path", path, "error", err.Error())
+		if tr.cancel != nil {
+			tr.cancel(fmt.Errorf("permanent error: %w", err))
+		}
+	}
+}
+
+// deadLetter moves the file to the dead-letter directory and returns the new path.
+// A timestamp is appended to the name if the same name exists.
+func (tr *Transporter) deadLetter(path string) (string, error) {
+	tr.fanout.clear(path)
+	return tr.moveFile(path, tr.config.DeadLetterDir)
+}
+
+// moveFile moves the file into the directory, copying it across file systems.
+// A timestamp is appended to the name if the name already exists in the directory.
+func (tr *Transporter) moveFile(path, dir string) (string, error) {
+	dst := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Lstat(dst); err == nil {
+		dst = fmt.Sprintf("%s.%s", dst, time.Now().Format("20060102T150405.000000000"))
+	}
+	if err := os.Rename(path, dst); err == nil {
+		return dst, nil
+	}
+	// across file systems
+	if err := copyFile(path, dst); err != nil {
+		return "", err
+	}
+	return dst, tr.removeFile(path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,155 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestIsPermanentError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&smithy.GenericAPIError{Code: "AccessDenied"}, true},
+		{&smithy.OperationError{Err: &smithy.GenericAPIError{Code: "NoSuchBucket"}}, true},
+		{&smithy.GenericAPIError{Code: "InternalError"}, false},
+		{&smithy.GenericAPIError{Code: "SlowDown"}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("unknown"), false},
+	}
+	for _, c := range cases {
+		if got := s3mover.IsPermanentError(c.err); got != c.want {
+			t.Errorf("%v: got %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestPermanentErrorDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	deadLetter := filepath.Join(t.TempDir(), "dead")
+	if err := os.Mkdir(deadLetter, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s3movertest.WriteFile(t, deadLetter, "foo.txt", []byte("old"))
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:               dir,
+		Bucket:               "testbucket",
+		KeyPrefix:            "test/dead-letter",
+		MaxParallels:         1,
+		FaultErrorRate:       1,
+		FaultErrorCode:       "AccessDenied",
+		PermanentErrorPolicy: s3mover.PermanentErrorDeadLetter,
+		DeadLetterDir:        deadLetter,
+	}
+	tr, _ := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(foo); !os.IsNotExist(err) {
+		t.Errorf("file must be moved: %v", err)
+	}
+	entries, err := os.ReadDir(deadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !strings.HasPrefix(entries[1].Name(), "foo.txt.") {
+		t.Errorf("unexpected dead-letter directory: %v", entries)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.DeadLettered != 1 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+	if len(tr.Failures()) != 0 {
+		t.Errorf("dead-lettered file must not be listed in failures: %v", tr.Failures())
+	}
+}
+
+func TestPermanentErrorExit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:               dir,
+		Bucket:               "testbucket",
+		KeyPrefix:            "test/exit",
+		MaxParallels:         1,
+		FaultErrorRate:       1,
+		FaultErrorCode:       "NoSuchBucket",
+		PermanentErrorPolicy: s3mover.PermanentErrorExit,
+	}
+	tr, _ := newTestTransporter(t, config)
+	err := tr.Run(ctx)
+	if !s3mover.IsPermanentError(err) {
+		t.Errorf("Run must return the permanent error: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("Run must stop before the timeout")
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:         dir,
+		Bucket:         "testbucket",
+		KeyPrefix:      "test/fail-fast",
+		MaxParallels:   1,
+		FaultErrorRate: 1,
+		FaultErrorCode: "AccessDenied",
+		FailFast:       []string{s3mover.FailFastAuth, s3mover.FailFastPermission},
+	}
+	tr, _ := newTestTransporter(t, config)
+	err := tr.Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "fail-fast by permission error AccessDenied") {
+		t.Errorf("Run must return the fail-fast error: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("Run must stop before the timeout")
+	}
+
+	config.FailFast = []string{"unknown"}
+	if err := config.Validate(); err == nil {
+		t.Error("unknown fail-fast class must be an error")
+	}
+}
+
+func TestFailuresRetain(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:         dir,
+		Bucket:         "testbucket",
+		KeyPrefix:      "test/failures",
+		MaxParallels:   1,
+		FaultErrorRate: 1,
+		FaultErrorCode: "InternalError",
+	}
+	tr, _ := newTestTransporter(t, config)
+	tr.Flush(ctx)
+	if fs := tr.Failures(); len(fs) != 1 || fs[0].Path != foo {
+		t.Fatalf("unexpected failures: %v", fs)
+	}
+	// removed by the operator between the scans
+	if err := os.Remove(foo); err != nil {
+		t.Fatal(err)
+	}
+	tr.Flush(ctx)
+	if fs := tr.Failures(); len(fs) != 0 {
+		t.Errorf("the failures of the removed file must be forgotten: %v", fs)
+	}
+}
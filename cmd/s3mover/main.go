@@ -2,66 +2,858 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/fujiwara/s3mover"
 )
 
 func main() {
 	if err := _main(); err != nil {
+		var ve *s3mover.ValidationError
+		if errors.As(err, &ve) && len(ve.Problems) > 1 {
+			for _, p := range ve.Problems {
+				slog.Error("invalid configuration", "error", p.Error())
+			}
+		}
 		slog.Error(err.Error())
+		var ee *exitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.code)
+		}
 		os.Exit(1)
 	}
 	slog.Info("s3mover stopped")
 }
 
+// exitError is an error with the exit status of the command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// onceExitCodes are the exit statuses of the once command by the status of the result.
+var onceExitCodes = map[string]int{
+	s3mover.OnceStatusOK:          0,
+	s3mover.OnceStatusPartial:     2,
+	s3mover.OnceStatusConfigError: 3,
+	s3mover.OnceStatusAuthError:   4,
+}
+
+// version is set by the build flags. e.g. -ldflags "-X main.version=v0.1.0"
+var version = "current"
+
+// command is a subcommand of s3mover.
+type command struct {
+	name        string
+	description string
+	// agent reports whether the command takes the configurations of the agent (-src, -bucket, ...).
+	agent bool
+	// stdout reports whether the command writes the results to stdout. The logs are written to stderr then.
+	stdout bool
+	// flags registers the flags specific to the command.
+	flags func(fs *flag.FlagSet)
+	// run runs the command. config is nil unless agent.
+	run func(config *s3mover.Config) error
+	// configError returns the error of the invalid flags, the environment variables or the timezone if not nil.
+	// The flags are parsed with flag.ContinueOnError then.
+	configError func(err error) error
+}
+
+func newCommands() []*command {
+	var replayOpt s3mover.ReplayOption
+	var verifyOpt s3mover.VerifyOption
+	var restoreOpt s3mover.RestoreOption
+	var reconcileOpt s3mover.ReconcileOption
+	var abortOpt s3mover.AbortUploadsOption
+	var since string
+	var iamOpt s3mover.IAMPolicyOption
+	var benchOpt s3mover.BenchOption
+	var endpoint, bundleOutput, bundleToken string
+	endpointFlag := func(fs *flag.FlagSet) {
+		fs.StringVar(&endpoint, "endpoint", s3mover.DefaultStatsEndpoint, "endpoint of the stats server")
+	}
+	return []*command{
+		{
+			name:        "run",
+			description: "run the agent to transport files to S3 (default)",
+			agent:       true,
+			run: func(config *s3mover.Config) error {
+				return withTransporter(config, "run", func(ctx context.Context, tr *s3mover.Transporter) error {
+					return tr.Run(ctx)
+				})
+			},
+		},
+		{
+			name:        "once",
+			description: "transport the files in src once and exit with the status of the result",
+			agent:       true,
+			stdout:      true,
+			run:         once,
+			configError: onceConfigError,
+		},
+		{
+			name:        "replay",
+			description: "re-attempt uploads of the files in a directory",
+			agent:       true,
+			stdout:      true,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&replayOpt.Dir, "dir", "", "directory of the files to replay")
+				fs.BoolVar(&replayOpt.Keep, "keep", false, "keep the files after uploading")
+			},
+			run: func(config *s3mover.Config) error {
+				return withTransporter(config, "replay", func(ctx context.Context, tr *s3mover.Transporter) error {
+					return replay(ctx, tr, replayOpt)
+				})
+			},
+		},
+		{
+			name:        "verify",
+			description: "check that the objects of the local files exist in the bucket",
+			agent:       true,
+			stdout:      true,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&verifyOpt.Dir, "dir", "", "directory of the local files to verify")
+			},
+			run: func(config *s3mover.Config) error {
+				return withTransporter(config, "verify", func(ctx context.Context, tr *s3mover.Transporter) error {
+					return verify(ctx, tr, verifyOpt)
+				})
+			},
+		},
+		{
+			name:        "restore",
+			description: "download the objects under the prefix into a local directory",
+			agent:       true,
+			stdout:      true,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&restoreOpt.Dest, "dest", "", "directory to download the objects into")
+				fs.StringVar(&since, "since", "", "restore only the objects modified at or after the date (2006-01-02) or the time (RFC3339)")
+				fs.BoolVar(&restoreOpt.Overwrite, "overwrite", false, "overwrite the existing files")
+			},
+			run: func(config *s3mover.Config) error {
+				if restoreOpt.Dest == "" {
+					return fmt.Errorf("dest is required")
+				}
+				var err error
+				if restoreOpt.Since, err = parseSince(since); err != nil {
+					return err
+				}
+				if config.SrcDir == "" {
+					// restore does not read src, but the configurations require it
+					config.SrcDir = restoreOpt.Dest
+				}
+				return withTransporter(config, "restore", func(ctx context.Context, tr *s3mover.Transporter) error {
+					return restore(ctx, tr, restoreOpt)
+				})
+			},
+		},
+		{
+			name:        "reconcile",
+			description: "report the objects in the audit log missing in the bucket",
+			agent:       true,
+			stdout:      true,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&reconcileOpt.Inventory, "inventory", "", "S3 URL of the manifest.json of the S3 Inventory report (default: list the objects)")
+				fs.StringVar(&since, "since", "", "reconcile only the records uploaded at or after the date (2006-01-02) or the time (RFC3339)")
+			},
+			run: func(config *s3mover.Config) error {
+				var err error
+				if reconcileOpt.Since, err = parseSince(since); err != nil {
+					return err
+				}
+				reconcileOpt.AuditLog = config.AuditLogPath
+				return withTransporter(config, "reconcile", func(ctx context.Context, tr *s3mover.Transporter) error {
+					return reconcile(ctx, tr, reconcileOpt)
+				})
+			},
+		},
+		{
+			name:        "abort-uploads",
+			description: "abort the stale incomplete multipart uploads under the prefix",
+			agent:       true,
+			stdout:      true,
+			flags: func(fs *flag.FlagSet) {
+				fs.DurationVar(&abortOpt.OlderThan, "older-than", 24*time.Hour, "abort the multipart uploads initiated before this duration")
+				fs.BoolVar(&abortOpt.DryRun, "dry-run", false, "list the stale multipart uploads without aborting them")
+			},
+			run: func(config *s3mover.Config) error {
+				return withTransporter(config, "abort-uploads", func(ctx context.Context, tr *s3mover.Transporter) error {
+					return abortUploads(ctx, tr, abortOpt)
+				})
+			},
+		},
+		{
+			name:        "validate",
+			description: "check the configurations without starting the agent",
+			agent:       true,
+			run: func(config *s3mover.Config) error {
+				return withTransporter(config, "validate", validate)
+			},
+		},
+		{
+			name:        "stats",
+			description: "print the metrics of the running agent",
+			flags:       endpointFlag,
+			run: func(*s3mover.Config) error {
+				return stats(endpoint)
+			},
+		},
+		{
+			name:        "healthcheck",
+			description: "check the health of the running agent",
+			flags:       endpointFlag,
+			run: func(*s3mover.Config) error {
+				return healthcheck(endpoint)
+			},
+		},
+		{
+			name:        "support-bundle",
+			description: "save the support bundle of the running agent to report an issue",
+			flags: func(fs *flag.FlagSet) {
+				endpointFlag(fs)
+				fs.StringVar(&bundleOutput, "output", "", "file to save the bundle, or - for stdout (default: s3mover-bundle-<time>.tar.gz)")
+				fs.StringVar(&bundleToken, "ingest-token", "", "bearer token of -ingest-token of the running agent")
+			},
+			run: func(*s3mover.Config) error {
+				return supportBundle(endpoint, bundleOutput, bundleToken)
+			},
+		},
+		{
+			name:        "iam-policy",
+			description: "print the minimal IAM policy for the configurations",
+			agent:       true,
+			stdout:      true,
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&iamOpt.Verify, "verify", false, "allow the verify subcommand")
+				fs.BoolVar(&iamOpt.Restore, "restore", false, "allow the restore subcommand")
+				fs.BoolVar(&iamOpt.Validate, "validate", false, "allow the validate subcommand to clean up the test object")
+				fs.BoolVar(&iamOpt.AbortUploads, "abort-uploads", false, "allow the abort-uploads subcommand")
+				fs.StringVar(&iamOpt.KMSKeyARN, "kms-key-arn", "", "ARN of the KMS key used by the default encryption of the bucket")
+			},
+			run: func(config *s3mover.Config) error {
+				return iamPolicy(config, iamOpt)
+			},
+		},
+		{
+			name:        "bench",
+			description: "measure the throughput with generated files",
+			agent:       true,
+			stdout:      true,
+			flags: func(fs *flag.FlagSet) {
+				fs.Int64Var(&benchOpt.FileSize, "size", 1024*1024, "size of each generated file in bytes")
+				fs.Float64Var(&benchOpt.Rate, "rate", 10, "number of files generated per second")
+				fs.DurationVar(&benchOpt.Duration, "duration", 10*time.Second, "duration of generating files")
+				fs.BoolVar(&benchOpt.Mock, "mock", false, "use an in-memory S3 client instead of the real bucket")
+				fs.DurationVar(&benchOpt.MockLatency, "mock-latency", 0, "latency of PutObject of the mock S3 client")
+			},
+			run: func(config *s3mover.Config) error {
+				return bench(config, benchOpt)
+			},
+		},
+		{
+			name:        "version",
+			description: "print the version",
+			run: func(*s3mover.Config) error {
+				fmt.Println("s3mover", currentVersion())
+				return nil
+			},
+		},
+	}
+}
+
+func findCommand(commands []*command, name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
 func _main() error {
+	name := "run"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	commands := newCommands()
+	if name == "help" {
+		// s3mover help [command]
+		name, args = "run", []string{"-h"}
+		if len(os.Args) > 2 {
+			name = os.Args[2]
+		}
+	}
+	cmd := findCommand(commands, name)
+	if cmd == nil {
+		printCommands(os.Stderr, commands)
+		return fmt.Errorf("unknown command: %s", name)
+	}
+
+	errorHandling := flag.ExitOnError
+	if cmd.configError != nil {
+		errorHandling = flag.ContinueOnError
+	}
+	fs := flag.NewFlagSet("s3mover "+cmd.name, errorHandling)
+	fs.Usage = func() {
+		usage(fs, cmd, commands)
+	}
 	var debug bool
-	config := &s3mover.Config{}
-	flag.StringVar(&config.SrcDir, "src", "", "source directory")
-	flag.StringVar(&config.Bucket, "bucket", "", "S3 bucket name")
-	flag.StringVar(&config.KeyPrefix, "prefix", "", "S3 key prefix")
-	flag.Int64Var(&config.MaxParallels, "parallels", s3mover.DefaultMaxParallels, "max parallels")
-	flag.BoolVar(&config.Gzip, "gzip", false, "gzip compress")
-	flag.IntVar(&config.GzipLevel, "gzip-level", 6, "gzip compress level (1-9)")
-	flag.StringVar(&config.TimeFormat, "time-format", s3mover.DefaultTimeFormat, "time format")
-	flag.BoolVar(&debug, "debug", false, "debug mode")
-	flag.IntVar(&config.StatsServerPort, "port", 9898, "stats server port")
-	flag.VisitAll(overrideWithEnv) // set default value from environment variable
-	flag.Parse()
-
-	s3mover.SetLogger(debug)
-
-	slog.Info("starting up s3mover")
-	if err := config.Validate(); err != nil {
+	var config *s3mover.Config
+	if cmd.agent {
+		config = &s3mover.Config{}
+		agentFlags(fs, config, &debug)
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	err := parseFlags(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0) // the same as flag.ExitOnError
+	}
+	if err == nil && cmd.agent && config.Timezone != "" {
+		err = s3mover.SetTimezone(config.Timezone)
+	}
+	if err != nil {
+		if cmd.configError != nil {
+			return cmd.configError(err)
+		}
 		return err
 	}
-	slog.Info("configurations loaded", "config", config)
+	if cmd.agent {
+		if cmd.stdout {
+			// stdout is used for the results
+			s3mover.SetLoggerWithAttrs(debug, os.Stderr, config.LogAttrs)
+		} else {
+			s3mover.SetLoggerWithAttrs(debug, os.Stdout, config.LogAttrs)
+		}
+	}
+	return cmd.run(config)
+}
+
+// usage prints the usage of the command with its flags.
+func usage(fs *flag.FlagSet, cmd *command, commands []*command) {
+	w := fs.Output()
+	if cmd.name == "run" {
+		fmt.Fprintln(w, "Usage: s3mover [command] [flags]")
+		fmt.Fprintln(w)
+		printCommands(w, commands)
+	} else {
+		fmt.Fprintf(w, "Usage: s3mover %s [flags]\n", cmd.name)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, cmd.description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	fs.PrintDefaults()
+}
+
+func printCommands(w io.Writer, commands []*command) {
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-15s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(w, "  %-15s %s\n", "help", "print the usage of the command")
+}
+
+// agentFlags registers the flags of the agent configurations.
+func agentFlags(fs *flag.FlagSet, config *s3mover.Config, debug *bool) {
+	fs.StringVar(&config.SrcDir, "src", "", "source directory")
+	fs.StringVar(&config.Bucket, "bucket", "", "S3 bucket name, or ARN of the access point")
+	fs.StringVar(&config.S3Endpoint, "s3-endpoint", "", "endpoint URL of the S3 API of -bucket, such as a proxy validating the uploads")
+	fs.StringVar(&config.KeyPrefix, "prefix", "", "S3 key prefix")
+	fs.StringVar(&config.KeyName, "key-name", "", "template of the object names with {name}, {ext} and {content_hash} (e.g. {name}-{content_hash}{ext}). default is the file name")
+	fs.Var((*stringsFlag)(&config.NormalizeName), "normalize-name", "normalization of the file names into the keys (nfc, space, percent). can be specified multiple times")
+	fs.StringVar(&config.LongKeyPolicy, "long-key", s3mover.LongKeyError, "policy for the keys longer than 1024 bytes (error, truncate, hash)")
+	fs.Int64Var(&config.MaxParallels, "parallels", s3mover.DefaultMaxParallels, "max parallels")
+	fs.BoolVar(&config.Gzip, "gzip", false, "gzip compress")
+	fs.StringVar(&config.Compress, "compress", "", "compression codec (gzip, lz4, snappy, auto). -gzip is the same as -compress gzip")
+	fs.Var((*stringsFlag)(&config.CompressMap), "compress-map", ".ext=codec or mime/type=codec selecting the codec with -compress auto (e.g. .log=lz4, image/*=none). can be specified multiple times")
+	fs.IntVar(&config.GzipLevel, "gzip-level", 6, "gzip compress level (1-9)")
+	fs.StringVar(&config.GzipSuffix, "gzip-suffix", s3mover.DefaultGzipSuffix, "suffix of the names of the compressed objects (e.g. .gzip), or none")
+	fs.BoolVar(&config.GzipReplaceExt, "gzip-replace-ext", false, "replace the extension of the names by -gzip-suffix instead of appending it (foo.log -> foo.gz)")
+	fs.Int64Var(&config.MaxInMemoryCompressSize, "max-inmemory-compress-size", s3mover.DefaultMaxInMemoryCompressSize, "max size of compressed content kept in memory in bytes. larger content is written into a temporary file (0 means unlimited)")
+	fs.Int64Var(&config.MultipartThreshold, "multipart-threshold", 0, "size of files uploaded by multipart uploads in bytes (0 disables multipart uploads)")
+	fs.Int64Var(&config.MultipartPartSize, "multipart-part-size", s3mover.DefaultMultipartPartSize, "size of each part of multipart uploads in bytes")
+	fs.IntVar(&config.MultipartConcurrency, "multipart-concurrency", s3mover.DefaultMultipartConcurrency, "number of parts uploaded concurrently for each file")
+	fs.StringVar(&config.TempDir, "temp-dir", "", "directory for temporary files (default: OS temporary directory)")
+	fs.StringVar(&config.StageDir, "stage-dir", "", "directory to copy and fsync each file into before uploading, for flaky sources such as NFS and FUSE")
+	fs.StringVar(&config.TimeFormat, "time-format", s3mover.DefaultTimeFormat, "time format")
+	fs.StringVar(&config.Timezone, "timezone", "", "time zone of the keys and the schedule (e.g. Asia/Tokyo, UTC). default is the local time zone")
+	fs.DurationVar(&config.TimeRound, "time-round", 0, "round down the time of the keys to the boundaries of the duration (e.g. 5m, 1h)")
+	fs.StringVar(&config.SQSQueueURL, "sqs-queue-url", "", "SQS queue URL to receive the paths of files to upload instead of scanning the source directory")
+	fs.StringVar(&config.PathsFrom, "paths-from", "", "read newline-delimited paths of files to upload from the file or FIFO (- for stdin) instead of scanning the source directory")
+	fs.StringVar(&config.IngestToken, "ingest-token", "", "enable POST /ingest on the stats server, authenticated by the bearer token")
+	fs.StringVar(&config.GRPCListen, "grpc-listen", "", "listen address of the gRPC control API (e.g. 127.0.0.1:9899, unix:/var/run/s3mover.sock)")
+	fs.IntVar(&config.GRPCMaxMessageSize, "grpc-max-message-size", s3mover.DefaultGRPCMaxMessageSize, "maximum size of a request message of the gRPC control API")
+	fs.StringVar(&config.Schedule, "schedule", "", `max parallels and bandwidth limit by time window (e.g. "Mon-Fri 09:00-18:00=1/1MB; 01:00-05:00=8"). 0 parallels pauses transporting`)
+	fs.Int64Var(&config.BandwidthLimit, "bandwidth-limit", 0, "average bandwidth limit of uploads in bytes per second (0 means unlimited)")
+	fs.Int64Var(&config.TenantMaxParallels, "tenant-max-parallels", 0, "max parallels of the uploads of each top-level subdirectory with -recursive (0 means unlimited)")
+	fs.Int64Var(&config.TenantBandwidthLimit, "tenant-bandwidth-limit", 0, "average bandwidth limit of the uploads of each top-level subdirectory in bytes per second with -recursive (0 means unlimited)")
+	fs.Int64Var(&config.MaxSpoolBytes, "max-spool-bytes", 0, "budget of the total size of the files in -src. drain, alert and apply -spool-overflow while exceeding it (0 disables)")
+	fs.StringVar(&config.SpoolOverflowPolicy, "spool-overflow", s3mover.SpoolOverflowDrain, "policy while the spool exceeds -max-spool-bytes (drain, reject, remove-newest)")
+	fs.DurationVar(&config.KeepAfterUpload, "keep-after-upload", 0, "keep uploaded files for the duration before removing them (e.g. 30m)")
+	fs.StringVar(&config.JournalPath, "journal", "", "path of the journal file to record the kept files (default <src>/"+s3mover.DefaultJournalName+")")
+	fs.StringVar(&config.ResumeJournalPath, "resume-journal", "", "path of the journal file to resume the multipart uploads and the removals of the uploaded files after restarts")
+	fs.BoolVar(&config.Mirror, "mirror", false, "mirror mode. keep local files and upload them again when modified")
+	fs.BoolVar(&config.RevisionSuffix, "revision-suffix", false, "append .r<N> to the names of re-uploaded objects in mirror mode")
+	fs.BoolVar(&config.Observe, "observe", false, "observe mode. report the files as they would be uploaded by the metrics, with neither uploading nor removing them")
+	fs.BoolVar(&config.Paranoid, "paranoid", false, "refuse to start unless the versioning or the replication of the bucket is enabled, not to remove the only copy of the files")
+	fs.StringVar(&config.AuditLogPath, "audit-log", "", "path of the audit log to append the records of uploaded objects as JSON lines")
+	fs.BoolVar(&config.AuditShutdown, "audit-log-shutdown", false, "record the summary of the run to -audit-log at the shutdown")
+	fs.Int64Var(&config.BufferMaxFiles, "buffer-max-files", 0, "hold the files until the number of files reaches this value (0 disables)")
+	fs.Int64Var(&config.BufferMaxBytes, "buffer-max-bytes", 0, "hold the files until the total size in bytes reaches this value (0 disables)")
+	fs.DurationVar(&config.BufferMaxAge, "buffer-max-age", 0, "hold the files until the oldest file gets older than this value (0 disables)")
+	fs.Var((*stringsFlag)(&config.Owners), "owner", "process only the files owned by the user name or uid. can be specified multiple times")
+	fs.Var((*stringsFlag)(&config.OwnerGroups), "owner-group", "process only the files owned by the group name or gid. can be specified multiple times")
+	fs.StringVar(&config.RequiredMode, "required-mode", "", "process only the files having all the permission bits in octal (e.g. 0040)")
+	fs.StringVar(&config.User, "user", "", "user name or uid to run as after binding the ports (requires root)")
+	fs.StringVar(&config.Group, "group", "", "group name or gid to run as with -user (default: the primary group of the user)")
+	fs.BoolVar(&config.UseFIPSEndpoint, "fips", false, "use the FIPS endpoints of the AWS APIs")
+	fs.StringVar(&config.CABundle, "ca-bundle", "", "path of the PEM file of the CA certificates to trust in addition to the system roots")
+	fs.StringVar(&config.ClientCert, "client-cert", "", "path of the PEM file of the TLS client certificate")
+	fs.StringVar(&config.ClientKey, "client-key", "", "path of the PEM file of the key of the TLS client certificate")
+	fs.StringVar(&config.Profile, "profile", "", "name of the profile of the shared configurations, e.g. an SSO profile (default: AWS_PROFILE)")
+	fs.BoolVar(&config.CheckIdentity, "check-identity", false, "check the identity of the credentials by STS GetCallerIdentity at startup")
+	fs.BoolVar(&config.IMDSDisabled, "imds-disabled", false, "disable the EC2 instance metadata service for the credentials and the key variables")
+	fs.BoolVar(&config.IMDSDisableV1Fallback, "imds-disable-v1-fallback", false, "disable the fallback to IMDSv1 when the IMDSv2 token can't be retrieved")
+	fs.StringVar(&config.IMDSEndpoint, "imds-endpoint", "", "endpoint of the EC2 instance metadata service (e.g. http://169.254.169.254)")
+	fs.DurationVar(&config.IMDSTimeout, "imds-timeout", 0, "timeout of each request to the EC2 instance metadata service (0 means the SDK default)")
+	fs.StringVar(&config.FallbackBucket, "fallback-bucket", "", "fallback bucket to upload when the primary bucket has failed continuously")
+	fs.StringVar(&config.FallbackRegion, "fallback-region", "", "region of the fallback bucket (default the same as the primary bucket)")
+	fs.DurationVar(&config.FallbackAfter, "fallback-after", s3mover.DefaultFallbackAfter, "duration of continuous failures of the primary bucket to use the fallback bucket")
+	fs.Var((*stringsFlag)(&config.HighPriority), "priority", "glob pattern of the relative path or the name of files uploaded before the others (e.g. billing/*). can be specified multiple times")
+	fs.BoolVar(&config.PreserveAttrs, "preserve-attrs", false, "store the owner, the mode and the mtime of the files as the object metadata")
+	fs.Var((*stringsFlag)(&config.PreserveXattrs), "preserve-xattrs", "names of the extended attributes stored as the object metadata (e.g. user.origin). can be specified multiple times")
+	fs.StringVar(&config.DoneMarker, "done-marker", "", "put completion marker objects. object: <key>.done after each upload, batch: _SUCCESS into the directories after each batch")
+	fs.Var((*stringsFlag)(&config.Destinations), "destination", "additional destination to upload each file to (e.g. s3://bucket/prefix?region=us-west-2). can be specified multiple times")
+	fs.StringVar(&config.BatchManifestPrefix, "batch-manifest-prefix", "", "put the CSV manifests of S3 Batch Operations of the uploaded objects of each day under the key prefix")
+	fs.DurationVar(&config.HeartbeatInterval, "heartbeat-interval", 0, "put the heartbeat object to the bucket at this interval (0 disables)")
+	fs.DurationVar(&config.AbortStaleUploadsAfter, "abort-stale-uploads", 0, "abort the incomplete multipart uploads under the prefix initiated before this duration (e.g. 24h, 0 disables)")
+	fs.DurationVar(&config.AbortStaleUploadsInterval, "abort-stale-uploads-interval", s3mover.DefaultAbortStaleUploadsInterval, "interval of aborting the stale multipart uploads with -abort-stale-uploads")
+	fs.StringVar(&config.HeartbeatKey, "heartbeat-key", s3mover.DefaultHeartbeatKey, "key of the heartbeat object. the key variables such as {hostname} are available")
+	fs.Int64Var(&config.CircuitBreakerThreshold, "circuit-breaker-threshold", 0, "number of consecutive upload errors to stop uploading for the cooldown (0 means disabled)")
+	fs.DurationVar(&config.CircuitBreakerCooldown, "circuit-breaker-cooldown", s3mover.DefaultCircuitBreakerCooldown, "duration to stop uploading after the circuit breaker opens")
+	fs.DurationVar(&config.UploadTimeout, "upload-timeout", 0, "timeout of each upload request (PutObject or UploadPart) not to hang on a stalled connection (0 disables)")
+	fs.DurationVar(&config.AdaptiveLatency, "adaptive-latency", 0, "reduce the parallelism while the average latency of the upload requests exceeds this value (0 disables)")
+	fs.Float64Var(&config.RetryBudget, "retry-budget", 0, "max ratio of the retries to the requests of S3 (e.g. 0.2). back off globally when exceeded (0 disables)")
+	fs.DurationVar(&config.RetryBudgetBackoff, "retry-budget-backoff", s3mover.DefaultRetryBudgetBackoff, "duration to stop uploading when -retry-budget is exhausted")
+	fs.Float64Var(&config.AdaptiveErrorRate, "adaptive-error-rate", 0, "reduce the parallelism while the error rate of the upload requests exceeds this value (0 disables)")
+	fs.BoolVar(&config.Sidecar, "sidecar", false, "read <name>.meta.json next to each file as the metadata, the tags and the content type of the object, and remove it with the file")
+	fs.StringVar(&config.KeyDirective, "key-directive", "", "prefix of the first line of the files to specify the key of the object (e.g. \"#s3mover-key:\"). the line is not uploaded")
+	fs.BoolVar(&config.ContentHash, "content-hash", false, "store the SHA-256 of each file in the object metadata and the journal, and skip uploading the files of the same content as the journal")
+	fs.BoolVar(&config.DedupeOnStartup, "dedupe-on-startup", false, "check whether the objects of the files left by the previous run already exist (HeadObject), and remove the files without uploading again if they exist")
+	fs.DurationVar(&config.DuplicateWindow, "duplicate-window", 0, "skip uploading the files of the same name, size and mtime uploaded within the duration, such as re-created by the producer (0 disables)")
+	fs.IntVar(&config.DuplicateCacheSize, "duplicate-cache-size", s3mover.DefaultDuplicateCacheSize, "number of the files remembered by -duplicate-window")
+	fs.StringVar(&config.PermanentErrorPolicy, "on-permanent-error", s3mover.PermanentErrorRetry, "policy for permanent S3 errors such as AccessDenied (retry, dead-letter, exit)")
+	fs.StringVar(&config.LocalErrorPolicy, "on-local-error", s3mover.LocalErrorRetry, "policy for the files failed to read repeatedly by local errors such as permission denied (retry, skip, dead-letter)")
+	fs.IntVar(&config.LocalErrorRetries, "local-error-retries", s3mover.DefaultLocalErrorRetries, "number of consecutive local read errors to apply -on-local-error")
+	fs.IntVar(&config.LockedRetries, "locked-retries", s3mover.DefaultLockedRetries, "number of the retries of a file locked by another process such as an antivirus scanner, before leaving it for the next scan")
+	fs.DurationVar(&config.LockedRetryWait, "locked-retry-wait", s3mover.DefaultLockedRetryWait, "wait before the first retry of a locked file, doubled by each retry")
+	fs.Var((*stringsFlag)(&config.FailFast), "fail-fast", "class of errors to exit immediately (auth, permission, bucket). can be specified multiple times")
+	fs.StringVar(&config.DeadLetterDir, "dead-letter-dir", "", "directory to move the files failed by permanent errors")
+	fs.StringVar(&config.Convert, "convert", "", "convert the files before uploading (parquet)")
+	fs.StringVar(&config.ConvertInput, "convert-input", s3mover.ConvertInputAuto, "input format of the files to convert (auto, jsonl, csv)")
+	fs.StringVar(&config.ParquetSchema, "parquet-schema", "", "schema of the parquet files. e.g. id:int64,name:string,time:timestamp")
+	fs.StringVar(&config.ValidateRecords, "validate-records", "", "validate the records before uploading and move the invalid files to -dead-letter-dir (auto, jsonl, csv)")
+	fs.IntVar(&config.CSVColumns, "csv-columns", 0, "number of CSV columns to validate (0 means the same as the header)")
+	fs.StringVar(&config.JSONSchemaPath, "json-schema", "", "JSON Schema file to validate the JSONL records")
+	fs.BoolVar(&config.Recursive, "recursive", false, "upload the files in the subdirectories of src")
+	fs.BoolVar(&config.PreservePath, "preserve-path", false, "preserve the relative path from src in the object keys (requires -recursive)")
+	fs.StringVar(&config.PreservePathLayout, "preserve-path-layout", s3mover.PathLayoutTimeDir, "layout of the preserved path (time/dir, dir/time)")
+	fs.IntVar(&config.Shards, "shards", 0, "move the files in src into the number of hashed subdirectories to keep the directories small, for the producers writing millions of files flat (0 disables)")
+	fs.StringVar(&config.EmptyFilePolicy, "empty-file", s3mover.FilePolicyUpload, "policy for empty files (upload, skip, delete)")
+	fs.Int64Var(&config.MaxFileSize, "max-file-size", 0, "max size of files to upload in bytes (0 means unlimited)")
+	fs.StringVar(&config.OversizedFilePolicy, "oversized-file", s3mover.FilePolicySkip, "policy for files larger than -max-file-size (skip, multipart, dead-letter)")
+	fs.StringVar(&config.DeleteStrategy, "delete-strategy", s3mover.DeleteUnlink, "how to delete the uploaded files (unlink, truncate, rename)")
+	fs.Var((*stringsFlag)(&config.DeleteRules), "delete-rule", "pattern=strategy overriding -delete-strategy for the files matching the glob pattern (e.g. app.log=truncate). can be specified multiple times")
+	fs.StringVar(&config.DeleteArchiveDir, "delete-archive-dir", "", "directory to move the uploaded files to by the rename strategy")
+	fs.StringVar(&config.MissingSrcPolicy, "on-missing-src", s3mover.MissingSrcWait, "policy when -src disappears at runtime (wait, exit)")
+	fs.StringVar(&config.TruncatePolicy, "on-truncate", s3mover.TruncateSkip, "policy for the files truncated after the discovery such as by copytruncate of logrotate (skip, upload)")
+	fs.BoolVar(debug, "debug", false, "debug mode")
+	fs.Var((*attrsFlag)(&config.LogAttrs), "log-attrs", "extra attributes added to every log record (e.g. service=foo,env=prod)")
+	fs.DurationVar(&config.LogSummaryInterval, "log-summary-interval", 0, "log a summary of the uploads at this interval instead of each upload (0 disables)")
+	fs.IntVar(&config.StatsServerPort, "port", 9898, "stats server port")
+	fs.StringVar(&config.AlertWebhookURL, "alert-webhook-url", "", "webhook URL to post alerts")
+	fs.StringVar(&config.AlertWebhookFormat, "alert-format", s3mover.AlertFormatGeneric, "alert webhook payload format (generic, slack)")
+	fs.Int64Var(&config.AlertQueuedThreshold, "alert-queued", 0, "alert when the number of queued files reaches this value (0 disables)")
+	fs.DurationVar(&config.AlertOldestAgeThreshold, "alert-oldest-age", 0, "alert when the oldest queued file is older than this duration (0 disables)")
+	fs.Int64Var(&config.AlertErrorsThreshold, "alert-errors", 0, "alert when the number of consecutive upload errors reaches this value (0 disables)")
+	fs.DurationVar(&config.AlertStaleThreshold, "alert-stale", 0, "alert when no files have been uploaded for this duration (0 disables)")
+	fs.DurationVar(&config.AlertCooldown, "alert-cooldown", s3mover.DefaultAlertCooldown, "minimum interval between alerts of the same kind")
+	fs.StringVar(&config.SentryDSN, "sentry-dsn", "", "Sentry DSN to report persistent errors and panics")
+	fs.StringVar(&config.SentryEnvironment, "sentry-environment", "", "Sentry environment")
+	fs.IntVar(&config.SentryErrorThreshold, "sentry-error-threshold", s3mover.DefaultSentryErrorThreshold, "report to Sentry when a file has failed this number of times in a row")
+
+	fs.Float64Var(&config.FaultErrorRate, "fault-error-rate", 0, "rate of injected S3 errors (0-1) for chaos testing")
+	fs.StringVar(&config.FaultErrorCode, "fault-error-code", s3mover.DefaultFaultErrorCode, "error code of injected S3 errors")
+	fs.DurationVar(&config.FaultLatency, "fault-latency", 0, "max latency injected into S3 requests for chaos testing")
+}
 
+// withTransporter validates the configurations and runs f with a new Transporter until a signal is received.
+func withTransporter(config *s3mover.Config, command string, f func(context.Context, *s3mover.Transporter) error) error {
+	ctx, stop, err := startup(config, command)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	tr, err := s3mover.New(ctx, config)
+	if err != nil {
+		return err
+	}
+	return f(ctx, tr)
+}
+
+// startup validates the configurations and returns the context canceled by signals,
+// or by the service control manager on Windows.
+func startup(config *s3mover.Config, command string) (context.Context, context.CancelFunc, error) {
+	slog.Info("starting up s3mover", "command", command, "version", currentVersion())
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	slog.Info("configurations loaded", "config", config)
 	ctx, stop := signal.NotifyContext(
 		context.Background(),
 		os.Interrupt,
 		syscall.SIGTERM,
 		syscall.SIGQUIT,
 	)
+	ctx, stop = serviceContext(ctx, stop)
+	return ctx, stop, nil
+}
+
+// currentVersion returns the version set by the build flags, or the module version for go install.
+func currentVersion() string {
+	if version != "current" && version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// once prints the result of TransportOnce as JSON to stdout, and returns exitError by the status.
+func once(config *s3mover.Config) error {
+	ctx, stop, err := startup(config, "once")
+	if err != nil {
+		return onceConfigError(err)
+	}
 	defer stop()
 	tr, err := s3mover.New(ctx, config)
+	if err != nil {
+		return onceConfigError(err)
+	}
+	return onceResult(tr.TransportOnce(ctx))
+}
+
+// onceConfigError prints the result of config_error of err as once, such as of the invalid flags.
+func onceConfigError(err error) error {
+	return onceResult(&s3mover.OnceResult{Status: s3mover.OnceStatusConfigError, Error: err.Error()})
+}
+
+// onceResult prints res as JSON to stdout, and returns exitError by the status.
+func onceResult(res *s3mover.OnceResult) error {
+	if err := json.NewEncoder(os.Stdout).Encode(res); err != nil {
+		return err
+	}
+	if res.Status == s3mover.OnceStatusOK {
+		slog.Info("all files are transported", "files", res.Processed)
+		return nil
+	}
+	msg := res.Error
+	if msg == "" {
+		msg = fmt.Sprintf("%d of %d files failed to transport", res.Failed, res.Total)
+	}
+	return &exitError{code: onceExitCodes[res.Status], err: fmt.Errorf("%s: %s", res.Status, msg)}
+}
+
+func replay(ctx context.Context, tr *s3mover.Transporter, opt s3mover.ReplayOption) error {
+	results, err := tr.Replay(ctx, opt)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	var failed int
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+		enc.Encode(r)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to replay", failed, len(results))
+	}
+	slog.Info("all files are replayed", "files", len(results))
+	return nil
+}
+
+func verify(ctx context.Context, tr *s3mover.Transporter, opt s3mover.VerifyOption) error {
+	results, err := tr.Verify(ctx, opt)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	var ng int
+	for _, r := range results {
+		if r.Status != s3mover.VerifyStatusOK {
+			ng++
+		}
+		enc.Encode(r)
+	}
+	if ng > 0 {
+		return fmt.Errorf("%d of %d files are not verified", ng, len(results))
+	}
+	slog.Info("all files are verified", "files", len(results))
+	return nil
+}
+
+func restore(ctx context.Context, tr *s3mover.Transporter, opt s3mover.RestoreOption) error {
+	results, err := tr.Restore(ctx, opt)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	var failed int
+	for _, r := range results {
+		if r.Status == s3mover.RestoreStatusError {
+			failed++
+		}
+		enc.Encode(r)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects failed to restore", failed, len(results))
+	}
+	slog.Info("all objects are restored", "objects", len(results))
+	return nil
+}
+
+func abortUploads(ctx context.Context, tr *s3mover.Transporter, opt s3mover.AbortUploadsOption) error {
+	results, err := tr.AbortStaleUploads(ctx, opt)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	var failed int
+	for _, r := range results {
+		if r.Status == s3mover.AbortUploadStatusError {
+			failed++
+		}
+		enc.Encode(r)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to abort %d of %d multipart uploads", failed, len(results))
+	}
+	slog.Info("stale multipart uploads are aborted", "uploads", len(results), "dry_run", opt.DryRun)
+	return nil
+}
+
+func reconcile(ctx context.Context, tr *s3mover.Transporter, opt s3mover.ReconcileOption) error {
+	results, err := tr.Reconcile(ctx, opt)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	var ng int
+	for _, r := range results {
+		if r.Status != s3mover.ReconcileStatusOK {
+			ng++
+			enc.Encode(r)
+		}
+	}
+	if ng > 0 {
+		return fmt.Errorf("%d of %d objects are not found as uploaded", ng, len(results))
+	}
+	slog.Info("all objects are reconciled", "objects", len(results))
+	return nil
+}
+
+// parseSince parses the date or the time of -since. The date is in the local time zone.
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q: must be 2006-01-02 or RFC3339", s)
+	}
+	return t, nil
+}
+
+func validate(ctx context.Context, tr *s3mover.Transporter) error {
+	for _, r := range tr.Validate(ctx) {
+		if !r.OK && !r.Warning {
+			return fmt.Errorf("validation failed: %s", r.Name)
+		}
+	}
+	slog.Info("all checks passed")
+	return nil
+}
+
+func stats(endpoint string) error {
+	st, err := s3mover.FetchStats(context.Background(), endpoint)
 	if err != nil {
 		return err
 	}
-	return tr.Run(ctx)
+	return st.Print(os.Stdout)
+}
+
+func healthcheck(endpoint string) error {
+	_, err := s3mover.Healthcheck(context.Background(), endpoint)
+	return err
 }
 
-// overrideWithEnv overrides flag value with environment variable.
-func overrideWithEnv(f *flag.Flag) {
-	name := strings.ToUpper(f.Name)
-	name = strings.Replace(name, "-", "_", -1)
-	if s := os.Getenv("S3MOVER_" + name); s != "" {
-		f.Value.Set(s)
+func supportBundle(endpoint, output, token string) error {
+	if output == "-" {
+		return s3mover.FetchSupportBundle(context.Background(), endpoint, token, os.Stdout)
+	}
+	if output == "" {
+		output = s3mover.SupportBundleName(time.Now())
+	}
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := s3mover.FetchSupportBundle(context.Background(), endpoint, token, f); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "saved the support bundle to", output)
+	return nil
+}
+
+func iamPolicy(config *s3mover.Config, opt s3mover.IAMPolicyOption) error {
+	if config.Bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(config.IAMPolicy(opt))
+}
+
+func bench(config *s3mover.Config, opt s3mover.BenchOption) error {
+	if config.SrcDir == "" {
+		config.SrcDir = os.TempDir()
+	}
+	if opt.Mock && config.Bucket == "" {
+		config.Bucket = "mock"
+	}
+	if opt.Mock && config.KeyPrefix == "" {
+		config.KeyPrefix = "bench"
+	}
+	ctx, stop, err := startup(config, "bench")
+	if err != nil {
+		return err
+	}
+	defer stop()
+	res, err := s3mover.Bench(ctx, config, opt)
+	if err != nil {
+		return err
+	}
+	return res.Print(os.Stdout)
+}
+
+// stringsFlag is a flag that can be specified multiple times. A comma-separated value is split.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, strings.Split(v, ",")...)
+	return nil
+}
+
+// attrsFlag is a flag of key=value pairs separated by commas. It can be specified multiple times.
+type attrsFlag map[string]string
+
+func (f *attrsFlag) String() string {
+	kvs := make([]string, 0, len(*f))
+	for k, v := range *f {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+func (f *attrsFlag) Set(v string) error {
+	attrs, err := s3mover.ParseLogAttrs(v)
+	if err != nil {
+		return err
+	}
+	if *f == nil {
+		*f = make(attrsFlag)
+	}
+	for k, v := range attrs {
+		(*f)[k] = v
+	}
+	return nil
+}
+
+// parseFlags parses args, and then sets the flags not specified in args from the environment variables
+// with -env-prefix, or the variables in -env-file. The environment variables take precedence over -env-file.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	prefix := fs.String("env-prefix", s3mover.DefaultEnvPrefix, "prefix of environment variables to set flags")
+	envFile := fs.String("env-file", "", "dotenv file to set flags. environment variables take precedence over it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	specified := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		specified[f.Name] = true
+	})
+	var dotenv map[string]string
+	if *envFile != "" {
+		var err error
+		if dotenv, err = s3mover.ReadDotenv(*envFile); err != nil {
+			return fmt.Errorf("failed to read env file: %w", err)
+		}
 	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || specified[f.Name] || f.Name == "env-prefix" || f.Name == "env-file" {
+			return
+		}
+		name := s3mover.EnvName(*prefix, f.Name)
+		s := os.Getenv(name)
+		if s == "" {
+			s = dotenv[name]
+		}
+		if s == "" {
+			return
+		}
+		if serr := f.Value.Set(s); serr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %w", s, name, serr)
+		}
+	})
+	return err
 }
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "context"
+
+// serviceContext returns ctx and stop as is. s3mover runs as a service only on Windows.
+func serviceContext(ctx context.Context, stop context.CancelFunc) (context.Context, context.CancelFunc) {
+	return ctx, stop
+}
@@ -0,0 +1,73 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+const serviceName = "s3mover"
+
+// serviceStopTimeout is the max time to wait for reporting the stopped state to the service control manager.
+const serviceStopTimeout = 10 * time.Second
+
+// serviceContext runs s3mover as a Windows service when started by the service control manager.
+// The returned context is canceled when the service is stopped. The returned stop reports that the agent has finished.
+func serviceContext(ctx context.Context, stop context.CancelFunc) (context.Context, context.CancelFunc) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &service{cancel: cancel, done: make(chan struct{})}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		if err := svc.Run(serviceName, s); err != nil {
+			slog.Error("failed to run as a Windows service", "error", err)
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		stop()
+		close(s.done)
+		select {
+		case <-finished:
+		case <-time.After(serviceStopTimeout):
+		}
+	}
+}
+
+// service implements svc.Handler.
+type service struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *service) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.Running, Accepts: accepts}
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				slog.Info("stopping the Windows service", "cmd", c.Cmd)
+				changes <- svc.Status{State: svc.StopPending}
+				s.cancel()
+				<-s.done
+				return false, 0
+			}
+		case <-s.done:
+			// the agent has finished by itself
+			return false, 0
+		}
+	}
+}
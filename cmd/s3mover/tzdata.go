@@ -0,0 +1,7 @@
+//go:build !notzdata
+
+package main
+
+// The timezone database is embedded, so -timezone works in the containers without zoneinfo, such as scratch
+// and distroless. Build with -tags notzdata to exclude it (about 450 KB).
+import _ "time/tzdata"
@@ -0,0 +1,167 @@
+package s3mover
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/pierrec/lz4/v4"
+)
+
+// compression codecs
+const (
+	CompressGzip   = "gzip"
+	CompressLZ4    = "lz4"
+	CompressSnappy = "snappy"
+	// CompressAuto selects the codec of each file by the extension or the sniffed MIME type.
+	CompressAuto = "auto"
+	// CompressNone is the codec not to compress in the compress maps.
+	CompressNone = "none"
+)
+
+// sniffLen is the number of bytes to sniff the MIME type, as http.DetectContentType.
+const sniffLen = 512
+
+// DefaultCompressMap is the mapping table of CompressAuto applied after CompressMap.
+// A key starting with "." is an extension (case-insensitive), otherwise a glob pattern of the MIME type sniffed by http.DetectContentType.
+// The files matching none of them are compressed with gzip.
+var DefaultCompressMap = []string{
+	// already compressed
+	".gz=none", ".tgz=none", ".zst=none", ".bz2=none", ".xz=none", ".zip=none", ".7z=none",
+	".lz4=none", ".sz=none", ".snappy=none", ".br=none",
+	".jpg=none", ".jpeg=none", ".png=none", ".gif=none", ".webp=none",
+	".mp3=none", ".mp4=none", ".mov=none", ".parquet=none", ".orc=none",
+	"image/*=none", "video/*=none", "audio/*=none", "font/woff*=none",
+	"application/x-gzip=none", "application/zip=none", "application/x-rar-compressed=none",
+}
+
+func validateCompressMap(rules []string) error {
+	for _, rule := range rules {
+		key, codec, ok := strings.Cut(rule, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid compress map %q. it must be .ext=codec or mime/type=codec", rule)
+		}
+		if _, err := path.Match(key, ""); err != nil {
+			return fmt.Errorf("invalid compress map pattern %q: %w", key, err)
+		}
+		switch codec {
+		case CompressGzip, CompressLZ4, CompressSnappy, CompressNone:
+		default:
+			return fmt.Errorf("codec of compress map %q must be %s, %s, %s or %s", rule, CompressGzip, CompressLZ4, CompressSnappy, CompressNone)
+		}
+	}
+	return nil
+}
+
+// suffixes of the names of the objects compressed by lz4 (the frame format) and snappy (the framing format)
+const (
+	LZ4Suffix    = ".lz4"
+	SnappySuffix = ".sz"
+)
+
+// codec returns the compression codec of the file, or empty if not compressed.
+func (tr *Transporter) codec(file string) string {
+	switch tr.config.Compress {
+	case "":
+		if tr.config.Gzip {
+			return CompressGzip
+		}
+	case CompressAuto:
+		return tr.autoCodec(file)
+	}
+	return tr.config.Compress
+}
+
+// autoCodec selects the codec of the file by the first matching rule of CompressMap and DefaultCompressMap.
+// The MIME type is sniffed only when a rule of the MIME type is reached.
+func (tr *Transporter) autoCodec(file string) string {
+	ext := filepath.Ext(file)
+	var mime string
+	var sniffed bool
+	for _, rules := range [][]string{tr.config.CompressMap, DefaultCompressMap} {
+		for _, rule := range rules {
+			key, codec, _ := strings.Cut(rule, "=")
+			if strings.HasPrefix(key, ".") {
+				if !strings.EqualFold(key, ext) {
+					continue
+				}
+			} else {
+				if !sniffed {
+					mime, sniffed = sniffContentType(tr.staged.source(file)), true
+				}
+				if ok, _ := path.Match(key, mime); !ok {
+					continue
+				}
+			}
+			if codec == CompressNone {
+				return ""
+			}
+			return codec
+		}
+	}
+	return CompressGzip
+}
+
+// sniffContentType returns the MIME type of the file without the parameters, or empty if failed to read.
+func sniffContentType(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	b := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, b)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return ""
+	}
+	mime, _, _ := strings.Cut(http.DetectContentType(b[:n]), ";")
+	return mime
+}
+
+// compressSuffix returns the suffix of the names of the objects compressed by the codec.
+func (c *Config) compressSuffix(codec string) string {
+	switch codec {
+	case CompressGzip:
+		return c.gzipSuffix()
+	case CompressLZ4:
+		return LZ4Suffix
+	case CompressSnappy:
+		return SnappySuffix
+	}
+	return ""
+}
+
+// compressCodec compresses src of the file into dst by the codec. The level is of gzip.
+func compressCodec(dst io.Writer, src io.Reader, codec string, stat os.FileInfo, level int) error {
+	var w io.WriteCloser
+	switch codec {
+	case CompressLZ4:
+		w = lz4.NewWriter(dst)
+	case CompressSnappy:
+		w = snappy.NewBufferedWriter(dst)
+	default:
+		return compress(dst, src, gzipHeader(stat), level)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// decompressCodec returns the reader decompressing r by the codec.
+func decompressCodec(r io.Reader, codec string) (io.Reader, error) {
+	switch codec {
+	case CompressLZ4:
+		return lz4.NewReader(r), nil
+	case CompressSnappy:
+		return snappy.NewReader(r), nil
+	}
+	return gzip.NewReader(r)
+}
@@ -0,0 +1,149 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+	"github.com/klauspost/compress/snappy"
+	"github.com/pierrec/lz4/v4"
+)
+
+func TestCompressCodec(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("foo bar baz\n", 100)
+	for _, c := range []struct {
+		codec  string
+		suffix string
+		reader func(io.Reader) io.Reader
+	}{
+		{s3mover.CompressLZ4, ".lz4", func(r io.Reader) io.Reader { return lz4.NewReader(r) }},
+		{s3mover.CompressSnappy, ".sz", func(r io.Reader) io.Reader { return snappy.NewReader(r) }},
+	} {
+		src := t.TempDir()
+		s3movertest.WriteFile(t, src, "foo.log", []byte(content))
+		config := &s3mover.Config{
+			SrcDir:       src,
+			Bucket:       "testbucket",
+			KeyPrefix:    "test/codec",
+			MaxParallels: 1,
+			TimeFormat:   "2006/01/02",
+			Compress:     c.codec,
+		}
+		tr, client := newTestTransporter(t, config)
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		keys := client.Keys()
+		if len(keys) != 1 || !strings.HasSuffix(keys[0], "/foo.log"+c.suffix) {
+			t.Fatalf("%s: unexpected keys %v", c.codec, keys)
+		}
+		obj := client.Objects[keys[0]]
+		if len(obj.Content) >= len(content) {
+			t.Errorf("%s: the content must be compressed: %d bytes", c.codec, len(obj.Content))
+		}
+		b, err := io.ReadAll(c.reader(bytes.NewReader(obj.Content)))
+		if err != nil || string(b) != content {
+			t.Errorf("%s: failed to decompress: %v", c.codec, err)
+		}
+
+		results, err := tr.Restore(ctx, s3mover.RestoreOption{Dest: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Status != s3mover.RestoreStatusRestored || !strings.HasSuffix(results[0].Path, "foo.log") {
+			t.Fatalf("%s: unexpected results: %v", c.codec, results)
+		}
+		if b, err := os.ReadFile(results[0].Path); err != nil || string(b) != content {
+			t.Errorf("%s: %s must be decompressed: %v", c.codec, results[0].Path, err)
+		}
+	}
+}
+
+func TestCompressValidate(t *testing.T) {
+	for _, config := range []s3mover.Config{
+		{Compress: "zstd"},
+		{Compress: s3mover.CompressLZ4, Gzip: true},
+	} {
+		config.SrcDir = t.TempDir()
+		config.Bucket = "testbucket"
+		config.KeyPrefix = "test/codec"
+		if err := config.Validate(); err == nil {
+			t.Errorf("compress %s with gzip %v must be invalid", config.Compress, config.Gzip)
+		}
+	}
+	config := &s3mover.Config{SrcDir: t.TempDir(), Bucket: "testbucket", KeyPrefix: "test/codec", Compress: s3mover.CompressGzip}
+	if err := config.Validate(); err != nil || !config.Gzip || config.GzipLevel != s3mover.DefaultGzipLevel {
+		t.Errorf("compress gzip must be the same as gzip: %+v %v", config.Gzip, err)
+	}
+}
+
+func TestCompressAuto(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100))
+	files := map[string][]byte{
+		"foo.log":     []byte("foo\n"),
+		"foo.csv":     []byte("a,b\n"),
+		"archive.gz":  []byte("\x1f\x8b\x08\x00"),
+		"image.dat":   png,
+		"IMAGE.JPG":   []byte("jpeg"),
+		"noext":       []byte("text"),
+		"binary.data": {0x00, 0x01, 0x02, 0x03},
+	}
+	for name, b := range files {
+		s3movertest.WriteFile(t, src, name, b)
+	}
+	config := &s3mover.Config{
+		SrcDir:       src,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/auto",
+		MaxParallels: 1,
+		TimeFormat:   "2006/01/02",
+		Compress:     s3mover.CompressAuto,
+		CompressMap:  []string{".log=lz4", "application/octet-stream=snappy"},
+	}
+	tr, client := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{
+		"foo.log.lz4",    // by the extension of the map
+		"foo.csv.gz",     // text/plain by default
+		"archive.gz",     // already compressed by the extension
+		"image.dat",      // image/png sniffed
+		"IMAGE.JPG",      // case-insensitive extension
+		"noext.gz",       // text/plain sniffed
+		"binary.data.sz", // application/octet-stream of the map
+	} {
+		if _, ok := client.Objects["test/auto/"+time.Now().In(s3mover.TZ).Format("2006/01/02")+"/"+key]; !ok {
+			t.Errorf("%s must be uploaded: %v", key, client.Keys())
+		}
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Uploaded != int64(len(files)) {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
+
+func TestCompressMapValidate(t *testing.T) {
+	for _, config := range []s3mover.Config{
+		{Compress: s3mover.CompressAuto, CompressMap: []string{".log"}},
+		{Compress: s3mover.CompressAuto, CompressMap: []string{".log=zstd"}},
+		{Compress: s3mover.CompressAuto, CompressMap: []string{"[=none"}},
+		{Compress: s3mover.CompressGzip, CompressMap: []string{".log=lz4"}},
+		{Compress: s3mover.CompressAuto, GzipSuffix: s3mover.GzipSuffixNone},
+	} {
+		config.SrcDir = t.TempDir()
+		config.Bucket = "testbucket"
+		config.KeyPrefix = "test/auto"
+		if err := config.Validate(); err == nil {
+			t.Errorf("compress %s with map %v must be invalid", config.Compress, config.CompressMap)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package s3mover
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// MaxCollisionKeys is the maximum number of the keys remembered in a time partition to detect the collisions.
+const MaxCollisionKeys = 100000
+
+// uploadedKeys records the keys uploaded recently to detect the collisions of the keys,
+// such as the files of the same name in the same time partition, which overwrite the objects silently.
+// The keys are recorded as the hashes to limit the memory usage. Only the keys uploaded in the current and the
+// previous time partition of TimeFormat are remembered, up to MaxCollisionKeys each.
+type uploadedKeys struct {
+	format string
+	round  time.Duration
+	size   int
+
+	mu        sync.Mutex
+	partition string
+	current   map[uint64]struct{}
+	previous  map[uint64]struct{}
+}
+
+// newUploadedKeys returns nil if the collisions are intended, as the re-uploads of the files modified in Mirror
+// without RevisionSuffix.
+func newUploadedKeys(config *Config) *uploadedKeys {
+	if config.Mirror && !config.RevisionSuffix {
+		return nil
+	}
+	format := config.TimeFormat
+	if format == "" {
+		format = DefaultTimeFormat
+	}
+	return &uploadedKeys{
+		format:  format,
+		round:   config.TimeRound,
+		size:    MaxCollisionKeys,
+		current: make(map[uint64]struct{}),
+	}
+}
+
+// add records the key in the bucket uploaded at now, and reports whether it was already uploaded.
+func (u *uploadedKeys) add(bucket, key string, now time.Time) bool {
+	if u == nil {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(bucket))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	partition := roundTime(now, u.round).In(TZ).Format(u.format)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if partition != u.partition || len(u.current) >= u.size {
+		u.partition = partition
+		u.previous, u.current = u.current, make(map[uint64]struct{})
+	}
+	if _, ok := u.current[sum]; ok {
+		return true
+	}
+	_, ok := u.previous[sum]
+	u.current[sum] = struct{}{}
+	return ok
+}
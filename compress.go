@@ -0,0 +1,224 @@
+package s3mover
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultGzipSuffix is appended to the names of the compressed objects by default.
+	DefaultGzipSuffix = ".gz"
+	// GzipSuffixNone appends no suffix to the names of the compressed objects.
+	GzipSuffixNone = "none"
+)
+
+// gzipSuffix returns the suffix of the names of the compressed objects.
+func (c *Config) gzipSuffix() string {
+	switch c.GzipSuffix {
+	case "":
+		return DefaultGzipSuffix
+	case GzipSuffixNone:
+		return ""
+	}
+	return c.GzipSuffix
+}
+
+// gzipBaseName removes the extension of the name to be replaced by the gzip suffix with GzipReplaceExt.
+// The suffix is appended by objectKey after the revision suffix.
+func (tr *Transporter) gzipBaseName(file, name string) string {
+	if !tr.config.GzipReplaceExt || tr.codec(file) != CompressGzip {
+		return name
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// DefaultMaxInMemoryCompressSize is the default size of files compressed in memory.
+const DefaultMaxInMemoryCompressSize = 64 * 1024 * 1024
+
+// MaxPooledBufferSize is the upper limit of the capacity of buffers returned to the pool.
+// Larger buffers are left to GC, not to retain the memory after compressing a huge file.
+const MaxPooledBufferSize = 4 * 1024 * 1024
+
+// pool of bytes.Buffer
+// reuse buffer for gzip compression
+var pool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBufferFromPool() (*bytes.Buffer, func()) {
+	buf := pool.Get().(*bytes.Buffer)
+	return buf, func() {
+		if buf.Cap() > MaxPooledBufferSize {
+			return
+		}
+		buf.Reset()
+		pool.Put(buf)
+	}
+}
+
+// pools of gzip.Writer for each compression level
+var gzipWriterPools [gzip.BestCompression + 1]sync.Pool
+
+func getGzipWriter(w io.Writer, level int) (*gzip.Writer, error) {
+	if level < gzip.NoCompression || level > gzip.BestCompression {
+		return gzip.NewWriterLevel(w, level)
+	}
+	if gw, ok := gzipWriterPools[level].Get().(*gzip.Writer); ok {
+		gw.Reset(w)
+		return gw, nil
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+func putGzipWriter(gw *gzip.Writer, level int) {
+	if level < gzip.NoCompression || level > gzip.BestCompression {
+		return
+	}
+	gw.Reset(io.Discard)
+	gzipWriterPools[level].Put(gw)
+}
+
+// gzipHeader returns the gzip header with the name and the mtime of the file.
+// The name is omitted if it can't be represented in Latin-1 as required by RFC 1952.
+func gzipHeader(stat os.FileInfo) gzip.Header {
+	h := gzip.Header{ModTime: stat.ModTime()}
+	if isLatin1(stat.Name()) {
+		h.Name = stat.Name()
+	}
+	return h
+}
+
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r == 0 || r > 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+func compress(dst io.Writer, src io.Reader, header gzip.Header, level int) error {
+	gw, err := getGzipWriter(dst, level)
+	if err != nil {
+		return err
+	}
+	defer putGzipWriter(gw, level)
+	// Reset clears the header, so it must be set for each use of the pooled writer.
+	gw.Name, gw.ModTime = header.Name, header.ModTime
+	if _, err := io.Copy(gw, src); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// bufferBody is a body of the pooled buffer. The buffer is returned to the pool on Close.
+type bufferBody struct {
+	*bytes.Reader
+	release func()
+	once    sync.Once
+}
+
+func (b *bufferBody) Close() error {
+	b.once.Do(b.release)
+	return nil
+}
+
+// tempFileBody is a body of the temporary file. The file is removed on Close.
+type tempFileBody struct {
+	*os.File
+}
+
+func (b *tempFileBody) Close() error {
+	err := b.File.Close()
+	if rerr := os.Remove(b.Name()); err == nil && !os.IsNotExist(rerr) {
+		err = rerr
+	}
+	return err
+}
+
+// spillWriter writes into the pooled buffer until the size exceeds max,
+// and then moves the content to a temporary file in dir and writes into it.
+type spillWriter struct {
+	max     int64
+	dir     string
+	buf     *bytes.Buffer
+	release func()
+	file    *os.File
+}
+
+func newSpillWriter(max int64, dir string) *spillWriter {
+	buf, release := getBufferFromPool()
+	return &spillWriter{max: max, dir: dir, buf: buf, release: release}
+}
+
+func (w *spillWriter) Write(p []byte) (int, error) {
+	if w.file != nil {
+		return w.file.Write(p)
+	}
+	if w.max > 0 && int64(w.buf.Len()+len(p)) > w.max {
+		if err := w.spill(); err != nil {
+			return 0, err
+		}
+		return w.file.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *spillWriter) spill() error {
+	f, err := os.CreateTemp(w.dir, "s3mover-*.gz")
+	if err != nil {
+		return err
+	}
+	w.file = f
+	_, err = w.buf.WriteTo(f)
+	w.release()
+	w.buf = nil
+	return err
+}
+
+// body returns the written content as a body and its length.
+func (w *spillWriter) body() (io.ReadCloser, int64, error) {
+	if w.file == nil {
+		return &bufferBody{Reader: bytes.NewReader(w.buf.Bytes()), release: w.release}, int64(w.buf.Len()), nil
+	}
+	length, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	return &tempFileBody{File: w.file}, length, nil
+}
+
+// discard releases the buffer or removes the temporary file.
+func (w *spillWriter) discard() {
+	if w.file != nil {
+		(&tempFileBody{File: w.file}).Close()
+		return
+	}
+	w.release()
+}
+
+// compressBody compresses src of the file by the codec. The compressed content is kept in memory up to maxInMemory bytes (0 means unlimited),
+// and is written into a temporary file in tempDir beyond that.
+func compressBody(src io.Reader, codec string, stat os.FileInfo, level int, maxInMemory int64, tempDir string) (io.ReadCloser, int64, error) {
+	w := newSpillWriter(maxInMemory, tempDir)
+	if err := compressCodec(w, src, codec, stat, level); err != nil {
+		w.discard()
+		return nil, 0, err
+	}
+	body, length, err := w.body()
+	if err != nil {
+		w.discard()
+		return nil, 0, err
+	}
+	return body, length, nil
+}
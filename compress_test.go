@@ -0,0 +1,137 @@
+package s3mover_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func readGzip(t *testing.T, r io.Reader) string {
+	t.Helper()
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestLoadFileGzBuffers(t *testing.T) {
+	raw, err := os.ReadFile("./testdata/raw.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the buffer of the first body must not be reused until it is closed
+	first, _, _, err := s3mover.LoadFile("./testdata/raw.txt", true, 6, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, _, err := s3mover.LoadFile("./testdata/foo.txt", true, 6, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if got := readGzip(t, first); got != string(raw) {
+		t.Errorf("unexpected content: %q", got)
+	}
+	first.Close()
+}
+
+func TestLoadFileGzSpill(t *testing.T) {
+	raw, err := os.ReadFile("./testdata/raw.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	body, size, _, err := s3mover.LoadFile("./testdata/raw.txt", true, 6, 16, tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := body.(interface{ Name() string })
+	if !ok {
+		t.Fatalf("expected a body of the temporary file, got %T", body)
+	}
+	if filepath.Dir(f.Name()) != tmpDir {
+		t.Errorf("expected the temporary file in %s, got %s", tmpDir, f.Name())
+	}
+	st, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size() != size {
+		t.Errorf("expected size %d, got %d", st.Size(), size)
+	}
+	if got := readGzip(t, body); got != string(raw) {
+		t.Errorf("unexpected content: %q", got)
+	}
+	if err := body.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected the temporary file removed, got %v", err)
+	}
+}
+
+func TestLoadFileGzInMemory(t *testing.T) {
+	// the threshold is applied to the compressed size, not the file size
+	dir := t.TempDir()
+	content := strings.Repeat("a", 1024*1024)
+	s3movertest.WriteFile(t, dir, "large.txt", []byte(content))
+	body, size, _, err := s3mover.LoadFile(filepath.Join(dir, "large.txt"), true, 6, 64*1024, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if _, ok := body.(interface{ Name() string }); ok {
+		t.Errorf("expected the compressed content kept in memory, got %T", body)
+	}
+	if size >= 64*1024 {
+		t.Errorf("expected size less than 64KiB, got %d", size)
+	}
+	if got := readGzip(t, body); got != content {
+		t.Errorf("unexpected content length %d", len(got))
+	}
+}
+
+func TestLoadFileGzHeader(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2024, 6, 1, 12, 34, 56, 0, time.UTC)
+	// the header must be set on each use of the pooled gzip writers
+	for _, name := range []string{"foo.txt", "bar.txt", "日本語.txt"} {
+		s3movertest.WriteFile(t, dir, name, []byte(name))
+		path := filepath.Join(dir, name)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		body, _, _, err := s3mover.LoadFile(path, true, 6, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := name
+		if name == "日本語.txt" {
+			expected = "" // not representable in Latin-1
+		}
+		if gr.Name != expected {
+			t.Errorf("unexpected name in the header: %q expected %q", gr.Name, expected)
+		}
+		if !gr.ModTime.Equal(mtime) {
+			t.Errorf("unexpected mtime in the header of %s: %s", name, gr.ModTime)
+		}
+		body.Close()
+		mtime = mtime.Add(time.Hour)
+	}
+}
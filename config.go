@@ -2,8 +2,15 @@ package s3mover
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	slogcontext "github.com/PumpkinSeed/slog-context"
 	"github.com/mattn/go-isatty"
@@ -18,41 +25,790 @@ type Config struct {
 	Gzip            bool
 	GzipLevel       int
 	TimeFormat      string
+	// Timezone is the time zone set by SetTimezone, instead of the local time zone, if not empty.
+	Timezone string
+	// KeyName is the template of the names of the objects with KeyVarName, KeyVarExt and KeyVarContentHash
+	// (e.g. "{name}-{content_hash}{ext}"), instead of the names of the files, if not empty.
+	KeyName string
+	// NormalizeName are the normalizations of the names of the files into the keys, such as NormalizeNFC.
+	NormalizeName []string
+	// LongKeyPolicy is applied to the keys longer than MaxKeyLength, LongKeyError by default.
+	LongKeyPolicy string
+	// TimeRound rounds down the time of the keys to the boundaries of the duration in the local time, if not zero.
+	TimeRound       time.Duration
+	SQSQueueURL     string
+	PathsFrom       string
+	IngestToken     string
+	GRPCListen      string
+	Schedule        string
+	BandwidthLimit  int64
+	KeepAfterUpload time.Duration
+	JournalPath     string
+	Mirror          bool
+	RevisionSuffix  bool
+	AuditLogPath    string
+	FallbackBucket  string
+	FallbackRegion  string
+	FallbackAfter   time.Duration
+	Destinations    []string
+	DoneMarker      string
+
+	// Observe scans the files and reports them as they would be uploaded by the metrics, with neither uploading nor removing them.
+	Observe bool
+
+	// Paranoid refuses to remove the local files unless the bucket has the versioning or the replication enabled at startup.
+	Paranoid bool
+
+	// PreserveAttrs stores the owner, the mode and the mtime of the files as the object metadata.
+	PreserveAttrs bool
+	// PreserveXattrs are the names of the extended attributes stored as the object metadata.
+	PreserveXattrs []string
+
+	// BufferMaxFiles, BufferMaxBytes, and BufferMaxAge hold the files in the source directory until
+	// the number of files, the total size, or the age of the oldest file reaches them, whichever first. 0 disables each.
+	BufferMaxFiles int64
+	BufferMaxBytes int64
+	BufferMaxAge   time.Duration
+
+	// Owners and OwnerGroups select the files owned by the users and the groups, by the names or the numeric IDs.
+	Owners      []string
+	OwnerGroups []string
+	// RequiredMode selects the files having all the permission bits in octal. e.g. "0040"
+	RequiredMode string
+
+	// User and Group are the user and the group to run as after opening the listeners. Group defaults to the primary group of User.
+	User  string
+	Group string
+
+	// UseFIPSEndpoint uses the FIPS endpoints of the AWS APIs.
+	UseFIPSEndpoint bool
+	// S3Endpoint overrides the endpoint of the S3 API of Bucket, such as a proxy validating the uploads.
+	// Bucket may be an access point ARN, and the requests are signed for the region of the ARN.
+	S3Endpoint string
+	// CABundle is the path of the PEM file of the CA certificates added to trust, e.g. of the TLS interception proxy.
+	CABundle string
+	// ClientCert and ClientKey are the paths of the PEM files of the TLS client certificate and its key.
+	ClientCert string
+	ClientKey  string
+
+	// Profile is the name of the profile of the shared configurations, including the SSO profiles.
+	Profile string
+	// CheckIdentity checks the identity of the credentials by STS GetCallerIdentity at startup.
+	CheckIdentity bool
+	// IMDSDisabled disables the EC2 instance metadata service, not to wait for it outside of EC2.
+	IMDSDisabled bool
+	// IMDSDisableV1Fallback disables the fallback to IMDSv1 when the IMDSv2 token can't be retrieved,
+	// e.g. dropped by the hop limit in containers.
+	IMDSDisableV1Fallback bool
+	// IMDSEndpoint overrides the endpoint of the instance metadata service.
+	IMDSEndpoint string
+	// IMDSTimeout is the timeout of each request to the instance metadata service. 0 means the SDK default.
+	IMDSTimeout time.Duration
+
+	// MaxInMemoryCompressSize is the max size of compressed content kept in memory.
+	// Larger content is written into a temporary file in TempDir. 0 means unlimited.
+	MaxInMemoryCompressSize int64
+	// TempDir is the directory for temporary files. Empty means the OS default.
+	TempDir string
+
+	// Compress is the compression codec of the files, such as CompressGzip. Gzip is the same as CompressGzip.
+	// CompressAuto selects the codec of each file by CompressMap and DefaultCompressMap.
+	Compress    string
+	CompressMap []string
+
+	// GzipSuffix is appended to the object names with Gzip, DefaultGzipSuffix if empty, or nothing with GzipSuffixNone.
+	// GzipReplaceExt replaces the extension of the names by GzipSuffix instead of appending it.
+	GzipSuffix     string
+	GzipReplaceExt bool
+
+	// StageDir copies each file into the directory and fsyncs it before uploading, and uploads the copy.
+	// It protects against the sources returning short data without an error, such as NFS and FUSE.
+	StageDir string
+
+	// ResumeJournalPath is the path of the journal of the uploads in progress, replayed on startup
+	// to resume the multipart uploads and to remove the files uploaded but not removed by the previous run.
+	ResumeJournalPath string
+
+	// MultipartThreshold is the size of files uploaded by multipart uploads. 0 disables multipart uploads.
+	MultipartThreshold   int64
+	MultipartPartSize    int64
+	MultipartConcurrency int
+
+	Convert       string
+	ConvertInput  string
+	ParquetSchema string
+
+	ValidateRecords string
+	CSVColumns      int
+	JSONSchemaPath  string
+
+	Recursive          bool
+	PreservePath       bool
+	PreservePathLayout string
+
+	// Shards moves the files discovered in SrcDir into the number of the subdirectories of ShardDirName
+	// hashed by the names, to keep the directories small, if not zero.
+	Shards int
+
+	// TenantMaxParallels and TenantBandwidthLimit limit the uploads of each top-level subdirectory (tenant)
+	// in the recursive mode. 0 means unlimited.
+	TenantMaxParallels   int64
+	TenantBandwidthLimit int64
+
+	// HighPriority are the glob patterns of the files uploaded before the others.
+	// A pattern matches the relative path from SrcDir or the file name.
+	HighPriority []string
+
+	// BatchManifestPrefix puts the CSV manifests of S3 Batch Operations of the uploaded objects of each day
+	// under the prefix in the bucket, if not empty.
+	BatchManifestPrefix string
+
+	// HeartbeatInterval puts the heartbeat object to HeartbeatKey in the bucket periodically, if not zero.
+	HeartbeatInterval time.Duration
+	HeartbeatKey      string
+
+	// AbortStaleUploadsAfter aborts the incomplete multipart uploads under the key prefix initiated before the duration,
+	// every AbortStaleUploadsInterval (DefaultAbortStaleUploadsInterval if zero), if not zero.
+	AbortStaleUploadsAfter    time.Duration
+	AbortStaleUploadsInterval time.Duration
+
+	CircuitBreakerThreshold int64
+	CircuitBreakerCooldown  time.Duration
+
+	// UploadTimeout is the timeout of each upload request (PutObject or UploadPart), if not zero.
+	UploadTimeout time.Duration
+
+	// AdaptiveLatency and AdaptiveErrorRate reduce the parallelism or pause uploading while the average latency
+	// or the error rate of the upload requests exceeds them. 0 disables each.
+	AdaptiveLatency   time.Duration
+	AdaptiveErrorRate float64
+
+	// DuplicateWindow suppresses the uploads of the files of the same name, size and modification time
+	// uploaded within the duration, remembering DuplicateCacheSize (DefaultDuplicateCacheSize if zero) files, if not zero.
+	DuplicateWindow    time.Duration
+	DuplicateCacheSize int
+
+	// RetryBudget limits the ratio of the retries to the requests of S3, and RetryBudgetBackoff stops uploading
+	// for the duration (DefaultRetryBudgetBackoff if zero) when it is exhausted. 0 disables.
+	RetryBudget        float64
+	RetryBudgetBackoff time.Duration
+
+	// Sidecar reads the sidecar (<name>.meta.json) of each file as the metadata, the tags and the content type
+	// of the object, and removes it with the file.
+	Sidecar bool
+
+	// KeyDirective is the prefix of the first line of the files to specify the key of the object.
+	// The key under the prefix follows it, or the exact key if it starts with a slash. The line is not uploaded.
+	KeyDirective string
+
+	// MaxSpoolBytes is the budget of the total size of the files in the source directory. 0 disables it.
+	// SpoolOverflowPolicy is applied while the spool exceeds it.
+	MaxSpoolBytes       int64
+	SpoolOverflowPolicy string
+
+	// DedupeOnStartup checks whether the objects of the files left by the previous run already exist
+	// before uploading them, and removes (or keeps) the files without uploading again if they exist.
+	DedupeOnStartup bool
+
+	// ContentHash stores the SHA-256 of the content of each file in the object metadata and the journal.
+	// A file of the same content as recorded in the journal at the path is not uploaded again.
+	ContentHash bool
+
+	PermanentErrorPolicy string
+	DeadLetterDir        string
+
+	// LocalErrorPolicy is applied to the files failed to read LocalErrorRetries times consecutively,
+	// such as by permission denied or I/O errors.
+	LocalErrorPolicy  string
+	LocalErrorRetries int
+
+	// LockedRetries is the number of the retries of a file locked by another process, waiting LockedRetryWait
+	// doubled by each retry, before leaving it for the next scan. The locks are not counted as errors.
+	LockedRetries   int
+	LockedRetryWait time.Duration
+
+	// FailFast are the classes of the errors to stop the agent immediately, such as FailFastAuth.
+	FailFast []string
+
+	EmptyFilePolicy     string
+	MaxFileSize         int64
+	OversizedFilePolicy string
+
+	// DeleteStrategy is how the uploaded files are deleted from SrcDir, DeleteUnlink by default.
+	// DeleteRules are "pattern=strategy" overriding it for the files matching the glob pattern
+	// of the relative path from SrcDir or the file name. The first matching rule is applied.
+	// DeleteArchiveDir is the directory the files are moved to by DeleteRename.
+	DeleteStrategy   string
+	DeleteRules      []string
+	DeleteArchiveDir string
+
+	// TruncatePolicy is applied to the files truncated after the discovery, such as by copytruncate of logrotate,
+	// TruncateSkip by default.
+	TruncatePolicy string
+
+	// MissingSrcPolicy is applied when the source directory disappears at runtime, such as by unmounting.
+	MissingSrcPolicy string
+
+	AlertWebhookURL         string
+	AlertWebhookFormat      string
+	AlertQueuedThreshold    int64
+	AlertOldestAgeThreshold time.Duration
+	AlertErrorsThreshold    int64
+	AlertStaleThreshold     time.Duration
+	AlertCooldown           time.Duration
+
+	SentryDSN            string
+	SentryEnvironment    string
+	SentryErrorThreshold int
+
+	// LogAttrs are the extra attributes added to every log record. See SetLoggerWithAttrs.
+	LogAttrs map[string]string
+
+	// LogSummaryInterval logs a summary of the uploads at the interval, and the log of each upload is lowered to debug.
+	LogSummaryInterval time.Duration
+
+	// AuditShutdown records the summary of the run to the audit log at the shutdown.
+	AuditShutdown bool
+
+	// GRPCMaxMessageSize is the maximum size of a request message accepted by the gRPC server.
+	GRPCMaxMessageSize int
+
+	FaultErrorRate float64
+	FaultErrorCode string
+	FaultLatency   time.Duration
 }
 
 const DefaultGzipLevel = 6
 
+// Validate validates the configurations and sets the defaults. It returns *ValidationError with all the problems found.
 func (c *Config) Validate() error {
+	var errs []error
 	if c.Bucket == "" {
-		return errors.New("bucket is required")
+		errs = append(errs, errors.New("bucket is required"))
+	}
+	if err := validateAccessPoint(c.Bucket); err != nil {
+		errs = append(errs, err)
+	}
+	if c.S3Endpoint != "" {
+		if u, err := url.Parse(c.S3Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid s3-endpoint %s: must be http(s)://host[:port]", c.S3Endpoint))
+		}
 	}
 	if c.KeyPrefix == "" {
-		return errors.New("prefix is required")
+		errs = append(errs, errors.New("prefix is required"))
 	}
 	if c.SrcDir == "" {
-		return errors.New("src is required")
+		errs = append(errs, errors.New("src is required"))
+	}
+	if c.MaxParallels < 0 {
+		errs = append(errs, errors.New("parallels must not be negative"))
+	}
+	if c.StatsServerPort < 0 || c.StatsServerPort > 65535 {
+		errs = append(errs, fmt.Errorf("port %d must be between 0 and 65535", c.StatsServerPort))
+	}
+	if c.GRPCListen != "" {
+		if err := validateListenAddress(c.GRPCListen); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateKeyVars(c.KeyPrefix); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTimeFormat(c.TimeFormat); err != nil {
+		errs = append(errs, err)
+	}
+	if c.KeyName != "" {
+		if err := validateKeyName(c.KeyName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.validateShards(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateParanoid(); err != nil {
+		errs = append(errs, err)
 	}
-	if c.Gzip {
+	if err := c.validateObserve(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateNormalizeName(c.NormalizeName); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.LongKeyPolicy {
+	case "":
+		c.LongKeyPolicy = LongKeyError
+	case LongKeyError, LongKeyTruncate, LongKeyHash:
+	default:
+		errs = append(errs, fmt.Errorf("long key policy must be %s, %s or %s", LongKeyError, LongKeyTruncate, LongKeyHash))
+	}
+	if c.IMDSDisabled && (c.IMDSEndpoint != "" || c.IMDSDisableV1Fallback || c.IMDSTimeout > 0) {
+		errs = append(errs, errors.New("imds-disabled can't be used with the other imds options"))
+	}
+	switch c.Compress {
+	case "":
+		if c.Gzip {
+			c.Compress = CompressGzip
+		}
+	case CompressGzip:
+		c.Gzip = true
+	case CompressLZ4, CompressSnappy, CompressAuto:
+		if c.Gzip {
+			errs = append(errs, fmt.Errorf("gzip and compress %s are exclusive", c.Compress))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("compress must be %s, %s, %s or %s", CompressGzip, CompressLZ4, CompressSnappy, CompressAuto))
+	}
+	if err := validateCompressMap(c.CompressMap); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.CompressMap) > 0 && c.Compress != CompressAuto {
+		errs = append(errs, errors.New("compress-map requires compress auto"))
+	}
+	if c.Compress == CompressAuto && c.GzipSuffix == GzipSuffixNone {
+		errs = append(errs, errors.New("gzip-suffix none can't be used with compress auto. the codecs are told by the suffixes"))
+	}
+	if c.Gzip || c.Compress == CompressAuto {
 		if c.GzipLevel == 0 {
 			c.GzipLevel = DefaultGzipLevel
 		}
 		if c.GzipLevel < 1 || c.GzipLevel > 9 {
-			return errors.New("gzip level must be between 1 and 9")
+			errs = append(errs, errors.New("gzip level must be between 1 and 9"))
+		}
+		switch {
+		case c.GzipSuffix == "":
+			c.GzipSuffix = DefaultGzipSuffix
+		case c.GzipSuffix == GzipSuffixNone:
+			if c.GzipReplaceExt {
+				errs = append(errs, errors.New("gzip-replace-ext requires a gzip suffix"))
+			}
+		case !strings.HasPrefix(c.GzipSuffix, ".") || strings.Contains(c.GzipSuffix, "/"):
+			errs = append(errs, fmt.Errorf("gzip suffix %q must start with . and must not contain /", c.GzipSuffix))
+		}
+	}
+	if c.AlertWebhookURL != "" {
+		switch c.AlertWebhookFormat {
+		case "":
+			c.AlertWebhookFormat = AlertFormatGeneric
+		case AlertFormatGeneric, AlertFormatSlack:
+		default:
+			errs = append(errs, fmt.Errorf("alert format must be %s or %s", AlertFormatGeneric, AlertFormatSlack))
+		}
+		if c.AlertCooldown == 0 {
+			c.AlertCooldown = DefaultAlertCooldown
+		}
+	}
+	if c.MaxSpoolBytes < 0 {
+		errs = append(errs, errors.New("max spool bytes must not be negative"))
+	}
+	if c.MaxSpoolBytes > 0 && (c.SQSQueueURL != "" || c.PathsFrom != "") {
+		errs = append(errs, errors.New("max-spool-bytes can't be used with sqs-queue-url or paths-from"))
+	}
+	switch c.SpoolOverflowPolicy {
+	case "":
+		c.SpoolOverflowPolicy = SpoolOverflowDrain
+	case SpoolOverflowDrain, SpoolOverflowReject, SpoolOverflowRemoveNewest:
+	default:
+		errs = append(errs, fmt.Errorf("spool overflow policy must be %s, %s or %s", SpoolOverflowDrain, SpoolOverflowReject, SpoolOverflowRemoveNewest))
+	}
+	if c.DedupeOnStartup && len(c.Destinations) > 0 {
+		errs = append(errs, errors.New("dedupe-on-startup can't be used with destinations"))
+	}
+	if c.SQSQueueURL != "" && c.PathsFrom != "" {
+		errs = append(errs, errors.New("sqs-queue-url and paths-from are exclusive"))
+	}
+	if c.IngestToken != "" {
+		if c.StatsServerPort == 0 && c.GRPCListen == "" {
+			errs = append(errs, errors.New("ingest token requires stats server port or grpc listen address"))
+		}
+		if c.SQSQueueURL != "" || c.PathsFrom != "" {
+			errs = append(errs, errors.New("ingest token can't be used with sqs-queue-url or paths-from"))
+		}
+	}
+	if c.GRPCListen != "" && !strings.HasPrefix(c.GRPCListen, "unix:") && c.IngestToken == "" {
+		errs = append(errs, errors.New("grpc listen address requires ingest token except for a unix domain socket"))
+	}
+	if c.GRPCMaxMessageSize < 0 {
+		errs = append(errs, errors.New("grpc max message size must not be negative"))
+	}
+	if c.GRPCMaxMessageSize == 0 {
+		c.GRPCMaxMessageSize = DefaultGRPCMaxMessageSize
+	}
+	if c.AuditShutdown && c.AuditLogPath == "" {
+		errs = append(errs, errors.New("audit-log-shutdown requires audit-log"))
+	}
+	if c.KeepAfterUpload < 0 {
+		errs = append(errs, errors.New("keep after upload must not be negative"))
+	}
+	if c.FallbackBucket != "" && c.FallbackAfter <= 0 {
+		c.FallbackAfter = DefaultFallbackAfter
+	}
+	for _, s := range c.Destinations {
+		if _, err := ParseDestination(s, c.KeyPrefix); err != nil {
+			errs = append(errs, err)
+		}
+		if err := validateKeyVars(s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.LogSummaryInterval < 0 {
+		errs = append(errs, errors.New("log summary interval must not be negative"))
+	}
+	if c.HeartbeatInterval < 0 {
+		errs = append(errs, errors.New("heartbeat interval must not be negative"))
+	}
+	if c.HeartbeatInterval > 0 {
+		if c.HeartbeatKey == "" {
+			c.HeartbeatKey = DefaultHeartbeatKey
+		}
+		if err := validateKeyVars(c.HeartbeatKey); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	if c.AbortStaleUploadsAfter < 0 || c.AbortStaleUploadsInterval < 0 {
+		errs = append(errs, errors.New("abort stale uploads durations must not be negative"))
+	}
+	if c.AbortStaleUploadsAfter > 0 && c.AbortStaleUploadsInterval == 0 {
+		c.AbortStaleUploadsInterval = DefaultAbortStaleUploadsInterval
+	}
+	if c.CircuitBreakerThreshold > 0 && c.CircuitBreakerCooldown <= 0 {
+		c.CircuitBreakerCooldown = DefaultCircuitBreakerCooldown
+	}
+	switch c.PermanentErrorPolicy {
+	case "":
+		c.PermanentErrorPolicy = PermanentErrorRetry
+	case PermanentErrorRetry, PermanentErrorExit:
+	case PermanentErrorDeadLetter:
+		if c.DeadLetterDir == "" {
+			errs = append(errs, errors.New("dead-letter-dir is required for on-permanent-error dead-letter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("permanent error policy must be %s, %s or %s", PermanentErrorRetry, PermanentErrorDeadLetter, PermanentErrorExit))
+	}
+	switch c.LocalErrorPolicy {
+	case "":
+		c.LocalErrorPolicy = LocalErrorRetry
+	case LocalErrorRetry, LocalErrorSkip:
+	case LocalErrorDeadLetter:
+		if c.DeadLetterDir == "" {
+			errs = append(errs, errors.New("dead-letter-dir is required for on-local-error dead-letter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("local error policy must be %s, %s or %s", LocalErrorRetry, LocalErrorSkip, LocalErrorDeadLetter))
+	}
+	if c.LocalErrorRetries < 0 {
+		errs = append(errs, errors.New("local error retries must not be negative"))
+	}
+	if c.LocalErrorRetries == 0 {
+		c.LocalErrorRetries = DefaultLocalErrorRetries
+	}
+	if c.LockedRetries < 0 || c.LockedRetryWait < 0 {
+		errs = append(errs, errors.New("locked retries and retry wait must not be negative"))
+	}
+	if c.LockedRetries == 0 {
+		c.LockedRetries = DefaultLockedRetries
+	}
+	if c.LockedRetryWait == 0 {
+		c.LockedRetryWait = DefaultLockedRetryWait
+	}
+	for _, class := range c.FailFast {
+		if _, ok := failFastErrorCodes[class]; !ok {
+			errs = append(errs, fmt.Errorf("fail-fast class must be %s, %s or %s", FailFastAuth, FailFastPermission, FailFastBucket))
+		}
+	}
+	switch c.Convert {
+	case "":
+	case ConvertParquet:
+		if c.KeyDirective != "" {
+			errs = append(errs, errors.New("key-directive can't be used with convert"))
+		}
+		if c.Gzip || c.Compress != "" {
+			errs = append(errs, errors.New("compression and convert are exclusive. parquet is compressed by itself"))
+		}
+		if c.ParquetSchema == "" {
+			errs = append(errs, errors.New("parquet-schema is required to convert to parquet"))
+		}
+		if _, err := ParseParquetSchema(c.ParquetSchema); err != nil {
+			errs = append(errs, err)
+		}
+		switch c.ConvertInput {
+		case "":
+			c.ConvertInput = ConvertInputAuto
+		case ConvertInputAuto, ConvertInputJSONL, ConvertInputCSV:
+		default:
+			errs = append(errs, fmt.Errorf("convert input must be %s, %s or %s", ConvertInputAuto, ConvertInputJSONL, ConvertInputCSV))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("convert must be %s", ConvertParquet))
+	}
+	switch c.ValidateRecords {
+	case "":
+		if c.JSONSchemaPath != "" || c.CSVColumns != 0 {
+			errs = append(errs, errors.New("json-schema and csv-columns require validate-records"))
+		}
+	case ConvertInputAuto, ConvertInputJSONL, ConvertInputCSV:
+		if c.DeadLetterDir == "" {
+			errs = append(errs, errors.New("dead-letter-dir is required to validate records"))
+		}
+		if c.CSVColumns < 0 {
+			errs = append(errs, errors.New("csv columns must not be negative"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("validate records must be %s, %s or %s", ConvertInputAuto, ConvertInputJSONL, ConvertInputCSV))
+	}
+	switch c.PreservePathLayout {
+	case "":
+		c.PreservePathLayout = PathLayoutTimeDir
+	case PathLayoutTimeDir, PathLayoutDirTime:
+	default:
+		errs = append(errs, fmt.Errorf("preserve path layout must be %s or %s", PathLayoutTimeDir, PathLayoutDirTime))
+	}
+	if c.PreservePath && !c.Recursive {
+		errs = append(errs, errors.New("preserve-path requires recursive"))
+	}
+	if err := c.validateDeleteStrategies(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Recursive && c.DeadLetterDir != "" {
+		if rel, err := filepath.Rel(c.SrcDir, c.DeadLetterDir); err == nil && !strings.HasPrefix(rel, "..") {
+			errs = append(errs, errors.New("dead-letter-dir must not be in src when recursive"))
+		}
+	}
+	switch c.EmptyFilePolicy {
+	case "":
+		c.EmptyFilePolicy = FilePolicyUpload
+	case FilePolicyUpload, FilePolicySkip, FilePolicyDelete:
+	default:
+		errs = append(errs, fmt.Errorf("empty file policy must be %s, %s or %s", FilePolicyUpload, FilePolicySkip, FilePolicyDelete))
+	}
+	switch c.OversizedFilePolicy {
+	case "":
+		c.OversizedFilePolicy = FilePolicySkip
+	case FilePolicySkip, FilePolicyMultipart:
+	case FilePolicyDeadLetter:
+		if c.DeadLetterDir == "" {
+			errs = append(errs, errors.New("dead-letter-dir is required for oversized-file dead-letter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("oversized file policy must be %s, %s or %s", FilePolicySkip, FilePolicyMultipart, FilePolicyDeadLetter))
+	}
+	switch c.TruncatePolicy {
+	case "":
+		c.TruncatePolicy = TruncateSkip
+	case TruncateSkip, TruncateUpload:
+	default:
+		errs = append(errs, fmt.Errorf("truncate policy must be %s or %s", TruncateSkip, TruncateUpload))
+	}
+	switch c.MissingSrcPolicy {
+	case "":
+		c.MissingSrcPolicy = MissingSrcWait
+	case MissingSrcWait, MissingSrcExit:
+	default:
+		errs = append(errs, fmt.Errorf("missing src policy must be %s or %s", MissingSrcWait, MissingSrcExit))
+	}
+	if c.MaxInMemoryCompressSize < 0 {
+		errs = append(errs, errors.New("max in-memory compress size must not be negative"))
+	}
+	if err := validatePriorityPatterns(c.HighPriority); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.DoneMarker {
+	case "", DoneMarkerObject, DoneMarkerBatch:
+	default:
+		errs = append(errs, fmt.Errorf("done marker must be %s or %s", DoneMarkerObject, DoneMarkerBatch))
+	}
+	if c.MultipartThreshold < 0 {
+		errs = append(errs, errors.New("multipart threshold must not be negative"))
+	}
+	if c.MultipartThreshold > 0 || c.OversizedFilePolicy == FilePolicyMultipart {
+		if c.MultipartPartSize == 0 {
+			c.MultipartPartSize = DefaultMultipartPartSize
+		}
+		if c.MultipartPartSize < MinMultipartPartSize {
+			errs = append(errs, fmt.Errorf("multipart part size must be at least %d bytes", MinMultipartPartSize))
+		}
+		if c.MultipartConcurrency == 0 {
+			c.MultipartConcurrency = DefaultMultipartConcurrency
+		}
+		if c.MultipartConcurrency < 0 {
+			errs = append(errs, errors.New("multipart concurrency must be positive"))
+		}
+	}
+	if c.TempDir != "" {
+		if st, err := os.Stat(c.TempDir); err != nil {
+			errs = append(errs, fmt.Errorf("invalid temp-dir: %w", err))
+		} else if !st.IsDir() {
+			errs = append(errs, fmt.Errorf("temp-dir %s is not a directory", c.TempDir))
+		}
+	}
+	if c.StageDir != "" {
+		if rel, err := filepath.Rel(c.SrcDir, c.StageDir); err == nil && (rel == "." || (c.Recursive && !strings.HasPrefix(rel, ".."))) {
+			errs = append(errs, errors.New("stage-dir must not be src, or in src when recursive"))
+		}
+	}
+	if c.ResumeJournalPath != "" {
+		journal := c.JournalPath
+		if journal == "" {
+			journal = filepath.Join(c.SrcDir, DefaultJournalName)
+		}
+		if filepath.Clean(c.ResumeJournalPath) == filepath.Clean(journal) {
+			errs = append(errs, errors.New("resume-journal must not be the same as journal"))
+		}
+	}
+	if c.TimeRound < 0 || c.TimeRound > 24*time.Hour || (c.TimeRound > 0 && (24*time.Hour)%c.TimeRound != 0) {
+		errs = append(errs, fmt.Errorf("time-round %s must divide 24h", c.TimeRound))
+	}
+	if c.UploadTimeout < 0 {
+		errs = append(errs, errors.New("upload timeout must not be negative"))
+	}
+	if c.AdaptiveLatency < 0 {
+		errs = append(errs, errors.New("adaptive latency must not be negative"))
+	}
+	if c.AdaptiveErrorRate < 0 || c.AdaptiveErrorRate > 1 {
+		errs = append(errs, errors.New("adaptive error rate must be between 0 and 1"))
+	}
+	if c.RetryBudget < 0 || c.RetryBudget > 1 {
+		errs = append(errs, errors.New("retry budget must be between 0 and 1"))
+	}
+	if c.RetryBudgetBackoff < 0 {
+		errs = append(errs, errors.New("retry budget backoff must not be negative"))
+	}
+	if c.RetryBudget > 0 && c.RetryBudgetBackoff == 0 {
+		c.RetryBudgetBackoff = DefaultRetryBudgetBackoff
+	}
+	if c.BufferMaxFiles < 0 || c.BufferMaxBytes < 0 || c.BufferMaxAge < 0 {
+		errs = append(errs, errors.New("buffer conditions must not be negative"))
+	}
+	if _, err := newOwnershipFilter(c); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Group != "" && c.User == "" {
+		errs = append(errs, errors.New("group requires user"))
+	}
+	if c.User != "" {
+		if _, err := lookupCredential(c.User, c.Group); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.validateTLS(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.MaxFileSize < 0 {
+		errs = append(errs, errors.New("max file size must not be negative"))
+	}
+	if c.Mirror && c.KeepAfterUpload > 0 {
+		errs = append(errs, errors.New("mirror and keep-after-upload are exclusive"))
+	}
+	if c.DuplicateWindow < 0 || c.DuplicateCacheSize < 0 {
+		errs = append(errs, errors.New("duplicate window and cache size must not be negative"))
+	}
+	if c.DuplicateWindow > 0 {
+		if c.Mirror || c.KeepAfterUpload > 0 {
+			errs = append(errs, errors.New("duplicate-window can't be used with mirror and keep-after-upload, which never upload the same files again"))
+		}
+		if c.DuplicateCacheSize == 0 {
+			c.DuplicateCacheSize = DefaultDuplicateCacheSize
+		}
+	}
+	if c.RevisionSuffix && !c.Mirror {
+		errs = append(errs, errors.New("revision-suffix requires mirror"))
+	}
+	if c.BandwidthLimit < 0 {
+		errs = append(errs, errors.New("bandwidth limit must not be negative"))
+	}
+	if c.TenantMaxParallels < 0 || c.TenantBandwidthLimit < 0 {
+		errs = append(errs, errors.New("tenant quotas must not be negative"))
+	}
+	if (c.TenantMaxParallels > 0 || c.TenantBandwidthLimit > 0) && !c.Recursive {
+		errs = append(errs, errors.New("tenant quotas require recursive"))
+	}
+	if _, err := ParseSchedule(c.Schedule); err != nil {
+		errs = append(errs, err)
+	}
+	if c.FaultErrorRate < 0 || c.FaultErrorRate > 1 {
+		errs = append(errs, errors.New("fault error rate must be between 0 and 1"))
+	}
+	if c.FaultErrorCode == "" {
+		c.FaultErrorCode = DefaultFaultErrorCode
+	}
+	if c.SentryDSN != "" && c.SentryErrorThreshold <= 0 {
+		c.SentryErrorThreshold = DefaultSentryErrorThreshold
+	}
+	return newValidationError(errs)
+}
+
+// RedactedValue replaces the sensitive values of the configurations.
+const RedactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the configurations with the sensitive values such as tokens and webhook URLs replaced by RedactedValue.
+func (c *Config) Redacted() *Config {
+	r := *c
+	for _, v := range []*string{&r.IngestToken, &r.SentryDSN, &r.AlertWebhookURL} {
+		if *v != "" {
+			*v = RedactedValue
+		}
+	}
+	return &r
+}
+
+// redactedConfig is Config without LogValue, not to be resolved recursively.
+type redactedConfig Config
+
+// LogValue implements slog.LogValuer to log the configurations redacted.
+func (c *Config) LogValue() slog.Value {
+	return slog.AnyValue((*redactedConfig)(c.Redacted()))
 }
 
 func SetLogger(debug bool) {
+	SetLoggerWithOutput(debug, os.Stdout)
+}
+
+// SetLoggerWithOutput sets the default logger that writes to w.
+func SetLoggerWithOutput(debug bool, w *os.File) {
+	SetLoggerWithAttrs(debug, w, nil)
+}
+
+// ParseLogAttrs parses the extra log attributes such as "service=foo,env=prod".
+func ParseLogAttrs(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	if s == "" {
+		return attrs, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid log attribute %q. must be key=value", kv)
+		}
+		attrs[k] = strings.TrimSpace(v)
+	}
+	return attrs, nil
+}
+
+// SetLoggerWithAttrs sets the default logger that writes to w with the extra attributes in every record.
+// The recent records are also kept for the support bundle.
+func SetLoggerWithAttrs(debug bool, w *os.File, attrs map[string]string) {
 	var h slog.Handler
 	logLevel := slog.LevelInfo
 	if debug {
 		logLevel = slog.LevelDebug
 	}
-	if isatty.IsTerminal(os.Stdout.Fd()) {
-		h = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})
+	out := io.MultiWriter(w, recentLogs)
+	if isatty.IsTerminal(w.Fd()) {
+		h = slog.NewTextHandler(out, &slog.HandlerOptions{Level: logLevel})
 	} else {
-		h = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})
+		h = slog.NewJSONHandler(out, &slog.HandlerOptions{Level: logLevel})
+	}
+	if len(attrs) > 0 {
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		as := make([]slog.Attr, 0, len(keys))
+		for _, k := range keys {
+			as = append(as, slog.String(k, attrs[k]))
+		}
+		h = h.WithAttrs(as)
 	}
 	slog.SetDefault(slog.New(slogcontext.NewHandler(h)))
 }
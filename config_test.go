@@ -0,0 +1,157 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+var secretConfig = &s3mover.Config{
+	SrcDir:          ".",
+	Bucket:          "testbucket",
+	KeyPrefix:       "test/config",
+	IngestToken:     "secret-token",
+	SentryDSN:       "https://secret@sentry.example.com/1",
+	AlertWebhookURL: "https://hooks.slack.com/services/secret",
+}
+
+func TestConfigRedacted(t *testing.T) {
+	r := secretConfig.Redacted()
+	if r.IngestToken != s3mover.RedactedValue || r.SentryDSN != s3mover.RedactedValue || r.AlertWebhookURL != s3mover.RedactedValue {
+		t.Errorf("secrets must be redacted: %+v", r)
+	}
+	if r.Bucket != "testbucket" {
+		t.Errorf("unexpected bucket: %s", r.Bucket)
+	}
+	if secretConfig.IngestToken != "secret-token" {
+		t.Error("the original must not be modified")
+	}
+	if (&s3mover.Config{}).Redacted().IngestToken != "" {
+		t.Error("empty values must be kept empty")
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("configurations loaded", "config", secretConfig)
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), s3mover.RedactedValue) {
+		t.Errorf("secrets must not be logged: %s", buf.String())
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	tr, err := s3mover.New(context.Background(), secretConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	tr.ConfigHandler()(w, httptest.NewRequest("GET", "/stats/config", nil))
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("secrets must not be served: %s", w.Body.String())
+	}
+	var c s3mover.Config
+	if err := json.NewDecoder(w.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Bucket != "testbucket" || c.IngestToken != s3mover.RedactedValue {
+		t.Errorf("unexpected config: %+v", c)
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("users are not supported on windows")
+	}
+	for _, c := range []struct {
+		user, group string
+		expected    string
+	}{
+		{"root", "", ""},
+		{"0", "0", ""},
+		{"", "root", "group requires user"},
+		{"s3mover-no-such-user", "", "unknown user"},
+		{"root", "s3mover-no-such-group", "unknown group"},
+	} {
+		config := &s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/user", User: c.user, Group: c.group}
+		err := config.Validate()
+		if c.expected == "" && err != nil {
+			t.Errorf("%s:%s: unexpected error %s", c.user, c.group, err)
+		} else if c.expected != "" && (err == nil || !strings.Contains(err.Error(), c.expected)) {
+			t.Errorf("%s:%s: expected error %q, got %v", c.user, c.group, c.expected, err)
+		}
+	}
+}
+
+func TestValidateAggregate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:          ".",
+		KeyPrefix:       "logs/{hostname",
+		TimeFormat:      "%Y/%m/%d",
+		Compress:        "zstd",
+		StatsServerPort: 65536,
+	}
+	err := config.Validate()
+	var ve *s3mover.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"bucket is required",
+		"port 65536 must be between 0 and 65535",
+		"unbalanced or invalid key variable",
+		"has no element of the time",
+		"compress must be",
+	}
+	if len(ve.Problems) != len(expected) {
+		t.Fatalf("unexpected problems: %v", ve.Problems)
+	}
+	for i, s := range expected {
+		if !strings.Contains(ve.Problems[i].Error(), s) {
+			t.Errorf("problem %d: expected %q, got %v", i, s, ve.Problems[i])
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "5 problems in the configurations: bucket is required; ") {
+		t.Errorf("unexpected message: %s", err)
+	}
+
+	// a single problem is reported as is
+	config = &s3mover.Config{SrcDir: ".", KeyPrefix: "test/config"}
+	if err := config.Validate(); err == nil || err.Error() != "bucket is required" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	for _, c := range []struct {
+		config s3mover.Config
+		ok     bool
+	}{
+		{s3mover.Config{TimeFormat: "2006/01/02/15"}, true},
+		{s3mover.Config{TimeFormat: "dt=2006-01-02/hour=15"}, true},
+		{s3mover.Config{TimeFormat: "yyyy/mm/dd"}, false},
+		{s3mover.Config{KeyPrefix: "logs/{hostname}/{pod_name}"}, true},
+		{s3mover.Config{KeyPrefix: "logs/{Hostname}"}, false},
+		{s3mover.Config{KeyPrefix: "logs/hostname}"}, false},
+		{s3mover.Config{IngestToken: "token", GRPCListen: "127.0.0.1:9899"}, true},
+		{s3mover.Config{GRPCListen: "unix:/var/run/s3mover.sock"}, true},
+		{s3mover.Config{IngestToken: "token", GRPCListen: "127.0.0.1"}, false},
+		{s3mover.Config{IngestToken: "token", GRPCListen: ":99999"}, false},
+		{s3mover.Config{GRPCListen: "unix:"}, false},
+		{s3mover.Config{StatsServerPort: -1}, false},
+		{s3mover.Config{MaxParallels: -1}, false},
+	} {
+		c.config.SrcDir, c.config.Bucket = ".", "testbucket"
+		if c.config.KeyPrefix == "" {
+			c.config.KeyPrefix = "test/config"
+		}
+		if err := c.config.Validate(); (err == nil) != c.ok {
+			t.Errorf("%+v: unexpected result: %v", c.config, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package s3mover
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ValidationError is returned by Config.Validate with all the problems of the configurations,
+// not only the first one, to fix them in one pass. errors.Is and errors.As test each problem.
+type ValidationError struct {
+	Problems []error
+}
+
+func newValidationError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: errs}
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Error()
+	}
+	msgs := make([]string, len(e.Problems))
+	for i, err := range e.Problems {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d problems in the configurations: %s", len(e.Problems), strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// validateTimeFormat checks that the time format of the keys is a layout of Go with any element of the time,
+// such as "2006/01/02/15". A format of the other languages like "%Y/%m/%d" puts all objects in the same prefix.
+func validateTimeFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	// all the elements differ
+	t1 := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	t2 := time.Date(2012, 11, 22, 16, 17, 18, 0, time.UTC)
+	if t1.Format(format) == t2.Format(format) {
+		return fmt.Errorf("time format %q has no element of the time. use the layout of Go such as %q", format, DefaultTimeFormat)
+	}
+	if _, err := time.Parse(format, t1.Format(format)); err != nil {
+		return fmt.Errorf("invalid time format %q: %w", format, err)
+	}
+	return nil
+}
+
+// validateListenAddress checks the host:port of the tcp listen address, or the path of the unix domain socket.
+func validateListenAddress(addr string) error {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return fmt.Errorf("listen address %s requires the path of the socket", addr)
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %s: %w", addr, err)
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return fmt.Errorf("invalid listen address %s: %w", addr, err)
+	}
+	return nil
+}
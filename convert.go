@@ -0,0 +1,291 @@
+package s3mover
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	// ConvertParquet converts the files to Parquet before uploading.
+	ConvertParquet = "parquet"
+
+	// ConvertInputAuto detects the input format by the file extension (.jsonl, .ndjson or .csv).
+	ConvertInputAuto = "auto"
+	// ConvertInputJSONL reads the files as newline-delimited JSON.
+	ConvertInputJSONL = "jsonl"
+	// ConvertInputCSV reads the files as CSV with a header row.
+	ConvertInputCSV = "csv"
+)
+
+// ParquetColumn represents a column of the Parquet schema.
+type ParquetColumn struct {
+	Name string
+	Type string // string, int64, double, boolean or timestamp
+}
+
+// ParseParquetSchema parses the Parquet schema such as "id:int64,name:string,time:timestamp".
+// All the columns are optional.
+func ParseParquetSchema(s string) ([]ParquetColumn, error) {
+	var columns []ParquetColumn
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(s, ",") {
+		name, typ, ok := strings.Cut(strings.TrimSpace(field), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid parquet column %q. must be name:type", field)
+		}
+		switch typ {
+		case "string", "int64", "double", "boolean", "timestamp":
+		default:
+			return nil, fmt.Errorf("unknown parquet type %q of %s", typ, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicated parquet column %s", name)
+		}
+		seen[name] = true
+		columns = append(columns, ParquetColumn{Name: name, Type: typ})
+	}
+	return columns, nil
+}
+
+// converter converts the JSONL or CSV files to Parquet.
+type converter struct {
+	input   string
+	schema  *parquet.Schema
+	columns map[string]int // name -> column index
+	types   []string       // column index -> type
+}
+
+func newConverter(input string, columns []ParquetColumn) *converter {
+	group := make(parquet.Group, len(columns))
+	for _, c := range columns {
+		var node parquet.Node
+		switch c.Type {
+		case "string":
+			node = parquet.String()
+		case "int64":
+			node = parquet.Int(64)
+		case "double":
+			node = parquet.Leaf(parquet.DoubleType)
+		case "boolean":
+			node = parquet.Leaf(parquet.BooleanType)
+		case "timestamp":
+			node = parquet.Timestamp(parquet.Millisecond)
+		}
+		group[c.Name] = parquet.Optional(node)
+	}
+	cv := &converter{
+		input:   input,
+		schema:  parquet.NewSchema("s3mover", group),
+		columns: make(map[string]int, len(columns)),
+	}
+	// the columns are ordered by name in the schema
+	for i, f := range cv.schema.Fields() {
+		cv.columns[f.Name()] = i
+		for _, c := range columns {
+			if c.Name == f.Name() {
+				cv.types = append(cv.types, c.Type)
+			}
+		}
+	}
+	return cv
+}
+
+// format returns the input format of the file, or an empty string if the file is not converted.
+func (cv *converter) format(path string) string {
+	if cv.input != ConvertInputAuto {
+		return cv.input
+	}
+	return detectRecordFormat(path)
+}
+
+// convert converts the file to Parquet.
+func (cv *converter) convert(path, format string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	w := parquet.NewWriter(&buf, cv.schema, parquet.Compression(&parquet.Snappy))
+	var rerr error
+	switch format {
+	case ConvertInputJSONL:
+		rerr = cv.readJSONL(f, w)
+	case ConvertInputCSV:
+		rerr = cv.readCSV(f, w)
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (cv *converter) readJSONL(r io.Reader, w *parquet.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxIngestSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			return &recordError{line: line, err: err}
+		}
+		row := make(parquet.Row, len(cv.types))
+		for i := range row {
+			row[i] = parquet.NullValue().Level(0, 0, i)
+		}
+		for name, v := range record {
+			i, ok := cv.columns[name]
+			if !ok || v == nil {
+				continue
+			}
+			pv, err := jsonValue(cv.types[i], v)
+			if err != nil {
+				return &recordError{line: line, err: fmt.Errorf("%s: %w", name, err)}
+			}
+			row[i] = pv.Level(0, 1, i)
+		}
+		if _, err := w.WriteRows([]parquet.Row{row}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (cv *converter) readCSV(r io.Reader, w *parquet.Writer) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return &recordError{line: 1, err: fmt.Errorf("failed to read header: %w", err)}
+	}
+	index := make([]int, len(header)) // field index -> column index
+	for i, name := range header {
+		if c, ok := cv.columns[strings.TrimSpace(name)]; ok {
+			index[i] = c
+		} else {
+			index[i] = -1
+		}
+	}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return &recordError{line: line, err: err}
+		}
+		row := make(parquet.Row, len(cv.types))
+		for i := range row {
+			row[i] = parquet.NullValue().Level(0, 0, i)
+		}
+		for i, s := range record {
+			c := index[i]
+			if c < 0 || (s == "" && cv.types[c] != "string") {
+				continue
+			}
+			pv, err := stringValue(cv.types[c], s)
+			if err != nil {
+				return &recordError{line: line, err: fmt.Errorf("%s: %w", header[i], err)}
+			}
+			row[c] = pv.Level(0, 1, c)
+		}
+		if _, err := w.WriteRows([]parquet.Row{row}); err != nil {
+			return err
+		}
+	}
+}
+
+func jsonValue(typ string, v any) (parquet.Value, error) {
+	switch v := v.(type) {
+	case string:
+		if typ == "string" || typ == "timestamp" {
+			return stringValue(typ, v)
+		}
+	case json.Number:
+		if typ == "string" {
+			return parquet.ByteArrayValue([]byte(v)), nil
+		}
+		if typ == "int64" || typ == "double" {
+			return stringValue(typ, v.String())
+		}
+	case bool:
+		if typ == "boolean" {
+			return parquet.BooleanValue(v), nil
+		}
+	}
+	return parquet.Value{}, fmt.Errorf("%v is not %s", v, typ)
+}
+
+func stringValue(typ, s string) (parquet.Value, error) {
+	switch typ {
+	case "string":
+		return parquet.ByteArrayValue([]byte(s)), nil
+	case "int64":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.Int64Value(n), nil
+	case "double":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.DoubleValue(f), nil
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.BooleanValue(b), nil
+	case "timestamp":
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.Int64Value(t.UnixMilli()), nil
+	}
+	return parquet.Value{}, fmt.Errorf("unknown type %s", typ)
+}
+
+// load loads the file as the body of the object named name, skipping the first offset bytes.
+// The file is converted and renamed by the conversion stage if configured.
+func (tr *Transporter) load(path, name string, offset int64) (io.ReadCloser, int64, time.Time, string, error) {
+	src := tr.staged.source(path)
+	if tr.converter != nil {
+		if format := tr.converter.format(path); format != "" {
+			st, err := os.Stat(src)
+			if err != nil {
+				return nil, 0, time.Time{}, "", err
+			}
+			b, err := tr.converter.convert(src, format)
+			if err != nil {
+				return nil, 0, time.Time{}, "", fmt.Errorf("failed to convert %s to parquet: %w", path, err)
+			}
+			name = strings.TrimSuffix(name, filepath.Ext(name)) + ".parquet"
+			return &bufferBody{Reader: bytes.NewReader(b), release: func() {}}, int64(len(b)), st.ModTime(), name, nil
+		}
+	}
+	body, length, ts, err := loadFile(src, offset, tr.codec(path), tr.config.GzipLevel, tr.config.MaxInMemoryCompressSize, tr.config.TempDir)
+	return body, length, ts, tr.gzipBaseName(path, name), err
+}
@@ -0,0 +1,102 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+	"github.com/parquet-go/parquet-go"
+)
+
+type testParquetRow struct {
+	ID    *int64   `parquet:"id,optional"`
+	Name  *string  `parquet:"name,optional"`
+	Score *float64 `parquet:"score,optional"`
+	OK    *bool    `parquet:"ok,optional"`
+}
+
+func TestConvertParquet(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.jsonl", []byte(`{"id":1,"name":"foo","score":1.5,"ok":true,"extra":"x"}
+{"id":2,"name":null}
+
+{"id":3}
+`))
+	s3movertest.WriteFile(t, dir, "bar.csv", []byte("name,id,ok\nbar,4,false\n,5,\n"))
+	s3movertest.WriteFile(t, dir, "raw.txt", []byte("raw"))
+	config := &s3mover.Config{
+		SrcDir:        dir,
+		Bucket:        "testbucket",
+		KeyPrefix:     "test/convert",
+		MaxParallels:  1,
+		Convert:       s3mover.ConvertParquet,
+		ParquetSchema: "id:int64,name:string,score:double,ok:boolean,time:timestamp",
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 3 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	rows := make(map[string][]testParquetRow)
+	for key, obj := range client.Objects {
+		name := filepath.Base(key)
+		if !strings.HasSuffix(name, ".parquet") {
+			if name != "raw.txt" {
+				t.Errorf("unexpected object %s", key)
+			}
+			continue
+		}
+		rs, err := parquet.Read[testParquetRow](bytes.NewReader(obj.Content), obj.Size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows[name] = rs
+	}
+	if rs := rows["foo.parquet"]; len(rs) != 3 || *rs[0].ID != 1 || *rs[0].Name != "foo" || *rs[0].Score != 1.5 || !*rs[0].OK || rs[1].Name != nil || rs[2].Score != nil {
+		t.Errorf("unexpected rows of foo: %+v", rs)
+	}
+	if rs := rows["bar.parquet"]; len(rs) != 2 || *rs[0].Name != "bar" || *rs[0].ID != 4 || *rs[0].OK || *rs[1].Name != "" || rs[1].OK != nil {
+		t.Errorf("unexpected rows of bar: %+v", rs)
+	}
+}
+
+func TestConvertParquetError(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	deadLetter := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.jsonl", []byte("{\"id\":1}\n{\"id\":\"x\"}\n"))
+	config := &s3mover.Config{
+		SrcDir:               dir,
+		Bucket:               "testbucket",
+		KeyPrefix:            "test/convert",
+		MaxParallels:         1,
+		Convert:              s3mover.ConvertParquet,
+		ParquetSchema:        "id:int64",
+		PermanentErrorPolicy: s3mover.PermanentErrorDeadLetter,
+		DeadLetterDir:        deadLetter,
+	}
+	tr, client := newTestTransporter(t, config)
+	tr.Flush(ctx)
+	if len(client.Objects) != 0 {
+		t.Errorf("must not be uploaded: %v", client.Keys())
+	}
+	if _, err := os.Stat(filepath.Join(deadLetter, "foo.jsonl")); err != nil {
+		t.Errorf("must be dead-lettered: %v", err)
+	}
+}
+
+func TestParseParquetSchema(t *testing.T) {
+	if _, err := s3mover.ParseParquetSchema("id:int64, name:string"); err != nil {
+		t.Error(err)
+	}
+	for _, s := range []string{"id", "id:int32", "id:int64,id:string", ":string"} {
+		if _, err := s3mover.ParseParquetSchema(s); err == nil {
+			t.Errorf("%s must be invalid", s)
+		}
+	}
+}
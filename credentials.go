@@ -0,0 +1,112 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/smithy-go"
+)
+
+// credentialErrorCodes are the error codes of the credentials expired or revoked while running.
+var credentialErrorCodes = map[string]bool{
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+	"InvalidToken":          true,
+	"TokenRefreshRequired":  true,
+	"RequestExpired":        true,
+}
+
+// credentialsError is the error of retrieving the credentials.
+type credentialsError struct {
+	err error
+}
+
+func (e *credentialsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.err
+}
+
+// isCredentialError reports whether the error is caused by the credentials, which may succeed with the fresh credentials.
+func isCredentialError(err error) bool {
+	var ce *credentialsError
+	if errors.As(err, &ce) {
+		return true
+	}
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		return credentialErrorCodes[ae.ErrorCode()]
+	}
+	return false
+}
+
+// loggingCredentials logs which provider of the default credential chain resolved the credentials,
+// and how long it took, since a slow IMDS makes the first requests time out with confusing errors.
+type loggingCredentials struct {
+	provider aws.CredentialsProvider
+	profile  string
+
+	mu      sync.Mutex
+	source  string
+	expires time.Time
+}
+
+// withCredentialsLogging wraps the credentials of the AWS configurations by loggingCredentials.
+func withCredentialsLogging(cfg aws.Config, profile string) aws.Config {
+	if cfg.Credentials != nil {
+		cfg.Credentials = &loggingCredentials{provider: cfg.Credentials, profile: profile}
+	}
+	return cfg
+}
+
+func (l *loggingCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	start := time.Now()
+	creds, err := l.provider.Retrieve(ctx)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		var te *ssocreds.InvalidTokenError
+		if errors.As(err, &te) {
+			err = fmt.Errorf("the SSO session has expired. run `aws sso login --profile %s`: %w", l.profile, err)
+		}
+		slog.WarnContext(ctx, "failed to retrieve credentials. see -imds-* flags if running in a container",
+			"elapsed", elapsed.String(), "error", err.Error())
+		return creds, &credentialsError{err: err}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the outer cache of the provider returns the same credentials until they expire
+	if creds.Source != l.source || !creds.Expires.Equal(l.expires) {
+		l.source, l.expires = creds.Source, creds.Expires
+		slog.InfoContext(ctx, "credentials retrieved", "provider", creds.Source, "elapsed", elapsed.String())
+	}
+	return creds, nil
+}
+
+// Invalidate invalidates the cached credentials to retrieve the fresh credentials by the next request.
+func (l *loggingCredentials) Invalidate() {
+	if c, ok := l.provider.(interface{ Invalidate() }); ok {
+		c.Invalidate()
+	}
+}
+
+// refreshCredentials invalidates the cached credentials of the client if the error is caused by the credentials,
+// and reports whether the request should be retried with the fresh credentials.
+func (tr *Transporter) refreshCredentials(ctx context.Context, credentials aws.CredentialsProvider, err error) bool {
+	if err == nil || !isCredentialError(err) {
+		return false
+	}
+	tr.metrics.CredentialError()
+	if c, ok := credentials.(interface{ Invalidate() }); ok {
+		c.Invalidate()
+	}
+	slog.WarnContext(ctx, "credentials error. retrying with the fresh credentials", "error", err.Error())
+	return true
+}
@@ -0,0 +1,83 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// expiringS3Client fails the first PutObject by the expired credentials.
+type expiringS3Client struct {
+	*s3movertest.MockS3Client
+	expired bool
+}
+
+func (c *expiringS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if !c.expired {
+		c.expired = true
+		return nil, &smithy.GenericAPIError{Code: "ExpiredToken", Message: "The provided token has expired."}
+	}
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/credentials",
+		MaxParallels: 1,
+	}
+	tr, _ := newTestTransporter(t, config)
+	client := &expiringS3Client{MockS3Client: s3movertest.NewMockS3Client()}
+	tr.SetS3Client(client)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 1 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	if len(client.Objects) != 1 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+	m := tr.Metrics().Snapshot()
+	if m.Objects.CredentialErrors != 1 || m.Objects.Errored != 0 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
+
+func TestCredentialsRefreshDestination(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	dest := "s3://dr-bucket/dr"
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/credentials",
+		MaxParallels: 1,
+		Destinations: []string{dest},
+	}
+	tr, _ := newTestTransporter(t, config)
+	dr := &expiringS3Client{MockS3Client: s3movertest.NewMockS3Client()}
+	tr.SetDestinationS3Client(dest, dr)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 1 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	if len(dr.Objects) != 1 {
+		t.Errorf("unexpected objects: %v", dr.Keys())
+	}
+	m := tr.Metrics().Snapshot()
+	if m.Objects.CredentialErrors != 1 || m.Destinations[dest].Errored != 0 {
+		t.Errorf("unexpected metrics: %+v %+v", m.Objects, m.Destinations[dest])
+	}
+}
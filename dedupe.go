@@ -0,0 +1,126 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// startupDedupe suppresses the duplicate uploads of the files left by the previous run.
+// A file modified before the start and not recorded in the journal is ambiguous, because the previous run
+// may have crashed after uploading it and before removing (or journaling) it.
+// If the object already exists, the file is handled as uploaded without uploading again, not to create
+// a duplicate version in the versioned buckets.
+type startupDedupe struct {
+	startedAt time.Time
+
+	mu      sync.Mutex
+	checked map[string]struct{}
+}
+
+// newStartupDedupe returns nil if DedupeOnStartup is disabled.
+func newStartupDedupe(config *Config, now time.Time) *startupDedupe {
+	if !config.DedupeOnStartup {
+		return nil
+	}
+	return &startupDedupe{
+		startedAt: now,
+		checked:   make(map[string]struct{}),
+	}
+}
+
+// ambiguous reports whether the file should be checked. Each file is checked only once.
+func (d *startupDedupe) ambiguous(path string, st os.FileInfo) bool {
+	if d == nil || !st.ModTime().Before(d.startedAt) {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.checked[path]; ok {
+		return false
+	}
+	d.checked[path] = struct{}{}
+	return true
+}
+
+// uploadedBefore returns the object of the file if it was already uploaded by the previous run.
+// It returns nil if the object doesn't exist or can't be confirmed, to upload the file as usual.
+func (tr *Transporter) uploadedBefore(ctx context.Context, path string, st os.FileInfo) *uploadResult {
+	if !tr.dedupe.ambiguous(path, st) {
+		return nil
+	}
+	if tr.journal != nil {
+		if _, ok := tr.journal.get(path); ok {
+			return nil
+		}
+	}
+	sidecar, err := tr.readSidecar(path)
+	if err != nil {
+		return nil
+	}
+	override, err := tr.readKeyOverride(path, sidecar)
+	if err != nil {
+		return nil
+	}
+	name := tr.objectName(tr.config.SrcDir, path)
+	transformed := tr.codec(path) != ""
+	if tr.converter != nil && tr.converter.format(path) != "" {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".parquet"
+		transformed = true
+	} else {
+		name = tr.gzipBaseName(path, name)
+	}
+	if name, err = tr.keyName(path, name); err != nil {
+		return nil
+	}
+	key, err := tr.fitKey(ctx, override.apply(tr.config.KeyPrefix, tr.objectKey(tr.config.KeyPrefix, path, name, st.ModTime()), 0))
+	if err != nil {
+		return nil
+	}
+	size := st.Size() - override.skip()
+	s3url := fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key)
+	out, err := tr.s3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &tr.config.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var nf *types.NotFound
+		if !errors.As(err, &nf) {
+			slog.WarnContext(ctx, "failed to check the object uploaded before the start. upload it", "path", path, "s3url", s3url, "error", err.Error())
+		}
+		return nil
+	}
+	// the size of the compressed or converted object differs from the file
+	if !transformed && aws.ToInt64(out.ContentLength) != size {
+		slog.InfoContext(ctx, "the object uploaded before the start differs in size. upload it", "path", path, "s3url", s3url)
+		return nil
+	}
+	mtime, ok := out.Metadata[MetadataMtime]
+	if ok && mtime != st.ModTime().UTC().Format(time.RFC3339Nano) {
+		slog.InfoContext(ctx, "the object uploaded before the start differs in mtime. upload it", "path", path, "s3url", s3url)
+		return nil
+	}
+	// the object at the key may be of another file of the same name in the same time partition
+	if !ok && transformed {
+		slog.InfoContext(ctx, "the object uploaded before the start can't be confirmed without the mtime metadata. upload it", "path", path, "s3url", s3url)
+		return nil
+	}
+	slog.InfoContext(ctx, "already uploaded before the start. skip uploading", "path", path, "s3url", s3url)
+	tr.metrics.Deduplicated()
+	return &uploadResult{
+		Bucket:    tr.config.Bucket,
+		Key:       key,
+		Size:      aws.ToInt64(out.ContentLength),
+		VersionID: aws.ToString(out.VersionId),
+	}
+}
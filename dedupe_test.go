@@ -0,0 +1,101 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestDedupeOnStartup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	client := s3movertest.NewMockS3Client()
+	newTransporter := func(dedupe bool) *s3mover.Transporter {
+		config := &s3mover.Config{
+			SrcDir:          dir,
+			Bucket:          "testbucket",
+			KeyPrefix:       "test/dedupe",
+			MaxParallels:    1,
+			DedupeOnStartup: dedupe,
+		}
+		tr, _ := newTestTransporter(t, config)
+		tr.SetS3Client(client)
+		return tr
+	}
+
+	// the previous run crashed after uploading foo.txt and before removing it
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	tr := newTransporter(false)
+	tr.SetRemoveFile(func(string) error { return errors.New("crashed") })
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 1 {
+		t.Fatalf("unexpected objects: %v", client.Keys())
+	}
+	var uploaded s3movertest.MockS3Object
+	for _, obj := range client.Objects {
+		uploaded = *obj
+	}
+
+	bar := s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	tr = newTransporter(true)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{foo, bar} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s must be removed: %v", path, err)
+		}
+	}
+	if len(client.Objects) != 2 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+	if obj := client.Objects[uploaded.Key]; !obj.LastModified.Equal(uploaded.LastModified) {
+		t.Errorf("%s must not be uploaded again", uploaded.Key)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Uploaded != 2 || m.Objects.Deduplicated != 1 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
+
+func TestDedupeOnStartupGzip(t *testing.T) {
+	ctx := context.Background()
+	for _, preserveAttrs := range []bool{false, true} {
+		dir := t.TempDir()
+		client := s3movertest.NewMockS3Client()
+		newTransporter := func(dedupe bool) *s3mover.Transporter {
+			config := &s3mover.Config{
+				SrcDir:          dir,
+				Bucket:          "testbucket",
+				KeyPrefix:       "test/dedupe",
+				MaxParallels:    1,
+				Gzip:            true,
+				PreserveAttrs:   preserveAttrs,
+				DedupeOnStartup: dedupe,
+			}
+			tr, _ := newTestTransporter(t, config)
+			tr.SetS3Client(client)
+			return tr
+		}
+		s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+		tr := newTransporter(false)
+		tr.SetRemoveFile(func(string) error { return errors.New("crashed") })
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		tr = newTransporter(true)
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// the compressed object can be confirmed only by the mtime metadata
+		m := tr.Metrics().Snapshot()
+		if expected := map[bool]int64{false: 0, true: 1}[preserveAttrs]; m.Objects.Uploaded != 1 || m.Objects.Deduplicated != expected {
+			t.Errorf("unexpected metrics with preserve-attrs %v: %+v", preserveAttrs, m.Objects)
+		}
+	}
+}
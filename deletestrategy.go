@@ -0,0 +1,111 @@
+package s3mover
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DeleteUnlink removes the uploaded file.
+	DeleteUnlink = "unlink"
+	// DeleteTruncate truncates the uploaded file to zero for the producers keeping the file open and appending to it.
+	DeleteTruncate = "truncate"
+	// DeleteRename moves the uploaded file to DeleteArchiveDir.
+	DeleteRename = "rename"
+)
+
+// validateDeleteStrategies validates DeleteStrategy and DeleteRules, and sets the default strategy.
+func (c *Config) validateDeleteStrategies() error {
+	switch c.DeleteStrategy {
+	case "":
+		c.DeleteStrategy = DeleteUnlink
+	case DeleteUnlink, DeleteTruncate, DeleteRename:
+	default:
+		return fmt.Errorf("delete strategy must be %s, %s or %s", DeleteUnlink, DeleteTruncate, DeleteRename)
+	}
+	rename := c.DeleteStrategy == DeleteRename
+	for _, rule := range c.DeleteRules {
+		pattern, strategy, ok := cutDeleteRule(rule)
+		if !ok {
+			return fmt.Errorf("invalid delete rule %q. it must be pattern=strategy", rule)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid delete rule pattern %q: %w", pattern, err)
+		}
+		switch strategy {
+		case DeleteUnlink, DeleteTruncate:
+		case DeleteRename:
+			rename = true
+		default:
+			return fmt.Errorf("strategy of delete rule %q must be %s, %s or %s", rule, DeleteUnlink, DeleteTruncate, DeleteRename)
+		}
+	}
+	if rename && c.DeleteArchiveDir == "" {
+		return errors.New("rename delete strategy requires delete-archive-dir")
+	}
+	if c.DeleteArchiveDir != "" && c.Recursive {
+		if rel, err := filepath.Rel(c.SrcDir, c.DeleteArchiveDir); err == nil && !strings.HasPrefix(rel, "..") {
+			return errors.New("delete-archive-dir must not be in src when recursive")
+		}
+	}
+	return nil
+}
+
+// cutDeleteRule splits the rule into the pattern and the strategy at the last "=".
+func cutDeleteRule(rule string) (pattern, strategy string, ok bool) {
+	i := strings.LastIndex(rule, "=")
+	if i <= 0 {
+		return "", "", false
+	}
+	return rule[:i], rule[i+1:], true
+}
+
+// deleteStrategy returns the deletion strategy of the file.
+// The first rule of DeleteRules whose pattern matches the relative path from the source directory or the file name is applied,
+// otherwise DeleteStrategy.
+func (tr *Transporter) deleteStrategy(p string) string {
+	if len(tr.config.DeleteRules) > 0 {
+		name := filepath.Base(p)
+		rel, err := filepath.Rel(tr.config.SrcDir, p)
+		if err != nil {
+			rel = name
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range tr.config.DeleteRules {
+			pattern, strategy, _ := cutDeleteRule(rule)
+			if ok, _ := path.Match(pattern, rel); ok {
+				return strategy
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				return strategy
+			}
+		}
+	}
+	if tr.config.DeleteStrategy == "" {
+		return DeleteUnlink
+	}
+	return tr.config.DeleteStrategy
+}
+
+// discard deletes the uploaded file from the source directory by the deletion strategy.
+func (tr *Transporter) discard(path string) error {
+	switch tr.deleteStrategy(path) {
+	case DeleteTruncate:
+		return os.Truncate(path, 0)
+	case DeleteRename:
+		_, err := tr.moveFile(path, tr.config.DeleteArchiveDir)
+		return err
+	default:
+		return tr.removeFile(path)
+	}
+}
+
+// truncated reports whether the file is empty after being truncated by DeleteTruncate.
+// Such files are left for the producer and never uploaded or removed.
+func (tr *Transporter) truncated(path string, st os.FileInfo) bool {
+	return st.Size() == 0 && tr.deleteStrategy(path) == DeleteTruncate
+}
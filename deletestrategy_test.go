@@ -0,0 +1,92 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestDeleteStrategy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	archive := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:           dir,
+		Bucket:           "testbucket",
+		KeyPrefix:        "test/delete",
+		MaxParallels:     1,
+		TimeFormat:       "2006/01/02/15/04/05.000000000",
+		DeleteRules:      []string{"app.log=truncate", "*.csv=rename"},
+		DeleteArchiveDir: archive,
+	}
+	tr, client := newTestTransporter(t, config)
+	app := s3movertest.WriteFile(t, dir, "app.log", []byte("foo\n"))
+	csv := s3movertest.WriteFile(t, dir, "foo.csv", []byte("a,b\n"))
+	other := s3movertest.WriteFile(t, dir, "other.log", []byte("bar\n"))
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 3 {
+		t.Fatalf("unexpected objects: %v", client.Keys())
+	}
+	if st, err := os.Stat(app); err != nil || st.Size() != 0 {
+		t.Errorf("%s must be truncated: %v", app, err)
+	}
+	if _, err := os.Stat(csv); !os.IsNotExist(err) {
+		t.Errorf("%s must be moved: %v", csv, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(archive, "foo.csv")); err != nil || string(b) != "a,b\n" {
+		t.Errorf("foo.csv must be archived: %q %v", b, err)
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Errorf("%s must be removed: %v", other, err)
+	}
+
+	// the truncated file is left for the producer without uploading
+	if _, total, err := tr.Flush(ctx); err != nil || total != 0 {
+		t.Fatalf("the truncated file must not be processed: %d %v", total, err)
+	}
+	f, err := os.OpenFile(app, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("bar\n")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 4 {
+		t.Fatalf("the appended data must be uploaded: %v", client.Keys())
+	}
+	if st, err := os.Stat(app); err != nil || st.Size() != 0 {
+		t.Errorf("%s must be truncated again: %v", app, err)
+	}
+}
+
+func TestDeleteStrategyValidate(t *testing.T) {
+	for _, c := range []struct {
+		config   s3mover.Config
+		expected string
+	}{
+		{s3mover.Config{DeleteStrategy: "shred"}, "delete strategy must be"},
+		{s3mover.Config{DeleteStrategy: s3mover.DeleteRename}, "requires delete-archive-dir"},
+		{s3mover.Config{DeleteRules: []string{"*.csv=rename"}}, "requires delete-archive-dir"},
+		{s3mover.Config{DeleteRules: []string{"*.csv"}}, "invalid delete rule"},
+		{s3mover.Config{DeleteRules: []string{"[=truncate"}}, "invalid delete rule pattern"},
+		{s3mover.Config{DeleteRules: []string{"*.csv=move"}}, "strategy of delete rule"},
+	} {
+		c.config.SrcDir = t.TempDir()
+		c.config.Bucket = "testbucket"
+		c.config.KeyPrefix = "test/delete"
+		if err := c.config.Validate(); err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s %v must be invalid by %q: %v", c.config.DeleteStrategy, c.config.DeleteRules, c.expected, err)
+		}
+	}
+}
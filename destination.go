@@ -0,0 +1,248 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Destination is an additional bucket to upload each file to, such as a DR bucket in another region
+// or S3 compatible storage like GCS.
+type Destination struct {
+	URL       string
+	Bucket    string
+	Prefix    string
+	Region    string
+	Endpoint  string
+	Profile   string
+	PathStyle bool
+}
+
+// ParseDestination parses the destination URL such as
+// "s3://bucket/prefix?region=us-west-2" or "s3://bucket/prefix?endpoint=https://storage.googleapis.com&profile=gcs".
+// The prefix defaults to the key prefix of the primary bucket.
+func ParseDestination(s, defaultPrefix string) (*Destination, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %q: %w", s, err)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid destination %q: must be s3://bucket[/prefix]", s)
+	}
+	d := &Destination{
+		URL:      s,
+		Bucket:   u.Host,
+		Prefix:   strings.TrimPrefix(u.Path, "/"),
+		Region:   u.Query().Get("region"),
+		Endpoint: u.Query().Get("endpoint"),
+		Profile:  u.Query().Get("profile"),
+	}
+	if d.Prefix == "" {
+		d.Prefix = defaultPrefix
+	}
+	if v := u.Query().Get("path_style"); v != "" {
+		if d.PathStyle, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid destination %q: path_style must be a boolean", s)
+		}
+	}
+	return d, nil
+}
+
+// newS3Client creates the S3 client of the destination and returns it with its credentials.
+// opts are the options to load the configurations of the profile.
+func (d *Destination) newS3Client(ctx context.Context, cfg aws.Config, opts ...func(*awsconfig.LoadOptions) error) (S3Client, aws.CredentialsProvider, error) {
+	if d.Profile != "" {
+		var err error
+		opts = append(opts[:len(opts):len(opts)], awsconfig.WithSharedConfigProfile(d.Profile))
+		if cfg, err = awsconfig.LoadDefaultConfig(ctx, opts...); err != nil {
+			return nil, nil, fmt.Errorf("failed to load profile %s for %s: %w", d.Profile, d.URL, err)
+		}
+		cfg = withCredentialsLogging(cfg, d.Profile)
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if d.Region != "" {
+			o.Region = d.Region
+		}
+		if d.Endpoint != "" {
+			o.BaseEndpoint = aws.String(d.Endpoint)
+			// FIPS endpoints can't be used with the custom endpoint
+			o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateDisabled
+		}
+		o.UsePathStyle = d.PathStyle
+	}), cfg.Credentials, nil
+}
+
+// destinationClient is a Destination with its S3 client.
+type destinationClient struct {
+	*Destination
+	s3          S3Client
+	credentials aws.CredentialsProvider
+}
+
+// DestinationMetrics represents the metrics of a destination.
+type DestinationMetrics struct {
+	Uploaded int64 `json:"uploaded"`
+	Errored  int64 `json:"errored"`
+	Bytes    int64 `json:"bytes"`
+}
+
+func (m *DestinationMetrics) PutObject(success bool) {
+	if success {
+		atomic.AddInt64(&m.Uploaded, 1)
+	} else {
+		atomic.AddInt64(&m.Errored, 1)
+	}
+}
+
+func (m *DestinationMetrics) AddBytes(n int64) {
+	atomic.AddInt64(&m.Bytes, n)
+}
+
+// primaryURL returns the URL of the primary bucket used as the name of the destination.
+func (c *Config) primaryURL() string {
+	return "s3://" + c.Bucket + "/" + strings.TrimPrefix(c.KeyPrefix, "/")
+}
+
+// addDestination adds the destination to fan out uploads.
+func (tr *Transporter) addDestination(d *Destination, client S3Client, credentials aws.CredentialsProvider) {
+	if tr.metrics.Destinations == nil {
+		tr.metrics.Destinations = map[string]*DestinationMetrics{
+			tr.config.primaryURL(): {},
+		}
+	}
+	tr.metrics.Destinations[d.URL] = &DestinationMetrics{}
+	tr.destinations = append(tr.destinations, &destinationClient{Destination: d, s3: client, credentials: credentials})
+}
+
+// SetDestinationS3Client replaces the S3 client of the destination. e.g. s3movertest.MockS3Client for testing.
+func (tr *Transporter) SetDestinationS3Client(url string, client S3Client) {
+	for _, d := range tr.destinations {
+		if d.URL == url {
+			d.s3 = client
+		}
+	}
+}
+
+// fanoutState remembers the destinations that each file has been uploaded to,
+// so a retry uploads the file only to the failed destinations.
+// The destinations are forgotten if the file is modified, or replaced by a new file of the same name.
+type fanoutState struct {
+	mu   sync.Mutex
+	done map[string]*fanoutFile
+}
+
+// fanoutFile is the destinations that the file of the size and the mtime has been uploaded to.
+type fanoutFile struct {
+	size    int64
+	modTime time.Time
+	dests   map[string]*uploadResult
+}
+
+func (s *fanoutState) get(path string, st fs.FileInfo, dest string) (*uploadResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.done[path]
+	if f == nil || f.size != st.Size() || !f.modTime.Equal(st.ModTime()) {
+		return nil, false
+	}
+	up, ok := f.dests[dest]
+	return up, ok
+}
+
+func (s *fanoutState) put(path string, st fs.FileInfo, dest string, up *uploadResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil {
+		s.done = make(map[string]*fanoutFile)
+	}
+	f := s.done[path]
+	if f == nil || f.size != st.Size() || !f.modTime.Equal(st.ModTime()) {
+		f = &fanoutFile{size: st.Size(), modTime: st.ModTime(), dests: make(map[string]*uploadResult)}
+		s.done[path] = f
+	}
+	f.dests[dest] = up
+}
+
+func (s *fanoutState) clear(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.done, path)
+}
+
+// uploadAll uploads the file to the primary bucket and all the destinations.
+// It returns the result of the primary bucket only when all the uploads succeed.
+func (tr *Transporter) uploadAll(ctx context.Context, path, name string, revision int) (*uploadResult, error) {
+	if len(tr.destinations) == 0 {
+		up, err := tr.upload(ctx, path, name, revision)
+		if err != nil {
+			return nil, err
+		}
+		tr.auditUploaded(ctx, path, up)
+		return up, nil
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		tr.fanout.clear(path)
+		return nil, asLocalReadError(path, err)
+	}
+	primaryURL := tr.config.primaryURL()
+	primary, ok := tr.fanout.get(path, st, primaryURL)
+	if !ok {
+		up, err := tr.upload(ctx, path, name, revision)
+		tr.metrics.Destinations[primaryURL].PutObject(err == nil)
+		if err != nil {
+			return nil, err
+		}
+		tr.metrics.Destinations[primaryURL].AddBytes(up.Size)
+		tr.auditUploaded(ctx, path, up)
+		tr.fanout.put(path, st, primaryURL, up)
+		primary = up
+	}
+	var errs []error
+	for _, d := range tr.destinations {
+		if _, ok := tr.fanout.get(path, st, d.URL); ok {
+			continue
+		}
+		up, err := tr.put(ctx, d.s3, d.Bucket, d.Prefix, path, name, revision)
+		if tr.refreshCredentials(ctx, d.credentials, err) {
+			up, err = tr.put(ctx, d.s3, d.Bucket, d.Prefix, path, name, revision)
+		}
+		tr.metrics.Destinations[d.URL].PutObject(err == nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.URL, err))
+			continue
+		}
+		tr.metrics.Destinations[d.URL].AddBytes(up.Size)
+		tr.auditUploaded(ctx, path, up)
+		tr.fanout.put(path, st, d.URL, up)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	tr.fanout.clear(path)
+	return primary, nil
+}
+
+// auditUploaded records the uploaded object to the audit log and the batch manifest.
+func (tr *Transporter) auditUploaded(ctx context.Context, path string, up *uploadResult) {
+	if err := tr.audit.uploaded(path, up); err != nil {
+		slog.WarnContext(ctx, err.Error())
+	}
+	if err := tr.manifest.add(up, time.Now()); err != nil {
+		slog.WarnContext(ctx, err.Error())
+	}
+}
@@ -0,0 +1,142 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+type flakyS3Client struct {
+	*s3movertest.MockS3Client
+	failures int
+}
+
+func (c *flakyS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("flaky")
+	}
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestParseDestination(t *testing.T) {
+	d, err := s3mover.ParseDestination("s3://dr-bucket/dr/prefix?region=us-west-2&path_style=true", "prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Bucket != "dr-bucket" || d.Prefix != "dr/prefix" || d.Region != "us-west-2" || !d.PathStyle {
+		t.Errorf("unexpected destination: %+v", d)
+	}
+	d, err = s3mover.ParseDestination("s3://gcs-bucket?endpoint=https://storage.googleapis.com&profile=gcs", "prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Prefix != "prefix" || d.Endpoint != "https://storage.googleapis.com" || d.Profile != "gcs" {
+		t.Errorf("unexpected destination: %+v", d)
+	}
+	for _, s := range []string{"gs://bucket", "s3:///prefix", "s3://bucket?path_style=maybe"} {
+		if _, err := s3mover.ParseDestination(s, ""); err == nil {
+			t.Errorf("%s must be invalid", s)
+		}
+	}
+}
+
+func TestFanout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	dest := "s3://dr-bucket/dr?region=us-west-2"
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "primary",
+		KeyPrefix:    "test/fanout",
+		MaxParallels: 1,
+		Destinations: []string{dest},
+	}
+	tr, _ := newTestTransporter(t, config)
+	primary := &flakyS3Client{MockS3Client: s3movertest.NewMockS3Client()}
+	dr := &flakyS3Client{MockS3Client: s3movertest.NewMockS3Client(), failures: 1}
+	tr.SetS3Client(primary)
+	tr.SetDestinationS3Client(dest, dr)
+
+	if processed, _, _ := tr.Flush(ctx); processed != 0 {
+		t.Error("must fail on the destination")
+	}
+	if _, err := os.Stat(foo); err != nil {
+		t.Errorf("file must be kept until all destinations succeed: %s", err)
+	}
+	if processed, _, _ := tr.Flush(ctx); processed != 1 {
+		t.Error("must succeed on retry")
+	}
+	if _, err := os.Stat(foo); !os.IsNotExist(err) {
+		t.Errorf("file must be removed: %v", err)
+	}
+	if len(primary.Keys()) != 1 || len(dr.Keys()) != 1 {
+		t.Errorf("unexpected objects: primary=%v dr=%v", primary.Keys(), dr.Keys())
+	}
+	for _, key := range dr.Keys() {
+		if !strings.HasPrefix(key, "dr/") {
+			t.Errorf("unexpected key: %s", key)
+		}
+	}
+
+	m := tr.Metrics().Snapshot()
+	if p := m.Destinations["s3://primary/test/fanout"]; p == nil || p.Uploaded != 1 || p.Errored != 0 {
+		t.Errorf("unexpected primary metrics: %+v", p)
+	}
+	if d := m.Destinations[dest]; d == nil || d.Uploaded != 1 || d.Errored != 1 || d.Bytes != 3 {
+		t.Errorf("unexpected destination metrics: %+v", d)
+	}
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `s3mover_destination_objects_errored_total{destination="` + dest + `"} 1`; !strings.Contains(buf.String(), want) {
+		t.Errorf("%s is not found in %s", want, buf.String())
+	}
+}
+
+func TestFanoutModified(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	dest := "s3://dr-bucket/dr"
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "primary",
+		KeyPrefix:    "test/fanout",
+		MaxParallels: 1,
+		Destinations: []string{dest},
+	}
+	tr, _ := newTestTransporter(t, config)
+	primary := &flakyS3Client{MockS3Client: s3movertest.NewMockS3Client()}
+	dr := &flakyS3Client{MockS3Client: s3movertest.NewMockS3Client(), failures: 1}
+	tr.SetS3Client(primary)
+	tr.SetDestinationS3Client(dest, dr)
+
+	if processed, _, _ := tr.Flush(ctx); processed != 0 {
+		t.Error("must fail on the destination")
+	}
+	// the file is replaced before the retry
+	if err := os.WriteFile(foo, []byte("foobar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(foo, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if processed, _, _ := tr.Flush(ctx); processed != 1 {
+		t.Error("must succeed on retry")
+	}
+	m := tr.Metrics().Snapshot()
+	if p := m.Destinations["s3://primary/test/fanout"]; p == nil || p.Uploaded != 2 || p.Bytes != 9 {
+		t.Errorf("the modified file must be uploaded to the primary again: %+v", p)
+	}
+}
@@ -0,0 +1,95 @@
+package s3mover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// kinds of the completion marker objects
+const (
+	// DoneMarkerObject puts "<key>.done" after each upload.
+	DoneMarkerObject = "object"
+	// DoneMarkerBatch puts "_SUCCESS" into each directory of the objects uploaded in a batch.
+	DoneMarkerBatch = "batch"
+)
+
+const (
+	DoneMarkerSuffix    = ".done"
+	DoneMarkerBatchName = "_SUCCESS"
+)
+
+// batchMarkers collects the directories of the objects uploaded in a batch to put the _SUCCESS markers.
+type batchMarkers struct {
+	mu      sync.Mutex
+	targets map[string]batchMarker
+}
+
+type batchMarker struct {
+	client S3Client
+	bucket string
+	dir    string
+}
+
+func (m *batchMarkers) add(marker batchMarker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.targets == nil {
+		m.targets = make(map[string]batchMarker)
+	}
+	m.targets[marker.bucket+"/"+marker.dir] = marker
+}
+
+// drain returns the collected markers and resets them.
+func (m *batchMarkers) drain() map[string]batchMarker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	targets := m.targets
+	m.targets = nil
+	return targets
+}
+
+func putMarker(ctx context.Context, client S3Client, bucket, key string) error {
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &bucket,
+		Key:           &key,
+		Body:          bytes.NewReader(nil),
+		ContentLength: aws.Int64(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put done marker s3://%s/%s: %w", bucket, key, err)
+	}
+	slog.DebugContext(ctx, "done marker put", "s3url", fmt.Sprintf("s3://%s/%s", bucket, key))
+	return nil
+}
+
+// markDone puts the marker of the uploaded object, or collects it into the batch.
+func (tr *Transporter) markDone(ctx context.Context, client S3Client, up *uploadResult) error {
+	switch tr.config.DoneMarker {
+	case DoneMarkerObject:
+		return putMarker(ctx, client, up.Bucket, up.Key+DoneMarkerSuffix)
+	case DoneMarkerBatch:
+		tr.batchMarkers.add(batchMarker{client: client, bucket: up.Bucket, dir: path.Dir(up.Key)})
+	}
+	return nil
+}
+
+// putBatchMarkers puts the _SUCCESS markers into the directories of the objects uploaded since the last call.
+// The markers failed to put are retried by the next batch.
+func (tr *Transporter) putBatchMarkers(ctx context.Context) {
+	if tr.config.DoneMarker != DoneMarkerBatch {
+		return
+	}
+	for _, m := range tr.batchMarkers.drain() {
+		if err := putMarker(ctx, m.client, m.bucket, path.Join(m.dir, DoneMarkerBatchName)); err != nil {
+			slog.WarnContext(ctx, err.Error())
+			tr.batchMarkers.add(m)
+		}
+	}
+}
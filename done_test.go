@@ -0,0 +1,57 @@
+package s3mover_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func testDoneMarker(t *testing.T, marker string) []string {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/done",
+		MaxParallels: 2,
+		TimeFormat:   "2006",
+		DoneMarker:   marker,
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 2 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	var names []string
+	for key, obj := range client.Objects {
+		name := key[strings.LastIndex(key, "/")+1:]
+		if strings.HasSuffix(name, s3mover.DoneMarkerSuffix) || name == s3mover.DoneMarkerBatchName {
+			if obj.Size != 0 {
+				t.Errorf("marker %s must be empty: %d bytes", key, obj.Size)
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDoneMarker(t *testing.T) {
+	for marker, expected := range map[string]string{
+		"":                       "bar.txt,foo.txt",
+		s3mover.DoneMarkerObject: "bar.txt,bar.txt.done,foo.txt,foo.txt.done",
+		s3mover.DoneMarkerBatch:  "_SUCCESS,bar.txt,foo.txt",
+	} {
+		t.Run(marker, func(t *testing.T) {
+			if names := strings.Join(testDoneMarker(t, marker), ","); names != expected {
+				t.Errorf("unexpected objects: %s", names)
+			}
+		})
+	}
+}
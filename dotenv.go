@@ -0,0 +1,62 @@
+package s3mover
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultEnvPrefix is the default prefix of the environment variables to set the flags.
+const DefaultEnvPrefix = "S3MOVER_"
+
+// EnvName returns the name of the environment variable for the flag, e.g. "S3MOVER_SQS_QUEUE_URL" for "sqs-queue-url".
+func EnvName(prefix, flagName string) string {
+	return prefix + strings.ReplaceAll(strings.ToUpper(flagName), "-", "_")
+}
+
+// ReadDotenv reads the variables from the dotenv file.
+// Each line is KEY=VALUE, optionally prefixed with "export". The value may be quoted by ' or ".
+// The double-quoted value is unescaped as a Go string literal. Empty lines and lines starting with # are ignored.
+func ReadDotenv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: invalid line", path, n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid value of %s: %w", path, n, key, err)
+			}
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			// strip the inline comment
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
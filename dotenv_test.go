@@ -0,0 +1,54 @@
+package s3mover_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestReadDotenv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := `# comment
+S3MOVER_BUCKET=mybucket
+export S3MOVER_PREFIX = logs/ # inline comment
+
+S3MOVER_LOG_ATTRS="service=app,env=\"prod\""
+S3MOVER_SQS_QUEUE_URL='https://sqs.example.com/q#1'
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := s3mover.ReadDotenv(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"S3MOVER_BUCKET":        "mybucket",
+		"S3MOVER_PREFIX":        "logs/",
+		"S3MOVER_LOG_ATTRS":     `service=app,env="prod"`,
+		"S3MOVER_SQS_QUEUE_URL": "https://sqs.example.com/q#1",
+	}
+	if len(vars) != len(expected) {
+		t.Errorf("unexpected vars: %v", vars)
+	}
+	for k, v := range expected {
+		if vars[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, vars[k])
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("NO_EQUAL\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3mover.ReadDotenv(path); err == nil {
+		t.Error("expected error for the invalid line")
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if name := s3mover.EnvName("APP1_", "sqs-queue-url"); name != "APP1_SQS_QUEUE_URL" {
+		t.Errorf("unexpected env name: %s", name)
+	}
+}
@@ -3,57 +3,200 @@ package s3mover
 import (
 	"context"
 	"io"
-	"strings"
-	"sync"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
 var (
 	ListFiles = listFiles
 	GenKey    = genKey
-	LoadFile  = loadFile
+	RoundTime = roundTime
 )
 
-func (tr *Transporter) SetMockS3(client *MockS3Client) {
-	tr.s3 = client
+func LoadFile(path string, gz bool, gzipLevel int, maxInMemory int64, tempDir string) (io.ReadCloser, int64, time.Time, error) {
+	codec := ""
+	if gz {
+		codec = CompressGzip
+	}
+	return loadFile(path, 0, codec, gzipLevel, maxInMemory, tempDir)
 }
 
-func NewMockS3Client() *MockS3Client {
-	return &MockS3Client{
-		mu:      sync.Mutex{},
-		Objects: make(map[string]*MockS3Object),
-	}
+var NewUploadedKeys = newUploadedKeys
+
+func (u *uploadedKeys) Add(bucket, key string, now time.Time) bool {
+	return u.add(bucket, key, now)
 }
 
-type MockS3Client struct {
-	mu      sync.Mutex
-	Objects map[string]*MockS3Object
+func (u *uploadedKeys) SetSize(size int) {
+	u.size = size
 }
 
-type MockS3Object struct {
-	Bucket  string
-	Key     string
-	Size    int64
-	Content []byte
+type AlertStatus = alertStatus
+
+var NewAlerter = newAlerter
+
+func (a *alerter) Check(ctx context.Context, st AlertStatus) []AlertPayload {
+	return a.check(ctx, st)
 }
 
-func (c *MockS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (a *alerter) Send(ctx context.Context, p AlertPayload) error {
+	return a.send(ctx, p)
+}
 
-	if strings.Contains(*input.Key, TestObjectKey) {
-		// ignore test object
-		return &s3.PutObjectOutput{}, nil
-	}
+func (a *alerter) SetNow(now func() time.Time) {
+	a.now = now
+}
 
-	b, _ := io.ReadAll(input.Body)
-	obj := MockS3Object{
-		Bucket:  *input.Bucket,
-		Key:     *input.Key,
-		Size:    *input.ContentLength,
-		Content: b,
-	}
-	c.Objects[obj.Key] = &obj
-	return &s3.PutObjectOutput{}, nil
+var NewErrorReporter = newErrorReporter
+
+var (
+	IdentityHint = identityHint
+	SameRole     = sameRole
+)
+
+func (tr *Transporter) CheckIdentity(ctx context.Context) error {
+	return tr.checkIdentity(ctx)
+}
+
+func (tr *Transporter) CheckProtection(ctx context.Context) error {
+	return tr.checkProtection(ctx)
+}
+
+func (r *errorReporter) Failed(ctx context.Context, path string, err error, count int) bool {
+	return r.failed(ctx, path, err, count)
+}
+
+func (tr *Transporter) HealthHandler() http.HandlerFunc {
+	return tr.healthHandler
+}
+
+func (tr *Transporter) ConfigHandler() http.HandlerFunc {
+	return tr.configHandler
+}
+
+func (tr *Transporter) BundleHandler() http.HandlerFunc {
+	return tr.bundleHandler
+}
+
+func (tr *Transporter) SetHealth(status, message string) {
+	tr.setHealth(status, message)
+}
+
+var NewFaultS3Client = newFaultS3Client
+
+func (tr *Transporter) SetSQSClient(client SQSClient) {
+	tr.sqs = client
+}
+
+func (tr *Transporter) ProcessMessages(ctx context.Context, msgs []sqstypes.Message) int64 {
+	return tr.processMessages(ctx, msgs)
+}
+
+func (tr *Transporter) IngestHandler() http.HandlerFunc {
+	return tr.ingestHandler
+}
+
+func (tr *Transporter) ApplySchedule(ctx context.Context, now time.Time) error {
+	return tr.applySchedule(ctx, now)
+}
+
+var NewBandwidthLimiter = newBandwidthLimiter
+
+func (l *bandwidthLimiter) Wait(ctx context.Context, n int64) error {
+	return l.wait(ctx, n)
+}
+
+func (tr *Transporter) Expire(ctx context.Context, now time.Time) {
+	tr.expire(ctx, now)
+}
+
+func (tr *Transporter) SetRemoveFile(f func(string) error) {
+	tr.removeFile = f
+}
+
+func (tr *Transporter) SetLocked(f func(error) bool) {
+	tr.locked = f
+}
+
+func (tr *Transporter) RunOnce(ctx context.Context) (int64, int64, error) {
+	return tr.runOnce(ctx, false)
+}
+
+func (tr *Transporter) Parallels() int64 {
+	return tr.parallels
+}
+
+func (tr *Transporter) PutHeartbeat(ctx context.Context, now time.Time) error {
+	return tr.putHeartbeat(ctx, now)
+}
+
+func (tr *Transporter) LogSummary(ctx context.Context) {
+	tr.summary.log(ctx, tr.config.LogSummaryInterval)
+}
+
+func (tr *Transporter) FlushBatchManifest(ctx context.Context, now time.Time) error {
+	return tr.flushBatchManifest(ctx, now)
+}
+
+var ErrInFlight = errInFlight
+
+func (tr *Transporter) Transport(ctx context.Context, path string) error {
+	return tr.transport(ctx, path)
+}
+
+var OpenJournal = openJournal
+
+const JournalCompactMin = journalCompactMin
+
+func (j *journal) Put(e *JournalEntry) error {
+	return j.put(e)
+}
+
+func (j *journal) Remove(paths ...string) error {
+	return j.remove(paths...)
+}
+
+func (j *journal) List() []JournalEntry {
+	return j.list()
+}
+
+var RetryRemove = retryRemove
+
+const RemoveRetries = removeRetries
+
+func (tr *Transporter) SkippedFiles() int {
+	tr.skipped.mu.Lock()
+	defer tr.skipped.mu.Unlock()
+	return len(tr.skipped.files)
+}
+
+func (tr *Transporter) ReplayResumeJournal(ctx context.Context) {
+	tr.replayResumeJournal(ctx)
+}
+
+func (tr *Transporter) AbortStaleUploadsAt(ctx context.Context, opt AbortUploadsOption, now time.Time) ([]AbortUploadResult, error) {
+	return tr.abortStaleUploads(ctx, opt, now)
+}
+
+func (c *Config) S3Options(o *s3.Options) {
+	c.s3Options(o)
+}
+
+type RetryBudget = retryBudget
+
+var NewRetryBudget = newRetryBudget
+
+func (b *retryBudget) S3Options(o *s3.Options) {
+	b.s3Options(o)
+}
+
+func (b *retryBudget) Allow(now time.Time) bool {
+	return b.allow(now)
+}
+
+func (b *retryBudget) Metrics() RetryBudgetMetrics {
+	return b.metrics
 }
@@ -0,0 +1,87 @@
+package s3mover
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Failure represents a file that has failed to be transported.
+type Failure struct {
+	Path          string    `json:"path"`
+	Count         int       `json:"count"`
+	LastError     string    `json:"last_error"`
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	LastFailedAt  time.Time `json:"last_failed_at"`
+}
+
+// failureTracker tracks consecutive failures of each file.
+type failureTracker struct {
+	mu       sync.Mutex
+	failures map[string]*Failure
+}
+
+func newFailureTracker() *failureTracker {
+	return &failureTracker{
+		failures: make(map[string]*Failure),
+	}
+}
+
+// failed records a failure of path and returns the number of consecutive failures.
+func (t *failureTracker) failed(path string, err error, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.failures[path]
+	if !ok {
+		f = &Failure{Path: path, FirstFailedAt: now}
+		t.failures[path] = f
+	}
+	f.Count++
+	f.LastError = err.Error()
+	f.LastFailedAt = now
+	return f.Count
+}
+
+// succeeded forgets the failures of path.
+func (t *failureTracker) succeeded(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, path)
+}
+
+// retain forgets the failures of the files not in paths, such as removed or moved by the others.
+func (t *failureTracker) retain(paths []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.failures) == 0 {
+		return
+	}
+	listed := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		listed[path] = struct{}{}
+	}
+	for path := range t.failures {
+		if _, ok := listed[path]; !ok {
+			delete(t.failures, path)
+		}
+	}
+}
+
+// list returns the failures sorted by path.
+func (t *failureTracker) list() []Failure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fs := make([]Failure, 0, len(t.failures))
+	for _, f := range t.failures {
+		fs = append(fs, *f)
+	}
+	sort.Slice(fs, func(i, j int) bool {
+		return fs[i].Path < fs[j].Path
+	})
+	return fs
+}
+
+// Failures returns the files that are failing to be transported.
+func (tr *Transporter) Failures() []Failure {
+	return tr.failures.list()
+}
@@ -0,0 +1,42 @@
+package s3mover
+
+// interleave orders paths round-robin across the groups by key, keeping the order in each group.
+// The groups are ordered by their first appearance in paths.
+func interleave(paths []string, key func(string) string) []string {
+	var keys []string
+	groups := make(map[string][]string)
+	for _, path := range paths {
+		k := key(path)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], path)
+	}
+	if len(keys) <= 1 {
+		return paths
+	}
+	ordered := make([]string, 0, len(paths))
+	for i := 0; len(ordered) < len(paths); i++ {
+		for _, k := range keys {
+			if g := groups[k]; i < len(g) {
+				ordered = append(ordered, g[i])
+			}
+		}
+	}
+	return ordered
+}
+
+// order orders the queued paths to upload.
+// The high priority files precede the others. In the recursive mode, the files in each priority class
+// are interleaved across the top-level subdirectories, so a huge backlog in a directory does not starve the others.
+func (tr *Transporter) order(paths []string) []string {
+	high, normal := tr.prioritize(paths)
+	if tr.config.Recursive {
+		high = interleave(high, tr.topDirectory)
+		normal = interleave(normal, tr.topDirectory)
+	}
+	if len(high) == 0 {
+		return normal
+	}
+	return append(high, normal...)
+}
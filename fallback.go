@@ -0,0 +1,78 @@
+package s3mover
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultFallbackAfter is the duration of continuous failures of the primary bucket to use the fallback bucket.
+	DefaultFallbackAfter = 5 * time.Minute
+
+	// fallbackProbeInterval is the interval to try the primary bucket while using the fallback bucket.
+	fallbackProbeInterval = time.Minute
+)
+
+// fallback tracks the failures of the primary bucket to redirect uploads to the fallback bucket.
+type fallback struct {
+	s3     S3Client
+	bucket string
+	after  time.Duration
+
+	failingSince atomic.Int64 // unix nano of the first failure of the primary bucket. 0 means healthy.
+	active       atomic.Bool
+	lastProbe    atomic.Int64
+}
+
+// SetFallbackS3Client replaces the S3 client for the fallback bucket.
+func (tr *Transporter) SetFallbackS3Client(client S3Client) {
+	if tr.fallback != nil {
+		tr.fallback.s3 = client
+	}
+}
+
+// FallbackActive reports whether uploads are redirected to the fallback bucket.
+func (tr *Transporter) FallbackActive() bool {
+	return tr.fallback != nil && tr.fallback.active.Load()
+}
+
+// primaryDestination returns the S3 client and the bucket for the next upload to the primary bucket.
+// While using the fallback bucket, the primary bucket is tried at fallbackProbeInterval.
+func (tr *Transporter) primaryDestination(now time.Time) (S3Client, string, bool) {
+	fb := tr.fallback
+	if fb == nil || !fb.active.Load() {
+		return tr.s3, tr.config.Bucket, false
+	}
+	last := fb.lastProbe.Load()
+	if now.UnixNano()-last >= int64(fallbackProbeInterval) && fb.lastProbe.CompareAndSwap(last, now.UnixNano()) {
+		return tr.s3, tr.config.Bucket, false
+	}
+	return fb.s3, fb.bucket, true
+}
+
+// primaryResult records the result of an upload to the primary bucket.
+func (tr *Transporter) primaryResult(ctx context.Context, err error, now time.Time) {
+	fb := tr.fallback
+	if fb == nil {
+		return
+	}
+	if err == nil {
+		fb.failingSince.Store(0)
+		if fb.active.CompareAndSwap(true, false) {
+			slog.InfoContext(ctx, "primary bucket is recovered. stop using the fallback bucket", "bucket", tr.config.Bucket)
+		}
+		return
+	}
+	fb.failingSince.CompareAndSwap(0, now.UnixNano())
+	since := time.Unix(0, fb.failingSince.Load())
+	if now.Sub(since) >= fb.after && fb.active.CompareAndSwap(false, true) {
+		fb.lastProbe.Store(now.UnixNano())
+		slog.WarnContext(ctx, "primary bucket has failed continuously. redirect uploads to the fallback bucket",
+			"bucket", tr.config.Bucket,
+			"fallback_bucket", fb.bucket,
+			"failing_since", since,
+		)
+	}
+}
@@ -0,0 +1,54 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestFallback(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:         dir,
+		Bucket:         "primary",
+		KeyPrefix:      "test/fallback",
+		MaxParallels:   1,
+		FallbackBucket: "fallback",
+		FallbackAfter:  time.Nanosecond,
+		FaultErrorRate: 1, // the primary bucket always fails
+	}
+	tr, _ := newTestTransporter(t, config)
+	primary := s3movertest.NewMockS3Client()
+	fallback := s3movertest.NewMockS3Client()
+	tr.SetS3Client(primary)
+	tr.SetFallbackS3Client(fallback)
+
+	for i := 0; i < 2; i++ {
+		if processed, _, _ := tr.Flush(ctx); processed != 0 {
+			t.Errorf("#%d: must fail on the primary bucket", i)
+		}
+	}
+	if !tr.FallbackActive() {
+		t.Fatal("fallback must be active")
+	}
+	if processed, _, _ := tr.Flush(ctx); processed != 1 {
+		t.Error("must be uploaded to the fallback bucket")
+	}
+	if len(fallback.Keys()) != 1 || len(primary.Keys()) != 0 {
+		t.Errorf("unexpected objects: primary=%v fallback=%v", primary.Keys(), fallback.Keys())
+	}
+	for _, obj := range fallback.Objects {
+		if obj.Bucket != "fallback" {
+			t.Errorf("unexpected bucket: %s", obj.Bucket)
+		}
+	}
+	m := tr.Metrics().Snapshot()
+	if m.Objects.Uploaded != 1 || m.Objects.UploadedFallback != 1 || m.Objects.Errored != 2 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
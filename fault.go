@@ -0,0 +1,118 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// DefaultFaultErrorCode is the default error code of the injected faults.
+const DefaultFaultErrorCode = "InternalError"
+
+// faultS3Client injects failures and latencies into the S3 client for chaos testing.
+type faultS3Client struct {
+	S3Client
+	errorRate float64
+	errorCode string
+	latency   time.Duration
+}
+
+func newFaultS3Client(client S3Client, config *Config) S3Client {
+	if config.FaultErrorRate <= 0 && config.FaultLatency <= 0 {
+		return client
+	}
+	return &faultS3Client{
+		S3Client:  client,
+		errorRate: config.FaultErrorRate,
+		errorCode: config.FaultErrorCode,
+		latency:   config.FaultLatency,
+	}
+}
+
+// inject sleeps for a random duration up to the latency and returns an error at the error rate.
+func (c *faultS3Client) inject(ctx context.Context, op string, key *string) error {
+	if key != nil && strings.Contains(*key, TestObjectKey) {
+		// the test object is not affected to start up
+		return nil
+	}
+	if c.latency > 0 {
+		d := time.Duration(rand.Int63n(int64(c.latency)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+	if c.errorRate > 0 && rand.Float64() < c.errorRate {
+		return &smithy.OperationError{
+			ServiceID:     "S3",
+			OperationName: op,
+			Err: &smithy.GenericAPIError{
+				Code:    c.errorCode,
+				Message: fmt.Sprintf("fault injected by s3mover (rate %g)", c.errorRate),
+			},
+		}
+	}
+	return nil
+}
+
+func (c *faultS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := c.inject(ctx, "PutObject", input.Key); err != nil {
+		return nil, err
+	}
+	return c.S3Client.PutObject(ctx, input, optFns...)
+}
+
+func (c *faultS3Client) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := c.inject(ctx, "HeadObject", input.Key); err != nil {
+		return nil, err
+	}
+	return c.S3Client.HeadObject(ctx, input, optFns...)
+}
+
+func (c *faultS3Client) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := c.inject(ctx, "DeleteObject", input.Key); err != nil {
+		return nil, err
+	}
+	return c.S3Client.DeleteObject(ctx, input, optFns...)
+}
+
+// The multipart methods are called only when the wrapped client implements MultipartS3Client. See multipartClient.
+
+func (c *faultS3Client) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if err := c.inject(ctx, "CreateMultipartUpload", input.Key); err != nil {
+		return nil, err
+	}
+	return c.S3Client.(MultipartS3Client).CreateMultipartUpload(ctx, input, optFns...)
+}
+
+func (c *faultS3Client) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if err := c.inject(ctx, "UploadPart", input.Key); err != nil {
+		return nil, err
+	}
+	return c.S3Client.(MultipartS3Client).UploadPart(ctx, input, optFns...)
+}
+
+func (c *faultS3Client) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := c.inject(ctx, "CompleteMultipartUpload", input.Key); err != nil {
+		return nil, err
+	}
+	return c.S3Client.(MultipartS3Client).CompleteMultipartUpload(ctx, input, optFns...)
+}
+
+func (c *faultS3Client) ListParts(ctx context.Context, input *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	if err := c.inject(ctx, "ListParts", input.Key); err != nil {
+		return nil, err
+	}
+	return c.S3Client.(ListPartsS3Client).ListParts(ctx, input, optFns...)
+}
+
+func (c *faultS3Client) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	// aborting is not affected to clean up the parts
+	return c.S3Client.(MultipartS3Client).AbortMultipartUpload(ctx, input, optFns...)
+}
@@ -0,0 +1,52 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestFaultS3Client(t *testing.T) {
+	ctx := context.Background()
+	mock := s3movertest.NewMockS3Client()
+	if c := s3mover.NewFaultS3Client(mock, &s3mover.Config{}); c != s3mover.S3Client(mock) {
+		t.Error("client must not be wrapped when fault injection is disabled")
+	}
+
+	c := s3mover.NewFaultS3Client(mock, &s3mover.Config{
+		FaultErrorRate: 1,
+		FaultErrorCode: "SlowDown",
+		FaultLatency:   10 * time.Millisecond,
+	})
+	_, err := c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String("testbucket"),
+		Key:           aws.String("foo"),
+		Body:          strings.NewReader("foo"),
+		ContentLength: aws.Int64(3),
+	})
+	var ae smithy.APIError
+	if !errors.As(err, &ae) || ae.ErrorCode() != "SlowDown" {
+		t.Errorf("expected injected SlowDown error, got %v", err)
+	}
+	if len(mock.Objects) != 0 {
+		t.Error("object must not be put when a fault is injected")
+	}
+
+	// the test object is not affected
+	if _, err := c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String("testbucket"),
+		Key:           aws.String(s3mover.TestObjectKey),
+		Body:          strings.NewReader("test"),
+		ContentLength: aws.Int64(4),
+	}); err != nil {
+		t.Errorf("test object must not be affected: %s", err)
+	}
+}
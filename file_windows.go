@@ -0,0 +1,14 @@
+//go:build windows
+
+package s3mover
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isFileLocked reports whether err is caused by another process opening or locking the file.
+func isFileLocked(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
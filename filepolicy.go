@@ -0,0 +1,133 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// FilePolicyUpload uploads the file as usual.
+	FilePolicyUpload = "upload"
+	// FilePolicySkip leaves the file in the source directory without uploading.
+	FilePolicySkip = "skip"
+	// FilePolicyDelete removes the file without uploading.
+	FilePolicyDelete = "delete"
+	// FilePolicyDeadLetter moves the file to the dead-letter directory without uploading.
+	FilePolicyDeadLetter = "dead-letter"
+	// FilePolicyMultipart uploads the file by the multipart upload regardless of MultipartThreshold.
+	FilePolicyMultipart = "multipart"
+)
+
+// filePolicy returns the policy for the file. FilePolicyMultipart is handled by useMultipart.
+func (tr *Transporter) filePolicy(st os.FileInfo) string {
+	switch {
+	case st.Size() == 0:
+		return tr.config.EmptyFilePolicy
+	case tr.config.MaxFileSize > 0 && st.Size() > tr.config.MaxFileSize:
+		return tr.config.OversizedFilePolicy
+	}
+	return FilePolicyUpload
+}
+
+// skippedFiles remembers the skipped files not to log them on every scan.
+type skippedFiles struct {
+	mu    sync.Mutex
+	files map[string]time.Time // path -> modification time
+}
+
+// add reports whether the file is newly skipped.
+func (s *skippedFiles) add(path string, modTime time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string]time.Time)
+	}
+	if t, ok := s.files[path]; ok && t.Equal(modTime) {
+		return false
+	}
+	s.files[path] = modTime
+	return true
+}
+
+// retain forgets the skipped files not in paths, such as removed by others.
+func (s *skippedFiles) retain(paths []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) == 0 {
+		return
+	}
+	listed := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		listed[path] = struct{}{}
+	}
+	for path := range s.files {
+		if _, ok := listed[path]; !ok {
+			delete(s.files, path)
+		}
+	}
+}
+
+// has reports whether the file is skipped and not modified since then.
+func (s *skippedFiles) has(path string, modTime time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.files[path]
+	return ok && t.Equal(modTime)
+}
+
+// skip reports whether the file is skipped by the policy.
+// The files skipped by LocalErrorSkip are retried after they are modified.
+// The sidecars are always skipped, uploaded as the attributes of the files.
+func (tr *Transporter) skip(ctx context.Context, path string) bool {
+	if tr.isSidecar(path) {
+		return true
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return tr.unreadable.has(path, time.Time{})
+	}
+	if tr.unreadable.has(path, st.ModTime()) {
+		return true
+	}
+	if tr.truncated(path, st) {
+		return true
+	}
+	if tr.filePolicy(st) != FilePolicySkip {
+		return false
+	}
+	if tr.skipped.add(path, st.ModTime()) {
+		if st.Size() == 0 {
+			slog.InfoContext(ctx, "skip empty file", "path", path)
+		} else {
+			slog.WarnContext(ctx, "skip oversized file", "path", path, "size", st.Size(), "max_file_size", tr.config.MaxFileSize)
+			if tr.alerter != nil {
+				tr.alerter.fire(ctx, "oversized", fmt.Sprintf("%s is skipped. size %d bytes exceeds %d bytes", path, st.Size(), tr.config.MaxFileSize),
+					float64(st.Size()), float64(tr.config.MaxFileSize))
+			}
+		}
+	}
+	return true
+}
+
+// applyFilePolicy removes or moves the file without uploading by the policy.
+// It reports whether the file is handled.
+func (tr *Transporter) applyFilePolicy(ctx context.Context, path string, st os.FileInfo) (bool, error) {
+	switch tr.filePolicy(st) {
+	case FilePolicyDelete:
+		slog.InfoContext(ctx, "remove file without uploading", "path", path, "size", st.Size())
+		return true, tr.remove(ctx, path)
+	case FilePolicyDeadLetter:
+		dst, err := tr.deadLetter(path)
+		if err != nil {
+			return true, fmt.Errorf("failed to move %s to the dead-letter directory: %w", path, err)
+		}
+		tr.metrics.DeadLettered()
+		slog.WarnContext(ctx, "moved oversized file to the dead-letter directory", "path", path, "dead_letter", dst, "size", st.Size())
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,138 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestFilePolicy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	deadLetter := t.TempDir()
+	empty := s3movertest.WriteFile(t, dir, "empty.txt", []byte{})
+	large := s3movertest.WriteFile(t, dir, "large.txt", []byte("0123456789"))
+	small := s3movertest.WriteFile(t, dir, "small.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:          dir,
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/policy",
+		MaxParallels:    1,
+		EmptyFilePolicy: s3mover.FilePolicySkip,
+		MaxFileSize:     5,
+		DeadLetterDir:   deadLetter,
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 1 || total != 1 {
+		t.Fatalf("unexpected flush result: %d/%d %v", processed, total, err)
+	}
+	if len(client.Keys()) != 1 {
+		t.Errorf("only the small file must be uploaded: %v", client.Keys())
+	}
+	for _, path := range []string{empty, large} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s must be skipped: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(small); !os.IsNotExist(err) {
+		t.Errorf("small file must be removed: %v", err)
+	}
+
+	// switch the policies
+	config.EmptyFilePolicy = s3mover.FilePolicyDelete
+	config.OversizedFilePolicy = s3mover.FilePolicyDeadLetter
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 2 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	if len(client.Keys()) != 1 {
+		t.Errorf("must not be uploaded: %v", client.Keys())
+	}
+	if _, err := os.Stat(empty); !os.IsNotExist(err) {
+		t.Errorf("empty file must be removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(deadLetter, "large.txt")); err != nil {
+		t.Errorf("large file must be moved to the dead-letter directory: %v", err)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.DeadLettered != 1 || m.Objects.Errored != 0 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
+
+func TestFilePolicyMultipart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	large := s3movertest.WriteFile(t, dir, "large.txt", []byte("0123456789"))
+	s3movertest.WriteFile(t, dir, "small.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:              dir,
+		Bucket:              "testbucket",
+		KeyPrefix:           "test/policy",
+		MaxParallels:        1,
+		MaxFileSize:         5,
+		OversizedFilePolicy: s3mover.FilePolicyMultipart,
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 2 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	if len(client.Keys()) != 2 || client.MultipartUploads != 1 {
+		t.Errorf("only the large file must be uploaded by multipart: %v %d", client.Keys(), client.MultipartUploads)
+	}
+	if _, err := os.Stat(large); !os.IsNotExist(err) {
+		t.Errorf("large file must be removed: %v", err)
+	}
+}
+
+func TestFilePolicySkippedPrune(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	large := s3movertest.WriteFile(t, dir, "large.txt", []byte("0123456789"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/policy",
+		MaxParallels: 1,
+		MaxFileSize:  5,
+	}
+	tr, _ := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := tr.SkippedFiles(); n != 1 {
+		t.Fatalf("the large file must be skipped: %d", n)
+	}
+	if err := os.Remove(large); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := tr.SkippedFiles(); n != 0 {
+		t.Errorf("the removed file must be forgotten: %d", n)
+	}
+}
+
+func TestFilePolicyValidate(t *testing.T) {
+	valid := s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/policy", MaxFileSize: 5}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, config := range []s3mover.Config{
+		{EmptyFilePolicy: "unknown"},
+		{OversizedFilePolicy: s3mover.FilePolicyDelete},
+		{OversizedFilePolicy: s3mover.FilePolicyDeadLetter},
+		{OversizedFilePolicy: s3mover.FilePolicyMultipart, MultipartPartSize: 1},
+		{MaxFileSize: -1},
+	} {
+		config.SrcDir = "."
+		config.Bucket = "testbucket"
+		config.KeyPrefix = "test/policy"
+		if err := config.Validate(); err == nil {
+			t.Errorf("must be invalid: %+v", config)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package s3mover
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/fujiwara/s3mover/s3moverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultGRPCMaxMessageSize is the default maximum size of a request message.
+// It accepts the content of UploadFile up to MaxIngestSize with the name.
+const DefaultGRPCMaxMessageSize = MaxIngestSize + 1<<20
+
+// grpcServer implements s3moverpb.ControlServer.
+type grpcServer struct {
+	s3moverpb.UnimplementedControlServer
+	tr *Transporter
+}
+
+// NewGRPCServer creates a gRPC server that serves the control API of the Transporter.
+func (tr *Transporter) NewGRPCServer() *grpc.Server {
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(tr.config.GRPCMaxMessageSize)}
+	if tr.config.IngestToken != "" {
+		opts = append(opts, grpc.UnaryInterceptor(tr.grpcAuthInterceptor))
+	}
+	srv := grpc.NewServer(opts...)
+	s3moverpb.RegisterControlServer(srv, &grpcServer{tr: tr})
+	return srv
+}
+
+// runGRPCServer serves the gRPC server on l opened by grpcListen. It does nothing if l is nil.
+func (tr *Transporter) runGRPCServer(ctx context.Context, l net.Listener) error {
+	ctx = slogcontext.WithValue(ctx, "component", "grpc-server")
+	if l == nil {
+		return nil
+	}
+	srv := tr.NewGRPCServer()
+	slog.InfoContext(ctx, "starting up gRPC server", "listen", tr.config.GRPCListen)
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			slog.ErrorContext(ctx, "failed to serve gRPC server", "error", err.Error())
+		}
+	}()
+
+	<-ctx.Done()
+	slog.InfoContext(ctx, "shutting down gRPC server")
+	srv.GracefulStop()
+	return nil
+}
+
+// grpcListen listens on addr. "unix:" prefix means a unix domain socket. It returns nil if addr is empty.
+func grpcListen(addr string) (net.Listener, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// remove the stale socket left by the previous process
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (tr *Transporter) grpcAuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(tr.config.IngestToken)) == 1 {
+			return handler(ctx, req)
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+func (s *grpcServer) UploadFile(ctx context.Context, req *s3moverpb.UploadFileRequest) (*s3moverpb.UploadFileResponse, error) {
+	name := req.GetName()
+	if err := validIngestName(name); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	path := filepath.Join(s.tr.config.SrcDir, name)
+	size, err := s.tr.ingest(path, bytes.NewReader(req.GetContent()))
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, status.Errorf(codes.AlreadyExists, "%s already exists", name)
+		}
+		if errors.Is(err, errSpoolFull) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	slog.InfoContext(ctx, "ingested", "path", path, "size", size)
+	return &s3moverpb.UploadFileResponse{Path: path, Size: size}, nil
+}
+
+func (s *grpcServer) Pause(ctx context.Context, req *s3moverpb.PauseRequest) (*s3moverpb.PauseResponse, error) {
+	s.tr.Pause()
+	return &s3moverpb.PauseResponse{}, nil
+}
+
+func (s *grpcServer) Resume(ctx context.Context, req *s3moverpb.ResumeRequest) (*s3moverpb.ResumeResponse, error) {
+	s.tr.Resume()
+	return &s3moverpb.ResumeResponse{}, nil
+}
+
+func (s *grpcServer) Flush(ctx context.Context, req *s3moverpb.FlushRequest) (*s3moverpb.FlushResponse, error) {
+	processed, total, err := s.tr.Flush(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &s3moverpb.FlushResponse{Processed: processed, Total: total}, nil
+}
+
+func (s *grpcServer) GetMetrics(ctx context.Context, req *s3moverpb.GetMetricsRequest) (*s3moverpb.GetMetricsResponse, error) {
+	m := s.tr.Metrics().Snapshot()
+	return &s3moverpb.GetMetricsResponse{
+		Uploaded: m.Objects.Uploaded,
+		Errored:  m.Objects.Errored,
+		Queued:   m.Objects.Queued,
+		Paused:   s.tr.Paused(),
+	}, nil
+}
+
+func (s *grpcServer) ListPending(ctx context.Context, req *s3moverpb.ListPendingRequest) (*s3moverpb.ListPendingResponse, error) {
+	paths, err := s.tr.listSrc()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	counts := make(map[string]int64)
+	for _, f := range s.tr.Failures() {
+		counts[f.Path] = int64(f.Count)
+	}
+	res := &s3moverpb.ListPendingResponse{}
+	for _, path := range paths {
+		st, err := os.Stat(path)
+		if err != nil {
+			continue // already transported
+		}
+		res.Files = append(res.Files, &s3moverpb.PendingFile{
+			Path:         path,
+			Size:         st.Size(),
+			ModifiedAt:   timestamppb.New(st.ModTime()),
+			FailureCount: counts[path],
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package s3mover_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3moverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCControl(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/grpc",
+		MaxParallels: 1,
+		IngestToken:  "secret",
+		GRPCListen:   "127.0.0.1:0",
+	}
+	tr, s3 := newTestTransporter(t, config)
+
+	l := bufconn.Listen(1 << 20)
+	srv := tr.NewGRPCServer()
+	go srv.Serve(l)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := s3moverpb.NewControlClient(conn)
+
+	if _, err := client.Pause(ctx, &s3moverpb.PauseRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("must be unauthenticated: %v", err)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+
+	if _, err := client.UploadFile(ctx, &s3moverpb.UploadFileRequest{Name: "../foo.txt"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("must be invalid argument: %v", err)
+	}
+	up, err := client.UploadFile(ctx, &s3moverpb.UploadFileRequest{Name: "foo.txt", Content: []byte("foo")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up.Size != 3 {
+		t.Errorf("unexpected size: %d", up.Size)
+	}
+	if _, err := client.UploadFile(ctx, &s3moverpb.UploadFileRequest{Name: "foo.txt", Content: []byte("foo")}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("must be already exists: %v", err)
+	}
+
+	pending, err := client.ListPending(ctx, &s3moverpb.ListPendingRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending.Files) != 1 || pending.Files[0].Path != up.Path {
+		t.Errorf("unexpected pending files: %v", pending.Files)
+	}
+
+	if _, err := client.Pause(ctx, &s3moverpb.PauseRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := client.GetMetrics(ctx, &s3moverpb.GetMetricsRequest{}); err != nil {
+		t.Fatal(err)
+	} else if !m.Paused {
+		t.Error("must be paused")
+	}
+
+	// Flush transports files even while paused
+	fl, err := client.Flush(ctx, &s3moverpb.FlushRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fl.Processed != 1 || fl.Total != 1 {
+		t.Errorf("unexpected flush result: %v", fl)
+	}
+	if len(s3.Keys()) != 1 {
+		t.Errorf("unexpected objects: %v", s3.Keys())
+	}
+	m, err := client.GetMetrics(ctx, &s3moverpb.GetMetricsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Uploaded != 1 {
+		t.Errorf("unexpected uploaded: %d", m.Uploaded)
+	}
+
+	if _, err := client.Resume(ctx, &s3moverpb.ResumeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Paused() {
+		t.Error("must be resumed")
+	}
+
+	// larger than the default limit of gRPC, 4 MiB
+	large := make([]byte, 5<<20)
+	if up, err := client.UploadFile(ctx, &s3moverpb.UploadFileRequest{Name: "large.txt", Content: large}); err != nil {
+		t.Fatal(err)
+	} else if up.Size != int64(len(large)) {
+		t.Errorf("unexpected size: %d", up.Size)
+	}
+}
+
+func TestGRPCListenRequiresToken(t *testing.T) {
+	for listen, valid := range map[string]bool{
+		"127.0.0.1:9899":             false,
+		":9899":                      false,
+		"unix:/var/run/s3mover.sock": true,
+	} {
+		config := &s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/grpc", GRPCListen: listen}
+		if err := config.Validate(); (err == nil) != valid {
+			t.Errorf("unexpected validation result of %s: %v", listen, err)
+		}
+		config.IngestToken = "secret"
+		if err := config.Validate(); err != nil {
+			t.Errorf("%s must be valid with the token: %v", listen, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestGzipSuffix(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		suffix     string
+		replaceExt bool
+		expected   string
+	}{
+		{"", false, "/foo.log.gz"},
+		{".gzip", false, "/foo.log.gzip"},
+		{s3mover.GzipSuffixNone, false, "/foo.log"},
+		{"", true, "/foo.gz"},
+		{".gzip", true, "/foo.gzip"},
+	} {
+		src := t.TempDir()
+		s3movertest.WriteFile(t, src, "foo.log", []byte("foo"))
+		config := &s3mover.Config{
+			SrcDir:         src,
+			Bucket:         "testbucket",
+			KeyPrefix:      "test/gzip",
+			MaxParallels:   1,
+			TimeFormat:     "2006/01/02",
+			Gzip:           true,
+			GzipSuffix:     c.suffix,
+			GzipReplaceExt: c.replaceExt,
+		}
+		tr, client := newTestTransporter(t, config)
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		keys := client.Keys()
+		if len(keys) != 1 || !strings.HasSuffix(keys[0], c.expected) {
+			t.Errorf("suffix %q replace-ext %v: unexpected keys %v, want suffix %s", c.suffix, c.replaceExt, keys, c.expected)
+			continue
+		}
+
+		dest := t.TempDir()
+		results, err := tr.Restore(ctx, s3mover.RestoreOption{Dest: dest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Status != s3mover.RestoreStatusRestored {
+			t.Fatalf("unexpected results: %v", results)
+		}
+		if b, err := os.ReadFile(results[0].Path); err != nil || string(b) != "foo" {
+			t.Errorf("suffix %q: %s must be decompressed: %q %v", c.suffix, results[0].Path, b, err)
+		}
+		if !c.replaceExt && filepath.Base(results[0].Path) != "foo.log" {
+			t.Errorf("suffix %q: unexpected restored path %s", c.suffix, results[0].Path)
+		}
+	}
+}
+
+func TestGzipSuffixValidate(t *testing.T) {
+	for _, c := range []struct {
+		suffix     string
+		replaceExt bool
+	}{
+		{"gz", false},
+		{".g/z", false},
+		{s3mover.GzipSuffixNone, true},
+	} {
+		config := &s3mover.Config{
+			SrcDir:         t.TempDir(),
+			Bucket:         "testbucket",
+			KeyPrefix:      "test/gzip",
+			Gzip:           true,
+			GzipSuffix:     c.suffix,
+			GzipReplaceExt: c.replaceExt,
+		}
+		if err := config.Validate(); err == nil {
+			t.Errorf("gzip suffix %q with replace-ext %v must be invalid", c.suffix, c.replaceExt)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package s3mover
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// MetadataSHA256 is the object metadata key of the hex-encoded SHA-256 of the content of the file with -content-hash.
+const MetadataSHA256 = "sha256"
+
+// fileHashes holds the content hashes of the files being uploaded.
+type fileHashes struct {
+	mu     sync.Mutex
+	hashes map[string]string // path -> hex-encoded SHA-256
+}
+
+func (h *fileHashes) put(path, sum string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hashes == nil {
+		h.hashes = make(map[string]string)
+	}
+	h.hashes[path] = sum
+}
+
+func (h *fileHashes) get(path string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sum, ok := h.hashes[path]
+	return sum, ok
+}
+
+func (h *fileHashes) remove(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.hashes, path)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashContent computes the SHA-256 of the content of the file to upload with ContentHash.
+// The hash is stored in the object metadata and the journal. The returned function forgets it.
+func (tr *Transporter) hashContent(path string) (string, func(), error) {
+	if !tr.config.ContentHash {
+		return "", func() {}, nil
+	}
+	sum, err := fileSHA256(tr.staged.source(path))
+	if err != nil {
+		return "", nil, asLocalReadError(path, err)
+	}
+	tr.hashes.put(path, sum)
+	return sum, func() { tr.hashes.remove(path) }, nil
+}
+
+// uploadedSameContent reports whether the journal records the file of the same content uploaded at the path,
+// such as the file recreated or touched after the upload. The journal entry is updated to the file
+// without uploading again.
+func (tr *Transporter) uploadedSameContent(ctx context.Context, path, sum string, st os.FileInfo) (bool, error) {
+	if sum == "" || tr.journal == nil {
+		return false, nil
+	}
+	e, ok := tr.journal.get(path)
+	if !ok || e.SHA256 != sum {
+		return false, nil
+	}
+	slog.InfoContext(ctx, "the same content is already uploaded. skip uploading", "path", path, "key", e.Key)
+	tr.metrics.Deduplicated()
+	updated := *e
+	updated.Size, updated.ModTime = st.Size(), st.ModTime()
+	return true, tr.journal.put(&updated)
+}
@@ -0,0 +1,78 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestContentHash(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal := filepath.Join(t.TempDir(), "journal")
+	client := s3movertest.NewMockS3Client()
+	newTransporter := func() *s3mover.Transporter {
+		config := &s3mover.Config{
+			SrcDir:         dir,
+			Bucket:         "testbucket",
+			KeyPrefix:      "test/hash",
+			MaxParallels:   1,
+			Mirror:         true,
+			RevisionSuffix: true,
+			JournalPath:    journal,
+			ContentHash:    true,
+		}
+		tr, _ := newTestTransporter(t, config)
+		tr.SetS3Client(client)
+		return tr
+	}
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	tr := newTransporter()
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 1 {
+		t.Fatalf("unexpected objects: %v", client.Keys())
+	}
+	for _, obj := range client.Objects {
+		// sha256 of "foo"
+		if sum := obj.Metadata[s3mover.MetadataSHA256]; sum != "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae" {
+			t.Errorf("unexpected sha256 metadata: %s", sum)
+		}
+	}
+
+	// recreated with the same content after the restart
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(foo, later, later); err != nil {
+		t.Fatal(err)
+	}
+	tr = newTransporter()
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 1 {
+		t.Errorf("the same content must not be uploaded again: %v", client.Keys())
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Deduplicated != 1 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+	// not processed again after updating the journal
+	if _, total, err := tr.Flush(ctx); err != nil || total != 0 {
+		t.Errorf("the file must be kept: %d %v", total, err)
+	}
+
+	if err := os.WriteFile(foo, []byte("bar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 2 {
+		t.Errorf("the modified content must be uploaded: %v", client.Keys())
+	}
+}
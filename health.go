@@ -0,0 +1,72 @@
+package s3mover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusStarting = "starting"
+
+	// HealthStatusDegraded means the agent is running but not able to transport files.
+	HealthStatusDegraded = "degraded"
+)
+
+// Health represents the health of the agent served at /healthz.
+type Health struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// OK reports whether the agent is healthy.
+func (h *Health) OK() bool {
+	return h.Status == HealthStatusOK
+}
+
+func (tr *Transporter) setHealth(status, message string) {
+	tr.health.Store(&Health{Status: status, Message: message})
+}
+
+// Health returns the current health of the agent.
+func (tr *Transporter) Health() *Health {
+	if h := tr.health.Load(); h != nil {
+		return h
+	}
+	return &Health{Status: HealthStatusStarting}
+}
+
+func (tr *Transporter) healthHandler(w http.ResponseWriter, r *http.Request) {
+	h := tr.Health()
+	w.Header().Set("Content-type", "application/json")
+	if !h.OK() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
+}
+
+// Healthcheck queries /healthz of the stats server at endpoint.
+// It returns an error if the agent is not healthy.
+func Healthcheck(ctx context.Context, endpoint string) (*Health, error) {
+	u := strings.TrimSuffix(endpoint, "/") + "/healthz"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: statsClientTimeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	h := &Health{}
+	if err := json.NewDecoder(resp.Body).Decode(h); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK || !h.OK() {
+		return h, fmt.Errorf("unhealthy: %s %s", h.Status, h.Message)
+	}
+	return h, nil
+}
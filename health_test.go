@@ -0,0 +1,35 @@
+package s3mover_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestHealthcheck(t *testing.T) {
+	ctx := context.Background()
+	tr, err := s3mover.New(ctx, &s3mover.Config{MaxParallels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(tr.HealthHandler())
+	defer srv.Close()
+
+	if h, err := s3mover.Healthcheck(ctx, srv.URL); err == nil {
+		t.Errorf("must be unhealthy while starting: %v", h)
+	} else if h.Status != s3mover.HealthStatusStarting {
+		t.Errorf("unexpected status: %s", h.Status)
+	}
+
+	tr.SetHealth(s3mover.HealthStatusOK, "")
+	if _, err := s3mover.Healthcheck(ctx, srv.URL); err != nil {
+		t.Errorf("must be healthy: %s", err)
+	}
+
+	tr.SetHealth(s3mover.HealthStatusDegraded, "src is not found")
+	if h, err := s3mover.Healthcheck(ctx, srv.URL); err == nil {
+		t.Errorf("must be unhealthy: %v", h)
+	}
+}
@@ -0,0 +1,82 @@
+package s3mover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultHeartbeatKey is the default key of the heartbeat object in the bucket.
+const DefaultHeartbeatKey = "s3mover-heartbeat/{hostname}.json"
+
+// Heartbeat represents the content of the heartbeat object.
+// The LastModified of the object is the time of the latest heartbeat.
+type Heartbeat struct {
+	Hostname string    `json:"hostname"`
+	Time     time.Time `json:"time"`
+	Health   *Health   `json:"health"`
+	Paused   bool      `json:"paused"`
+	Uploaded int64     `json:"uploaded"`
+	Errored  int64     `json:"errored"`
+	Queued   int64     `json:"queued"`
+}
+
+// runHeartbeat puts the heartbeat object every HeartbeatInterval, so that a central process can detect
+// the hosts whose s3mover has died by the staleness of the objects.
+func (tr *Transporter) runHeartbeat(ctx context.Context) error {
+	if tr.config.HeartbeatInterval <= 0 || tr.config.Observe {
+		return nil
+	}
+	ctx = slogcontext.WithValue(ctx, "component", "heartbeat")
+	ticker := time.NewTicker(tr.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := tr.putHeartbeat(ctx, time.Now()); err != nil {
+			// the next heartbeat may succeed
+			slog.WarnContext(ctx, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// putHeartbeat puts the heartbeat object of now to the bucket.
+func (tr *Transporter) putHeartbeat(ctx context.Context, now time.Time) error {
+	m := tr.metrics.Snapshot()
+	hostname, _ := os.Hostname()
+	b, err := json.Marshal(Heartbeat{
+		Hostname: hostname,
+		Time:     now,
+		Health:   tr.Health(),
+		Paused:   tr.Paused(),
+		Uploaded: m.Objects.Uploaded,
+		Errored:  m.Objects.Errored,
+		Queued:   m.Objects.Queued,
+	})
+	if err != nil {
+		return err
+	}
+	key := tr.config.HeartbeatKey
+	if _, err := tr.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &tr.config.Bucket,
+		Key:           &key,
+		Body:          bytes.NewReader(b),
+		ContentLength: aws.Int64(int64(len(b))),
+		ContentType:   aws.String("application/json"),
+	}); err != nil {
+		return fmt.Errorf("failed to put heartbeat to s3://%s/%s: %w", tr.config.Bucket, key, err)
+	}
+	slog.DebugContext(ctx, "heartbeat", "s3url", fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key))
+	return nil
+}
@@ -0,0 +1,44 @@
+package s3mover_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	config := &s3mover.Config{
+		SrcDir:            t.TempDir(),
+		Bucket:            "testbucket",
+		KeyPrefix:         "test/heartbeat",
+		MaxParallels:      1,
+		HeartbeatInterval: time.Minute,
+	}
+	tr, client := newTestTransporter(t, config)
+	now := time.Date(2024, 6, 1, 12, 34, 56, 0, time.UTC)
+	if err := tr.PutHeartbeat(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	obj, ok := client.Objects["s3mover-heartbeat/"+hostname+".json"]
+	if !ok {
+		t.Fatalf("heartbeat object not found: %v", client.Objects)
+	}
+	var hb s3mover.Heartbeat
+	if err := json.Unmarshal(obj.Content, &hb); err != nil {
+		t.Fatal(err)
+	}
+	if hb.Hostname != hostname || !hb.Time.Equal(now) || hb.Health == nil {
+		t.Errorf("unexpected heartbeat: %+v", hb)
+	}
+
+	doc := (&s3mover.Config{Bucket: "testbucket", KeyPrefix: "test/heartbeat", HeartbeatInterval: time.Minute}).IAMPolicy(s3mover.IAMPolicyOption{})
+	if r := doc.Statement[0].Resource; len(r) != 2 || r[1] != "arn:aws:s3:::testbucket/s3mover-heartbeat/*.json" {
+		t.Errorf("unexpected resources: %v", r)
+	}
+}
@@ -0,0 +1,24 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// newTestTransporter validates the config and returns a new Transporter uploading to a mock S3 client.
+func newTestTransporter(t testing.TB, config *s3mover.Config) (*s3mover.Transporter, *s3movertest.MockS3Client) {
+	t.Helper()
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := s3mover.New(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := s3movertest.NewMockS3Client()
+	tr.SetS3Client(client)
+	return tr, client
+}
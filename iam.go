@@ -0,0 +1,178 @@
+package s3mover
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// IAMPolicyOption represents options for IAMPolicy.
+type IAMPolicyOption struct {
+	// Verify allows HeadObject for the verify subcommand.
+	Verify bool
+	// Validate allows DeleteObject to clean up the test object of the validate subcommand.
+	Validate bool
+	// Restore allows ListBucket and GetObject for the restore subcommand.
+	Restore bool
+	// AbortUploads allows ListBucketMultipartUploads and AbortMultipartUpload for the abort-uploads subcommand.
+	AbortUploads bool
+	// KMSKeyARN allows the KMS key used by the default encryption of the bucket.
+	KMSKeyARN string
+}
+
+// IAMPolicyDocument represents an IAM policy document.
+type IAMPolicyDocument struct {
+	Version   string               `json:"Version"`
+	Statement []IAMPolicyStatement `json:"Statement"`
+}
+
+// IAMPolicyStatement represents a statement of an IAM policy document.
+type IAMPolicyStatement struct {
+	Sid      string   `json:"Sid,omitempty"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+	// Condition is a map of the condition operators to the condition keys and values.
+	Condition map[string]map[string][]string `json:"Condition,omitempty"`
+}
+
+// IAMPolicy returns the minimal IAM policy to run s3mover with the configuration.
+func (c *Config) IAMPolicy(opt IAMPolicyOption) *IAMPolicyDocument {
+	actions := []string{"s3:PutObject"}
+	if opt.Verify || opt.Restore || c.DedupeOnStartup {
+		// HeadObject requires s3:GetObject
+		actions = append(actions, "s3:GetObject")
+	}
+	if opt.Validate {
+		actions = append(actions, "s3:DeleteObject")
+	}
+	if c.Sidecar {
+		// the tags of the sidecars
+		actions = append(actions, "s3:PutObjectTagging")
+	}
+	abortUploads := opt.AbortUploads || c.AbortStaleUploadsAfter > 0
+	if c.MultipartThreshold > 0 || abortUploads {
+		// the other multipart APIs are allowed by s3:PutObject
+		actions = append(actions, "s3:AbortMultipartUpload")
+		if c.ResumeJournalPath != "" {
+			// ListParts to resume the multipart uploads
+			actions = append(actions, "s3:ListMultipartUploadParts")
+		}
+	}
+	doc := &IAMPolicyDocument{
+		Version: "2012-10-17",
+		Statement: []IAMPolicyStatement{
+			{
+				Sid:      "S3Objects",
+				Effect:   "Allow",
+				Action:   actions,
+				Resource: []string{objectsARN(c.Bucket, c.KeyPrefix)},
+			},
+		},
+	}
+	if c.FallbackBucket != "" {
+		doc.Statement[0].Resource = append(doc.Statement[0].Resource, objectsARN(c.FallbackBucket, c.KeyPrefix))
+	}
+	for _, s := range c.Destinations {
+		// S3 compatible storage with the custom endpoint is out of IAM
+		if d, err := ParseDestination(s, c.KeyPrefix); err == nil && d.Endpoint == "" {
+			doc.Statement[0].Resource = append(doc.Statement[0].Resource, objectsARN(d.Bucket, d.Prefix))
+		}
+	}
+	if c.BatchManifestPrefix != "" {
+		doc.Statement[0].Resource = append(doc.Statement[0].Resource, objectsARN(c.Bucket, c.BatchManifestPrefix))
+	}
+	if c.HeartbeatInterval > 0 {
+		key := c.HeartbeatKey
+		if key == "" {
+			key = DefaultHeartbeatKey
+		}
+		doc.Statement[0].Resource = append(doc.Statement[0].Resource, objectARN(c.Bucket, "")+keyVarRegexp.ReplaceAllString(key, "*"))
+	}
+	// HeadObject of a missing object returns 403 instead of 404 without s3:ListBucket
+	if opt.Restore || c.DedupeOnStartup {
+		doc.Statement = append(doc.Statement, IAMPolicyStatement{
+			Sid:       "S3List",
+			Effect:    "Allow",
+			Action:    []string{"s3:ListBucket"},
+			Resource:  []string{bucketARN(c.Bucket)},
+			Condition: map[string]map[string][]string{"StringLike": {"s3:prefix": {prefixPattern(c.KeyPrefix)}}},
+		})
+	}
+	if c.Paranoid {
+		resources := []string{bucketARN(c.Bucket)}
+		if c.FallbackBucket != "" {
+			resources = append(resources, bucketARN(c.FallbackBucket))
+		}
+		doc.Statement = append(doc.Statement, IAMPolicyStatement{
+			Sid:      "S3Protection",
+			Effect:   "Allow",
+			Action:   []string{"s3:GetBucketVersioning", "s3:GetReplicationConfiguration"},
+			Resource: resources,
+		})
+	}
+	if c.SQSQueueURL != "" {
+		doc.Statement = append(doc.Statement, IAMPolicyStatement{
+			Sid:      "SQS",
+			Effect:   "Allow",
+			Action:   []string{"sqs:ReceiveMessage", "sqs:DeleteMessage"},
+			Resource: []string{sqsQueueARN(c.SQSQueueURL)},
+		})
+	}
+	if abortUploads {
+		doc.Statement = append(doc.Statement, IAMPolicyStatement{
+			// s3:prefix is not available for ListMultipartUploads
+			Sid:      "S3ListUploads",
+			Effect:   "Allow",
+			Action:   []string{"s3:ListBucketMultipartUploads"},
+			Resource: []string{bucketARN(c.Bucket)},
+		})
+	}
+	if opt.KMSKeyARN != "" {
+		doc.Statement = append(doc.Statement, IAMPolicyStatement{
+			Sid:      "KMS",
+			Effect:   "Allow",
+			Action:   []string{"kms:GenerateDataKey"},
+			Resource: []string{opt.KMSKeyARN},
+		})
+	}
+	return doc
+}
+
+// objectsARN returns the ARN of the objects that s3mover puts to the bucket with the prefix.
+// The key variables in the prefix are replaced with wildcards to allow all the hosts.
+func objectsARN(bucket, keyPrefix string) string {
+	return objectARN(bucket, prefixPattern(keyPrefix))
+}
+
+// objectARN returns the ARN of the object of the key in the bucket, or via the access point ARN.
+func objectARN(bucket, key string) string {
+	if arn.IsARN(bucket) {
+		return bucket + "/object/" + key
+	}
+	return "arn:aws:s3:::" + bucket + "/" + key
+}
+
+// prefixPattern returns the wildcard pattern of the keys under the prefix.
+func prefixPattern(keyPrefix string) string {
+	prefix := strings.Trim(keyVarRegexp.ReplaceAllString(keyPrefix, "*"), "/")
+	if prefix == "" {
+		return "*"
+	}
+	return prefix + "/*"
+}
+
+// sqsQueueARN converts the URL of the SQS queue (https://sqs.{region}.amazonaws.com/{account}/{name}) to the ARN.
+func sqsQueueARN(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return "*"
+	}
+	host := strings.Split(u.Host, ".")
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(host) < 2 || host[0] != "sqs" || len(path) != 2 {
+		return "*"
+	}
+	return "arn:aws:sqs:" + host[1] + ":" + path[0] + ":" + path[1]
+}
@@ -0,0 +1,59 @@
+package s3mover_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+var testIAMPolicies = []struct {
+	prefix   string
+	queueURL string
+	opt      s3mover.IAMPolicyOption
+	expected string
+}{
+	{
+		"myprefix/",
+		"",
+		s3mover.IAMPolicyOption{},
+		`{"Version":"2012-10-17","Statement":[{"Sid":"S3Objects","Effect":"Allow","Action":["s3:PutObject"],"Resource":["arn:aws:s3:::mybucket/myprefix/*"]}]}`,
+	},
+	{
+		"/foo/bar",
+		"",
+		s3mover.IAMPolicyOption{Verify: true, Validate: true, KMSKeyARN: "arn:aws:kms:ap-northeast-1:123456789012:key/xxx"},
+		`{"Version":"2012-10-17","Statement":[{"Sid":"S3Objects","Effect":"Allow","Action":["s3:PutObject","s3:GetObject","s3:DeleteObject"],"Resource":["arn:aws:s3:::mybucket/foo/bar/*"]},{"Sid":"KMS","Effect":"Allow","Action":["kms:GenerateDataKey"],"Resource":["arn:aws:kms:ap-northeast-1:123456789012:key/xxx"]}]}`,
+	},
+	{
+		"myprefix",
+		"https://sqs.ap-northeast-1.amazonaws.com/123456789012/myqueue",
+		s3mover.IAMPolicyOption{},
+		`{"Version":"2012-10-17","Statement":[{"Sid":"S3Objects","Effect":"Allow","Action":["s3:PutObject"],"Resource":["arn:aws:s3:::mybucket/myprefix/*"]},{"Sid":"SQS","Effect":"Allow","Action":["sqs:ReceiveMessage","sqs:DeleteMessage"],"Resource":["arn:aws:sqs:ap-northeast-1:123456789012:myqueue"]}]}`,
+	},
+	{
+		"logs/{instance_id}",
+		"",
+		s3mover.IAMPolicyOption{},
+		`{"Version":"2012-10-17","Statement":[{"Sid":"S3Objects","Effect":"Allow","Action":["s3:PutObject"],"Resource":["arn:aws:s3:::mybucket/logs/*/*"]}]}`,
+	},
+	{
+		"logs/{hostname}/",
+		"",
+		s3mover.IAMPolicyOption{Restore: true},
+		`{"Version":"2012-10-17","Statement":[{"Sid":"S3Objects","Effect":"Allow","Action":["s3:PutObject","s3:GetObject"],"Resource":["arn:aws:s3:::mybucket/logs/*/*"]},{"Sid":"S3List","Effect":"Allow","Action":["s3:ListBucket"],"Resource":["arn:aws:s3:::mybucket"],"Condition":{"StringLike":{"s3:prefix":["logs/*/*"]}}}]}`,
+	},
+}
+
+func TestIAMPolicy(t *testing.T) {
+	for _, c := range testIAMPolicies {
+		config := &s3mover.Config{Bucket: "mybucket", KeyPrefix: c.prefix, SQSQueueURL: c.queueURL}
+		b, err := json.Marshal(config.IAMPolicy(c.opt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, string(b))
+		}
+	}
+}
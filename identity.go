@@ -0,0 +1,70 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// checkIdentity resolves the identity of the credentials by STS GetCallerIdentity at startup, which requires no permissions.
+// It reports the misconfigurations of IRSA and EKS Pod Identity clearly, instead of the opaque errors of PutObject.
+func (tr *Transporter) checkIdentity(ctx context.Context) error {
+	if !tr.config.CheckIdentity {
+		return nil
+	}
+	out, err := sts.NewFromConfig(tr.awsConfig).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		if hint := identityHint(); hint != "" {
+			return fmt.Errorf("failed to check the identity (%s): %w", hint, err)
+		}
+		return fmt.Errorf("failed to check the identity: %w", err)
+	}
+	arn := aws.ToString(out.Arn)
+	slog.InfoContext(ctx, "identity resolved",
+		"account", aws.ToString(out.Account), "arn", arn, "user_id", aws.ToString(out.UserId))
+	// the credentials in the environment variables take precedence over IRSA
+	if role := os.Getenv("AWS_ROLE_ARN"); role != "" && os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" && !sameRole(role, arn) {
+		slog.WarnContext(ctx, "the identity is not the role of IRSA. other credentials take precedence", "role_arn", role, "arn", arn)
+	}
+	return nil
+}
+
+// identityHint returns the hint of the misconfigurations of IRSA and EKS Pod Identity found in the environment variables.
+func identityHint() string {
+	var hints []string
+	if file := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); file != "" {
+		if os.Getenv("AWS_ROLE_ARN") == "" {
+			hints = append(hints, "AWS_WEB_IDENTITY_TOKEN_FILE is set but AWS_ROLE_ARN is not. check the eks.amazonaws.com/role-arn annotation of the service account")
+		}
+		if _, err := os.Stat(file); err != nil {
+			hints = append(hints, fmt.Sprintf("the web identity token file of IRSA is unreadable: %s. check the projected volume of the pod", err))
+		}
+	} else if os.Getenv("AWS_ROLE_ARN") != "" {
+		hints = append(hints, "AWS_ROLE_ARN is set but AWS_WEB_IDENTITY_TOKEN_FILE is not. check the pod identity webhook of IRSA")
+	}
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file == "" {
+			hints = append(hints, "AWS_CONTAINER_CREDENTIALS_FULL_URI is set but AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE is not. check the EKS Pod Identity Agent")
+		} else if _, err := os.Stat(file); err != nil {
+			hints = append(hints, fmt.Sprintf("the authorization token file of EKS Pod Identity is unreadable: %s. check the EKS Pod Identity association", err))
+		}
+	}
+	return strings.Join(hints, "; ")
+}
+
+// sameRole reports whether the assumed role ARN of STS is the session of the IAM role ARN.
+// e.g. arn:aws:sts::123456789012:assumed-role/myrole/session is the session of arn:aws:iam::123456789012:role/myrole.
+func sameRole(roleARN, arn string) bool {
+	_, role, ok := strings.Cut(roleARN, ":role/")
+	if !ok {
+		return false
+	}
+	// the path of the role is not included in the assumed role ARN
+	role = role[strings.LastIndex(role, "/")+1:]
+	return strings.Contains(arn, ":assumed-role/"+role+"/")
+}
@@ -0,0 +1,74 @@
+package s3mover_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestCheckIdentity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/s3mover</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`)
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ENDPOINT_URL_STS", srv.URL)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	config := &s3mover.Config{
+		SrcDir:        t.TempDir(),
+		Bucket:        "testbucket",
+		KeyPrefix:     "test/identity",
+		MaxParallels:  1,
+		CheckIdentity: true,
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tr, err := s3mover.New(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.CheckIdentity(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIdentityHint(t *testing.T) {
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", filepath.Join(t.TempDir(), "token"))
+	t.Setenv("AWS_ROLE_ARN", "")
+	hint := s3mover.IdentityHint()
+	if !strings.Contains(hint, "AWS_ROLE_ARN is not") || !strings.Contains(hint, "token file of IRSA is unreadable") {
+		t.Errorf("unexpected hint: %s", hint)
+	}
+}
+
+func TestSameRole(t *testing.T) {
+	for _, c := range []struct {
+		role, arn string
+		same      bool
+	}{
+		{"arn:aws:iam::123456789012:role/myrole", "arn:aws:sts::123456789012:assumed-role/myrole/session", true},
+		{"arn:aws:iam::123456789012:role/path/to/myrole", "arn:aws:sts::123456789012:assumed-role/myrole/session", true},
+		{"arn:aws:iam::123456789012:role/myrole", "arn:aws:sts::123456789012:assumed-role/noderole/i-0123", false},
+		{"arn:aws:iam::123456789012:role/myrole", "arn:aws:iam::123456789012:user/myrole", false},
+	} {
+		if got := s3mover.SameRole(c.role, c.arn); got != c.same {
+			t.Errorf("SameRole(%s, %s) = %v", c.role, c.arn, got)
+		}
+	}
+}
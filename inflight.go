@@ -0,0 +1,43 @@
+package s3mover
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// errInFlight is returned by transport when the file is being transported by another goroutine.
+	errInFlight = errors.New("already in flight")
+	// errLeft is returned by transport when the file is left in the source directory without uploading,
+	// such as owned by the other instances, kept after uploading, or skipped by the policy.
+	errLeft = errors.New("left in the source directory")
+)
+
+// inFlight is the set of the paths being transported. It guarantees that the same path is never
+// transported twice concurrently, even if the scans overlap or the same path is notified by SQS twice.
+type inFlight struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{paths: make(map[string]struct{})}
+}
+
+// acquire adds the path to the set, and reports whether it was not in flight.
+func (f *inFlight) acquire(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.paths[path]; ok {
+		return false
+	}
+	f.paths[path] = struct{}{}
+	return true
+}
+
+// release removes the path from the set.
+func (f *inFlight) release(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.paths, path)
+}
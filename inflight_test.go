@@ -0,0 +1,58 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// blockingS3Client blocks PutObject until unblocked.
+type blockingS3Client struct {
+	*s3movertest.MockS3Client
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (c *blockingS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.started <- struct{}{}
+	<-c.unblock
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestInFlight(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/inflight",
+		MaxParallels: 2,
+	}
+	tr, _ := newTestTransporter(t, config)
+	client := &blockingS3Client{
+		MockS3Client: s3movertest.NewMockS3Client(),
+		started:      make(chan struct{}),
+		unblock:      make(chan struct{}),
+	}
+	tr.SetS3Client(client)
+	done := make(chan error)
+	go func() {
+		done <- tr.Transport(ctx, path)
+	}()
+	<-client.started
+	if err := tr.Transport(ctx, path); !errors.Is(err, s3mover.ErrInFlight) {
+		t.Errorf("the same path must not be transported concurrently: %v", err)
+	}
+	close(client.unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 1 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+}
@@ -0,0 +1,119 @@
+package s3mover
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+)
+
+// MaxIngestSize is the maximum size of a request body accepted by /ingest.
+const MaxIngestSize = 100 << 20
+
+// IngestResult is the response of /ingest.
+type IngestResult struct {
+	Path  string `json:"path,omitempty"`
+	Size  int64  `json:"size,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ingestHandler accepts a file body and writes it into the source directory.
+// The file is written to a hidden temporary file and linked to the final name,
+// so the pipeline never sees a partially written file.
+func (tr *Transporter) ingestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := slogcontext.WithValue(r.Context(), "component", "ingest")
+	reply := func(code int, res IngestResult) {
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(res)
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		reply(http.StatusMethodNotAllowed, IngestResult{Error: "method not allowed"})
+		return
+	}
+	if !tr.ingestAuthorized(r) {
+		reply(http.StatusUnauthorized, IngestResult{Error: "unauthorized"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if err := validIngestName(name); err != nil {
+		reply(http.StatusBadRequest, IngestResult{Error: err.Error()})
+		return
+	}
+	path := filepath.Join(tr.config.SrcDir, name)
+	size, err := tr.ingest(path, http.MaxBytesReader(w, r.Body, MaxIngestSize))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		switch {
+		case errors.As(err, &mbe):
+			reply(http.StatusRequestEntityTooLarge, IngestResult{Error: err.Error()})
+		case errors.Is(err, os.ErrExist):
+			reply(http.StatusConflict, IngestResult{Error: fmt.Sprintf("%s already exists", name)})
+		case errors.Is(err, errSpoolFull):
+			reply(http.StatusInsufficientStorage, IngestResult{Error: err.Error()})
+		default:
+			slog.ErrorContext(ctx, "failed to ingest", "path", path, "error", err.Error())
+			reply(http.StatusInternalServerError, IngestResult{Error: "failed to write file"})
+		}
+		return
+	}
+	slog.InfoContext(ctx, "ingested", "path", path, "size", size)
+	reply(http.StatusCreated, IngestResult{Path: path, Size: size})
+}
+
+func (tr *Transporter) ingestAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(tr.config.IngestToken)) == 1
+}
+
+func validIngestName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name is required")
+	case strings.HasPrefix(name, "."):
+		return errors.New("name must not start with a dot")
+	case strings.ContainsAny(name, `/\`) || filepath.Base(name) != name:
+		return errors.New("name must not contain path separators")
+	}
+	return nil
+}
+
+func (tr *Transporter) ingest(path string, body io.Reader) (int64, error) {
+	if tr.spoolRejecting() {
+		return 0, errSpoolFull
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ingest-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	// os.Link fails if the path already exists, unlike os.Rename.
+	if err := os.Link(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,80 @@
+package s3mover_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestIngest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	tr, err := s3mover.New(ctx, &s3mover.Config{
+		SrcDir:       dir,
+		MaxParallels: 1,
+		IngestToken:  "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(tr.IngestHandler())
+	defer srv.Close()
+
+	post := func(name, token, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/ingest?name="+name, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"a.log", "", http.StatusUnauthorized},
+		{"a.log", "wrong", http.StatusUnauthorized},
+		{"", "secret", http.StatusBadRequest},
+		{".hidden", "secret", http.StatusBadRequest},
+		{"..%2Fescape", "secret", http.StatusBadRequest},
+		{"a.log", "secret", http.StatusCreated},
+		{"a.log", "secret", http.StatusConflict},
+	}
+	for _, c := range cases {
+		if code := post(c.name, c.token, "hello"); code != c.code {
+			t.Errorf("name=%q token=%q: unexpected status %d, want %d", c.name, c.token, code, c.code)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "a.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("unexpected content: %q", b)
+	}
+	paths, err := s3mover.ListFiles(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Errorf("temporary files must not be left: %v", paths)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
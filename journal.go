@@ -0,0 +1,297 @@
+package s3mover
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultJournalName is the name of the journal file in the source directory.
+const DefaultJournalName = ".s3mover-journal"
+
+// JournalEntry represents a file that has been uploaded and is kept in the source directory.
+type JournalEntry struct {
+	Path       string    `json:"path"`
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	Revision   int       `json:"revision,omitempty"`
+	VersionID  string    `json:"version_id,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"` // with ContentHash
+
+	// the entries of the resume journal
+	Bucket   string `json:"bucket,omitempty"`
+	UploadID string `json:"upload_id,omitempty"` // the multipart upload in progress
+}
+
+// matches reports whether the file is not modified since uploaded.
+func (e *JournalEntry) matches(st os.FileInfo) bool {
+	return e.Size == st.Size() && e.ModTime.Equal(st.ModTime())
+}
+
+// journalRecord is a line of the journal file. A record with Removed forgets the entry of the path.
+type journalRecord struct {
+	*JournalEntry
+	Removed string `json:"removed,omitempty"`
+}
+
+// journalCRCTable is the table of the CRC-32C checksums of the journal records.
+var journalCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// journalCRCLen is the length of the checksum field `,"crc":"01234567"` at the end of a record.
+const journalCRCLen = len(`,"crc":"01234567"`)
+
+// encodeJournalRecord encodes the record as a line of JSON with the CRC-32C checksum of the record
+// without the checksum as the last field.
+func encodeJournalRecord(r *journalRecord) ([]byte, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := crc32.Checksum(b, journalCRCTable)
+	b = append(b[:len(b)-1], fmt.Sprintf(`,"crc":"%08x"}`, sum)...)
+	return append(b, '\n'), nil
+}
+
+// verifyJournalRecord reports whether the checksum of the line matches. The records of the older versions
+// without the checksum are valid.
+func verifyJournalRecord(line []byte) bool {
+	n := len(line) - journalCRCLen - 1
+	if n < 1 || !bytes.HasPrefix(line[n:], []byte(`,"crc":"`)) || line[len(line)-1] != '}' {
+		return true
+	}
+	var sum uint32
+	if _, err := fmt.Sscanf(string(line[n+len(`,"crc":"`):len(line)-2]), "%08x", &sum); err != nil {
+		return false
+	}
+	body := append(line[:n:n], '}')
+	return crc32.Checksum(body, journalCRCTable) == sum
+}
+
+// journalCompactMin is the min number of the records appended since the last compaction to compact the journal.
+const journalCompactMin = 1024
+
+// journal persists the state of the uploaded files to survive restarts.
+// The journal file is JSON lines of the records appended by each change, and it's compacted
+// to the current entries on loading and when the appended records outnumber the entries.
+// A journal without the path is kept in memory only.
+type journal struct {
+	mu        sync.Mutex
+	path      string
+	f         *os.File
+	appended  int
+	corrupted int // the records skipped by the checksums on loading
+	entries   map[string]*JournalEntry
+}
+
+// openJournal loads the journal file at path. A missing file means an empty journal.
+func openJournal(path string) (*journal, error) {
+	j := &journal{
+		path:    path,
+		entries: make(map[string]*JournalEntry),
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+	if err := j.load(b); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %w", path, err)
+	}
+	if j.corrupted > 0 {
+		slog.Warn("skipped the corrupted records of the journal", "path", path, "records", j.corrupted)
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// load replays the records of the journal file.
+func (j *journal) load(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("[")) {
+		// the journal of the older versions is a JSON array of the entries
+		var entries []*JournalEntry
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			j.entries[e.Path] = e
+		}
+		return nil
+	}
+	lines := bytes.Split(b, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		if !verifyJournalRecord(line) {
+			j.corrupted++
+			continue
+		}
+		var r journalRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			if i == len(lines)-1 {
+				// the last record truncated by a crash
+				break
+			}
+			return err
+		}
+		j.apply(&r)
+	}
+	return nil
+}
+
+func (j *journal) apply(r *journalRecord) {
+	if r.Removed != "" {
+		delete(j.entries, r.Removed)
+	} else if r.JournalEntry != nil {
+		j.entries[r.Path] = r.JournalEntry
+	}
+}
+
+// newMemoryJournal creates a journal that is not persisted.
+func newMemoryJournal() *journal {
+	return &journal{entries: make(map[string]*JournalEntry)}
+}
+
+// put records the entry and appends it to the journal.
+func (j *journal) put(e *JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.append(&journalRecord{JournalEntry: e})
+}
+
+// get returns the entry of path.
+func (j *journal) get(path string) (*JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.entries[path]
+	return e, ok
+}
+
+// remove forgets the entries of paths and appends them to the journal.
+func (j *journal) remove(paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	records := make([]*journalRecord, 0, len(paths))
+	for _, path := range paths {
+		records = append(records, &journalRecord{Removed: path})
+	}
+	return j.append(records...)
+}
+
+// list returns the entries sorted by path.
+func (j *journal) list() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.sorted()
+}
+
+func (j *journal) sorted() []JournalEntry {
+	entries := make([]JournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Path < entries[b].Path
+	})
+	return entries
+}
+
+// prune forgets the entries of the files that no longer exist.
+// The multipart uploads in progress are kept to be aborted by the replay of the resume journal.
+func (j *journal) prune() {
+	for path, e := range j.entries {
+		if e.UploadID != "" {
+			continue
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			delete(j.entries, path)
+		}
+	}
+}
+
+// append applies the records and appends them to the journal file.
+// It compacts the journal when the appended records outnumber the entries.
+func (j *journal) append(records ...*journalRecord) error {
+	for _, r := range records {
+		j.apply(r)
+	}
+	if j.path == "" {
+		return nil
+	}
+	j.appended += len(records)
+	if j.appended > journalCompactMin && j.appended > len(j.entries) {
+		return j.compact()
+	}
+	var buf bytes.Buffer
+	for _, r := range records {
+		b, err := encodeJournalRecord(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	// a single write not to interleave the records
+	if _, err := j.f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to append journal: %w", err)
+	}
+	return nil
+}
+
+// compact writes the current entries to a temporary file, renames it atomically, and reopens it to append.
+// The entries of the files removed by others are pruned, not to grow the journal forever in mirror mode.
+func (j *journal) compact() error {
+	if j.path == "" {
+		return nil
+	}
+	j.prune()
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, e := range j.sorted() {
+		e := e
+		b, err := encodeJournalRecord(&journalRecord{JournalEntry: &e})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(b)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save journal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save journal: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("failed to save journal: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	if j.f != nil {
+		j.f.Close()
+	}
+	j.f, j.appended = f, 0
+	return nil
+}
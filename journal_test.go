@@ -0,0 +1,115 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, s3mover.DefaultJournalName)
+	j, err := s3mover.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		p := s3movertest.WriteFile(t, dir, name, []byte("a"))
+		if err := j.Put(&s3mover.JournalEntry{Path: p, Key: "test/" + name, Size: 1, ModTime: now, UploadedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte("\n")); n != 4 {
+		t.Errorf("each change must be appended as a record: %d lines\n%s", n, b)
+	}
+	// the last record truncated by a crash is ignored
+	if err := os.WriteFile(path, append(b, []byte(`{"path":"d.txt","ke`)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j, err = s3mover.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := j.List(); len(entries) != 2 || entries[0].Key != "test/a.txt" || entries[1].Key != "test/c.txt" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+	// compacted on loading
+	if b, _ := os.ReadFile(path); bytes.Count(b, []byte("\n")) != 2 {
+		t.Errorf("the journal must be compacted on loading:\n%s", b)
+	}
+	// the entries of the files removed by others are pruned by the compaction
+	if err := os.Remove(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	j, err = s3mover.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := j.List(); len(entries) != 1 || entries[0].Key != "test/c.txt" {
+		t.Errorf("unexpected entries after pruning: %v", entries)
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, s3mover.DefaultJournalName)
+	j, err := s3mover.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < s3mover.JournalCompactMin*2; i++ {
+		name := fmt.Sprintf("%d.txt", i%10)
+		p := filepath.Join(dir, name)
+		if i < 10 {
+			s3movertest.WriteFile(t, dir, name, []byte("a"))
+		}
+		if err := j.Put(&s3mover.JournalEntry{Path: p, Key: "test/" + name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(b, []byte("\n")); n > s3mover.JournalCompactMin+10 {
+		t.Errorf("the journal must be compacted: %d lines", n)
+	}
+	j, err = s3mover.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := j.List(); len(entries) != 10 {
+		t.Errorf("unexpected entries: %d", len(entries))
+	}
+}
+
+func TestJournalCompatible(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, s3mover.DefaultJournalName)
+	a := s3movertest.WriteFile(t, dir, "a.txt", []byte("a"))
+	if err := os.WriteFile(path, []byte(`[{"path":`+strconv.Quote(a)+`,"key":"test/a.txt","size":1}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j, err := s3mover.OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := j.List(); len(entries) != 1 || entries[0].Key != "test/a.txt" {
+		t.Errorf("the journal of the older versions must be loaded: %v", entries)
+	}
+}
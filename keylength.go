@@ -0,0 +1,112 @@
+package s3mover
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxKeyLength is the max length of the object keys of S3 in bytes.
+const MaxKeyLength = 1024
+
+const (
+	// LongKeyError fails to upload the file with a permanent error.
+	LongKeyError = "error"
+	// LongKeyTruncate truncates the name of the object, appending the hash of the key to keep it unique.
+	LongKeyTruncate = "truncate"
+	// LongKeyHash replaces the name of the object with the hash of the key, keeping the extension.
+	LongKeyHash = "hash"
+)
+
+// maxKeyExtLength is the max length of the extensions kept by LongKeyTruncate and LongKeyHash.
+const maxKeyExtLength = 32
+
+// longKeyHashLength is the length of the hash appended by LongKeyTruncate.
+const longKeyHashLength = 16
+
+// unsafeKeyChars are the characters to avoid in the keys by the guidelines of S3.
+const unsafeKeyChars = "\\{}^%`[]\"<>~#|"
+
+// keyError represents a key that is not accepted by S3.
+// It never succeeds by retrying, so it is treated as a permanent error.
+type keyError struct {
+	key    string
+	reason string
+}
+
+func (e *keyError) Error() string {
+	return fmt.Sprintf("invalid key %q: %s", e.key, e.reason)
+}
+
+// fitKey validates the generated key, and shortens it by LongKeyPolicy if it is longer than MaxKeyLength.
+// The keys containing the characters to avoid are logged.
+func (tr *Transporter) fitKey(ctx context.Context, key string) (string, error) {
+	if !utf8.ValidString(key) {
+		return "", &keyError{key: key, reason: "must be valid UTF-8"}
+	}
+	if i := strings.IndexFunc(key, func(r rune) bool {
+		return r < 0x20 || r == 0x7f || strings.ContainsRune(unsafeKeyChars, r)
+	}); i >= 0 {
+		slog.WarnContext(ctx, "the key contains a character to avoid. it may need special handling by the other tools",
+			"key", key,
+			"char", fmt.Sprintf("%q", key[i:i+1]),
+		)
+	}
+	if len(key) <= MaxKeyLength {
+		return key, nil
+	}
+	if tr.config.LongKeyPolicy == LongKeyError {
+		return "", &keyError{key: key, reason: fmt.Sprintf("%d bytes is longer than %d bytes", len(key), MaxKeyLength)}
+	}
+	dir, base := path.Split(key)
+	ext := keyExt(base)
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	var name string
+	switch tr.config.LongKeyPolicy {
+	case LongKeyTruncate:
+		name = strings.TrimSuffix(base, ext)
+		room := MaxKeyLength - len(dir) - len(ext) - longKeyHashLength - 1
+		name = truncateUTF8(name, max(room, 0)) + "-" + hash[:longKeyHashLength]
+	case LongKeyHash:
+		name = hash
+	}
+	fitted := dir + name + ext
+	if len(fitted) > MaxKeyLength {
+		return "", &keyError{key: key, reason: fmt.Sprintf("the directories are too long to keep it under %d bytes", MaxKeyLength)}
+	}
+	slog.WarnContext(ctx, "the key is too long. shortened by the long-key policy",
+		"policy", tr.config.LongKeyPolicy,
+		"key", fitted,
+		slog.Int("length", len(key)),
+	)
+	return fitted, nil
+}
+
+// keyExt returns the extensions of the name such as ".log.gz" kept by shortening the key,
+// or the last extension if they are longer than maxKeyExtLength.
+func keyExt(name string) string {
+	if i := strings.Index(name, "."); i > 0 && len(name)-i <= maxKeyExtLength {
+		return name[i:]
+	}
+	if ext := path.Ext(name); len(ext) <= maxKeyExtLength {
+		return ext
+	}
+	return ""
+}
+
+// truncateUTF8 truncates s to at most n bytes without breaking the UTF-8 characters.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
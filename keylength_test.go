@@ -0,0 +1,87 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestLongKey(t *testing.T) {
+	ctx := context.Background()
+	// the file names are limited to 255 bytes by most file systems
+	prefix := "test/" + strings.Repeat("p", 800)
+	name := strings.Repeat("あ", 80) + ".log"
+	for _, policy := range []string{s3mover.LongKeyTruncate, s3mover.LongKeyHash} {
+		dir := t.TempDir()
+		s3movertest.WriteFile(t, dir, name, []byte("foo"))
+		s3movertest.WriteFile(t, dir, strings.Repeat("あ", 79)+"い.log", []byte("bar"))
+		config := &s3mover.Config{
+			SrcDir:        dir,
+			Bucket:        "testbucket",
+			KeyPrefix:     prefix,
+			MaxParallels:  1,
+			Gzip:          true,
+			LongKeyPolicy: policy,
+		}
+		tr, client := newTestTransporter(t, config)
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		keys := client.Keys()
+		if len(keys) != 2 || keys[0] == keys[1] {
+			t.Fatalf("%s: the shortened keys must be unique: %v", policy, keys)
+		}
+		for _, key := range keys {
+			if len(key) > s3mover.MaxKeyLength || !strings.HasPrefix(key, prefix+"/") || !strings.HasSuffix(key, ".log.gz") {
+				t.Errorf("%s: unexpected key %s (%d bytes)", policy, key, len(key))
+			}
+			if !utf8.ValidString(key) {
+				t.Errorf("%s: the key must be valid UTF-8: %q", policy, key)
+			}
+		}
+	}
+}
+
+func TestLongKeyError(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	deadLetter := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, strings.Repeat("f", 200)+".log", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:               dir,
+		Bucket:               "testbucket",
+		KeyPrefix:            "test/" + strings.Repeat("p", 900),
+		MaxParallels:         1,
+		PermanentErrorPolicy: s3mover.PermanentErrorDeadLetter,
+		DeadLetterDir:        deadLetter,
+	}
+	tr, client := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 0 {
+		t.Errorf("the long key must not be uploaded: %v", client.Keys())
+	}
+	if _, err := os.Stat(filepath.Join(deadLetter, filepath.Base(foo))); err != nil {
+		t.Errorf("the file must be moved to the dead-letter directory as a permanent error: %v", err)
+	}
+}
+
+func TestLongKeyValidate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:        t.TempDir(),
+		Bucket:        "testbucket",
+		KeyPrefix:     "test/long-key",
+		MaxParallels:  1,
+		LongKeyPolicy: "drop",
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("unknown long key policy must be invalid")
+	}
+}
@@ -0,0 +1,79 @@
+package s3mover
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// KeyVarName is the key variable of KeyName expanded to the name of the file without the extension.
+	KeyVarName = "name"
+	// KeyVarExt is the key variable of KeyName expanded to the extension of the file, including the dot.
+	KeyVarExt = "ext"
+	// KeyVarContentHash is the key variable of KeyName expanded to the short hex-encoded SHA-256 of the content of the file.
+	KeyVarContentHash = "content_hash"
+)
+
+// ContentHashKeyLength is the length of {content_hash} in the keys.
+const ContentHashKeyLength = 6
+
+func validateKeyName(s string) error {
+	if strings.Contains(s, "/") {
+		return fmt.Errorf("key-name %s must not contain /", s)
+	}
+	names := keyVars(s)
+	if len(names) == 0 {
+		return errors.New("key-name must contain {name} or {content_hash} not to upload all the files to the same key")
+	}
+	for _, name := range names {
+		switch name {
+		case KeyVarName, KeyVarExt, KeyVarContentHash:
+		default:
+			return fmt.Errorf("unknown key variable {%s} in key-name %s", name, s)
+		}
+	}
+	return nil
+}
+
+// keyName normalizes the name by NormalizeName, and expands KeyName for the file at the path.
+// The directories of the name by PreservePath are kept.
+func (tr *Transporter) keyName(file, name string) (string, error) {
+	name = normalizeName(name, tr.config.NormalizeName)
+	if tr.config.KeyName == "" {
+		return name, nil
+	}
+	dir, base := path.Split(name)
+	ext := path.Ext(base)
+	var err error
+	expanded := keyVarRegexp.ReplaceAllStringFunc(tr.config.KeyName, func(m string) string {
+		switch m[1 : len(m)-1] {
+		case KeyVarName:
+			return strings.TrimSuffix(base, ext)
+		case KeyVarExt:
+			return ext
+		case KeyVarContentHash:
+			var sum string
+			sum, err = tr.contentHash(file)
+			return sum[:min(len(sum), ContentHashKeyLength)]
+		}
+		return m
+	})
+	if err != nil {
+		return "", err
+	}
+	return dir + expanded, nil
+}
+
+// contentHash returns the SHA-256 of the content of the file, computed already by ContentHash if enabled.
+func (tr *Transporter) contentHash(file string) (string, error) {
+	if sum, ok := tr.hashes.get(file); ok {
+		return sum, nil
+	}
+	sum, err := fileSHA256(tr.staged.source(file))
+	if err != nil {
+		return "", asLocalReadError(file, err)
+	}
+	return sum, nil
+}
@@ -0,0 +1,76 @@
+package s3mover_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestKeyName(t *testing.T) {
+	ctx := context.Background()
+	client := s3movertest.NewMockS3Client()
+	upload := func(content string, gzip bool) string {
+		t.Helper()
+		src := t.TempDir()
+		s3movertest.WriteFile(t, src, "foo.log", []byte(content))
+		config := &s3mover.Config{
+			SrcDir:       src,
+			Bucket:       "testbucket",
+			KeyPrefix:    "test/keyname",
+			MaxParallels: 1,
+			TimeFormat:   "2006/01/02",
+			KeyName:      "{name}-{content_hash}{ext}",
+			Gzip:         gzip,
+		}
+		tr, _ := newTestTransporter(t, config)
+		tr.SetS3Client(client)
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])[:s3mover.ContentHashKeyLength]
+	}
+
+	foo := upload("foo", false)
+	bar := upload("bar", false)
+	upload("foo", true)
+	keys := client.Keys()
+	if len(keys) != 3 {
+		t.Fatalf("the files of the same name must not collide: %v", keys)
+	}
+	for _, suffix := range []string{"/foo-" + foo + ".log", "/foo-" + bar + ".log", "/foo-" + foo + ".log.gz"} {
+		var found bool
+		for _, key := range keys {
+			found = found || strings.HasSuffix(key, suffix)
+		}
+		if !found {
+			t.Errorf("%s must be uploaded: %v", suffix, keys)
+		}
+	}
+
+	// the duplicate of the same content is uploaded to the same key
+	upload("foo", false)
+	if m := client.Keys(); len(m) != 3 {
+		t.Errorf("the duplicate must have the same key: %v", m)
+	}
+}
+
+func TestKeyNameValidate(t *testing.T) {
+	for _, name := range []string{"fixed.log", "{name}-{hostname}{ext}", "{name}/{content_hash}"} {
+		config := &s3mover.Config{
+			SrcDir:       t.TempDir(),
+			Bucket:       "testbucket",
+			KeyPrefix:    "test/keyname",
+			MaxParallels: 1,
+			KeyName:      name,
+		}
+		if err := config.Validate(); err == nil {
+			t.Errorf("key-name %s must be invalid", name)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package s3mover
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxKeyDirectiveLength is the max length of the first line to read as KeyDirective.
+const maxKeyDirectiveLength = 4096
+
+// keyOverride represents the destination key specified by the producer of the file,
+// by the sidecar or the first-line directive.
+type keyOverride struct {
+	key    string // the exact key in the bucket
+	suffix string // the key under the prefix
+	offset int64  // the length of the directive line stripped from the content
+}
+
+// readKeyOverride reads the key specified by the sidecar or the first line of the file.
+// The sidecar takes precedence, but the directive line is stripped anyway. It returns nil if neither is specified.
+func (tr *Transporter) readKeyOverride(p string, sidecar *Sidecar) (*keyOverride, error) {
+	o, err := tr.readKeyDirective(p)
+	if err != nil {
+		return nil, err
+	}
+	if sidecar == nil || (sidecar.Key == "" && sidecar.KeySuffix == "") {
+		return o, nil
+	}
+	if o == nil {
+		o = &keyOverride{}
+	}
+	if err := validateKeySuffix(sidecar.KeySuffix); err != nil {
+		return nil, fmt.Errorf("invalid key suffix in the sidecar of %s: %w", p, err)
+	}
+	o.key, o.suffix = strings.TrimLeft(sidecar.Key, "/"), strings.TrimRight(sidecar.KeySuffix, "/")
+	if o.key == "" && o.suffix == "" {
+		return nil, fmt.Errorf("empty key in the sidecar of %s", p)
+	}
+	return o, nil
+}
+
+// readKeyDirective reads the key specified by the first line of the file.
+func (tr *Transporter) readKeyDirective(p string) (*keyOverride, error) {
+	if tr.config.KeyDirective == "" {
+		return nil, nil
+	}
+	line, err := readFirstLine(p)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), tr.config.KeyDirective)
+	if !ok {
+		return nil, nil
+	}
+	o := &keyOverride{offset: int64(len(line))}
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "/") {
+		o.key = strings.TrimLeft(v, "/")
+	} else {
+		if err := validateKeySuffix(v); err != nil {
+			return nil, fmt.Errorf("invalid key suffix in the directive of %s: %w", p, err)
+		}
+		o.suffix = strings.TrimRight(v, "/")
+	}
+	if o.key == "" && o.suffix == "" {
+		return nil, fmt.Errorf("empty key in the directive of %s", p)
+	}
+	return o, nil
+}
+
+// validateKeySuffix validates that the key suffix stays under the prefix.
+func validateKeySuffix(s string) error {
+	if strings.HasPrefix(s, "/") {
+		return fmt.Errorf("%q must not be absolute", s)
+	}
+	for _, seg := range strings.Split(s, "/") {
+		if seg == ".." {
+			return fmt.Errorf("%q must not have .. segments", s)
+		}
+	}
+	return nil
+}
+
+// readFirstLine reads the first line of the file including the newline.
+// It returns an empty string if the first line is too long.
+func readFirstLine(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	line, err := bufio.NewReaderSize(io.LimitReader(f, maxKeyDirectiveLength), maxKeyDirectiveLength).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\n") && len(line) >= maxKeyDirectiveLength {
+		return "", nil
+	}
+	return line, nil
+}
+
+// apply returns the key overridden from the generated key. A positive revision is appended as ".r<revision>".
+func (o *keyOverride) apply(prefix, generated string, revision int) string {
+	if o == nil {
+		return generated
+	}
+	key := o.key
+	if key == "" {
+		if validateKeySuffix(o.suffix) != nil {
+			// never escape from the prefix
+			return generated
+		}
+		key = path.Join(prefix, o.suffix)
+	}
+	if revision > 0 {
+		key = fmt.Sprintf("%s.r%d", key, revision)
+	}
+	return key
+}
+
+// skip returns the length of the content to strip.
+func (o *keyOverride) skip() int64 {
+	if o == nil {
+		return 0
+	}
+	return o.offset
+}
@@ -0,0 +1,91 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestKeyOverride(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "suffix.txt", []byte("#s3mover-key: backup/db/20240603.dump\nsuffix\n"))
+	s3movertest.WriteFile(t, dir, "exact.txt", []byte("#s3mover-key: /other/exact.txt\nexact\n"))
+	s3movertest.WriteFile(t, dir, "sidecar.txt", []byte("#s3mover-key: ignored\nsidecar\n"))
+	s3movertest.WriteFile(t, dir, "sidecar.txt"+s3mover.SidecarSuffix, []byte(`{"key_suffix":"from/sidecar.txt"}`))
+	s3movertest.WriteFile(t, dir, "plain.txt", []byte("plain\n"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/key-override",
+		MaxParallels: 1,
+		Sidecar:      true,
+		KeyDirective: "#s3mover-key:",
+	}
+	tr, client := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"test/key-override/backup/db/20240603.dump": "suffix\n",
+		"other/exact.txt": "exact\n",
+		// the sidecar takes precedence
+		"test/key-override/from/sidecar.txt": "sidecar\n",
+	}
+	if len(client.Objects) != len(expected)+1 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+	for key, content := range expected {
+		obj, ok := client.Objects[key]
+		if !ok {
+			t.Errorf("%s is not uploaded: %v", key, client.Keys())
+			continue
+		}
+		if string(obj.Content) != content || obj.Size != int64(len(content)) {
+			t.Errorf("unexpected content of %s: %q (%d)", key, obj.Content, obj.Size)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files must be removed: %v", entries)
+	}
+}
+
+func TestKeyOverrideEscape(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	directive := s3movertest.WriteFile(t, dir, "directive.txt", []byte("#s3mover-key: ../other-tenant/x.txt\ndirective\n"))
+	sidecar := s3movertest.WriteFile(t, dir, "sidecar.txt", []byte("sidecar\n"))
+	s3movertest.WriteFile(t, dir, "sidecar.txt"+s3mover.SidecarSuffix, []byte(`{"key_suffix":"a/../../other-tenant/y.txt"}`))
+	absolute := s3movertest.WriteFile(t, dir, "absolute.txt", []byte("absolute\n"))
+	s3movertest.WriteFile(t, dir, "absolute.txt"+s3mover.SidecarSuffix, []byte(`{"key_suffix":"/other-tenant/z.txt"}`))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/key-override",
+		MaxParallels: 1,
+		Sidecar:      true,
+		KeyDirective: "#s3mover-key:",
+	}
+	tr, client := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 0 {
+		t.Errorf("the keys out of the prefix must not be uploaded: %v", client.Keys())
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Errored != 3 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+	for _, path := range []string{directive, sidecar, absolute} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s must be left: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package s3mover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+)
+
+const (
+	// KeyVarHostname is the key variable expanded to the hostname.
+	KeyVarHostname = "hostname"
+	// KeyVarInstanceID is the key variable expanded to the EC2 instance ID fetched from IMDS.
+	KeyVarInstanceID = "instance_id"
+	// KeyVarTaskID is the key variable expanded to the ECS task ID fetched from the task metadata endpoint.
+	KeyVarTaskID = "task_id"
+	// KeyVarPodName is the key variable expanded to the Kubernetes pod name.
+	KeyVarPodName = "pod_name"
+)
+
+// MetadataTimeout is the timeout for fetching the instance metadata.
+var MetadataTimeout = 5 * time.Second
+
+var keyVarRegexp = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// keyVars returns the names of the key variables in s.
+func keyVars(s string) []string {
+	var names []string
+	for _, m := range keyVarRegexp.FindAllStringSubmatch(s, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+func validateKeyVars(s string) error {
+	// the braces not of the key variables are typos such as {hostname or {Hostname}
+	if rest := keyVarRegexp.ReplaceAllString(s, ""); strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("unbalanced or invalid key variable in %s", s)
+	}
+	for _, name := range keyVars(s) {
+		switch name {
+		case KeyVarHostname, KeyVarInstanceID, KeyVarTaskID, KeyVarPodName:
+		default:
+			return fmt.Errorf("unknown key variable {%s} in %s", name, s)
+		}
+	}
+	return nil
+}
+
+// keyVarResolver resolves the key variables at startup.
+// The values are fetched only when used and cached.
+type keyVarResolver struct {
+	awsConfig   aws.Config
+	imdsOptions func(*imds.Options)
+	values      map[string]string
+}
+
+func newKeyVarResolver(cfg aws.Config, imdsOptions func(*imds.Options)) *keyVarResolver {
+	return &keyVarResolver{awsConfig: cfg, imdsOptions: imdsOptions, values: make(map[string]string)}
+}
+
+// expand replaces the key variables in s with the values.
+func (r *keyVarResolver) expand(ctx context.Context, s string) (string, error) {
+	if err := validateKeyVars(s); err != nil {
+		return "", err
+	}
+	var err error
+	expanded := keyVarRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		if err != nil {
+			return m
+		}
+		var v string
+		v, err = r.lookup(ctx, m[1:len(m)-1])
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+func (r *keyVarResolver) lookup(ctx context.Context, name string) (string, error) {
+	if v, ok := r.values[name]; ok {
+		return v, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, MetadataTimeout)
+	defer cancel()
+	var v string
+	var err error
+	switch name {
+	case KeyVarHostname:
+		v, err = os.Hostname()
+	case KeyVarInstanceID:
+		v, err = instanceID(ctx, r.awsConfig, r.imdsOptions)
+	case KeyVarTaskID:
+		v, err = taskID(ctx)
+	case KeyVarPodName:
+		v, err = podName()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve key variable {%s}: %w", name, err)
+	}
+	if v == "" {
+		return "", fmt.Errorf("key variable {%s} is empty", name)
+	}
+	r.values[name] = v
+	return v, nil
+}
+
+func instanceID(ctx context.Context, cfg aws.Config, optFns ...func(*imds.Options)) (string, error) {
+	out, err := imds.NewFromConfig(cfg, optFns...).GetMetadata(ctx, &imds.GetMetadataInput{Path: "instance-id"})
+	if err != nil {
+		return "", err
+	}
+	defer out.Content.Close()
+	b, err := io.ReadAll(out.Content)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// taskID returns the ECS task ID, the last part of the task ARN.
+func taskID(ctx context.Context) (string, error) {
+	endpoint := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if endpoint == "" {
+		return "", fmt.Errorf("ECS_CONTAINER_METADATA_URI_V4 is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/task", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("task metadata endpoint returned %s", resp.Status)
+	}
+	var task struct {
+		TaskARN string `json:"TaskARN"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		return "", err
+	}
+	return task.TaskARN[strings.LastIndex(task.TaskARN, "/")+1:], nil
+}
+
+// podName returns the pod name from the POD_NAME environment variable set by the Downward API,
+// or the hostname which is the pod name by default.
+func podName() (string, error) {
+	if v := os.Getenv("POD_NAME"); v != "" {
+		return v, nil
+	}
+	return os.Hostname()
+}
@@ -0,0 +1,65 @@
+package s3mover_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestKeyVars(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+		fmt.Fprint(w, "token")
+	})
+	mux.HandleFunc("/latest/meta-data/instance-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "i-0123456789abcdef0")
+	})
+	mux.HandleFunc("/v4/task", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"TaskARN":"arn:aws:ecs:ap-northeast-1:123456789012:task/cluster/0123456789abcdef"}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", ts.URL)
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", ts.URL+"/v4")
+	t.Setenv("POD_NAME", "s3mover-abcde")
+	hostname, _ := os.Hostname()
+
+	config := &s3mover.Config{
+		SrcDir:       t.TempDir(),
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/{hostname}/{instance_id}/{task_id}/{pod_name}",
+		MaxParallels: 1,
+		Destinations: []string{"s3://otherbucket/other/{pod_name}"},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := s3mover.New(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "test/" + hostname + "/i-0123456789abcdef0/0123456789abcdef/s3mover-abcde"
+	if config.KeyPrefix != expected {
+		t.Errorf("unexpected prefix: %s", config.KeyPrefix)
+	}
+	if _, ok := tr.Metrics().Snapshot().Destinations["s3://otherbucket/other/s3mover-abcde"]; !ok {
+		t.Errorf("unexpected destinations: %v", tr.Metrics().Snapshot().Destinations)
+	}
+}
+
+func TestKeyVarsValidate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:    ".",
+		Bucket:    "testbucket",
+		KeyPrefix: "test/{unknown}",
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("unknown key variable must be invalid")
+	}
+}
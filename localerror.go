@@ -0,0 +1,161 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// LocalErrorRetry retries the files failed to read forever.
+	LocalErrorRetry = "retry"
+	// LocalErrorSkip leaves the files failed to read LocalErrorRetries times in the source directory and alerts them.
+	LocalErrorSkip = "skip"
+	// LocalErrorDeadLetter moves the files failed to read LocalErrorRetries times to the dead-letter directory.
+	LocalErrorDeadLetter = "dead-letter"
+
+	// DefaultLocalErrorRetries is the default number of consecutive local read errors to apply the policy.
+	DefaultLocalErrorRetries = 3
+)
+
+const (
+	localErrorNotFound   = "not_found"
+	localErrorPermission = "permission"
+	localErrorIO         = "io"
+	localErrorOther      = "other"
+)
+
+// LocalErrorMetrics represents the number of local read errors by the reason.
+type LocalErrorMetrics struct {
+	NotFound   int64 `json:"not_found"`
+	Permission int64 `json:"permission"`
+	IO         int64 `json:"io"`
+	Other      int64 `json:"other"`
+}
+
+func (m *LocalErrorMetrics) add(reason string) {
+	switch reason {
+	case localErrorNotFound:
+		atomic.AddInt64(&m.NotFound, 1)
+	case localErrorPermission:
+		atomic.AddInt64(&m.Permission, 1)
+	case localErrorIO:
+		atomic.AddInt64(&m.IO, 1)
+	default:
+		atomic.AddInt64(&m.Other, 1)
+	}
+}
+
+func (m *LocalErrorMetrics) snapshot() LocalErrorMetrics {
+	return LocalErrorMetrics{
+		NotFound:   atomic.LoadInt64(&m.NotFound),
+		Permission: atomic.LoadInt64(&m.Permission),
+		IO:         atomic.LoadInt64(&m.IO),
+		Other:      atomic.LoadInt64(&m.Other),
+	}
+}
+
+// localReadError is an error of reading the local file, distinguished from the S3 errors.
+type localReadError struct {
+	err error
+}
+
+func (e *localReadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *localReadError) Unwrap() error {
+	return e.err
+}
+
+// asLocalReadError wraps the error of reading the source file path (or its sidecar) as localReadError.
+// The errors of the other files, such as the temporary files of compression in TempDir, are not of the source.
+func asLocalReadError(path string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		if pe.Path != path && pe.Path != path+SidecarSuffix {
+			return err
+		}
+		return &localReadError{err: err}
+	}
+	if errors.Is(err, syscall.EIO) {
+		return &localReadError{err: err}
+	}
+	return err
+}
+
+// IsLocalReadError reports whether the error is of reading the local file, such as permission denied and I/O errors.
+func IsLocalReadError(err error) bool {
+	var le *localReadError
+	return errors.As(err, &le)
+}
+
+// localErrorReason returns the reason of the local read error for the metrics and the logs.
+func localErrorReason(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return localErrorNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return localErrorPermission
+	case errors.Is(err, syscall.EIO):
+		return localErrorIO
+	}
+	return localErrorOther
+}
+
+// vanished reports whether the file listed by the scan was removed before uploading, such as by the other
+// instances or the rotation. It's not an upload failure.
+// The paths of SQS and PathsFrom are not listed by s3mover, so the missing files of them are still errors.
+func (tr *Transporter) vanished(ctx context.Context, path string, err error) bool {
+	if tr.config.SQSQueueURL != "" || tr.config.PathsFrom != "" {
+		return false
+	}
+	if !IsLocalReadError(err) || !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	tr.metrics.LocalError(localErrorNotFound)
+	tr.failures.succeeded(path)
+	slog.InfoContext(ctx, "file disappeared after listing", "path", path)
+	return true
+}
+
+// onLocalError applies LocalErrorPolicy to the file failed to read n times consecutively.
+func (tr *Transporter) onLocalError(ctx context.Context, path string, err error, n int) {
+	if tr.config.LocalErrorPolicy == LocalErrorRetry || n < tr.config.LocalErrorRetries {
+		return
+	}
+	switch tr.config.LocalErrorPolicy {
+	case LocalErrorSkip:
+		var modTime time.Time
+		if st, err := os.Stat(path); err == nil {
+			modTime = st.ModTime()
+		}
+		tr.unreadable.add(path, modTime)
+		tr.failures.succeeded(path)
+		msg := fmt.Sprintf("%s is skipped after %d consecutive read errors: %s", path, n, err)
+		slog.ErrorContext(ctx, "skip unreadable file", "path", path, "errors", n, "error", err.Error())
+		if tr.alerter != nil {
+			tr.alerter.fire(ctx, "unreadable", msg, float64(n), float64(tr.config.LocalErrorRetries))
+		}
+	case LocalErrorDeadLetter:
+		dst, derr := tr.deadLetter(path)
+		if derr != nil {
+			slog.ErrorContext(ctx, "failed to move file to the dead-letter directory", "path", path, "error", derr.Error())
+			return
+		}
+		tr.metrics.DeadLettered()
+		tr.failures.succeeded(path)
+		slog.ErrorContext(ctx, "moved file to the dead-letter directory by read errors",
+			"path", path,
+			"dead_letter", dst,
+			"errors", n,
+			"error", err.Error(),
+		)
+	}
+}
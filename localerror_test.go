@@ -0,0 +1,98 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestLocalErrorSkip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not available")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	// a symlink loop fails to read, and a dangling symlink looks like a file removed after listing
+	loop := filepath.Join(dir, "loop.txt")
+	if err := os.Symlink(loop, loop); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "removed.txt"), filepath.Join(dir, "vanished.txt")); err != nil {
+		t.Fatal(err)
+	}
+	config := &s3mover.Config{
+		SrcDir:            dir,
+		Bucket:            "testbucket",
+		KeyPrefix:         "test/local-error",
+		MaxParallels:      1,
+		LocalErrorPolicy:  s3mover.LocalErrorSkip,
+		LocalErrorRetries: 2,
+	}
+	tr, _ := newTestTransporter(t, config)
+	for i := 0; i < 3; i++ {
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := tr.Metrics().Snapshot()
+	// foo.txt is uploaded, loop.txt errored twice and skipped, and vanished.txt is not an error
+	if m.Objects.Uploaded != 1 || m.Objects.Errored != 2 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+	if le := m.Objects.LocalErrors; le.Other != 2 || le.NotFound != 3 || le.Permission != 0 || le.IO != 0 {
+		t.Errorf("unexpected local errors: %+v", le)
+	}
+	if m.Scan.Skipped.Policy != 1 {
+		t.Errorf("skipped file must be counted by the last scan: %+v", m.Scan.Skipped)
+	}
+	if len(tr.Failures()) != 0 {
+		t.Errorf("skipped file must not be listed in failures: %v", tr.Failures())
+	}
+}
+
+func TestLocalErrorTempDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foofoofoo"))
+	tempDir := filepath.Join(t.TempDir(), "spill")
+	if err := os.Mkdir(tempDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	deadLetter := filepath.Join(t.TempDir(), "dead-letter")
+	config := &s3mover.Config{
+		SrcDir:                  dir,
+		Bucket:                  "testbucket",
+		KeyPrefix:               "test/local-error",
+		MaxParallels:            1,
+		Gzip:                    true,
+		MaxInMemoryCompressSize: 1,
+		TempDir:                 tempDir,
+		DeadLetterDir:           deadLetter,
+		LocalErrorPolicy:        s3mover.LocalErrorDeadLetter,
+		LocalErrorRetries:       1,
+	}
+	tr, _ := newTestTransporter(t, config)
+	// the spill of the compression fails, not the read of the source
+	if err := os.Remove(tempDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m := tr.Metrics().Snapshot()
+	if m.Objects.Errored != 1 || m.Objects.DeadLettered != 0 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+	if le := m.Objects.LocalErrors; le != (s3mover.LocalErrorMetrics{}) {
+		t.Errorf("the errors of the temp dir must not be local read errors: %+v", le)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the source file must be left: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestLocalStack(t *testing.T) {
+	client, bucket := s3movertest.NewLocalStackClient(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       bucket,
+		KeyPrefix:    "test/localstack",
+		MaxParallels: 1,
+	}
+	tr, err := s3mover.New(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.SetS3Client(client)
+
+	for _, r := range tr.Validate(ctx) {
+		if !r.OK {
+			t.Errorf("check %s failed: %s", r.Name, r.Message)
+		}
+	}
+	if _, err := tr.Replay(ctx, s3mover.ReplayOption{Dir: dir, Keep: true}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := tr.Verify(ctx, s3mover.VerifyOption{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != s3mover.VerifyStatusOK {
+		t.Errorf("unexpected verify results: %v", results)
+	}
+}
@@ -0,0 +1,43 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultLockedRetries is the default number of the retries of a file locked by another process.
+	DefaultLockedRetries = 5
+	// DefaultLockedRetryWait is the default wait before the first retry of a locked file, doubled by each retry.
+	DefaultLockedRetryWait = 500 * time.Millisecond
+)
+
+// isLocked reports whether the error is of reading the local file locked by another process,
+// such as a sharing violation by an antivirus scanner or an indexer on Windows.
+func (tr *Transporter) isLocked(err error) bool {
+	return err != nil && IsLocalReadError(err) && tr.locked(err)
+}
+
+// retryLocked retries processing the file shortly while it's locked by another process, doubling the wait,
+// and returns the last error. The locks are counted in the metrics, not as errors.
+func (tr *Transporter) retryLocked(ctx context.Context, path string, err error) error {
+	for i := 0; tr.isLocked(err); i++ {
+		tr.metrics.Locked()
+		if i >= tr.config.LockedRetries || ctx.Err() != nil {
+			break
+		}
+		wait := tr.config.LockedRetryWait << i
+		slog.InfoContext(ctx, "the file is locked by another process. retry shortly", "path", path, "error", err.Error(), "wait", wait)
+		tr.sleep(ctx, wait)
+		err = tr.process(ctx, path)
+	}
+	return err
+}
+
+// leaveLocked leaves the file still locked after LockedRetries for the next scan, without counting it as an error nor alerting.
+func (tr *Transporter) leaveLocked(ctx context.Context, path string, err error) error {
+	slog.WarnContext(ctx, "the file is still locked by another process. left for the next scan", "path", path, "error", err.Error())
+	return fmt.Errorf("%s is %w: locked", path, errLeft)
+}
@@ -0,0 +1,68 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestLockedRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not available")
+	}
+	ctx := context.Background()
+	for _, c := range []struct {
+		unlockAfter int
+		uploaded    int64
+		locked      int64
+	}{
+		{2, 1, 2}, // unlocked while retrying
+		{0, 0, 4}, // still locked after the retries
+	} {
+		dir := t.TempDir()
+		// reading a symlink loop fails as if the file is locked
+		foo := filepath.Join(dir, "foo.txt")
+		if err := os.Symlink(foo, foo); err != nil {
+			t.Fatal(err)
+		}
+		config := &s3mover.Config{
+			SrcDir:          dir,
+			Bucket:          "testbucket",
+			KeyPrefix:       "test/locked",
+			MaxParallels:    1,
+			LockedRetries:   3,
+			LockedRetryWait: time.Millisecond,
+		}
+		tr, client := newTestTransporter(t, config)
+		var calls int
+		tr.SetLocked(func(err error) bool {
+			calls++
+			if calls == c.unlockAfter {
+				os.Remove(foo)
+				s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+			}
+			return errors.Is(err, syscall.ELOOP)
+		})
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(client.Objects)) != c.uploaded {
+			t.Errorf("unlock after %d: unexpected objects: %v", c.unlockAfter, client.Keys())
+		}
+		m := tr.Metrics().Snapshot()
+		if m.Objects.Uploaded != c.uploaded || m.Objects.Locked != c.locked {
+			t.Errorf("unlock after %d: unexpected metrics: %+v", c.unlockAfter, m.Objects)
+		}
+		if m.Objects.Errored != 0 || m.Objects.LocalErrors != (s3mover.LocalErrorMetrics{}) || len(tr.Failures()) != 0 {
+			t.Errorf("unlock after %d: the locks must not be errors: %+v %v", c.unlockAfter, m.Objects, tr.Failures())
+		}
+	}
+}
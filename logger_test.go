@@ -0,0 +1,101 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestSetLoggerWithAttrs(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	attrs, err := s3mover.ParseLogAttrs("service=foo, env=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s3mover.SetLoggerWithAttrs(false, f, attrs)
+	slog.Info("hello", "path", "foo.txt")
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["service"] != "foo" || rec["env"] != "prod" || rec["path"] != "foo.txt" {
+		t.Errorf("unexpected log record: %v", rec)
+	}
+}
+
+func TestParseLogAttrs(t *testing.T) {
+	for _, s := range []string{"service", "=foo", "service=foo,"} {
+		if _, err := s3mover.ParseLogAttrs(s); err == nil {
+			t.Errorf("%s must be invalid", s)
+		}
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	config := &s3mover.Config{
+		SrcDir:             dir,
+		Bucket:             "testbucket",
+		KeyPrefix:          "test/summary",
+		MaxParallels:       1,
+		LogSummaryInterval: time.Minute,
+	}
+	tr, _ := newTestTransporter(t, config)
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s3mover.SetLoggerWithAttrs(false, f, nil)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 2 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	tr.LogSummary(ctx)
+	tr.LogSummary(ctx) // no uploads since the last summary
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summaries []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		var rec map[string]any
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatal(err)
+		}
+		switch rec["msg"] {
+		case "upload completed":
+			t.Errorf("each upload must not be logged: %v", rec)
+		case "uploads summary":
+			summaries = append(summaries, rec)
+		}
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("unexpected summaries: %v", summaries)
+	}
+	if s := summaries[0]; s["files"] != float64(2) || s["bytes"] != float64(6) {
+		t.Errorf("unexpected summary: %v", s)
+	}
+}
@@ -0,0 +1,67 @@
+package s3mover
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+)
+
+// uploadSummary aggregates the uploads to log a summary every LogSummaryInterval instead of each upload.
+type uploadSummary struct {
+	files atomic.Int64
+	bytes atomic.Int64
+}
+
+// newUploadSummary returns nil if LogSummaryInterval is 0 (disabled).
+func newUploadSummary(config *Config) *uploadSummary {
+	if config.LogSummaryInterval <= 0 {
+		return nil
+	}
+	return &uploadSummary{}
+}
+
+// uploadLogLevel returns the level of the log for each upload, and records the upload to the summary.
+func (s *uploadSummary) uploadLogLevel(size int64) slog.Level {
+	if s == nil {
+		return slog.LevelInfo
+	}
+	s.files.Add(1)
+	s.bytes.Add(size)
+	return slog.LevelDebug
+}
+
+// log logs the summary of the uploads since the last call, if any.
+func (s *uploadSummary) log(ctx context.Context, interval time.Duration) {
+	files, bytes := s.files.Swap(0), s.bytes.Swap(0)
+	if files == 0 {
+		return
+	}
+	slog.InfoContext(ctx, "uploads summary",
+		slog.Int64("files", files),
+		slog.Int64("bytes", bytes),
+		slog.Duration("interval", interval),
+	)
+}
+
+// runLogSummary logs the summary of the uploads every LogSummaryInterval, and at the shutdown.
+func (tr *Transporter) runLogSummary(ctx context.Context) error {
+	if tr.summary == nil {
+		return nil
+	}
+	ctx = slogcontext.WithValue(ctx, "component", "transporter")
+	interval := tr.config.LogSummaryInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			tr.summary.log(ctx, interval)
+			return ctx.Err()
+		case <-ticker.C:
+			tr.summary.log(ctx, interval)
+		}
+	}
+}
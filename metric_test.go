@@ -1,10 +1,16 @@
 package s3mover_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
 )
 
 func TestMetrics(t *testing.T) {
@@ -28,3 +34,173 @@ func TestMetrics(t *testing.T) {
 	}
 	t.Log(m)
 }
+
+func TestMetricsSnapshot(t *testing.T) {
+	m := s3mover.NewMetrics()
+	m.PutObject(true)
+	m.SetQueued(3)
+	s := m.Snapshot()
+	if s.Objects.Uploaded != 1 || s.Objects.Queued != 3 {
+		t.Errorf("unexpected snapshot: %#v", s.Objects)
+	}
+	if s.Objects.SecondsSinceLastUpload <= 0 {
+		t.Errorf("seconds since last upload must be counted from the start: %f", s.Objects.SecondsSinceLastUpload)
+	}
+	if s.Runtime == nil {
+		t.Fatal("runtime metrics must be set")
+	}
+	if s.Runtime.Goroutines <= 0 {
+		t.Errorf("goroutines: %d", s.Runtime.Goroutines)
+	}
+	if s.Runtime.HeapInUse == 0 {
+		t.Error("heap in use must not be 0")
+	}
+}
+
+func TestMetricsPrometheus(t *testing.T) {
+	m := s3mover.NewMetrics()
+	m.PutObject(true)
+	m.PutObject(false)
+	var b strings.Builder
+	if err := m.Snapshot().WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, s := range []string{
+		"# TYPE s3mover_objects_uploaded_total counter\ns3mover_objects_uploaded_total 1\n",
+		"s3mover_objects_errored_total 1\n",
+		"s3mover_objects_queued 0\n",
+		"# TYPE s3mover_goroutines gauge\n",
+		"s3mover_heap_inuse_bytes ",
+		"s3mover_open_fds ",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q is not found in output:\n%s", s, out)
+		}
+	}
+}
+
+func TestScanMetrics(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "empty.txt", []byte{})
+	s3movertest.WriteFile(t, dir, ".hidden", []byte("hidden"))
+	config := &s3mover.Config{
+		SrcDir:          dir,
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/scan",
+		MaxParallels:    1,
+		EmptyFilePolicy: s3mover.FilePolicySkip,
+	}
+	tr, _ := newTestTransporter(t, config)
+	if m := tr.Metrics().Snapshot(); m.Scan != nil {
+		t.Errorf("scan metrics must be nil before scanning: %+v", m.Scan)
+	}
+	tr.Flush(ctx)
+	tr.Flush(ctx)
+	sc := tr.Metrics().Snapshot().Scan
+	if sc == nil {
+		t.Fatal("scan metrics must be set")
+	}
+	if sc.Count != 2 || sc.Discovered != 1 || sc.Skipped.Hidden != 1 || sc.Skipped.Policy != 1 || sc.Skipped.Kept != 0 {
+		t.Errorf("unexpected scan metrics: %+v", sc)
+	}
+	var b strings.Builder
+	if err := tr.Metrics().Snapshot().WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	if want := `s3mover_scan_files_skipped{reason="hidden"} 1`; !strings.Contains(b.String(), want) {
+		t.Errorf("%s is not found in %s", want, b.String())
+	}
+}
+
+func TestBacklogMetrics(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("barbar"))
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "foo.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/backlog",
+		MaxParallels: 1,
+	}
+	tr, _ := newTestTransporter(t, config)
+	tr.Flush(ctx)
+	// the backlog is of the first scan only
+	s3movertest.WriteFile(t, dir, "baz.txt", []byte("baz"))
+	tr.Flush(ctx)
+	b := tr.Metrics().Snapshot().Backlog
+	if b == nil {
+		t.Fatal("backlog metrics must be set")
+	}
+	if b.Files != 2 || b.Bytes != 9 || b.OldestAgeSeconds < 3600 {
+		t.Errorf("unexpected backlog metrics: %+v", b)
+	}
+}
+
+func TestKeyCollisionMetrics(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/collision",
+		MaxParallels: 1,
+		TimeFormat:   "2006",
+	}
+	tr, _ := newTestTransporter(t, config)
+	// the same name in the same time partition
+	for _, name := range []string{"foo.txt", "bar.txt", "foo.txt"} {
+		s3movertest.WriteFile(t, dir, name, []byte(name))
+		tr.Flush(ctx)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Uploaded != 3 || m.Objects.KeyCollisions != 1 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
+
+func TestKeyCollisionPartition(t *testing.T) {
+	u := s3mover.NewUploadedKeys(&s3mover.Config{TimeFormat: "2006/01/02/15"})
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, s3mover.TZ)
+	if u.Add("testbucket", "foo", now) || u.Add("testbucket", "bar", now) {
+		t.Error("the first upload must not collide")
+	}
+	if !u.Add("testbucket", "foo", now.Add(time.Hour)) {
+		t.Error("the key of the previous partition must collide")
+	}
+	if u.Add("otherbucket", "foo", now.Add(time.Hour)) {
+		t.Error("the key of the other bucket must not collide")
+	}
+	// rolled over twice
+	if u.Add("testbucket", "bar", now.Add(3*time.Hour)) {
+		t.Error("the keys older than the previous partition must be forgotten")
+	}
+
+	// bounded in the partition
+	u.SetSize(2)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		u.Add("testbucket", key, now)
+	}
+	if u.Add("testbucket", "a", now) {
+		t.Error("the keys over the size must be forgotten")
+	}
+	if !u.Add("testbucket", "d", now) {
+		t.Error("the recent keys must be remembered")
+	}
+
+	// the re-uploads are intended in mirror
+	u = s3mover.NewUploadedKeys(&s3mover.Config{Mirror: true})
+	if u.Add("testbucket", "foo", now) || u.Add("testbucket", "foo", now) {
+		t.Error("the re-uploads in mirror must not collide")
+	}
+	u = s3mover.NewUploadedKeys(&s3mover.Config{Mirror: true, RevisionSuffix: true})
+	if u.Add("testbucket", "foo", now) || !u.Add("testbucket", "foo", now) {
+		t.Error("the same key with revision-suffix must collide")
+	}
+}
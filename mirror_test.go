@@ -0,0 +1,83 @@
+package s3mover_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestMirror(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	config := &s3mover.Config{
+		SrcDir:         dir,
+		Bucket:         "testbucket",
+		KeyPrefix:      "test/mirror",
+		MaxParallels:   1,
+		Mirror:         true,
+		RevisionSuffix: true,
+		AuditLogPath:   auditLog,
+	}
+	tr, client := newTestTransporter(t, config)
+
+	for i, content := range []string{"foo", "", "foofoo", "", "foofoofoo"} {
+		if content != "" {
+			if err := os.WriteFile(foo, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(foo); err != nil {
+			t.Errorf("#%d: file must be kept in mirror mode: %s", i, err)
+		}
+	}
+
+	keys := client.Keys()
+	if len(keys) != 3 {
+		t.Fatalf("unexpected objects: %v", keys)
+	}
+	sort.Strings(keys)
+	for i, suffix := range []string{"foo.txt", "foo.txt.r1", "foo.txt.r2"} {
+		if !strings.HasSuffix(keys[i], suffix) {
+			t.Errorf("unexpected key: %s, want suffix %s", keys[i], suffix)
+		}
+	}
+
+	f, err := os.Open(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []s3mover.AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec s3mover.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 3 {
+		t.Fatalf("unexpected audit records: %v", records)
+	}
+	for _, rec := range records {
+		if rec.Event != s3mover.AuditEventUploaded || rec.Path != foo || rec.Bucket != "testbucket" {
+			t.Errorf("unexpected audit record: %v", rec)
+		}
+	}
+	if records[2].Size != int64(len("foofoofoo")) {
+		t.Errorf("unexpected size: %d", records[2].Size)
+	}
+}
@@ -7,7 +7,13 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	slogcontext "github.com/PumpkinSeed/slog-context"
 )
@@ -17,7 +23,191 @@ type Metrics struct {
 		Uploaded int64 `json:"uploaded"`
 		Errored  int64 `json:"errored"`
 		Queued   int64 `json:"queued"`
+
+		// UploadedBytes is the total size of the uploaded objects, after compressing.
+		UploadedBytes int64 `json:"uploaded_bytes"`
+
+		// UploadedFallback is the number of objects uploaded to the fallback bucket, included in Uploaded.
+		UploadedFallback int64 `json:"uploaded_fallback"`
+
+		// DeadLettered is the number of files moved to the dead-letter directory.
+		DeadLettered int64 `json:"dead_lettered"`
+
+		// TimedOut is the number of objects failed by UploadTimeout, included in Errored.
+		TimedOut int64 `json:"timed_out"`
+
+		// KeyCollisions is the number of uploads to the keys already uploaded in the current or the previous time partition.
+		KeyCollisions int64 `json:"key_collisions"`
+
+		// Deduplicated is the number of files not uploaded again by DedupeOnStartup, included in Uploaded.
+		Deduplicated int64 `json:"deduplicated"`
+
+		// DuplicatesSuppressed is the number of files not uploaded because the same files were uploaded
+		// within DuplicateWindow, included in Uploaded.
+		DuplicatesSuppressed int64 `json:"duplicates_suppressed"`
+
+		// Truncated is the number of files truncated after the discovery, such as by copytruncate of logrotate.
+		Truncated int64 `json:"truncated"`
+
+		// Locked is the number of the reads of the files failed by the locks of the other processes, retried without counting as errors.
+		Locked int64 `json:"locked"`
+
+		// Observed is the number of files which would be uploaded by Observe, and ObservedBytes is the total size of them after compressing.
+		Observed      int64 `json:"observed"`
+		ObservedBytes int64 `json:"observed_bytes"`
+
+		// CredentialErrors is the number of uploads failed by the expired or unavailable credentials.
+		CredentialErrors int64 `json:"credential_errors"`
+
+		// LocalErrors is the number of errors of reading the local files by the reason, not of S3.
+		LocalErrors LocalErrorMetrics `json:"local_errors"`
+
+		// SecondsSinceLastUpload is the elapsed time since the last successful upload, or since the start if never uploaded.
+		SecondsSinceLastUpload float64 `json:"seconds_since_last_successful_upload"`
 	} `json:"objects"`
+	Workers      WorkerMetrics                  `json:"workers"`
+	Scan         *ScanMetrics                   `json:"scan,omitempty"`
+	Backlog      *BacklogMetrics                `json:"backlog,omitempty"`
+	Spool        *SpoolMetrics                  `json:"spool,omitempty"`
+	Destinations map[string]*DestinationMetrics `json:"destinations,omitempty"`
+	Directories  map[string]*DirectoryMetrics   `json:"directories,omitempty"`
+	Priorities   map[string]*PriorityMetrics    `json:"priorities,omitempty"`
+	Runtime      *RuntimeMetrics                `json:"runtime,omitempty"`
+	RetryBudget  *RetryBudgetMetrics            `json:"retry_budget,omitempty"`
+
+	mu           sync.Mutex // guards Scan, Backlog, Spool and Directories
+	lastUploaded int64      // unix nano time of the last upload, or the start
+	workerWait   int64      // the total nanoseconds waited for the workers
+}
+
+// ScanMetrics represents the metrics of the last scan of the source directory.
+// The duration is of listing and filtering the files, excluding uploading.
+type ScanMetrics struct {
+	Count           int64   `json:"count"`
+	Errors          int64   `json:"errors"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Discovered      int64   `json:"discovered"`
+	Skipped         struct {
+		Hidden   int64 `json:"hidden"`
+		Kept     int64 `json:"kept"`
+		Policy   int64 `json:"policy"`
+		Owner    int64 `json:"owner"`
+		Observed int64 `json:"observed"`
+	} `json:"skipped"`
+}
+
+// setScan records the last scan and counts it.
+func (m *Metrics) setScan(scan ScanMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Scan != nil {
+		scan.Count = m.Scan.Count
+		scan.Errors = m.Scan.Errors
+	}
+	scan.Count++
+	m.Scan = &scan
+}
+
+// scanError counts the failed scan. The last scan is kept.
+func (m *Metrics) scanError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Scan == nil {
+		m.Scan = &ScanMetrics{}
+	}
+	m.Scan.Errors++
+}
+
+// DirectoryMetrics represents the metrics of a top-level subdirectory of the source directory in recursive mode.
+// The files directly in the source directory are counted as ".".
+type DirectoryMetrics struct {
+	Uploaded int64 `json:"uploaded"`
+	Errored  int64 `json:"errored"`
+	Queued   int64 `json:"queued"`
+	Bytes    int64 `json:"bytes"`
+
+	// Throttled is the number of times the files are left for the next scan by TenantMaxParallels.
+	Throttled int64 `json:"throttled"`
+
+	SecondsSinceLastUpload float64 `json:"seconds_since_last_successful_upload"`
+
+	lastUploaded int64 // unix nano time of the last upload, or the first seen
+}
+
+func (m *DirectoryMetrics) Throttle() {
+	atomic.AddInt64(&m.Throttled, 1)
+}
+
+func (m *DirectoryMetrics) PutObject(success bool) {
+	if success {
+		atomic.AddInt64(&m.Uploaded, 1)
+	} else {
+		atomic.AddInt64(&m.Errored, 1)
+	}
+}
+
+func (m *DirectoryMetrics) AddBytes(n int64) {
+	atomic.AddInt64(&m.Bytes, n)
+}
+
+// directory returns the metrics of the directory, creating it if needed.
+func (m *Metrics) directory(dir string) *DirectoryMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Directories == nil {
+		m.Directories = make(map[string]*DirectoryMetrics)
+	}
+	d, ok := m.Directories[dir]
+	if !ok {
+		d = &DirectoryMetrics{lastUploaded: time.Now().UnixNano()}
+		m.Directories[dir] = d
+	}
+	return d
+}
+
+// uploadedAt records the time of the last successful upload.
+func (m *Metrics) uploadedAt(t time.Time) {
+	atomic.StoreInt64(&m.lastUploaded, t.UnixNano())
+}
+
+// uploadedAt records the time of the last successful upload from the directory.
+func (m *DirectoryMetrics) uploadedAt(t time.Time) {
+	atomic.StoreInt64(&m.lastUploaded, t.UnixNano())
+}
+
+// sinceLastUpload returns the elapsed seconds since the unix nano time, or 0 if not set.
+func sinceLastUpload(nano int64, now time.Time) float64 {
+	if nano == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, nano)).Seconds()
+}
+
+// setDirectoryQueued sets the number of queued files by directory.
+// The directories not in queued are reset to zero.
+func (m *Metrics) setDirectoryQueued(queued map[string]int64) {
+	for dir, n := range queued {
+		atomic.StoreInt64(&m.directory(dir).Queued, n)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dir, d := range m.Directories {
+		if _, ok := queued[dir]; !ok {
+			atomic.StoreInt64(&d.Queued, 0)
+		}
+	}
+}
+
+// RuntimeMetrics represents the Go runtime statistics of the process.
+type RuntimeMetrics struct {
+	Goroutines int    `json:"goroutines"`
+	HeapInUse  uint64 `json:"heap_in_use"`
+	GC         struct {
+		Count        uint32 `json:"count"`
+		PauseTotalNs uint64 `json:"pause_total_ns"`
+		LastPauseNs  uint64 `json:"last_pause_ns"`
+	} `json:"gc"`
+	OpenFDs int `json:"open_fds"`
 }
 
 func (m *Metrics) PutObject(success bool) {
@@ -28,22 +218,234 @@ func (m *Metrics) PutObject(success bool) {
 	}
 }
 
+func (m *Metrics) AddUploadedBytes(n int64) {
+	atomic.AddInt64(&m.Objects.UploadedBytes, n)
+}
+
+func (m *Metrics) UploadedFallback() {
+	atomic.AddInt64(&m.Objects.UploadedFallback, 1)
+}
+
+func (m *Metrics) DeadLettered() {
+	atomic.AddInt64(&m.Objects.DeadLettered, 1)
+}
+
+func (m *Metrics) TimedOut() {
+	atomic.AddInt64(&m.Objects.TimedOut, 1)
+}
+
+func (m *Metrics) KeyCollision() {
+	atomic.AddInt64(&m.Objects.KeyCollisions, 1)
+}
+
+func (m *Metrics) Deduplicated() {
+	atomic.AddInt64(&m.Objects.Deduplicated, 1)
+}
+
+func (m *Metrics) DuplicateSuppressed() {
+	atomic.AddInt64(&m.Objects.DuplicatesSuppressed, 1)
+}
+
+func (m *Metrics) Truncated() {
+	atomic.AddInt64(&m.Objects.Truncated, 1)
+}
+
+func (m *Metrics) Locked() {
+	atomic.AddInt64(&m.Objects.Locked, 1)
+}
+
+func (m *Metrics) Observed(size int64) {
+	atomic.AddInt64(&m.Objects.Observed, 1)
+	atomic.AddInt64(&m.Objects.ObservedBytes, size)
+}
+
+func (m *Metrics) CredentialError() {
+	atomic.AddInt64(&m.Objects.CredentialErrors, 1)
+}
+
+func (m *Metrics) LocalError(reason string) {
+	m.Objects.LocalErrors.add(reason)
+}
+
 func (m *Metrics) SetQueued(n int64) {
 	atomic.StoreInt64(&m.Objects.Queued, n)
 }
 
+// Snapshot returns a copy of the metrics with the current runtime statistics.
+func (m *Metrics) Snapshot() *Metrics {
+	now := time.Now()
+	s := &Metrics{}
+	s.Objects.SecondsSinceLastUpload = sinceLastUpload(atomic.LoadInt64(&m.lastUploaded), now)
+	s.Objects.Uploaded = atomic.LoadInt64(&m.Objects.Uploaded)
+	s.Objects.Errored = atomic.LoadInt64(&m.Objects.Errored)
+	s.Objects.Queued = atomic.LoadInt64(&m.Objects.Queued)
+	s.Objects.UploadedBytes = atomic.LoadInt64(&m.Objects.UploadedBytes)
+	s.Objects.UploadedFallback = atomic.LoadInt64(&m.Objects.UploadedFallback)
+	s.Objects.DeadLettered = atomic.LoadInt64(&m.Objects.DeadLettered)
+	s.Objects.TimedOut = atomic.LoadInt64(&m.Objects.TimedOut)
+	s.Objects.KeyCollisions = atomic.LoadInt64(&m.Objects.KeyCollisions)
+	s.Objects.Deduplicated = atomic.LoadInt64(&m.Objects.Deduplicated)
+	s.Objects.DuplicatesSuppressed = atomic.LoadInt64(&m.Objects.DuplicatesSuppressed)
+	s.Objects.Truncated = atomic.LoadInt64(&m.Objects.Truncated)
+	s.Objects.Locked = atomic.LoadInt64(&m.Objects.Locked)
+	s.Objects.Observed = atomic.LoadInt64(&m.Objects.Observed)
+	s.Objects.ObservedBytes = atomic.LoadInt64(&m.Objects.ObservedBytes)
+	s.Objects.CredentialErrors = atomic.LoadInt64(&m.Objects.CredentialErrors)
+	s.Objects.LocalErrors = m.Objects.LocalErrors.snapshot()
+	s.Workers = m.workersSnapshot()
+	if m.Destinations != nil {
+		s.Destinations = make(map[string]*DestinationMetrics, len(m.Destinations))
+		for url, d := range m.Destinations {
+			s.Destinations[url] = &DestinationMetrics{
+				Uploaded: atomic.LoadInt64(&d.Uploaded),
+				Errored:  atomic.LoadInt64(&d.Errored),
+				Bytes:    atomic.LoadInt64(&d.Bytes),
+			}
+		}
+	}
+	if m.Priorities != nil {
+		s.Priorities = make(map[string]*PriorityMetrics, len(m.Priorities))
+		for class, pm := range m.Priorities {
+			s.Priorities[class] = &PriorityMetrics{
+				Uploaded: atomic.LoadInt64(&pm.Uploaded),
+				Errored:  atomic.LoadInt64(&pm.Errored),
+				Queued:   atomic.LoadInt64(&pm.Queued),
+			}
+		}
+	}
+	if b := m.RetryBudget; b != nil {
+		s.RetryBudget = &RetryBudgetMetrics{
+			Requests: atomic.LoadInt64(&b.Requests),
+			Retries:  atomic.LoadInt64(&b.Retries),
+			Rejected: atomic.LoadInt64(&b.Rejected),
+			Backoffs: atomic.LoadInt64(&b.Backoffs),
+		}
+	}
+	m.mu.Lock()
+	if m.Scan != nil {
+		scan := *m.Scan
+		s.Scan = &scan
+	}
+	if m.Backlog != nil {
+		backlog := *m.Backlog
+		s.Backlog = &backlog
+	}
+	if m.Spool != nil {
+		spool := *m.Spool
+		s.Spool = &spool
+	}
+	if m.Directories != nil {
+		s.Directories = make(map[string]*DirectoryMetrics, len(m.Directories))
+		for dir, d := range m.Directories {
+			s.Directories[dir] = &DirectoryMetrics{
+				Uploaded: atomic.LoadInt64(&d.Uploaded),
+				Errored:  atomic.LoadInt64(&d.Errored),
+				Queued:   atomic.LoadInt64(&d.Queued),
+				Bytes:    atomic.LoadInt64(&d.Bytes),
+
+				Throttled: atomic.LoadInt64(&d.Throttled),
+
+				SecondsSinceLastUpload: sinceLastUpload(atomic.LoadInt64(&d.lastUploaded), now),
+			}
+		}
+	}
+	m.mu.Unlock()
+	s.Runtime = NewRuntimeMetrics()
+	return s
+}
+
+// topDirectory returns the top-level subdirectory of path in the source directory, or "." for the files directly in it.
+func (tr *Transporter) topDirectory(path string) string {
+	rel, err := filepath.Rel(tr.config.SrcDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "."
+	}
+	dir, _, ok := strings.Cut(filepath.ToSlash(rel), "/")
+	if !ok {
+		return "."
+	}
+	return dir
+}
+
+// directoryMetrics returns the metrics of the top-level subdirectory of path, or nil unless recursive.
+func (tr *Transporter) directoryMetrics(path string) *DirectoryMetrics {
+	if !tr.config.Recursive {
+		return nil
+	}
+	return tr.metrics.directory(tr.topDirectory(path))
+}
+
+// setQueued sets the number of queued files in total, by priority class and by directory.
+func (tr *Transporter) setQueued(paths []string) {
+	tr.metrics.SetQueued(int64(len(paths)))
+	tr.setPriorityQueued(paths)
+	if !tr.config.Recursive {
+		return
+	}
+	queued := make(map[string]int64)
+	for _, path := range paths {
+		queued[tr.topDirectory(path)]++
+	}
+	tr.metrics.setDirectoryQueued(queued)
+}
+
 func (tr *Transporter) Metrics() *Metrics {
 	return tr.metrics
 }
 
 func NewMetrics() *Metrics {
-	return &Metrics{}
+	return &Metrics{lastUploaded: time.Now().UnixNano()}
 }
 
-// HTTP server to serve metrics
-func (tr *Transporter) runStatsServer(ctx context.Context) error {
-	ctx = slogcontext.WithValue(ctx, "component", "stats-server")
+// NewRuntimeMetrics reads the current Go runtime statistics.
+func NewRuntimeMetrics() *RuntimeMetrics {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	r := &RuntimeMetrics{
+		Goroutines: runtime.NumGoroutine(),
+		HeapInUse:  ms.HeapInuse,
+		OpenFDs:    countOpenFDs(),
+	}
+	r.GC.Count = ms.NumGC
+	r.GC.PauseTotalNs = ms.PauseTotalNs
+	if ms.NumGC > 0 {
+		r.GC.LastPauseNs = ms.PauseNs[(ms.NumGC+255)%256]
+	}
+	return r
+}
+
+// countOpenFDs returns the number of open file descriptors of the process.
+// It returns -1 if the platform does not provide the information.
+func countOpenFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries)
+		}
+	}
+	return -1
+}
+
+// configHandler serves the effective configurations with the sensitive values redacted.
+func (tr *Transporter) configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-type", "application/json")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(tr.config.Redacted()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// listenStats listens on the port of the stats server. It returns nil if the stats server is disabled.
+func (tr *Transporter) listenStats() (net.Listener, error) {
 	if tr.config.StatsServerPort == 0 {
+		return nil, nil
+	}
+	return net.Listen("tcp", fmt.Sprintf(":%d", tr.config.StatsServerPort))
+}
+
+// runStatsServer serves the stats server on l opened by listenStats.
+func (tr *Transporter) runStatsServer(ctx context.Context, l net.Listener) error {
+	ctx = slogcontext.WithValue(ctx, "component", "stats-server")
+	if l == nil {
 		slog.InfoContext(ctx, "stats server is disabled")
 		return nil
 	}
@@ -51,20 +453,36 @@ func (tr *Transporter) runStatsServer(ctx context.Context) error {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-type", "application/json")
 		enc := json.NewEncoder(w)
-		if err := enc.Encode(tr.Metrics()); err != nil {
+		if err := enc.Encode(tr.Metrics().Snapshot()); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	promHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "text/plain; version=0.0.4")
+		if err := tr.Metrics().Snapshot().WritePrometheus(w); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	failuresHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(tr.Failures()); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/stats/metrics", handler)
-	addr := fmt.Sprintf(":%d", tr.config.StatsServerPort)
+	mux.HandleFunc("/stats/failures", failuresHandler)
+	mux.HandleFunc("/stats/config", tr.configHandler)
+	mux.HandleFunc("/healthz", tr.healthHandler)
+	mux.HandleFunc("/metrics", promHandler)
+	mux.HandleFunc("/debug/bundle", tr.bundleHandler)
+	if tr.config.IngestToken != "" {
+		mux.HandleFunc("/ingest", tr.ingestHandler)
+	}
 	srv := &http.Server{
 		Handler: mux,
-		Addr:    addr,
-	}
-	l, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
+		Addr:    l.Addr().String(),
 	}
 	slog.InfoContext(ctx, "starting up stats server", "listen", l.Addr().String())
 
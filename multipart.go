@@ -0,0 +1,229 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// DefaultMultipartPartSize is the default size of each part of multipart uploads.
+	DefaultMultipartPartSize = 8 * 1024 * 1024
+	// MinMultipartPartSize is the minimum part size allowed by S3.
+	MinMultipartPartSize = 5 * 1024 * 1024
+	// MaxMultipartParts is the maximum number of parts allowed by S3.
+	MaxMultipartParts = 10000
+	// DefaultMultipartConcurrency is the default number of parts uploaded concurrently for each file.
+	DefaultMultipartConcurrency = 4
+)
+
+// MultipartS3Client is an interface for the S3 client supporting multipart uploads.
+// When the S3Client implements it, large files are uploaded by multipart uploads.
+type MultipartS3Client interface {
+	CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// multipartClient returns the client as MultipartS3Client when the multipart upload is available.
+func multipartClient(client S3Client) (MultipartS3Client, bool) {
+	if c, ok := client.(*faultS3Client); ok {
+		client = c.S3Client
+		if _, ok := client.(MultipartS3Client); ok {
+			return c, true
+		}
+		return nil, false
+	}
+	mc, ok := client.(MultipartS3Client)
+	return mc, ok
+}
+
+// useMultipart reports whether the body of the length should be uploaded by the multipart upload.
+func (tr *Transporter) useMultipart(client S3Client, body io.Reader, length int64) (MultipartS3Client, io.ReaderAt, bool) {
+	oversized := tr.config.OversizedFilePolicy == FilePolicyMultipart && tr.config.MaxFileSize > 0 && length > tr.config.MaxFileSize
+	if !oversized && (tr.config.MultipartThreshold <= 0 || length < tr.config.MultipartThreshold) {
+		return nil, nil, false
+	}
+	ra, ok := body.(io.ReaderAt)
+	if !ok {
+		return nil, nil, false
+	}
+	mc, ok := multipartClient(client)
+	if !ok {
+		return nil, nil, false
+	}
+	return mc, ra, true
+}
+
+// partSize returns the part size for the length not to exceed the max number of parts.
+func (tr *Transporter) partSize(length int64) int64 {
+	size := tr.config.MultipartPartSize
+	if size <= 0 {
+		size = DefaultMultipartPartSize
+	}
+	if min := (length + MaxMultipartParts - 1) / MaxMultipartParts; size < min {
+		size = min
+	}
+	return size
+}
+
+// putMultipart uploads the body of the file path by the multipart upload. The parts are uploaded concurrently up to MultipartConcurrency.
+// The upload recorded in the resume journal by the previous run is resumed.
+func (tr *Transporter) putMultipart(ctx context.Context, client MultipartS3Client, path, bucket, key string, metadata map[string]string, sidecar *Sidecar, body io.ReaderAt, length int64) (*uploadResult, error) {
+	uploadID, uploaded := tr.resumableUpload(ctx, client, path, bucket, key)
+	if uploadID == "" {
+		created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      &bucket,
+			Key:         &key,
+			Metadata:    metadata,
+			ContentType: sidecar.contentType(),
+			Tagging:     sidecar.tagging(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create multipart upload: %w", err)
+		}
+		uploadID = aws.ToString(created.UploadId)
+		tr.recordMultipart(ctx, path, bucket, key, uploadID)
+	}
+	tr.uploading.Store(uploadID, struct{}{})
+	defer tr.uploading.Delete(uploadID)
+
+	parts, err := tr.uploadParts(ctx, client, bucket, key, uploadID, body, length, uploaded)
+	if err != nil {
+		tr.abandonMultipart(ctx, client, path, bucket, key, uploadID)
+		return nil, err
+	}
+	out, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		tr.abandonMultipart(ctx, client, path, bucket, key, uploadID)
+		return nil, fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	tr.forgetResume(ctx, path)
+	up := &uploadResult{Bucket: bucket, Key: key, Size: length, VersionID: aws.ToString(out.VersionId)}
+	up.RequestID, _ = awsmiddleware.GetRequestIDMetadata(out.ResultMetadata)
+	up.HostID, _ = s3.GetHostIDMetadata(out.ResultMetadata)
+	return up, nil
+}
+
+// uploadParts uploads the parts of the body. The parts already uploaded by the previous run with the same size and content are not uploaded again.
+func (tr *Transporter) uploadParts(ctx context.Context, client MultipartS3Client, bucket, key, uploadID string, body io.ReaderAt, length int64, uploaded map[int32]types.Part) ([]types.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := tr.config.MultipartConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultMultipartConcurrency
+	}
+	size := tr.partSize(length)
+	sem := make(chan struct{}, concurrency)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		parts []types.CompletedPart
+		errs  []error
+	)
+	for n, off := int32(1), int64(0); off < length; n, off = n+1, off+size {
+		partSize := size
+		if off+partSize > length {
+			partSize = length - off
+		}
+		if p, ok := uploaded[n]; ok && partUploaded(p, io.NewSectionReader(body, off, partSize), partSize) {
+			mu.Lock()
+			parts = append(parts, types.CompletedPart{ETag: p.ETag, PartNumber: aws.Int32(n)})
+			mu.Unlock()
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(n int32, off, partSize int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			part, err := tr.uploadPart(ctx, client, bucket, key, uploadID, n, io.NewSectionReader(body, off, partSize), partSize)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				cancel()
+				return
+			}
+			parts = append(parts, *part)
+		}(n, off, partSize)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.ToInt32(parts[i].PartNumber) < aws.ToInt32(parts[j].PartNumber)
+	})
+	return parts, nil
+}
+
+func (tr *Transporter) uploadPart(ctx context.Context, client MultipartS3Client, bucket, key, uploadID string, n int32, body io.ReadSeeker, size int64) (*types.CompletedPart, error) {
+	if err := tr.waitBandwidth(ctx, size); err != nil {
+		return nil, err
+	}
+	slog.DebugContext(ctx, "uploading part",
+		"s3url", fmt.Sprintf("s3://%s/%s", bucket, key),
+		slog.Int("part", int(n)),
+		slog.Int64("size", size),
+	)
+	start := time.Now()
+	uctx, cancel := tr.uploadContext(ctx)
+	defer cancel()
+	out, err := client.UploadPart(uctx, &s3.UploadPartInput{
+		Bucket:        &bucket,
+		Key:           &key,
+		UploadId:      &uploadID,
+		PartNumber:    aws.Int32(n),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	err = tr.uploadTimedOut(uctx, err)
+	tr.adaptive.observe(time.Since(start), err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part %d: %w", n, err)
+	}
+	return &types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(n)}, nil
+}
+
+// abortMultipart aborts the multipart upload not to be charged for the uploaded parts.
+// It runs even if ctx is canceled.
+func (tr *Transporter) abortMultipart(ctx context.Context, client MultipartS3Client, bucket, key, uploadID string) {
+	ctx = context.WithoutCancel(ctx)
+	if _, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	}); err != nil {
+		slog.WarnContext(ctx, "failed to abort multipart upload",
+			"s3url", fmt.Sprintf("s3://%s/%s", bucket, key),
+			"upload_id", uploadID,
+			"error", err,
+		)
+	}
+}
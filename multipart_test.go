@@ -0,0 +1,113 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func newMultipartTransporter(t *testing.T, dir string) *s3mover.Transporter {
+	t.Helper()
+	config := &s3mover.Config{
+		SrcDir:               dir,
+		Bucket:               "testbucket",
+		KeyPrefix:            "test/multipart",
+		MaxParallels:         1,
+		MultipartThreshold:   s3mover.MinMultipartPartSize,
+		MultipartPartSize:    s3mover.MinMultipartPartSize,
+		MultipartConcurrency: 2,
+	}
+	tr, _ := newTestTransporter(t, config)
+	return tr
+}
+
+func TestMultipart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	large := bytes.Repeat([]byte("0123456789"), s3mover.MinMultipartPartSize*2/10+1)
+	s3movertest.WriteFile(t, dir, "large.txt", large)
+	s3movertest.WriteFile(t, dir, "small.txt", []byte("foo"))
+
+	tr := newMultipartTransporter(t, dir)
+	client := s3movertest.NewMockS3Client()
+	tr.SetS3Client(client)
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 2 || total != 2 {
+		t.Fatalf("unexpected flush result: %d/%d %v", processed, total, err)
+	}
+	if client.MultipartUploads != 1 || client.UploadedParts != 3 {
+		t.Errorf("unexpected multipart uploads: %d uploads %d parts", client.MultipartUploads, client.UploadedParts)
+	}
+	var found bool
+	for _, obj := range client.Objects {
+		if int64(len(obj.Content)) == int64(len(large)) {
+			found = true
+			if !bytes.Equal(obj.Content, large) {
+				t.Error("unexpected content of the multipart upload")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("large file is not uploaded: %v", client.Keys())
+	}
+}
+
+type failingPartS3Client struct {
+	*s3movertest.MockS3Client
+}
+
+func (c *failingPartS3Client) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if aws.ToInt32(input.PartNumber) == 2 {
+		return nil, errors.New("part failed")
+	}
+	return c.MockS3Client.UploadPart(ctx, input, optFns...)
+}
+
+func TestMultipartAbort(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := s3movertest.WriteFile(t, dir, "large.txt", make([]byte, s3mover.MinMultipartPartSize*2))
+
+	tr := newMultipartTransporter(t, dir)
+	client := &failingPartS3Client{s3movertest.NewMockS3Client()}
+	tr.SetS3Client(client)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 0 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	if client.AbortedUploads != 1 || client.MultipartUploads != 0 {
+		t.Errorf("the multipart upload must be aborted: %d aborted %d completed", client.AbortedUploads, client.MultipartUploads)
+	}
+	if len(client.Keys()) != 0 {
+		t.Errorf("must not be uploaded: %v", client.Keys())
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the file must be kept: %v", err)
+	}
+}
+
+func TestMultipartValidate(t *testing.T) {
+	for _, config := range []s3mover.Config{
+		{MultipartThreshold: -1},
+		{MultipartThreshold: 1, MultipartPartSize: 1024},
+		{MultipartThreshold: 1, MultipartConcurrency: -1},
+	} {
+		config.SrcDir, config.Bucket, config.KeyPrefix = ".", "testbucket", "test/multipart"
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected error: %+v", config)
+		}
+	}
+}
+
+func TestMultipartIAMPolicy(t *testing.T) {
+	config := s3mover.Config{Bucket: "testbucket", KeyPrefix: "test/multipart", MultipartThreshold: s3mover.MinMultipartPartSize}
+	actions := config.IAMPolicy(s3mover.IAMPolicyOption{}).Statement[0].Action
+	if len(actions) != 2 || actions[1] != "s3:AbortMultipartUpload" {
+		t.Errorf("unexpected actions: %v", actions)
+	}
+}
@@ -0,0 +1,67 @@
+package s3mover
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// NormalizeNFC normalizes the names to the Unicode NFC, such as the NFD names created on macOS.
+	NormalizeNFC = "nfc"
+	// NormalizeSpace replaces the white spaces in the names with underscores.
+	NormalizeSpace = "space"
+	// NormalizePercent percent-encodes the characters in the names except the safe characters of S3.
+	NormalizePercent = "percent"
+)
+
+func validateNormalizeName(names []string) error {
+	for _, n := range names {
+		switch n {
+		case NormalizeNFC, NormalizeSpace, NormalizePercent:
+		default:
+			return fmt.Errorf("normalize-name must be %s, %s or %s", NormalizeNFC, NormalizeSpace, NormalizePercent)
+		}
+	}
+	return nil
+}
+
+// normalizeName normalizes the name of the object by the normalizations in the order of
+// NormalizeNFC, NormalizeSpace and NormalizePercent regardless of the order specified.
+func normalizeName(name string, normalizations []string) string {
+	if len(normalizations) == 0 {
+		return name
+	}
+	if slices.Contains(normalizations, NormalizeNFC) {
+		name = norm.NFC.String(name)
+	}
+	if slices.Contains(normalizations, NormalizeSpace) {
+		name = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return '_'
+			}
+			return r
+		}, name)
+	}
+	if slices.Contains(normalizations, NormalizePercent) {
+		name = percentEncodeKey(name)
+	}
+	return name
+}
+
+// percentEncodeKey percent-encodes the bytes of s except the safe characters of S3 and slashes.
+func percentEncodeKey(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!-_.*'()/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package s3mover_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestNormalizeName(t *testing.T) {
+	ctx := context.Background()
+	// "が" in NFD is "か" and the combining voiced sound mark
+	nfd := "\u304b\u3099 b&c.log"
+	for _, c := range []struct {
+		normalize []string
+		expected  string
+	}{
+		{nil, "/" + nfd},
+		{[]string{s3mover.NormalizeNFC}, "/\u304c b&c.log"},
+		{[]string{s3mover.NormalizeSpace}, "/\u304b\u3099_b&c.log"},
+		{[]string{s3mover.NormalizePercent, s3mover.NormalizeSpace, s3mover.NormalizeNFC}, "/%E3%81%8C_b%26c.log"},
+	} {
+		dir := t.TempDir()
+		s3movertest.WriteFile(t, dir, nfd, []byte("foo"))
+		config := &s3mover.Config{
+			SrcDir:        dir,
+			Bucket:        "testbucket",
+			KeyPrefix:     "test/normalize",
+			MaxParallels:  1,
+			NormalizeName: c.normalize,
+		}
+		tr, client := newTestTransporter(t, config)
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if keys := client.Keys(); len(keys) != 1 || !strings.HasSuffix(keys[0], c.expected) {
+			t.Errorf("normalize %v: unexpected keys %q, want suffix %q", c.normalize, keys, c.expected)
+		}
+	}
+}
+
+func TestNormalizeNameValidate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:        t.TempDir(),
+		Bucket:        "testbucket",
+		KeyPrefix:     "test/normalize",
+		MaxParallels:  1,
+		NormalizeName: []string{"nfkc"},
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("unknown normalization must be invalid")
+	}
+}
@@ -0,0 +1,83 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+func (c *Config) validateObserve() error {
+	if !c.Observe {
+		return nil
+	}
+	if c.SQSQueueURL != "" {
+		return errors.New("observe can't be used with sqs-queue-url, which deletes the messages of the files")
+	}
+	return nil
+}
+
+// observe reports the file as it would be uploaded, with neither uploading nor removing it.
+// The key and the size after compressing are computed as uploading. The file is not observed again until modified.
+func (tr *Transporter) observe(ctx context.Context, path string) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, asLocalReadError(path, err))
+	}
+	if policy := tr.filePolicy(st); policy == FilePolicyDelete || policy == FilePolicyDeadLetter {
+		tr.observed.add(path, st.ModTime())
+		slog.InfoContext(ctx, "observed. would be handled without uploading", "path", path, "size", st.Size(), "policy", policy)
+		return nil
+	}
+	key, length, err := tr.observeKey(ctx, path)
+	if err != nil {
+		return err
+	}
+	tr.observed.add(path, st.ModTime())
+	tr.metrics.Observed(length)
+	slog.InfoContext(ctx, "observed. would be uploaded",
+		"path", path,
+		"s3url", fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key),
+		slog.Int64("size", length),
+	)
+	return nil
+}
+
+// observeKey returns the key and the size of the object as put to the primary bucket.
+func (tr *Transporter) observeKey(ctx context.Context, path string) (string, int64, error) {
+	sidecar, err := tr.readSidecar(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read sidecar: %w", asLocalReadError(path, err))
+	}
+	override, err := tr.readKeyOverride(path, sidecar)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read key directive: %w", asLocalReadError(path, err))
+	}
+	prefix := tr.config.KeyPrefix
+	body, length, ts, name, err := tr.load(path, tr.objectName(tr.config.SrcDir, path), override.skip())
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open file: %w", asLocalReadError(path, err))
+	}
+	defer body.Close()
+	if name, err = tr.keyName(path, name); err != nil {
+		return "", 0, fmt.Errorf("failed to hash content: %w", err)
+	}
+	key, err := tr.fitKey(ctx, override.apply(prefix, tr.objectKey(prefix, path, name, ts), 0))
+	if err != nil {
+		return "", 0, err
+	}
+	return key, length, nil
+}
+
+// alreadyObserved reports whether the file has been observed and is not modified since then.
+func (tr *Transporter) alreadyObserved(path string) bool {
+	if !tr.config.Observe {
+		return false
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return tr.observed.has(path, st.ModTime())
+}
@@ -0,0 +1,75 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestObserve(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.log", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "bar.log", []byte("bar"))
+	s3movertest.WriteFile(t, dir, "empty.log", nil)
+	config := &s3mover.Config{
+		SrcDir:          dir,
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/observe",
+		MaxParallels:    1,
+		EmptyFilePolicy: s3mover.FilePolicyDelete,
+		Observe:         true,
+	}
+	tr, client := newTestTransporter(t, config)
+	for i := 0; i < 2; i++ {
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(client.Objects) != 0 {
+		t.Errorf("no objects must be uploaded: %v", client.Keys())
+	}
+	for _, name := range []string{"foo.log", "bar.log", "empty.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s must be left: %v", name, err)
+		}
+	}
+	m := tr.Metrics().Snapshot()
+	if m.Objects.Observed != 2 || m.Objects.ObservedBytes != 6 || m.Objects.Uploaded != 0 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+	if m.Scan.Skipped.Observed != 3 || m.Objects.Queued != 0 {
+		t.Errorf("the observed files must be skipped: %+v", m.Scan)
+	}
+
+	// observed again after modified
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(foo, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Observed != 3 {
+		t.Errorf("the modified file must be observed again: %+v", m.Objects)
+	}
+}
+
+func TestObserveValidate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:       t.TempDir(),
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/observe",
+		MaxParallels: 1,
+		Observe:      true,
+		SQSQueueURL:  "https://sqs.ap-northeast-1.amazonaws.com/123456789012/myqueue",
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("observe must not be used with sqs-queue-url")
+	}
+}
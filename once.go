@@ -0,0 +1,92 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// OnceStatusOK means all the files are uploaded.
+	OnceStatusOK = "ok"
+	// OnceStatusPartial means some files failed to upload, and they are left in the source directory.
+	OnceStatusPartial = "partial"
+	// OnceStatusConfigError means the configurations are invalid, or the bucket or the source directory is not usable.
+	OnceStatusConfigError = "config_error"
+	// OnceStatusAuthError means the credentials are invalid, expired or unavailable.
+	OnceStatusAuthError = "auth_error"
+)
+
+// OnceResult is the result of TransportOnce.
+type OnceResult struct {
+	Status          string  `json:"status"`
+	Total           int64   `json:"total"`
+	Processed       int64   `json:"processed"`
+	Failed          int64   `json:"failed"`
+	UploadedBytes   int64   `json:"uploaded_bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// IsAuthError reports whether the error is caused by the credentials, such as InvalidAccessKeyId and ExpiredToken.
+func IsAuthError(err error) bool {
+	if isCredentialError(err) {
+		return true
+	}
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		for _, code := range failFastErrorCodes[FailFastAuth] {
+			if ae.ErrorCode() == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TransportOnce transports the files in the source directory once ignoring the buffer conditions, and returns the result.
+// The files failed to upload are left in the source directory for the next run.
+func (tr *Transporter) TransportOnce(ctx context.Context) *OnceResult {
+	ctx = slogcontext.WithValue(ctx, "component", "transporter")
+	start := time.Now()
+	res := &OnceResult{}
+	defer func() {
+		res.DurationSeconds = time.Since(start).Seconds()
+	}()
+	if err := tr.init(ctx); err != nil {
+		res.Status = OnceStatusConfigError
+		if IsAuthError(err) {
+			res.Status = OnceStatusAuthError
+		}
+		res.Error = err.Error()
+		return res
+	}
+	defer tr.audit.close()
+	processed, total, err := tr.Flush(ctx)
+	if err := tr.flushBatchManifest(ctx, time.Now()); err != nil {
+		slog.WarnContext(ctx, err.Error())
+	}
+	if tr.manifest != nil {
+		tr.manifest.close()
+	}
+	res.Processed, res.Total = processed, total
+	res.Failed = total - processed
+	res.UploadedBytes = tr.metrics.Snapshot().Objects.UploadedBytes
+	switch {
+	case err != nil:
+		res.Status = OnceStatusPartial
+		res.Error = err.Error()
+	case tr.authFailed.Load():
+		res.Status = OnceStatusAuthError
+	case res.Failed > 0:
+		res.Status = OnceStatusPartial
+	default:
+		res.Status = OnceStatusOK
+	}
+	slog.InfoContext(ctx, "transported once", "status", res.Status, "processed", processed, "total", total)
+	return res
+}
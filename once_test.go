@@ -0,0 +1,62 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// failingS3Client fails PutObject of the keys containing match.
+type failingS3Client struct {
+	*s3movertest.MockS3Client
+	match string
+	err   error
+}
+
+func (c *failingS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if strings.Contains(*input.Key, c.match) {
+		return nil, c.err
+	}
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestTransportOnce(t *testing.T) {
+	authErr := &smithy.GenericAPIError{Code: "InvalidAccessKeyId", Message: "The AWS Access Key Id you provided does not exist in our records."}
+	for _, tc := range []struct {
+		name      string
+		match     string
+		err       error
+		status    string
+		processed int64
+	}{
+		{name: "ok", match: "nothing", status: s3mover.OnceStatusOK, processed: 2},
+		{name: "partial", match: "bar.txt", err: errors.New("flaky"), status: s3mover.OnceStatusPartial, processed: 1},
+		{name: "auth on upload", match: "bar.txt", err: authErr, status: s3mover.OnceStatusAuthError, processed: 1},
+		{name: "auth on startup", match: s3mover.TestObjectKey, err: authErr, status: s3mover.OnceStatusAuthError},
+		{name: "no bucket", match: s3mover.TestObjectKey, err: &smithy.GenericAPIError{Code: "NoSuchBucket"}, status: s3mover.OnceStatusConfigError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+			s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+			config := &s3mover.Config{
+				SrcDir:       dir,
+				Bucket:       "testbucket",
+				KeyPrefix:    "test/once",
+				MaxParallels: 1,
+			}
+			tr, _ := newTestTransporter(t, config)
+			tr.SetS3Client(&failingS3Client{MockS3Client: s3movertest.NewMockS3Client(), match: tc.match, err: tc.err})
+			res := tr.TransportOnce(context.Background())
+			if res.Status != tc.status || res.Processed != tc.processed {
+				t.Errorf("unexpected result: %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package s3mover
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ownershipFilter selects the files by the owner, the group, and the permission bits.
+type ownershipFilter struct {
+	uids map[uint32]bool
+	gids map[uint32]bool
+	mode os.FileMode
+}
+
+// newOwnershipFilter creates the filter by Owners, OwnerGroups, and RequiredMode. It returns nil if none is specified.
+func newOwnershipFilter(c *Config) (*ownershipFilter, error) {
+	if len(c.Owners) == 0 && len(c.OwnerGroups) == 0 && c.RequiredMode == "" {
+		return nil, nil
+	}
+	if len(c.Owners) > 0 || len(c.OwnerGroups) > 0 {
+		if _, _, ok := fileOwnerOf("."); !ok {
+			return nil, fmt.Errorf("owner and owner-group are not supported on this platform")
+		}
+	}
+	f := &ownershipFilter{}
+	for _, name := range c.Owners {
+		uid, err := lookupUID(name)
+		if err != nil {
+			return nil, err
+		}
+		if f.uids == nil {
+			f.uids = make(map[uint32]bool)
+		}
+		f.uids[uint32(uid)] = true
+	}
+	for _, name := range c.OwnerGroups {
+		gid, err := lookupGID(name)
+		if err != nil {
+			return nil, err
+		}
+		if f.gids == nil {
+			f.gids = make(map[uint32]bool)
+		}
+		f.gids[uint32(gid)] = true
+	}
+	if c.RequiredMode != "" {
+		mode, err := strconv.ParseUint(c.RequiredMode, 8, 32)
+		if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+			return nil, fmt.Errorf("invalid required-mode %s: must be octal permission bits such as 0640", c.RequiredMode)
+		}
+		f.mode = os.FileMode(mode)
+	}
+	return f, nil
+}
+
+// match reports whether the file is owned by one of the owners and the groups, and has all the required permission bits.
+func (f *ownershipFilter) match(st os.FileInfo) bool {
+	if f == nil {
+		return true
+	}
+	if st.Mode().Perm()&f.mode != f.mode {
+		return false
+	}
+	if f.uids == nil && f.gids == nil {
+		return true
+	}
+	uid, gid, ok := fileOwner(st)
+	if !ok {
+		return false
+	}
+	return (f.uids == nil || f.uids[uid]) && (f.gids == nil || f.gids[gid])
+}
+
+// owned reports whether the file is in charge of this instance by the ownership filter.
+// The files not in charge are left for the other instances silently.
+func (tr *Transporter) owned(path string) bool {
+	if tr.ownership == nil {
+		return true
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		// let the following steps handle the error
+		return true
+	}
+	return tr.ownership.match(st)
+}
+
+func fileOwnerOf(path string) (uid, gid uint32, ok bool) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	return fileOwner(st)
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func testOwnership(t *testing.T, setup func(dir string), config *s3mover.Config) string {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"a.txt": 0600, "b.txt": 0640, "c.txt": 0644} {
+		s3movertest.WriteFile(t, dir, name, []byte(name))
+		if err := os.Chmod(filepath.Join(dir, name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if setup != nil {
+		setup(dir)
+	}
+	config.SrcDir, config.Bucket, config.KeyPrefix = dir, "testbucket", "test/ownership"
+	config.MaxParallels, config.TimeFormat = 1, "2006"
+	tr, client := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for key := range client.Objects {
+		names = append(names, filepath.Base(key))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestOwnershipRequiredMode(t *testing.T) {
+	if names := testOwnership(t, nil, &s3mover.Config{RequiredMode: "0040"}); names != "b.txt,c.txt" {
+		t.Errorf("unexpected uploaded files: %s", names)
+	}
+	if names := testOwnership(t, nil, &s3mover.Config{RequiredMode: "0644"}); names != "c.txt" {
+		t.Errorf("unexpected uploaded files: %s", names)
+	}
+}
+
+func TestOwnershipOwner(t *testing.T) {
+	uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+	if names := testOwnership(t, nil, &s3mover.Config{Owners: []string{uid}, OwnerGroups: []string{gid}}); names != "a.txt,b.txt,c.txt" {
+		t.Errorf("unexpected uploaded files: %s", names)
+	}
+	if os.Getuid() != 0 {
+		t.Skip("chown requires root")
+	}
+	other := func(dir string) {
+		if err := os.Chown(filepath.Join(dir, "a.txt"), 65534, 65534); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names := testOwnership(t, other, &s3mover.Config{Owners: []string{uid}}); names != "b.txt,c.txt" {
+		t.Errorf("unexpected uploaded files: %s", names)
+	}
+	if names := testOwnership(t, other, &s3mover.Config{OwnerGroups: []string{"65534"}}); names != "a.txt" {
+		t.Errorf("unexpected uploaded files: %s", names)
+	}
+}
+
+func TestOwnershipInvalid(t *testing.T) {
+	for _, config := range []*s3mover.Config{
+		{RequiredMode: "rw-r-----"},
+		{RequiredMode: "1777"},
+		{Owners: []string{"s3mover-no-such-user"}},
+		{OwnerGroups: []string{"s3mover-no-such-group"}},
+	} {
+		config.SrcDir, config.Bucket, config.KeyPrefix = ".", "testbucket", "test/ownership"
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected an error for %v %v %s", config.Owners, config.OwnerGroups, config.RequiredMode)
+		}
+	}
+}
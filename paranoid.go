@@ -0,0 +1,97 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// ProtectionS3Client is an interface for the S3 client getting the versioning and the replication of the bucket.
+// Paranoid requires the S3Client to implement it.
+type ProtectionS3Client interface {
+	GetBucketVersioning(ctx context.Context, input *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error)
+	GetBucketReplication(ctx context.Context, input *s3.GetBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error)
+}
+
+// protectionClient returns the client as ProtectionS3Client when getting the versioning and the replication is available.
+func protectionClient(client S3Client) (ProtectionS3Client, bool) {
+	if c, ok := client.(*faultS3Client); ok {
+		client = c.S3Client
+	}
+	pc, ok := client.(ProtectionS3Client)
+	return pc, ok
+}
+
+func (c *Config) validateParanoid() error {
+	if !c.Paranoid {
+		return nil
+	}
+	switch {
+	case c.Mirror:
+		return errors.New("paranoid can't be used with mirror, which never removes the files")
+	case arn.IsARN(c.Bucket):
+		return errors.New("paranoid can't be used with the access point, which doesn't report the versioning of the bucket")
+	}
+	return nil
+}
+
+// checkProtection checks that the buckets which the files are uploaded to before removing them keep another copy of
+// the objects by the versioning or the replication. With Paranoid, s3mover refuses to start to remove the local files
+// when the uploads would be the only copy, such as of the bucket misconfigured.
+func (tr *Transporter) checkProtection(ctx context.Context) error {
+	if !tr.config.Paranoid {
+		return nil
+	}
+	if err := checkBucketProtection(ctx, tr.s3, tr.config.Bucket); err != nil {
+		return err
+	}
+	if fb := tr.fallback; fb != nil {
+		return checkBucketProtection(ctx, fb.s3, fb.bucket)
+	}
+	return nil
+}
+
+func checkBucketProtection(ctx context.Context, client S3Client, bucket string) error {
+	protection, err := bucketProtection(ctx, client, bucket)
+	if err != nil {
+		return fmt.Errorf("paranoid refuses to remove the local files: %w", err)
+	}
+	slog.InfoContext(ctx, "the bucket keeps another copy of the objects", "bucket", bucket, "protection", protection)
+	return nil
+}
+
+// bucketProtection returns "versioning" or "replication" by which the bucket keeps another copy of the objects.
+func bucketProtection(ctx context.Context, client S3Client, bucket string) (string, error) {
+	pc, ok := protectionClient(client)
+	if !ok {
+		return "", errors.New("the S3 client does not support getting the versioning of the bucket")
+	}
+	v, err := pc.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: &bucket})
+	if err != nil {
+		return "", fmt.Errorf("failed to get the versioning of %s: %w", bucket, err)
+	}
+	if v.Status == types.BucketVersioningStatusEnabled {
+		return "versioning", nil
+	}
+	r, err := pc.GetBucketReplication(ctx, &s3.GetBucketReplicationInput{Bucket: &bucket})
+	var ae smithy.APIError
+	if errors.As(err, &ae) && ae.ErrorCode() == "ReplicationConfigurationNotFoundError" {
+		return "", fmt.Errorf("neither the versioning nor the replication of %s is enabled", bucket)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get the replication of %s: %w", bucket, err)
+	}
+	if r.ReplicationConfiguration != nil {
+		for _, rule := range r.ReplicationConfiguration.Rules {
+			if rule.Status == types.ReplicationRuleStatusEnabled {
+				return "replication", nil
+			}
+		}
+	}
+	return "", fmt.Errorf("neither the versioning nor the replication of %s is enabled", bucket)
+}
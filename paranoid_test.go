@@ -0,0 +1,80 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestParanoid(t *testing.T) {
+	ctx := context.Background()
+	replication := func(status types.ReplicationRuleStatus) *types.ReplicationConfiguration {
+		return &types.ReplicationConfiguration{Rules: []types.ReplicationRule{{Status: status}}}
+	}
+	for _, c := range []struct {
+		name        string
+		versioning  types.BucketVersioningStatus
+		replication *types.ReplicationConfiguration
+		ok          bool
+	}{
+		{"versioning", types.BucketVersioningStatusEnabled, nil, true},
+		{"replication", "", replication(types.ReplicationRuleStatusEnabled), true},
+		{"none", "", nil, false},
+		{"suspended", types.BucketVersioningStatusSuspended, nil, false},
+		{"replication disabled", "", replication(types.ReplicationRuleStatusDisabled), false},
+	} {
+		config := &s3mover.Config{
+			SrcDir:       t.TempDir(),
+			Bucket:       "testbucket",
+			KeyPrefix:    "test/paranoid",
+			MaxParallels: 1,
+			Paranoid:     true,
+		}
+		tr, client := newTestTransporter(t, config)
+		client.Versioning, client.Replication = c.versioning, c.replication
+		if err := tr.CheckProtection(ctx); (err == nil) != c.ok {
+			t.Errorf("%s: unexpected result: %v", c.name, err)
+		}
+	}
+}
+
+func TestParanoidFallback(t *testing.T) {
+	ctx := context.Background()
+	config := &s3mover.Config{
+		SrcDir:         t.TempDir(),
+		Bucket:         "testbucket",
+		KeyPrefix:      "test/paranoid",
+		MaxParallels:   1,
+		Paranoid:       true,
+		FallbackBucket: "fallbackbucket",
+	}
+	tr, client := newTestTransporter(t, config)
+	client.Versioning = types.BucketVersioningStatusEnabled
+	fallback := s3movertest.NewMockS3Client()
+	tr.SetFallbackS3Client(fallback)
+	if err := tr.CheckProtection(ctx); err == nil {
+		t.Error("the fallback bucket must be protected too")
+	}
+	fallback.Versioning = types.BucketVersioningStatusEnabled
+	if err := tr.CheckProtection(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParanoidValidate(t *testing.T) {
+	for _, c := range []s3mover.Config{
+		{Paranoid: true, Mirror: true},
+		{Paranoid: true, Bucket: "arn:aws:s3:ap-northeast-1:123456789012:accesspoint/myap"},
+	} {
+		c.SrcDir, c.KeyPrefix, c.MaxParallels = t.TempDir(), "test/paranoid", 1
+		if c.Bucket == "" {
+			c.Bucket = "testbucket"
+		}
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v must be invalid", c)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package s3mover
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+)
+
+// runPathsFrom reads newline-delimited paths from config.PathsFrom and transports the files as they arrive.
+// "-" means stdin. A FIFO is reopened when the writer closes it, so it never reaches EOF.
+func (tr *Transporter) runPathsFrom(ctx context.Context) error {
+	ctx = slogcontext.WithValue(ctx, "paths_from", tr.config.PathsFrom)
+	tr.setHealth(HealthStatusOK, "")
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		r, fifo, err := tr.openPathsFrom()
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "reading paths")
+		err = tr.readPaths(ctx, r, &wg)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if !fifo {
+			slog.InfoContext(ctx, "reached EOF")
+			return nil
+		}
+	}
+}
+
+func (tr *Transporter) openPathsFrom() (io.ReadCloser, bool, error) {
+	if tr.config.PathsFrom == "-" {
+		return io.NopCloser(os.Stdin), false, nil
+	}
+	// opening a FIFO blocks until a writer opens it
+	f, err := os.Open(tr.config.PathsFrom)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open %s: %w", tr.config.PathsFrom, err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	return f, st.Mode()&os.ModeNamedPipe != 0, nil
+}
+
+func (tr *Transporter) readPaths(ctx context.Context, r io.Reader, wg *sync.WaitGroup) error {
+	lines := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		errCh <- scanner.Err()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return <-errCh
+			}
+			path := strings.TrimSpace(line)
+			if path == "" {
+				continue
+			}
+			path, err := tr.srcPath(path)
+			if err != nil {
+				slog.WarnContext(ctx, "ignore the path", "error", err.Error())
+				continue
+			}
+			if err := tr.waitResumed(ctx); err != nil {
+				return err
+			}
+			if err := tr.waitCircuit(ctx); err != nil {
+				return err
+			}
+			release, err := tr.acquireWorker(ctx)
+			if err != nil {
+				return err
+			}
+			wg.Add(1)
+			go func() {
+				defer release()
+				defer wg.Done()
+				tr.transport(ctx, path)
+				tr.putBatchMarkers(ctx)
+			}()
+		}
+	}
+}
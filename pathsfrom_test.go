@@ -0,0 +1,64 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestRunPathsFrom(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+	paths := []string{
+		s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo")),
+		"",
+		filepath.Join(dir, "notfound.txt"),
+		// ignored
+		s3movertest.WriteFile(t, other, "bar.txt", []byte("bar")),
+		filepath.Join(dir, "..", filepath.Base(other), "bar.txt"),
+		s3movertest.WriteFile(t, dir, ".writing.txt", []byte("writing")),
+	}
+	list := filepath.Join(t.TempDir(), "paths.txt")
+	if err := os.WriteFile(list, []byte(strings.Join(paths, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/paths-from",
+		MaxParallels: 2,
+		PathsFrom:    list,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tr, client := newTestTransporter(t, config)
+
+	// Run returns at EOF of the list
+	if err := tr.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Run must return at EOF")
+	}
+	if len(client.Objects) != 1 {
+		t.Errorf("expected 1 object, got %v", client.Keys())
+	}
+	m := tr.Metrics()
+	if m.Objects.Uploaded != 1 || m.Objects.Errored != 1 {
+		t.Errorf("unexpected metrics: %#v", m.Objects)
+	}
+	if _, err := os.Stat(paths[0]); err == nil {
+		t.Errorf("%s must be removed", paths[0])
+	}
+	for _, path := range paths[3:] {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s out of the source directory or hidden must be left: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package s3mover
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Pause stops transporting new files until Resume is called.
+// In-flight uploads are not interrupted.
+func (tr *Transporter) Pause() {
+	if tr.paused.CompareAndSwap(false, true) {
+		slog.Info("paused")
+	}
+}
+
+// Resume restarts transporting files.
+func (tr *Transporter) Resume() {
+	if tr.paused.CompareAndSwap(true, false) {
+		slog.Info("resumed")
+	}
+}
+
+// Paused reports whether the Transporter is paused by Pause, the schedule or the adaptive mode.
+func (tr *Transporter) Paused() bool {
+	return tr.paused.Load() || tr.schedulePaused.Load() || tr.adaptivePaused.Load()
+}
+
+// waitResumed blocks while the Transporter is paused.
+func (tr *Transporter) waitResumed(ctx context.Context) error {
+	for tr.Paused() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(RetryWait):
+		}
+	}
+	return nil
+}
+
+// Flush transports the files in the source directory immediately, even while paused or buffering.
+// It returns the number of processed files and the total number of files.
+func (tr *Transporter) Flush(ctx context.Context) (int64, int64, error) {
+	return tr.runOnce(ctx, true)
+}
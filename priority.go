@@ -0,0 +1,99 @@
+package s3mover
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// priority classes of files
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+)
+
+// PriorityMetrics represents the metrics of a priority class.
+type PriorityMetrics struct {
+	Uploaded int64 `json:"uploaded"`
+	Errored  int64 `json:"errored"`
+	Queued   int64 `json:"queued"`
+}
+
+func (m *PriorityMetrics) PutObject(success bool) {
+	if success {
+		atomic.AddInt64(&m.Uploaded, 1)
+	} else {
+		atomic.AddInt64(&m.Errored, 1)
+	}
+}
+
+func validatePriorityPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid priority pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// priority returns the priority class of the file.
+// The file is high priority when the relative path from the source directory or the file name matches any of HighPriority.
+func (tr *Transporter) priority(p string) string {
+	if len(tr.config.HighPriority) == 0 {
+		return PriorityNormal
+	}
+	name := filepath.Base(p)
+	rel, err := filepath.Rel(tr.config.SrcDir, p)
+	if err != nil {
+		rel = name
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range tr.config.HighPriority {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return PriorityHigh
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return PriorityHigh
+		}
+	}
+	return PriorityNormal
+}
+
+// prioritize splits paths into the high priority files and the others, keeping the order in each class.
+func (tr *Transporter) prioritize(paths []string) (high, normal []string) {
+	if len(tr.config.HighPriority) == 0 {
+		return nil, paths
+	}
+	for _, p := range paths {
+		if tr.priority(p) == PriorityHigh {
+			high = append(high, p)
+		} else {
+			normal = append(normal, p)
+		}
+	}
+	return high, normal
+}
+
+// priorityMetrics returns the metrics of the priority class of the file, or nil unless HighPriority is configured.
+func (tr *Transporter) priorityMetrics(p string) *PriorityMetrics {
+	if tr.metrics.Priorities == nil {
+		return nil
+	}
+	return tr.metrics.Priorities[tr.priority(p)]
+}
+
+// setPriorityQueued sets the number of queued files by priority class.
+func (tr *Transporter) setPriorityQueued(paths []string) {
+	if tr.metrics.Priorities == nil {
+		return
+	}
+	var high int64
+	for _, p := range paths {
+		if tr.priority(p) == PriorityHigh {
+			high++
+		}
+	}
+	atomic.StoreInt64(&tr.metrics.Priorities[PriorityHigh].Queued, high)
+	atomic.StoreInt64(&tr.metrics.Priorities[PriorityNormal].Queued, int64(len(paths))-high)
+}
@@ -0,0 +1,72 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+	"github.com/samber/lo"
+)
+
+func TestPriority(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a/1.debug", "a/2.debug", "b/1.debug", "b/2.billing", "c/1.debug", "c/2.debug", "d/3.billing"} {
+		sub := filepath.Join(dir, filepath.Dir(name))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		s3movertest.WriteFile(t, sub, filepath.Base(name), []byte(name))
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/priority",
+		MaxParallels: 1,
+		TimeFormat:   "2006",
+		Recursive:    true,
+		PreservePath: true,
+		HighPriority: []string{"*.billing", "c/2.*"},
+	}
+	tr, _ := newTestTransporter(t, config)
+	client := &orderedS3Client{MockS3Client: s3movertest.NewMockS3Client()}
+	tr.SetS3Client(client)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 7 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	names := lo.Map(client.keys, func(k string, _ int) string {
+		return k[strings.LastIndex(k, "/20")+6:]
+	})
+	// the high priority files first, and interleaved across the directories in each class
+	expected := []string{"b/2.billing", "c/2.debug", "d/3.billing", "a/1.debug", "b/1.debug", "c/1.debug", "a/2.debug"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected order: %v", names)
+	}
+
+	m := tr.Metrics().Snapshot()
+	if h := m.Priorities[s3mover.PriorityHigh]; h.Uploaded != 3 || h.Queued != 3 {
+		t.Errorf("unexpected high priority metrics: %+v", h)
+	}
+	if n := m.Priorities[s3mover.PriorityNormal]; n.Uploaded != 4 || n.Queued != 4 {
+		t.Errorf("unexpected normal priority metrics: %+v", n)
+	}
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `s3mover_priority_objects_uploaded_total{priority="high"} 3`) {
+		t.Errorf("unexpected prometheus metrics:\n%s", buf.String())
+	}
+}
+
+func TestPriorityValidate(t *testing.T) {
+	config := s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/priority", HighPriority: []string{"[a"}}
+	if err := config.Validate(); err == nil {
+		t.Error("expected error for the invalid pattern")
+	}
+}
@@ -0,0 +1,98 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// credential represents the user and the group to run as.
+type credential struct {
+	uid, gid int
+	name     string
+}
+
+// lookupCredential resolves the user and the group by the names or the numeric IDs.
+// The group defaults to the primary group of the user.
+func lookupCredential(userName, groupName string) (*credential, error) {
+	u, err := lookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	c := &credential{name: u.Username}
+	if c.uid, err = strconv.Atoi(u.Uid); err != nil {
+		return nil, fmt.Errorf("user %s has no numeric uid: %s", userName, u.Uid)
+	}
+	if groupName == "" {
+		if c.gid, err = strconv.Atoi(u.Gid); err != nil {
+			return nil, fmt.Errorf("user %s has no numeric gid: %s", userName, u.Gid)
+		}
+	} else if c.gid, err = lookupGID(groupName); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %s", name)
+		}
+	}
+	return u, nil
+}
+
+// lookupUID returns the uid of the user name or the numeric uid.
+func lookupUID(name string) (int, error) {
+	u, err := lookupUser(name)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, fmt.Errorf("user %s has no numeric uid: %s", name, u.Uid)
+	}
+	return uid, nil
+}
+
+// lookupGID returns the gid of the group name or the numeric gid.
+func lookupGID(name string) (int, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		if g, err = user.LookupGroupId(name); err != nil {
+			return 0, fmt.Errorf("unknown group %s", name)
+		}
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return 0, fmt.Errorf("group %s has no numeric gid: %s", name, g.Gid)
+	}
+	return gid, nil
+}
+
+// dropPrivileges changes the user and the group of the process to User and Group.
+// The unix domain socket of the gRPC server is passed to the user not to be left inaccessible.
+func (tr *Transporter) dropPrivileges(ctx context.Context) error {
+	if tr.config.User == "" {
+		return nil
+	}
+	c, err := lookupCredential(tr.config.User, tr.config.Group)
+	if err != nil {
+		return err
+	}
+	if path, ok := strings.CutPrefix(tr.config.GRPCListen, "unix:"); ok {
+		if err := os.Chown(path, c.uid, c.gid); err != nil {
+			return fmt.Errorf("failed to chown %s: %w", path, err)
+		}
+	}
+	if err := setCredential(c); err != nil {
+		return fmt.Errorf("failed to drop privileges to %s: %w", c.name, err)
+	}
+	slog.InfoContext(ctx, "dropped privileges", "user", c.name, "uid", c.uid, "gid", c.gid)
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package s3mover
+
+import "errors"
+
+func setCredential(c *credential) error {
+	return errors.New("dropping privileges is not supported on this platform")
+}
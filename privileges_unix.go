@@ -0,0 +1,27 @@
+//go:build unix
+
+package s3mover
+
+import (
+	"errors"
+	"syscall"
+)
+
+// setCredential sets the supplementary groups, the gid and the uid of all threads of the process.
+// The uid must be the last, because setting the groups requires the privilege.
+func setCredential(c *credential) error {
+	if err := syscall.Setgroups([]int{c.gid}); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(c.gid); err != nil {
+		return err
+	}
+	if err := syscall.Setuid(c.uid); err != nil {
+		return err
+	}
+	// regaining the privileges must fail
+	if c.uid != 0 && syscall.Setuid(0) == nil {
+		return errors.New("the privileges can be regained")
+	}
+	return nil
+}
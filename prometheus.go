@@ -0,0 +1,184 @@
+package s3mover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const prometheusNamespace = "s3mover"
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	p := &promWriter{w: bw}
+	p.write("objects_uploaded_total", "counter", "The number of objects uploaded to S3.", m.Objects.Uploaded)
+	p.write("objects_errored_total", "counter", "The number of objects that failed to upload.", m.Objects.Errored)
+	p.write("objects_queued", "gauge", "The number of objects queued for upload.", m.Objects.Queued)
+	p.write("objects_uploaded_bytes_total", "counter", "The total size of the objects uploaded to S3.", m.Objects.UploadedBytes)
+	p.write("objects_uploaded_fallback_total", "counter", "The number of objects uploaded to the fallback bucket.", m.Objects.UploadedFallback)
+	p.write("objects_dead_lettered_total", "counter", "The number of files moved to the dead-letter directory.", m.Objects.DeadLettered)
+	p.write("objects_timed_out_total", "counter", "The number of objects that failed to upload by the upload timeout.", m.Objects.TimedOut)
+	p.write("objects_key_collisions_total", "counter", "The number of uploads to the keys already uploaded in the current or the previous time partition.", m.Objects.KeyCollisions)
+	p.write("objects_duplicates_suppressed_total", "counter", "The number of files not uploaded because the same files were uploaded recently.", m.Objects.DuplicatesSuppressed)
+	p.write("objects_truncated_total", "counter", "The number of files truncated after the discovery, such as by copytruncate.", m.Objects.Truncated)
+	p.write("objects_locked_total", "counter", "The number of the reads of the files failed by the locks of the other processes.", m.Objects.Locked)
+	p.write("objects_observed_total", "counter", "The number of files which would be uploaded in the observe mode.", m.Objects.Observed)
+	p.write("objects_observed_bytes_total", "counter", "The total size of the files which would be uploaded in the observe mode.", m.Objects.ObservedBytes)
+	p.write("objects_credential_errors_total", "counter", "The number of uploads failed by the expired or unavailable credentials.", m.Objects.CredentialErrors)
+	le := m.Objects.LocalErrors
+	p.writeSamples("objects_local_errors_total", "counter", "The number of errors of reading the local files.", []promSample{
+		{`reason="not_found"`, le.NotFound},
+		{`reason="permission"`, le.Permission},
+		{`reason="io"`, le.IO},
+		{`reason="other"`, le.Other},
+	})
+	p.write("seconds_since_last_successful_upload", "gauge", "The elapsed seconds since the last successful upload.", m.Objects.SecondsSinceLastUpload)
+	p.write("workers_active", "gauge", "The number of the workers uploading now.", m.Workers.Active)
+	p.write("workers_max_parallels", "gauge", "The current max parallels, limited by the schedule and the adaptive mode.", m.Workers.MaxParallels)
+	p.write("workers_acquired_total", "counter", "The number of the uploads started by the workers.", m.Workers.Acquired)
+	p.write("workers_wait_seconds_total", "counter", "The total seconds the uploads waited for a worker.", m.Workers.WaitSeconds)
+	if sc := m.Scan; sc != nil {
+		p.write("scans_total", "counter", "The number of scans of the source directory.", sc.Count)
+		p.write("scan_errors_total", "counter", "The number of failed scans of the source directory.", sc.Errors)
+		p.write("scan_duration_seconds", "gauge", "The duration of the last scan in seconds.", sc.DurationSeconds)
+		p.write("scan_files_discovered", "gauge", "The number of files discovered by the last scan.", sc.Discovered)
+		p.writeSamples("scan_files_skipped", "gauge", "The number of files skipped by the last scan.", []promSample{
+			{`reason="hidden"`, sc.Skipped.Hidden},
+			{`reason="kept"`, sc.Skipped.Kept},
+			{`reason="policy"`, sc.Skipped.Policy},
+			{`reason="owner"`, sc.Skipped.Owner},
+			{`reason="observed"`, sc.Skipped.Observed},
+		})
+	}
+	if b := m.Backlog; b != nil {
+		p.write("startup_backlog_files", "gauge", "The number of files queued at startup.", b.Files)
+		p.write("startup_backlog_bytes", "gauge", "The total size in bytes of the files queued at startup.", b.Bytes)
+		p.write("startup_backlog_oldest_age_seconds", "gauge", "The age in seconds of the oldest file queued at startup.", b.OldestAgeSeconds)
+	}
+	if sp := m.Spool; sp != nil {
+		over := 0
+		if sp.Over {
+			over = 1
+		}
+		p.write("spool_bytes", "gauge", "The total size in bytes of the files in the source directory.", sp.Bytes)
+		p.write("spool_max_bytes", "gauge", "The budget of the spool in bytes.", sp.MaxBytes)
+		p.write("spool_over", "gauge", "1 if the spool exceeds the budget.", over)
+		p.write("spool_files_removed_total", "counter", "The number of files removed without uploading to fit in the budget.", sp.Removed)
+	}
+	if b := m.RetryBudget; b != nil {
+		p.write("retry_budget_requests_total", "counter", "The number of the attempts of S3 requests, including the retries.", b.Requests)
+		p.write("retry_budget_retries_total", "counter", "The number of the retried attempts of S3 requests.", b.Retries)
+		p.write("retry_budget_rejected_total", "counter", "The number of the retries not attempted by the exhausted retry budget.", b.Rejected)
+		p.write("retry_budget_backoffs_total", "counter", "The number of the global backoffs by the exhausted retry budget.", b.Backoffs)
+	}
+	if len(m.Destinations) > 0 {
+		urls := make([]string, 0, len(m.Destinations))
+		for url := range m.Destinations {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		uploaded := make([]promSample, 0, len(urls))
+		errored := make([]promSample, 0, len(urls))
+		bytes := make([]promSample, 0, len(urls))
+		for _, url := range urls {
+			labels := fmt.Sprintf(`destination=%q`, url)
+			uploaded = append(uploaded, promSample{labels, m.Destinations[url].Uploaded})
+			errored = append(errored, promSample{labels, m.Destinations[url].Errored})
+			bytes = append(bytes, promSample{labels, m.Destinations[url].Bytes})
+		}
+		p.writeSamples("destination_objects_uploaded_total", "counter", "The number of objects uploaded to each destination.", uploaded)
+		p.writeSamples("destination_objects_errored_total", "counter", "The number of objects that failed to upload to each destination.", errored)
+		p.writeSamples("destination_uploaded_bytes_total", "counter", "The number of bytes uploaded to each destination.", bytes)
+	}
+	if len(m.Directories) > 0 {
+		dirs := make([]string, 0, len(m.Directories))
+		for dir := range m.Directories {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		var uploaded, errored, queued, bytes, throttled, since []promSample
+		for _, dir := range dirs {
+			labels := fmt.Sprintf(`directory=%q`, dir)
+			d := m.Directories[dir]
+			uploaded = append(uploaded, promSample{labels, d.Uploaded})
+			errored = append(errored, promSample{labels, d.Errored})
+			queued = append(queued, promSample{labels, d.Queued})
+			bytes = append(bytes, promSample{labels, d.Bytes})
+			throttled = append(throttled, promSample{labels, d.Throttled})
+			since = append(since, promSample{labels, d.SecondsSinceLastUpload})
+		}
+		p.writeSamples("directory_objects_uploaded_total", "counter", "The number of objects uploaded from each directory.", uploaded)
+		p.writeSamples("directory_objects_errored_total", "counter", "The number of objects that failed to upload from each directory.", errored)
+		p.writeSamples("directory_objects_queued", "gauge", "The number of objects queued for upload in each directory.", queued)
+		p.writeSamples("directory_uploaded_bytes_total", "counter", "The number of bytes uploaded from each directory.", bytes)
+		p.writeSamples("directory_objects_throttled_total", "counter", "The number of times the files in each directory are left for the next scan by the tenant quota.", throttled)
+		p.writeSamples("directory_seconds_since_last_successful_upload", "gauge", "The elapsed seconds since the last successful upload from each directory.", since)
+	}
+	if len(m.Priorities) > 0 {
+		classes := make([]string, 0, len(m.Priorities))
+		for class := range m.Priorities {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		var uploaded, errored, queued []promSample
+		for _, class := range classes {
+			labels := fmt.Sprintf(`priority=%q`, class)
+			pm := m.Priorities[class]
+			uploaded = append(uploaded, promSample{labels, pm.Uploaded})
+			errored = append(errored, promSample{labels, pm.Errored})
+			queued = append(queued, promSample{labels, pm.Queued})
+		}
+		p.writeSamples("priority_objects_uploaded_total", "counter", "The number of objects uploaded in each priority class.", uploaded)
+		p.writeSamples("priority_objects_errored_total", "counter", "The number of objects that failed to upload in each priority class.", errored)
+		p.writeSamples("priority_objects_queued", "gauge", "The number of objects queued for upload in each priority class.", queued)
+	}
+	if r := m.Runtime; r != nil {
+		p.write("goroutines", "gauge", "The number of goroutines.", r.Goroutines)
+		p.write("heap_inuse_bytes", "gauge", "The number of bytes in in-use heap spans.", r.HeapInUse)
+		p.write("gc_count_total", "counter", "The number of completed GC cycles.", r.GC.Count)
+		p.write("gc_pause_seconds_total", "counter", "The cumulative GC pause time in seconds.", float64(r.GC.PauseTotalNs)/1e9)
+		p.write("gc_last_pause_seconds", "gauge", "The most recent GC pause time in seconds.", float64(r.GC.LastPauseNs)/1e9)
+		p.write("open_fds", "gauge", "The number of open file descriptors.", r.OpenFDs)
+	}
+	if p.err != nil {
+		return p.err
+	}
+	return bw.Flush()
+}
+
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) write(name, typ, help string, value any) {
+	p.writeSamples(name, typ, help, []promSample{{Value: value}})
+}
+
+// promSample is a sample of a metric with the labels such as `key="value"`.
+type promSample struct {
+	Labels string
+	Value  any
+}
+
+func (p *promWriter) writeSamples(name, typ, help string, samples []promSample) {
+	if p.err != nil {
+		return
+	}
+	name = prometheusNamespace + "_" + name
+	if _, p.err = fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ); p.err != nil {
+		return
+	}
+	for _, s := range samples {
+		if s.Labels != "" {
+			_, p.err = fmt.Fprintf(p.w, "%s{%s} %v\n", name, s.Labels, s.Value)
+		} else {
+			_, p.err = fmt.Fprintf(p.w, "%s %v\n", name, s.Value)
+		}
+		if p.err != nil {
+			return
+		}
+	}
+}
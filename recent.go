@@ -0,0 +1,90 @@
+package s3mover
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultDuplicateCacheSize is the default number of the files remembered by DuplicateWindow.
+const DefaultDuplicateCacheSize = 10000
+
+// recentFile identifies a file by the name, the size and the modification time.
+type recentFile struct {
+	name    string
+	size    int64
+	modTime int64
+}
+
+type recentEntry struct {
+	file       recentFile
+	uploadedAt time.Time
+}
+
+// recentUploads is an LRU of the files uploaded recently, to suppress the duplicate uploads of the same file
+// re-created by the producer within the window, such as before the deletion propagates.
+type recentUploads struct {
+	window time.Duration
+	size   int
+
+	mu      sync.Mutex
+	order   *list.List // of *recentEntry, the most recent first
+	entries map[recentFile]*list.Element
+}
+
+// newRecentUploads returns nil if DuplicateWindow is zero.
+func newRecentUploads(config *Config) *recentUploads {
+	if config.DuplicateWindow <= 0 {
+		return nil
+	}
+	return &recentUploads{
+		window:  config.DuplicateWindow,
+		size:    config.DuplicateCacheSize,
+		order:   list.New(),
+		entries: make(map[recentFile]*list.Element),
+	}
+}
+
+// add records the file uploaded at now, evicting the least recently uploaded file over the size.
+func (r *recentUploads) add(name string, st os.FileInfo, now time.Time) {
+	if r == nil {
+		return
+	}
+	f := recentFile{name: name, size: st.Size(), modTime: st.ModTime().UnixNano()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.entries[f]; ok {
+		el.Value.(*recentEntry).uploadedAt = now
+		r.order.MoveToFront(el)
+		return
+	}
+	r.entries[f] = r.order.PushFront(&recentEntry{file: f, uploadedAt: now})
+	for r.order.Len() > r.size {
+		r.evict(r.order.Back())
+	}
+}
+
+// uploaded reports whether the same file was uploaded within the window before now.
+func (r *recentUploads) uploaded(name string, st os.FileInfo, now time.Time) bool {
+	if r == nil {
+		return false
+	}
+	f := recentFile{name: name, size: st.Size(), modTime: st.ModTime().UnixNano()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	el, ok := r.entries[f]
+	if !ok {
+		return false
+	}
+	if now.Sub(el.Value.(*recentEntry).uploadedAt) > r.window {
+		r.evict(el)
+		return false
+	}
+	return true
+}
+
+func (r *recentUploads) evict(el *list.Element) {
+	delete(r.entries, el.Value.(*recentEntry).file)
+	r.order.Remove(el)
+}
@@ -0,0 +1,74 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestDuplicateWindow(t *testing.T) {
+	ctx := context.Background()
+	mtime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	for _, c := range []struct {
+		window     time.Duration
+		mtime      time.Time
+		suppressed int64
+	}{
+		{time.Hour, mtime, 1},
+		{time.Hour, mtime.Add(time.Second), 0}, // modified
+		{time.Nanosecond, mtime, 0},            // expired
+	} {
+		dir := t.TempDir()
+		config := &s3mover.Config{
+			SrcDir:          dir,
+			Bucket:          "testbucket",
+			KeyPrefix:       "test/duplicate",
+			MaxParallels:    1,
+			TimeFormat:      "2006/01/02",
+			DuplicateWindow: c.window,
+		}
+		tr, client := newTestTransporter(t, config)
+		var modified time.Time
+		for i, mt := range []time.Time{mtime, c.mtime} {
+			foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+			if err := os.Chtimes(foo, mt, mt); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := tr.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(foo); !os.IsNotExist(err) {
+				t.Errorf("window %s: %s must be removed: %v", c.window, foo, err)
+			}
+			if i == 0 {
+				modified = client.Objects["test/duplicate/"+mt.In(s3mover.TZ).Format("2006/01/02")+"/foo.txt"].LastModified
+			}
+		}
+		for key, obj := range client.Objects {
+			if uploadedAgain := !obj.LastModified.Equal(modified); uploadedAgain != (c.suppressed == 0) {
+				t.Errorf("window %s: unexpected upload of %s", c.window, key)
+			}
+		}
+		if m := tr.Metrics().Snapshot(); m.Objects.Uploaded != 2 || m.Objects.DuplicatesSuppressed != c.suppressed {
+			t.Errorf("window %s: unexpected metrics: %+v", c.window, m.Objects)
+		}
+	}
+}
+
+func TestDuplicateWindowValidate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:          t.TempDir(),
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/duplicate",
+		MaxParallels:    1,
+		DuplicateWindow: time.Minute,
+		Mirror:          true,
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("duplicate-window must not be used with mirror")
+	}
+}
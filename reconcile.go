@@ -0,0 +1,273 @@
+package s3mover
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	ReconcileStatusOK           = "ok"
+	ReconcileStatusMissing      = "missing"
+	ReconcileStatusSizeMismatch = "size_mismatch"
+)
+
+// ReconcileOption represents options for Reconcile.
+type ReconcileOption struct {
+	// AuditLog is the path of the audit log to reconcile.
+	AuditLog string
+	// Inventory is the S3 URL of the manifest.json of the S3 Inventory report.
+	// If empty, the objects are listed by ListObjectsV2.
+	Inventory string
+	// Since reconciles only the records uploaded at or after it, if not zero.
+	Since time.Time
+}
+
+// ReconcileResult represents the result of reconciling an uploaded object in the audit log.
+type ReconcileResult struct {
+	URL        string    `json:"url"`
+	Path       string    `json:"path"`
+	Status     string    `json:"status"`
+	Size       int64     `json:"size"`
+	RemoteSize int64     `json:"remote_size,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// remoteObjects represents the objects in the bucket at the time.
+type remoteObjects struct {
+	bucket string
+	at     time.Time
+	sizes  map[string]int64
+}
+
+// Reconcile compares the uploaded objects recorded in the audit log with the objects in the bucket.
+// The records of the primary bucket under the key prefix are reconciled, and the records later than the listing
+// or the creation of the inventory report are skipped. The results are returned in the order of the keys.
+func (tr *Transporter) Reconcile(ctx context.Context, opt ReconcileOption) ([]ReconcileResult, error) {
+	ctx = slogcontext.WithValue(ctx, "component", "reconcile")
+	if opt.AuditLog == "" {
+		return nil, fmt.Errorf("audit log is required")
+	}
+	client, ok := restoreClient(tr.s3)
+	if !ok {
+		return nil, fmt.Errorf("the S3 client does not support listing and downloading objects")
+	}
+	prefix := strings.Trim(tr.config.KeyPrefix, "/") + "/"
+	var remote *remoteObjects
+	var err error
+	if opt.Inventory != "" {
+		remote, err = readInventory(ctx, client, opt.Inventory, prefix)
+	} else {
+		remote, err = tr.listRemoteObjects(ctx, client, prefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if remote.bucket != tr.config.Bucket {
+		return nil, fmt.Errorf("the inventory is of the bucket %s, not %s", remote.bucket, tr.config.Bucket)
+	}
+	records, err := readAuditLog(opt.AuditLog, remote.bucket, prefix, opt.Since, remote.at)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "reconciling", "audit_log", opt.AuditLog, "records", len(records), "objects", len(remote.sizes))
+
+	results := make([]ReconcileResult, 0, len(records))
+	for key, rec := range records {
+		r := ReconcileResult{
+			URL:        fmt.Sprintf("s3://%s/%s", rec.Bucket, key),
+			Path:       rec.Path,
+			Size:       rec.Size,
+			UploadedAt: rec.Time,
+		}
+		size, ok := remote.sizes[key]
+		switch {
+		case !ok:
+			r.Status = ReconcileStatusMissing
+		case size != rec.Size:
+			r.Status = ReconcileStatusSizeMismatch
+			r.RemoteSize = size
+		default:
+			r.Status = ReconcileStatusOK
+			r.RemoteSize = size
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].URL < results[j].URL
+	})
+	return results, nil
+}
+
+// listRemoteObjects lists the objects under the prefix by ListObjectsV2.
+func (tr *Transporter) listRemoteObjects(ctx context.Context, client RestoreS3Client, prefix string) (*remoteObjects, error) {
+	remote := &remoteObjects{bucket: tr.config.Bucket, at: time.Now(), sizes: make(map[string]int64)}
+	objects, err := tr.listRestoreObjects(ctx, client, prefix, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		remote.sizes[aws.ToString(obj.Key)] = aws.ToInt64(obj.Size)
+	}
+	return remote, nil
+}
+
+// readAuditLog reads the latest uploaded records of the keys in the bucket under the prefix, from since until until.
+func readAuditLog(path, bucket, prefix string, since, until time.Time) (map[string]*AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	records := make(map[string]*AuditRecord)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("invalid audit log at line %d: %w", n, err)
+		}
+		if rec.Event != AuditEventUploaded || rec.Bucket != bucket || !strings.HasPrefix(rec.Key, prefix) {
+			continue
+		}
+		if rec.Time.Before(since) || rec.Time.After(until) {
+			continue
+		}
+		records[rec.Key] = &rec
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return records, nil
+}
+
+// inventoryManifest represents the manifest.json of the S3 Inventory report.
+type inventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// readInventory reads the objects under the prefix in the S3 Inventory report of the manifest. Only the CSV format is supported.
+func readInventory(ctx context.Context, client RestoreS3Client, manifestURL, prefix string) (*remoteObjects, error) {
+	u, err := url.Parse(manifestURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid inventory %q: must be s3://bucket/path/to/manifest.json", manifestURL)
+	}
+	body, err := getObject(ctx, client, u.Host, strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory manifest: %w", err)
+	}
+	defer body.Close()
+	var m inventoryManifest
+	if err := json.NewDecoder(body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid inventory manifest: %w", err)
+	}
+	if m.FileFormat != "CSV" {
+		return nil, fmt.Errorf("unsupported inventory format %s: only CSV is supported", m.FileFormat)
+	}
+	msec, err := strconv.ParseInt(m.CreationTimestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid creationTimestamp of inventory manifest: %s", m.CreationTimestamp)
+	}
+	columns := make(map[string]int)
+	for i, c := range strings.Split(m.FileSchema, ",") {
+		columns[strings.TrimSpace(c)] = i
+	}
+	if _, ok := columns["Key"]; !ok {
+		return nil, errors.New("the inventory has no Key field")
+	}
+	if _, ok := columns["Size"]; !ok {
+		return nil, errors.New("the inventory has no Size field")
+	}
+
+	remote := &remoteObjects{bucket: m.SourceBucket, at: time.UnixMilli(msec), sizes: make(map[string]int64)}
+	bucket := strings.TrimPrefix(m.DestinationBucket, "arn:aws:s3:::")
+	for _, file := range m.Files {
+		if err := readInventoryFile(ctx, client, bucket, file.Key, prefix, columns, remote.sizes); err != nil {
+			return nil, fmt.Errorf("failed to read inventory file %s: %w", file.Key, err)
+		}
+	}
+	return remote, nil
+}
+
+// readInventoryFile reads the gzipped CSV file of the inventory. The objects out of the prefix,
+// the delete markers and the noncurrent versions are skipped, not to hold the whole bucket in memory.
+func readInventoryFile(ctx context.Context, client RestoreS3Client, bucket, key, prefix string, columns map[string]int, sizes map[string]int64) error {
+	body, err := getObject(ctx, client, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	gr, err := gzip.NewReader(body)
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(gr)
+	r.FieldsPerRecord = len(columns)
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return row[i]
+		}
+		return ""
+	}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if field(row, "IsLatest") == "false" || field(row, "IsDeleteMarker") == "true" {
+			continue
+		}
+		// the keys in the inventory are URL-encoded
+		k, err := url.QueryUnescape(field(row, "Key"))
+		if err != nil {
+			return fmt.Errorf("invalid key %s: %w", field(row, "Key"), err)
+		}
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		size, err := strconv.ParseInt(field(row, "Size"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid size of %s: %w", k, err)
+		}
+		sizes[k] = size
+	}
+}
+
+func getObject(ctx context.Context, client RestoreS3Client, bucket, key string) (io.ReadCloser, error) {
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
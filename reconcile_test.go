@@ -0,0 +1,120 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func setupReconcile(t *testing.T) (*s3mover.Transporter, *s3movertest.MockS3Client, string) {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		s3movertest.WriteFile(t, dir, name, []byte(name))
+	}
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/reconcile",
+		MaxParallels: 1,
+		TimeFormat:   "2006",
+		AuditLogPath: auditLog,
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 3 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	// break b.txt and lose c.txt silently
+	for key, obj := range client.Objects {
+		switch filepath.Base(key) {
+		case "b.txt":
+			obj.Size++
+		case "c.txt":
+			delete(client.Objects, key)
+		}
+	}
+	return tr, client, auditLog
+}
+
+func testReconcileResults(t *testing.T, results []s3mover.ReconcileResult) {
+	t.Helper()
+	expected := map[string]string{
+		"a.txt": s3mover.ReconcileStatusOK,
+		"b.txt": s3mover.ReconcileStatusSizeMismatch,
+		"c.txt": s3mover.ReconcileStatusMissing,
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), results)
+	}
+	for _, r := range results {
+		if s := expected[filepath.Base(r.Path)]; s != r.Status {
+			t.Errorf("%s: expected %s, got %s", r.URL, s, r.Status)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tr, _, auditLog := setupReconcile(t)
+	results, err := tr.Reconcile(context.Background(), s3mover.ReconcileOption{AuditLog: auditLog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testReconcileResults(t, results)
+
+	// since skips all the records
+	results, err = tr.Reconcile(context.Background(), s3mover.ReconcileOption{AuditLog: auditLog, Since: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no results, got %v", results)
+	}
+}
+
+func TestReconcileInventory(t *testing.T) {
+	ctx := context.Background()
+	tr, client, auditLog := setupReconcile(t)
+
+	// the inventory report of the objects in the mock
+	var csv bytes.Buffer
+	gw := gzip.NewWriter(&csv)
+	for key, obj := range client.Objects {
+		fmt.Fprintf(gw, "%q,%q,%q,%d\n", obj.Bucket, strings.ReplaceAll(key, "/", "%2F"), "true", obj.Size)
+	}
+	fmt.Fprintf(gw, "%q,%q,%q,%d\n", "testbucket", "test/reconcile/noncurrent", "false", 1)
+	// the rows out of the prefix are not parsed
+	fmt.Fprintf(gw, "%q,%q,%q,%q\n", "testbucket", "other/prefix", "true", "unknown")
+	gw.Close()
+	manifest := func(created time.Time) []byte {
+		return []byte(fmt.Sprintf(`{"sourceBucket":"testbucket","destinationBucket":"arn:aws:s3:::inventory","creationTimestamp":"%d","fileFormat":"CSV","fileSchema":"Bucket, Key, IsLatest, Size","files":[{"key":"testbucket/inv/data/1.csv.gz"}]}`, created.UnixMilli()))
+	}
+	client.Objects["testbucket/inv/manifest.json"] = &s3movertest.MockS3Object{Bucket: "inventory", Key: "testbucket/inv/manifest.json", Content: manifest(time.Now().Add(time.Second))}
+	client.Objects["testbucket/inv/data/1.csv.gz"] = &s3movertest.MockS3Object{Bucket: "inventory", Key: "testbucket/inv/data/1.csv.gz", Content: csv.Bytes()}
+
+	opt := s3mover.ReconcileOption{AuditLog: auditLog, Inventory: "s3://inventory/testbucket/inv/manifest.json"}
+	results, err := tr.Reconcile(ctx, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testReconcileResults(t, results)
+
+	// the records after the creation of the report are skipped
+	client.Objects["testbucket/inv/manifest.json"].Content = manifest(time.Now().Add(-time.Hour))
+	results, err = tr.Reconcile(ctx, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no results, got %v", results)
+	}
+}
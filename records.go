@@ -0,0 +1,153 @@
+package s3mover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// recordError represents an invalid record in a file.
+// It never succeeds by retrying, so it is treated as a permanent error.
+type recordError struct {
+	line int
+	err  error
+}
+
+func (e *recordError) Error() string {
+	return fmt.Sprintf("invalid record at line %d: %s", e.line, e.err)
+}
+
+func (e *recordError) Unwrap() error {
+	return e.err
+}
+
+// detectRecordFormat returns the record format of the file by the extension,
+// or an empty string if the file is not JSONL nor CSV.
+func detectRecordFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return ConvertInputJSONL
+	case ".csv":
+		return ConvertInputCSV
+	}
+	return ""
+}
+
+// recordValidator validates the records in the files before uploading.
+type recordValidator struct {
+	format  string // auto, jsonl or csv
+	columns int    // number of CSV columns. 0 means the same as the header
+	schema  *jsonschema.Schema
+}
+
+func newRecordValidator(config *Config) (*recordValidator, error) {
+	v := &recordValidator{
+		format:  config.ValidateRecords,
+		columns: config.CSVColumns,
+	}
+	if config.JSONSchemaPath != "" {
+		schema, err := jsonschema.Compile(config.JSONSchemaPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile json schema %s: %w", config.JSONSchemaPath, err)
+		}
+		v.schema = schema
+	}
+	return v, nil
+}
+
+// validate validates the records in the file.
+// It returns a *recordError for an invalid record.
+func (v *recordValidator) validate(path string) error {
+	format := v.format
+	if format == ConvertInputAuto {
+		format = detectRecordFormat(path)
+	}
+	if format == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch format {
+	case ConvertInputJSONL:
+		return v.validateJSONL(f)
+	case ConvertInputCSV:
+		return v.validateCSV(f)
+	}
+	return nil
+}
+
+func (v *recordValidator) validateJSONL(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxIngestSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var record any
+		if err := dec.Decode(&record); err != nil {
+			return &recordError{line: line, err: err}
+		}
+		if dec.More() {
+			return &recordError{line: line, err: errors.New("multiple JSON values in a line")}
+		}
+		if v.schema != nil {
+			if err := v.schema.Validate(record); err != nil {
+				return &recordError{line: line, err: err}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func (v *recordValidator) validateCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = v.columns
+	cr.ReuseRecord = true
+	for line := 1; ; line++ {
+		_, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return &recordError{line: line, err: err}
+		}
+	}
+}
+
+// validateRecords validates the records in the file and moves the invalid file to the dead-letter directory.
+// It reports whether the file is invalid.
+func (tr *Transporter) validateRecords(ctx context.Context, path string) (bool, error) {
+	if tr.validator == nil {
+		return false, nil
+	}
+	verr := tr.validator.validate(path)
+	var ce *recordError
+	if !errors.As(verr, &ce) {
+		return false, verr
+	}
+	dst, err := tr.deadLetter(path)
+	if err != nil {
+		return true, fmt.Errorf("failed to move invalid file %s to the dead-letter directory: %w", path, err)
+	}
+	tr.metrics.DeadLettered()
+	slog.WarnContext(ctx, "moved invalid file to the dead-letter directory", "path", path, "dead_letter", dst, "error", verr.Error())
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestValidateRecords(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	deadLetter := t.TempDir()
+	schema := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(schema, []byte(`{"type":"object","required":["id"],"properties":{"id":{"type":"integer"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"valid.jsonl":     "{\"id\":1}\n\n{\"id\":2,\"name\":\"foo\"}\n",
+		"broken.jsonl":    "{\"id\":1}\n{\"id\":\n",
+		"schema.jsonl":    "{\"id\":1}\n{\"name\":\"foo\"}\n",
+		"valid.csv":       "id,name\n1,foo\n2,bar\n",
+		"columns.csv":     "id,name\n1,foo\n2\n",
+		"not-records.txt": "foo",
+	}
+	for name, content := range files {
+		s3movertest.WriteFile(t, dir, name, []byte(content))
+	}
+	config := &s3mover.Config{
+		SrcDir:          dir,
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/records",
+		MaxParallels:    1,
+		ValidateRecords: s3mover.ConvertInputAuto,
+		JSONSchemaPath:  schema,
+		DeadLetterDir:   deadLetter,
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != int64(len(files)) {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	var uploaded []string
+	for _, key := range client.Keys() {
+		uploaded = append(uploaded, filepath.Base(key))
+	}
+	sort.Strings(uploaded)
+	if len(uploaded) != 3 || uploaded[0] != "not-records.txt" || uploaded[1] != "valid.csv" || uploaded[2] != "valid.jsonl" {
+		t.Errorf("unexpected uploaded files: %v", uploaded)
+	}
+	for _, name := range []string{"broken.jsonl", "schema.jsonl", "columns.csv"} {
+		if _, err := os.Stat(filepath.Join(deadLetter, name)); err != nil {
+			t.Errorf("%s must be dead-lettered: %v", name, err)
+		}
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.DeadLettered != 3 || m.Objects.Errored != 0 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
+
+func TestValidateRecordsRequiresDeadLetter(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:          ".",
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/records",
+		ValidateRecords: s3mover.ConvertInputJSONL,
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("validate-records without dead-letter-dir must be invalid")
+	}
+}
@@ -0,0 +1,255 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+	"github.com/samber/lo"
+)
+
+func TestPreservePath(t *testing.T) {
+	for _, layout := range []string{s3mover.PathLayoutTimeDir, s3mover.PathLayoutDirTime} {
+		t.Run(layout, func(t *testing.T) {
+			testPreservePath(t, layout)
+		})
+	}
+}
+
+func testPreservePath(t *testing.T, layout string) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a/b/c.log", "d/c.log", "c.log", ".hidden/c.log", "a/.c.log"} {
+		sub := filepath.Join(dir, filepath.Dir(name))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		s3movertest.WriteFile(t, sub, filepath.Base(name), []byte(name))
+	}
+	config := &s3mover.Config{
+		SrcDir:             dir,
+		Bucket:             "testbucket",
+		KeyPrefix:          "test/preserve",
+		MaxParallels:       1,
+		TimeFormat:         "2006",
+		Recursive:          true,
+		PreservePath:       true,
+		PreservePathLayout: layout,
+	}
+	tr, client := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 3 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	keys := lo.Filter(client.Keys(), func(k string, _ int) bool {
+		return !strings.Contains(k, s3mover.TestObjectKey)
+	})
+	sort.Strings(keys)
+	year := lo.Must(os.Stat(dir)).ModTime().In(s3mover.TZ).Format("2006")
+	var expected []string
+	switch layout {
+	case s3mover.PathLayoutTimeDir:
+		expected = []string{
+			"test/preserve/" + year + "/a/b/c.log",
+			"test/preserve/" + year + "/c.log",
+			"test/preserve/" + year + "/d/c.log",
+		}
+	case s3mover.PathLayoutDirTime:
+		expected = []string{
+			"test/preserve/" + year + "/c.log",
+			"test/preserve/a/b/" + year + "/c.log",
+			"test/preserve/d/" + year + "/c.log",
+		}
+	}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	for _, name := range []string{".hidden/c.log", "a/.c.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("hidden files must not be uploaded: %v", err)
+		}
+	}
+}
+
+func TestPreservePathValidate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:       ".",
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/preserve",
+		PreservePath: true,
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("preserve-path without recursive must be invalid")
+	}
+	config.PreservePath = false
+	config.Recursive = true
+	config.DeadLetterDir = "./dead"
+	if err := config.Validate(); err == nil {
+		t.Error("dead-letter-dir in src must be invalid when recursive")
+	}
+}
+
+func TestDirectoryMetrics(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a/b/foo.log", "a/bar.log", "c/foo.log", "foo.log"} {
+		sub := filepath.Join(dir, filepath.Dir(name))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		s3movertest.WriteFile(t, sub, filepath.Base(name), []byte(name))
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/directory",
+		MaxParallels: 1,
+		Recursive:    true,
+		PreservePath: true,
+	}
+	tr, _ := newTestTransporter(t, config)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 4 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	m := tr.Metrics().Snapshot()
+	if d := m.Directories["a"]; d == nil || d.Uploaded != 2 || d.Queued != 2 || d.Bytes != int64(len("a/b/foo.log")+len("a/bar.log")) {
+		t.Errorf("unexpected metrics of a: %+v", d)
+	}
+	if d := m.Directories["."]; d == nil || d.Uploaded != 1 || d.Bytes != int64(len("foo.log")) {
+		t.Errorf("unexpected metrics of .: %+v", d)
+	}
+	// the queued files are reset on the next scan
+	tr.Flush(ctx)
+	m = tr.Metrics().Snapshot()
+	if d := m.Directories["c"]; d == nil || d.Uploaded != 1 || d.Queued != 0 {
+		t.Errorf("unexpected metrics of c: %+v", d)
+	}
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `s3mover_directory_objects_uploaded_total{directory="a"} 2`; !strings.Contains(buf.String(), want) {
+		t.Errorf("%s is not found in %s", want, buf.String())
+	}
+}
+
+// orderedS3Client records the order of the uploaded keys.
+type orderedS3Client struct {
+	*s3movertest.MockS3Client
+	mu   sync.Mutex
+	keys []string
+}
+
+func (c *orderedS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if !strings.Contains(*input.Key, s3mover.TestObjectKey) {
+		c.mu.Lock()
+		c.keys = append(c.keys, *input.Key)
+		c.mu.Unlock()
+	}
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestFairScheduling(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a/1.log", "a/2.log", "a/3.log", "b/1.log", "c/1.log", "c/2.log"} {
+		sub := filepath.Join(dir, filepath.Dir(name))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		s3movertest.WriteFile(t, sub, filepath.Base(name), []byte(name))
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/fair",
+		MaxParallels: 1,
+		TimeFormat:   "2006",
+		Recursive:    true,
+		PreservePath: true,
+	}
+	tr, _ := newTestTransporter(t, config)
+	client := &orderedS3Client{MockS3Client: s3movertest.NewMockS3Client()}
+	tr.SetS3Client(client)
+	if processed, _, err := tr.Flush(ctx); err != nil || processed != 6 {
+		t.Fatalf("unexpected flush result: %d %v", processed, err)
+	}
+	names := lo.Map(client.keys, func(k string, _ int) string {
+		_, name, _ := strings.Cut(k, "/"+time.Now().Format("2006")+"/")
+		return name
+	})
+	expected := []string{"a/1.log", "b/1.log", "c/1.log", "a/2.log", "c/2.log", "a/3.log"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected order: %v", names)
+	}
+}
+
+// gatedS3Client blocks PutObject until the gate is closed.
+type gatedS3Client struct {
+	*s3movertest.MockS3Client
+	gate     chan struct{}
+	inflight sync.WaitGroup
+}
+
+func (c *gatedS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if !strings.Contains(*input.Key, s3mover.TestObjectKey) {
+		c.inflight.Done()
+		<-c.gate
+	}
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestTenantMaxParallels(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a/1.log", "a/2.log", "a/3.log", "b/1.log"} {
+		sub := filepath.Join(dir, filepath.Dir(name))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		s3movertest.WriteFile(t, sub, filepath.Base(name), []byte(name))
+	}
+	config := &s3mover.Config{
+		SrcDir:             dir,
+		Bucket:             "testbucket",
+		KeyPrefix:          "test/tenant",
+		MaxParallels:       4,
+		TimeFormat:         "2006",
+		Recursive:          true,
+		PreservePath:       true,
+		TenantMaxParallels: 1,
+	}
+	tr, _ := newTestTransporter(t, config)
+	client := &gatedS3Client{MockS3Client: s3movertest.NewMockS3Client(), gate: make(chan struct{})}
+	client.inflight.Add(2)
+	tr.SetS3Client(client)
+	go func() {
+		// a/1.log and b/1.log are in flight
+		client.inflight.Wait()
+		close(client.gate)
+	}()
+	// a/2.log and a/3.log are left for the next scan
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 2 || total != 2 {
+		t.Fatalf("unexpected flush result: processed=%d total=%d err=%v", processed, total, err)
+	}
+	m := tr.Metrics().Snapshot()
+	if d := m.Directories["a"]; d == nil || d.Uploaded != 1 || d.Throttled != 2 || d.Queued != 3 {
+		t.Errorf("unexpected metrics of a: %+v", d)
+	}
+	if d := m.Directories["b"]; d == nil || d.Uploaded != 1 || d.Throttled != 0 {
+		t.Errorf("unexpected metrics of b: %+v", d)
+	}
+
+	config.Recursive = false
+	if err := config.Validate(); err == nil {
+		t.Error("tenant quotas without recursive must be an error")
+	}
+}
@@ -0,0 +1,29 @@
+package s3mover
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	removeRetries   = 5
+	removeRetryWait = 100 * time.Millisecond
+)
+
+// removeFile removes the file. The removal is retried with backoff while the file is locked by another process,
+// e.g. an antivirus scanner or the writer still opening the file on Windows.
+// The file still locked is removed later by the next scan.
+func removeFile(path string) error {
+	return retryRemove(os.Remove, isFileLocked, removeRetryWait, path)
+}
+
+// retryRemove calls remove up to removeRetries times more while the error is locked, doubling the wait.
+func retryRemove(remove func(string) error, locked func(error) bool, wait time.Duration, path string) error {
+	for i := 0; ; i++ {
+		err := remove(path)
+		if err == nil || !locked(err) || i >= removeRetries {
+			return err
+		}
+		time.Sleep(wait << i)
+	}
+}
@@ -0,0 +1,88 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestRetryRemoveOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/remove",
+		MaxParallels: 1,
+	}
+	tr, client := newTestTransporter(t, config)
+	tr.SetRemoveFile(func(string) error {
+		return errors.New("device or resource busy")
+	})
+	if processed, _, _ := tr.Flush(ctx); processed != 0 {
+		t.Error("must fail to remove")
+	}
+	if len(client.Keys()) != 1 {
+		t.Fatalf("must be uploaded: %v", client.Keys())
+	}
+	// the object is not uploaded again
+	delete(client.Objects, client.Keys()[0])
+	tr.SetRemoveFile(os.Remove)
+	if processed, _, _ := tr.Flush(ctx); processed != 1 {
+		t.Error("must succeed to remove")
+	}
+	if len(client.Keys()) != 0 {
+		t.Errorf("must not be uploaded again: %v", client.Keys())
+	}
+	if _, err := os.Stat(foo); !os.IsNotExist(err) {
+		t.Errorf("file must be removed: %v", err)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.Uploaded != 1 || m.Objects.Errored != 1 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
+
+func TestRetryRemove(t *testing.T) {
+	errLocked := errors.New("locked")
+	locked := func(err error) bool { return errors.Is(err, errLocked) }
+	for _, c := range []struct {
+		name     string
+		failures int
+		err      error
+		calls    int
+	}{
+		{"locked then removed", 3, nil, 4},
+		{"still locked", s3mover.RemoveRetries + 10, errLocked, s3mover.RemoveRetries + 1},
+		{"not locked error", 10, os.ErrPermission, 1},
+	} {
+		var calls int
+		var waits []time.Time
+		remove := func(string) error {
+			calls++
+			waits = append(waits, time.Now())
+			if calls <= c.failures {
+				if c.err == nil {
+					return errLocked
+				}
+				return c.err
+			}
+			return nil
+		}
+		err := s3mover.RetryRemove(remove, locked, time.Millisecond, "foo.txt")
+		if !errors.Is(err, c.err) || calls != c.calls {
+			t.Errorf("%s: unexpected result: %v after %d calls", c.name, err, calls)
+		}
+		// the wait doubles by each retry
+		for i := 2; i < len(waits); i++ {
+			if waits[i].Sub(waits[i-1]) < time.Millisecond<<(i-1) {
+				t.Errorf("%s: retry %d must wait %s", c.name, i, time.Millisecond<<(i-1))
+			}
+		}
+	}
+}
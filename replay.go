@@ -0,0 +1,71 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+)
+
+// ReplayOption represents options for Replay.
+type ReplayOption struct {
+	// Dir is the directory of the files to replay. e.g. a dead-letter directory.
+	Dir string
+	// Keep keeps the files after uploading.
+	Keep bool
+}
+
+// ReplayResult represents the result of replaying a file.
+type ReplayResult struct {
+	Path  string `json:"path"`
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Replay re-attempts uploads of the files in opt.Dir with the current configuration.
+// The results are returned in the order of the file names.
+func (tr *Transporter) Replay(ctx context.Context, opt ReplayOption) ([]ReplayResult, error) {
+	ctx = slogcontext.WithValue(ctx, "component", "replay")
+	if opt.Dir == "" {
+		return nil, fmt.Errorf("dir is required")
+	}
+	paths, err := listFiles(opt.Dir, tr.config.Recursive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in %s: %w", opt.Dir, err)
+	}
+	slog.InfoContext(ctx, "replaying", "dir", opt.Dir, "files", len(paths))
+
+	results := make([]ReplayResult, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		i, path := i, path
+		results[i].Path = path
+		release, err := tr.acquireWorker(ctx)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer release()
+			defer wg.Done()
+			up, err := tr.uploadAll(ctx, path, tr.objectName(opt.Dir, path), 0)
+			if err != nil {
+				slog.WarnContext(ctx, "failed to replay", "path", path, "error", err.Error())
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].URL = fmt.Sprintf("s3://%s/%s", up.Bucket, up.Key)
+			if opt.Keep {
+				return
+			}
+			if err := tr.removeFile(path); err != nil {
+				results[i].Error = fmt.Sprintf("uploaded but failed to remove: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
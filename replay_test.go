@@ -0,0 +1,49 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", ".c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/replay",
+		MaxParallels: 2,
+	}
+	tr, client := newTestTransporter(t, config)
+
+	results, err := tr.Replay(ctx, s3mover.ReplayOption{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %v", results)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			t.Errorf("unexpected error: %v", r)
+		}
+		if _, err := os.Stat(r.Path); err == nil {
+			t.Errorf("replayed file must be removed: %s", r.Path)
+		}
+	}
+	if len(client.Objects) != 2 {
+		t.Errorf("expected 2 objects, got %d", len(client.Objects))
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".c.txt")); err != nil {
+		t.Error("dot files must not be replayed")
+	}
+}
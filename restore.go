@@ -0,0 +1,251 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	RestoreStatusRestored = "restored"
+	RestoreStatusExists   = "exists"
+	RestoreStatusError    = "error"
+)
+
+// RestoreS3Client is an interface for the S3 client supporting the restore and reconcile subcommands.
+type RestoreS3Client interface {
+	ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// RestoreOption represents options for Restore.
+type RestoreOption struct {
+	// Dest is the directory to download the objects into.
+	Dest string
+	// Since restores only the objects modified at or after it, if not zero.
+	Since time.Time
+	// Overwrite overwrites the existing files. Otherwise, they are skipped.
+	Overwrite bool
+}
+
+// RestoreResult represents the result of restoring an object.
+type RestoreResult struct {
+	URL    string `json:"url"`
+	Path   string `json:"path,omitempty"`
+	Status string `json:"status"`
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// restoreClient returns the client as RestoreS3Client when listing and downloading are available.
+func restoreClient(client S3Client) (RestoreS3Client, bool) {
+	if c, ok := client.(*faultS3Client); ok {
+		client = c.S3Client
+	}
+	rc, ok := client.(RestoreS3Client)
+	return rc, ok
+}
+
+// Restore downloads the objects under the key prefix into opt.Dest, keeping the relative keys as the paths.
+// The objects with the .gz suffix are decompressed and saved without the suffix.
+// The mode and the mtime stored by PreserveAttrs are applied to the files.
+// The results are returned in the order of the keys.
+func (tr *Transporter) Restore(ctx context.Context, opt RestoreOption) ([]RestoreResult, error) {
+	ctx = slogcontext.WithValue(ctx, "component", "restore")
+	if opt.Dest == "" {
+		return nil, fmt.Errorf("dest is required")
+	}
+	client, ok := restoreClient(tr.s3)
+	if !ok {
+		return nil, fmt.Errorf("the S3 client does not support listing and downloading objects")
+	}
+	if err := os.MkdirAll(opt.Dest, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", opt.Dest, err)
+	}
+	prefix := strings.Trim(tr.config.KeyPrefix, "/") + "/"
+	objects, err := tr.listRestoreObjects(ctx, client, prefix, opt.Since)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "restoring", "s3url", fmt.Sprintf("s3://%s/%s", tr.config.Bucket, prefix), "dest", opt.Dest, "objects", len(objects))
+
+	results := make([]RestoreResult, len(objects))
+	var wg sync.WaitGroup
+	for i, obj := range objects {
+		i, key := i, aws.ToString(obj.Key)
+		results[i].URL = fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key)
+		if err := tr.sem.Acquire(ctx, 1); err != nil {
+			results[i].Status = RestoreStatusError
+			results[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer tr.sem.Release(1)
+			defer wg.Done()
+			results[i] = tr.restore(ctx, client, key, strings.TrimPrefix(key, prefix), opt)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// listRestoreObjects lists the objects to restore under the prefix, skipping the done markers and the test objects.
+func (tr *Transporter) listRestoreObjects(ctx context.Context, client RestoreS3Client, prefix string, since time.Time) ([]types.Object, error) {
+	var objects []types.Object
+	p := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: &tr.config.Bucket,
+		Prefix: &prefix,
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range out.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, "/") || strings.Contains(key, TestObjectKey) || tr.isDoneMarker(key) {
+				continue
+			}
+			if !since.IsZero() && aws.ToTime(obj.LastModified).Before(since) {
+				continue
+			}
+			objects = append(objects, obj)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.ToString(objects[i].Key) < aws.ToString(objects[j].Key)
+	})
+	return objects, nil
+}
+
+// isDoneMarker reports whether the key is of the marker put by DoneMarker.
+func (tr *Transporter) isDoneMarker(key string) bool {
+	switch tr.config.DoneMarker {
+	case DoneMarkerObject:
+		return strings.HasSuffix(key, DoneMarkerSuffix)
+	case DoneMarkerBatch:
+		return path.Base(key) == DoneMarkerBatchName
+	}
+	return false
+}
+
+// objectCodec returns the compression codec of the object of the relative key by the suffix, and the key without it.
+// Without the gzip suffix (GzipSuffixNone), the objects are compressed with Gzip.
+func (tr *Transporter) objectCodec(rel string) (string, string) {
+	for _, codec := range []string{CompressGzip, CompressLZ4, CompressSnappy} {
+		if suffix := tr.config.compressSuffix(codec); suffix != "" && strings.HasSuffix(rel, suffix) {
+			return codec, strings.TrimSuffix(rel, suffix)
+		}
+	}
+	if tr.config.Gzip && tr.config.gzipSuffix() == "" {
+		return CompressGzip, rel
+	}
+	return "", rel
+}
+
+func (tr *Transporter) restore(ctx context.Context, client RestoreS3Client, key, rel string, opt RestoreOption) RestoreResult {
+	r := RestoreResult{URL: fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key)}
+	fail := func(format string, args ...any) RestoreResult {
+		r.Status = RestoreStatusError
+		r.Error = fmt.Sprintf(format, args...)
+		slog.WarnContext(ctx, "failed to restore", "s3url", r.URL, "error", r.Error)
+		return r
+	}
+	codec, rel := tr.objectCodec(rel)
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return fail("the key is out of the dest: %s", rel)
+	}
+	r.Path = filepath.Join(opt.Dest, filepath.FromSlash(rel))
+	if !opt.Overwrite {
+		if _, err := os.Lstat(r.Path); err == nil {
+			r.Status = RestoreStatusExists
+			return r
+		}
+	}
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &tr.config.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return fail("failed to get object: %s", err)
+	}
+	defer out.Body.Close()
+	var body io.Reader = out.Body
+	if codec != "" {
+		dr, err := decompressCodec(out.Body, codec)
+		if err != nil {
+			return fail("failed to decompress: %s", err)
+		}
+		body = dr
+	}
+	if r.Size, err = writeRestoreFile(r.Path, body); err != nil {
+		return fail("failed to write %s: %s", r.Path, err)
+	}
+	if err := applyFileMetadata(r.Path, out.Metadata); err != nil {
+		return fail("failed to apply the attributes to %s: %s", r.Path, err)
+	}
+	r.Status = RestoreStatusRestored
+	slog.DebugContext(ctx, "restored", "s3url", r.URL, "path", r.Path, "size", r.Size)
+	return r
+}
+
+// writeRestoreFile writes the content into a temporary file and renames it to the path,
+// not to leave a partial file at the path.
+func writeRestoreFile(path string, body io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".s3mover-restore-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	n, err := io.Copy(f, body)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(f.Name(), path)
+}
+
+// applyFileMetadata applies the mode and the mtime of the object metadata stored by PreserveAttrs to the file.
+func applyFileMetadata(path string, md map[string]string) error {
+	if v, ok := md[MetadataMode]; ok {
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s metadata: %s", MetadataMode, v)
+		}
+		if err := os.Chmod(path, os.FileMode(mode).Perm()); err != nil {
+			return err
+		}
+	}
+	if v, ok := md[MetadataMtime]; ok {
+		mtime, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return fmt.Errorf("invalid %s metadata: %s", MetadataMtime, v)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	mtime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"a.txt", "b.txt", "old.txt"} {
+		s3movertest.WriteFile(t, src, name, []byte("content of "+name))
+		path := filepath.Join(src, name)
+		if err := os.Chmod(path, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &s3mover.Config{
+		SrcDir:        src,
+		Bucket:        "testbucket",
+		KeyPrefix:     "test/restore",
+		MaxParallels:  2,
+		TimeFormat:    "2006/01/02",
+		Gzip:          true,
+		PreserveAttrs: true,
+		DoneMarker:    s3mover.DoneMarkerObject,
+	}
+	tr, client := newTestTransporter(t, config)
+	if _, err := tr.Replay(ctx, s3mover.ReplayOption{Dir: src, Keep: true}); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now().Add(-time.Hour)
+	for key, obj := range client.Objects {
+		if strings.HasSuffix(key, "/old.txt.gz") {
+			obj.LastModified = since.Add(-time.Hour)
+		}
+	}
+
+	dest := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dest, "2024/06/01"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s3movertest.WriteFile(t, filepath.Join(dest, "2024/06/01"), "b.txt", []byte("existing"))
+
+	results, err := tr.Restore(ctx, s3mover.RestoreOption{Dest: dest, Since: since})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// old.txt is skipped by since, and the done markers are skipped
+	expected := map[string]string{
+		"a.txt": s3mover.RestoreStatusRestored,
+		"b.txt": s3mover.RestoreStatusExists,
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), results)
+	}
+	for _, r := range results {
+		if s := expected[filepath.Base(r.Path)]; s != r.Status {
+			t.Errorf("%s: expected %s, got %s %s", r.URL, s, r.Status, r.Error)
+		}
+	}
+
+	path := filepath.Join(dest, "2024/06/01/a.txt")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "content of a.txt" {
+		t.Errorf("unexpected content: %q", b)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.ModTime().Equal(mtime) {
+		t.Errorf("unexpected mtime: %s", st.ModTime())
+	}
+	if st.Mode().Perm() != 0600 && filepath.Separator == '/' {
+		t.Errorf("unexpected mode: %s", st.Mode())
+	}
+	if b, _ := os.ReadFile(filepath.Join(dest, "2024/06/01/b.txt")); string(b) != "existing" {
+		t.Errorf("the existing file must not be overwritten: %q", b)
+	}
+
+	// overwrite
+	results, err = tr.Restore(ctx, s3mover.RestoreOption{Dest: dest, Since: since, Overwrite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Status != s3mover.RestoreStatusRestored {
+			t.Errorf("%s: expected restored, got %s %s", r.URL, r.Status, r.Error)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(dest, "2024/06/01/b.txt")); string(b) != "content of b.txt" {
+		t.Errorf("unexpected content: %q", b)
+	}
+}
@@ -0,0 +1,218 @@
+package s3mover
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ListPartsS3Client is an interface for the S3 client listing the uploaded parts of a multipart upload.
+// When the S3Client implements it, the multipart uploads recorded in the resume journal are resumed.
+type ListPartsS3Client interface {
+	ListParts(ctx context.Context, input *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+}
+
+// listPartsClient returns the client as ListPartsS3Client when listing the parts is available.
+func listPartsClient(client MultipartS3Client) (ListPartsS3Client, bool) {
+	if c, ok := client.(*faultS3Client); ok {
+		if _, ok := c.S3Client.(ListPartsS3Client); !ok {
+			return nil, false
+		}
+	}
+	lc, ok := client.(ListPartsS3Client)
+	return lc, ok
+}
+
+// listParts returns the uploaded parts of the multipart upload by the part number.
+func listParts(ctx context.Context, client ListPartsS3Client, bucket, key, uploadID string) (map[int32]types.Part, error) {
+	parts := make(map[int32]types.Part)
+	input := &s3.ListPartsInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	}
+	for {
+		out, err := client.ListParts(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range out.Parts {
+			parts[aws.ToInt32(p.PartNumber)] = p
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			return parts, nil
+		}
+		input.PartNumberMarker = out.NextPartNumberMarker
+	}
+}
+
+// partUploaded reports whether the uploaded part has the size and the same content as r, by the ETag of the part.
+func partUploaded(p types.Part, r io.Reader, size int64) bool {
+	if aws.ToInt64(p.Size) != size {
+		return false
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return false
+	}
+	return aws.ToString(p.ETag) == fmt.Sprintf(`"%x"`, h.Sum(nil))
+}
+
+// recordMultipart records the multipart upload of the file to the primary bucket in the resume journal.
+func (tr *Transporter) recordMultipart(ctx context.Context, path, bucket, key, uploadID string) {
+	if tr.resume == nil || bucket != tr.config.Bucket {
+		return
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if err := tr.resume.put(&JournalEntry{
+		Path:       path,
+		Bucket:     bucket,
+		Key:        key,
+		Size:       st.Size(),
+		ModTime:    st.ModTime(),
+		UploadedAt: time.Now(),
+		UploadID:   uploadID,
+	}); err != nil {
+		slog.WarnContext(ctx, "failed to record multipart upload", "path", path, "upload_id", uploadID, "error", err)
+	}
+}
+
+// resumableUpload returns the upload ID and the uploaded parts of the multipart upload of the file
+// recorded in the resume journal. It returns an empty upload ID if no upload can be resumed.
+func (tr *Transporter) resumableUpload(ctx context.Context, client MultipartS3Client, path, bucket, key string) (string, map[int32]types.Part) {
+	if tr.resume == nil || bucket != tr.config.Bucket {
+		return "", nil
+	}
+	e, ok := tr.resume.get(path)
+	if !ok || e.UploadID == "" {
+		return "", nil
+	}
+	lc, ok := listPartsClient(client)
+	if !ok || e.Bucket != bucket || e.Key != key {
+		tr.abandonMultipart(context.WithoutCancel(ctx), client, path, e.Bucket, e.Key, e.UploadID)
+		return "", nil
+	}
+	parts, err := listParts(ctx, lc, bucket, key, e.UploadID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to list the parts of multipart upload. uploading again", "path", path, "upload_id", e.UploadID, "error", err)
+		tr.abandonMultipart(context.WithoutCancel(ctx), client, path, bucket, key, e.UploadID)
+		return "", nil
+	}
+	slog.InfoContext(ctx, "resuming multipart upload", "path", path, "key", key, "upload_id", e.UploadID, "parts", len(parts))
+	return e.UploadID, parts
+}
+
+// abandonMultipart aborts the failed multipart upload and forgets it. The upload interrupted by the shutdown
+// is kept in the resume journal to be resumed by the next run.
+func (tr *Transporter) abandonMultipart(ctx context.Context, client MultipartS3Client, path, bucket, key, uploadID string) {
+	if tr.resume != nil && ctx.Err() != nil && tr.resumable(path, uploadID) {
+		slog.InfoContext(ctx, "multipart upload is interrupted. it will be resumed by the next run", "path", path, "upload_id", uploadID)
+		return
+	}
+	tr.abortMultipart(ctx, client, bucket, key, uploadID)
+	tr.forgetMultipart(ctx, path, uploadID)
+}
+
+// resumable reports whether the multipart upload of the file is recorded in the resume journal.
+func (tr *Transporter) resumable(path, uploadID string) bool {
+	e, ok := tr.resume.get(path)
+	return ok && e.UploadID == uploadID
+}
+
+// forgetMultipart forgets the multipart upload of the file recorded in the resume journal.
+func (tr *Transporter) forgetMultipart(ctx context.Context, path, uploadID string) {
+	if tr.resume != nil && tr.resumable(path, uploadID) {
+		tr.forgetResume(ctx, path)
+	}
+}
+
+// recordUploaded records the file uploaded to the primary bucket in the resume journal, to remove it (or keep it by the journal)
+// without uploading again after a crash before removing it.
+func (tr *Transporter) recordUploaded(ctx context.Context, path string, up *uploadResult, st os.FileInfo, revision int) {
+	if tr.resume == nil || up.Bucket != tr.config.Bucket {
+		return
+	}
+	if err := tr.resume.put(&JournalEntry{
+		Path:       path,
+		Bucket:     up.Bucket,
+		Key:        up.Key,
+		Size:       st.Size(),
+		ModTime:    st.ModTime(),
+		UploadedAt: time.Now(),
+		Revision:   revision,
+		VersionID:  up.VersionID,
+	}); err != nil {
+		slog.WarnContext(ctx, "failed to record uploaded file", "path", path, "error", err)
+	}
+}
+
+// forgetResume forgets the file in the resume journal.
+func (tr *Transporter) forgetResume(ctx context.Context, path string) {
+	if tr.resume == nil {
+		return
+	}
+	if _, ok := tr.resume.get(path); !ok {
+		return
+	}
+	if err := tr.resume.remove(path); err != nil {
+		slog.WarnContext(ctx, "failed to forget file in resume journal", "path", path, "error", err)
+	}
+}
+
+// replayResumeJournal replays the resume journal of the previous run on startup.
+// The files uploaded but not removed are removed (or kept by the journal) without uploading again.
+// The multipart uploads of the files not modified are kept to be resumed, and the others are aborted.
+func (tr *Transporter) replayResumeJournal(ctx context.Context) {
+	if tr.resume == nil {
+		return
+	}
+	var finished, resumable, aborted int
+	for _, e := range tr.resume.list() {
+		e := e
+		st, err := os.Stat(e.Path)
+		matched := err == nil && e.matches(st)
+		switch {
+		case e.UploadID != "" && matched:
+			resumable++
+			continue
+		case e.UploadID != "":
+			if mc, ok := multipartClient(tr.s3); ok {
+				tr.abortMultipart(ctx, mc, e.Bucket, e.Key, e.UploadID)
+			}
+			aborted++
+		case matched:
+			up := &uploadResult{Bucket: e.Bucket, Key: e.Key, Size: e.Size, VersionID: e.VersionID}
+			if err := tr.finishUploaded(ctx, &e, up, st); err != nil {
+				slog.WarnContext(ctx, "failed to finish uploaded file. retry removing only", "path", e.Path, "error", err)
+				if tr.journal == nil {
+					tr.unremoved.put(&e)
+				}
+				continue
+			}
+			finished++
+		}
+		tr.forgetResume(ctx, e.Path)
+	}
+	if finished+resumable+aborted > 0 {
+		slog.InfoContext(ctx, "replayed resume journal", "finished", finished, "resumable", resumable, "aborted", aborted)
+	}
+}
+
+// finishUploaded removes the file uploaded by the previous run, or keeps it by the journal.
+func (tr *Transporter) finishUploaded(ctx context.Context, e *JournalEntry, up *uploadResult, st os.FileInfo) error {
+	if tr.journal != nil {
+		return tr.keep(e.Path, up, st, e.Revision)
+	}
+	return tr.remove(ctx, e.Path)
+}
@@ -0,0 +1,128 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// crashingS3Client cancels the run on uploading the part of the number, as the agent is stopped.
+type crashingS3Client struct {
+	*s3movertest.MockS3Client
+	part   int32
+	cancel context.CancelFunc
+}
+
+func (c *crashingS3Client) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if aws.ToInt32(input.PartNumber) == c.part {
+		c.cancel()
+		return nil, ctx.Err()
+	}
+	return c.MockS3Client.UploadPart(ctx, input, optFns...)
+}
+
+func newResumeTransporter(t *testing.T, dir, journal string) *s3mover.Transporter {
+	t.Helper()
+	config := &s3mover.Config{
+		SrcDir:               dir,
+		Bucket:               "testbucket",
+		KeyPrefix:            "test/resume",
+		MaxParallels:         1,
+		MultipartThreshold:   s3mover.MinMultipartPartSize,
+		MultipartPartSize:    s3mover.MinMultipartPartSize,
+		MultipartConcurrency: 1,
+		ResumeJournalPath:    journal,
+	}
+	tr, _ := newTestTransporter(t, config)
+	return tr
+}
+
+func TestResumeJournalMultipart(t *testing.T) {
+	for _, modified := range []bool{false, true} {
+		dir := t.TempDir()
+		journal := filepath.Join(t.TempDir(), "resume")
+		large := bytes.Repeat([]byte("0123456789"), s3mover.MinMultipartPartSize*2/10+1)
+		path := s3movertest.WriteFile(t, dir, "large.txt", large)
+
+		client := s3movertest.NewMockS3Client()
+		ctx, cancel := context.WithCancel(context.Background())
+		tr := newResumeTransporter(t, dir, journal)
+		tr.SetS3Client(&crashingS3Client{MockS3Client: client, part: 3, cancel: cancel})
+		tr.Flush(ctx)
+		if client.UploadedParts != 2 || client.AbortedUploads != 0 {
+			t.Fatalf("the interrupted upload must be kept: %d parts %d aborted", client.UploadedParts, client.AbortedUploads)
+		}
+		if modified {
+			large = append(large, "modified"...)
+			s3movertest.WriteFile(t, dir, "large.txt", large)
+		}
+
+		ctx = context.Background()
+		tr = newResumeTransporter(t, dir, journal)
+		tr.SetS3Client(client)
+		tr.ReplayResumeJournal(ctx)
+		if processed, total, err := tr.Flush(ctx); err != nil || processed != 1 || total != 1 {
+			t.Fatalf("unexpected flush result: %d/%d %v", processed, total, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s must be removed: %v", path, err)
+		}
+		expected := map[bool][2]int{false: {3, 0}, true: {5, 1}}[modified]
+		if client.UploadedParts != expected[0] || client.AbortedUploads != expected[1] {
+			t.Errorf("unexpected multipart uploads with modified %v: %d parts %d aborted", modified, client.UploadedParts, client.AbortedUploads)
+		}
+		if client.MultipartUploads != 1 || len(client.Objects) != 1 {
+			t.Fatalf("unexpected objects: %v", client.Keys())
+		}
+		for _, obj := range client.Objects {
+			if !bytes.Equal(obj.Content, large) {
+				t.Error("unexpected content of the resumed upload")
+			}
+		}
+	}
+}
+
+func TestResumeJournalRemove(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal := filepath.Join(t.TempDir(), "resume")
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+
+	// the previous run crashed after uploading foo.txt and before removing it
+	client := s3movertest.NewMockS3Client()
+	tr := newResumeTransporter(t, dir, journal)
+	tr.SetS3Client(client)
+	tr.SetRemoveFile(func(string) error { return errors.New("crashed") })
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tr = newResumeTransporter(t, dir, journal)
+	tr.SetS3Client(client)
+	tr.ReplayResumeJournal(ctx)
+	if _, err := os.Stat(foo); !os.IsNotExist(err) {
+		t.Errorf("%s must be removed by the replay: %v", foo, err)
+	}
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 0 || total != 0 {
+		t.Errorf("unexpected flush result: %d/%d %v", processed, total, err)
+	}
+	if len(client.Objects) != 1 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+	b, err := os.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	if !bytes.Contains(lines[len(lines)-1], []byte(`"removed"`)) {
+		t.Errorf("the file must be forgotten after the replay: %s", b)
+	}
+}
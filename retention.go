@@ -0,0 +1,105 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+)
+
+// keep records the uploaded file to the journal instead of removing it.
+// The file is removed by runRetention after KeepAfterUpload, or kept forever in mirror mode.
+func (tr *Transporter) keep(path string, up *uploadResult, st os.FileInfo, revision int) error {
+	sha256, _ := tr.hashes.get(path)
+	return tr.journal.put(&JournalEntry{
+		Path:       path,
+		Key:        up.Key,
+		Size:       st.Size(),
+		ModTime:    st.ModTime(),
+		UploadedAt: time.Now(),
+		Revision:   revision,
+		VersionID:  up.VersionID,
+		SHA256:     sha256,
+	})
+}
+
+// kept reports whether the file has been uploaded and is kept until the grace period expires.
+// A file modified after the upload is not kept, so it will be uploaded again.
+func (tr *Transporter) kept(path string) bool {
+	if tr.journal == nil {
+		return false
+	}
+	e, ok := tr.journal.get(path)
+	if !ok {
+		return false
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return e.matches(st)
+}
+
+// runRetention removes the kept files whose grace period has expired.
+func (tr *Transporter) runRetention(ctx context.Context) error {
+	if tr.journal == nil || tr.config.Observe {
+		return nil
+	}
+	ctx = slogcontext.WithValue(ctx, "component", "retention")
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		// removes the expired files kept by the previous process at first
+		tr.expire(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+const retentionInterval = 10 * time.Second
+
+// expire removes the kept files uploaded before now - KeepAfterUpload.
+// Failed removals are retried on the next call.
+// In mirror mode, it only forgets the files removed by others.
+func (tr *Transporter) expire(ctx context.Context, now time.Time) {
+	var done []string
+	for _, e := range tr.journal.list() {
+		if tr.config.Mirror {
+			if _, err := os.Stat(e.Path); errors.Is(err, os.ErrNotExist) {
+				done = append(done, e.Path)
+			}
+			continue
+		}
+		if now.Sub(e.UploadedAt) < tr.config.KeepAfterUpload {
+			continue
+		}
+		st, err := os.Stat(e.Path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// removed by others
+		case err != nil:
+			slog.WarnContext(ctx, "failed to stat kept file", "path", e.Path, "error", err.Error())
+			continue
+		case !e.matches(st):
+			// modified after the upload. it will be uploaded again
+			slog.InfoContext(ctx, "kept file is modified after upload", "path", e.Path)
+		default:
+			if err := tr.discard(e.Path); err != nil {
+				slog.WarnContext(ctx, "failed to remove kept file", "path", e.Path, "error", err.Error())
+				continue
+			}
+			tr.removeSidecar(ctx, e.Path)
+			slog.DebugContext(ctx, "removed kept file", "path", e.Path, "uploaded_at", e.UploadedAt)
+		}
+		done = append(done, e.Path)
+	}
+	if err := tr.journal.remove(done...); err != nil {
+		slog.WarnContext(ctx, err.Error())
+	}
+}
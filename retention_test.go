@@ -0,0 +1,85 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestKeepAfterUpload(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	bar := s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	config := &s3mover.Config{
+		SrcDir:          dir,
+		Bucket:          "testbucket",
+		KeyPrefix:       "test/keep",
+		MaxParallels:    2,
+		KeepAfterUpload: 30 * time.Minute,
+	}
+	client := s3movertest.NewMockS3Client()
+	// the transporters after restarting share the bucket
+	newTransporter := func() *s3mover.Transporter {
+		tr, _ := newTestTransporter(t, config)
+		tr.SetS3Client(client)
+		return tr
+	}
+	flush := func(tr *s3mover.Transporter, want int64) {
+		t.Helper()
+		processed, total, err := tr.Flush(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if processed != want || total != want {
+			t.Errorf("unexpected result: processed=%d total=%d, want %d", processed, total, want)
+		}
+	}
+
+	tr := newTransporter()
+	flush(tr, 2)
+	for _, path := range []string{foo, bar} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s must be kept: %s", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, s3mover.DefaultJournalName)); err != nil {
+		t.Errorf("journal must be saved: %s", err)
+	}
+	// already uploaded
+	flush(tr, 0)
+
+	// the journal survives restarts
+	tr = newTransporter()
+	flush(tr, 0)
+	if len(client.Keys()) != 2 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+
+	// a modified file is uploaded again
+	if err := os.WriteFile(bar, []byte("barbar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	flush(tr, 1)
+
+	tr.Expire(ctx, time.Now().Add(10*time.Minute))
+	for _, path := range []string{foo, bar} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s must be kept in the grace period: %s", path, err)
+		}
+	}
+	tr.Expire(ctx, time.Now().Add(31*time.Minute))
+	for _, path := range []string{foo, bar} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s must be removed: %v", path, err)
+		}
+	}
+	// the journal is empty after expiration
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	flush(newTransporter(), 1)
+}
@@ -0,0 +1,171 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// DefaultRetryBudgetBackoff is the default duration to stop uploading after the retry budget is exhausted.
+	DefaultRetryBudgetBackoff = 30 * time.Second
+
+	// retryBudgetWindow is the window to count the requests and the retries. The previous window is counted too.
+	retryBudgetWindow = time.Minute
+	// retryBudgetMinRequests is the number of the requests in the windows to start limiting the retries.
+	retryBudgetMinRequests = 10
+)
+
+// errRetryBackoff is returned by runOnce while backing off by the exhausted retry budget.
+var errRetryBackoff = errors.New("backing off by the exhausted retry budget")
+
+// RetryBudgetMetrics represents the metrics of the retry budget.
+type RetryBudgetMetrics struct {
+	// Requests is the number of the attempts of S3 requests, including the retries.
+	Requests int64 `json:"requests"`
+	// Retries is the number of the retried attempts.
+	Retries int64 `json:"retries"`
+	// Rejected is the number of the retries not attempted by the exhausted budget.
+	Rejected int64 `json:"rejected"`
+	// Backoffs is the number of the global backoffs.
+	Backoffs int64 `json:"backoffs"`
+}
+
+// retryBudget limits the ratio of the retries to the requests of S3 across the uploads, not to amplify
+// region-wide throttling by the retries of many hosts. When the budget is exhausted, the retries are not
+// attempted and uploading is stopped for the backoff.
+type retryBudget struct {
+	ratio   float64
+	backoff time.Duration
+
+	mu           sync.Mutex
+	start        time.Time
+	requests     int64
+	retries      int64
+	prevRequests int64
+	prevRetries  int64
+
+	backoffUntil atomic.Int64 // unix nano
+	metrics      RetryBudgetMetrics
+}
+
+// newRetryBudget returns nil if RetryBudget is 0 (disabled).
+func newRetryBudget(config *Config) *retryBudget {
+	if config.RetryBudget <= 0 {
+		return nil
+	}
+	return &retryBudget{
+		ratio:   config.RetryBudget,
+		backoff: config.RetryBudgetBackoff,
+	}
+}
+
+// s3Options wraps the retryer of the S3 client to count the requests and the retries by the budget.
+func (b *retryBudget) s3Options(o *s3.Options) {
+	if b == nil {
+		return
+	}
+	o.Retryer = &budgetRetryer{RetryerV2: retryerV2(o.Retryer), budget: b}
+}
+
+// rotate starts the new window if the current window has passed.
+func (b *retryBudget) rotate(now time.Time) {
+	switch elapsed := now.Sub(b.start); {
+	case elapsed >= 2*retryBudgetWindow:
+		b.prevRequests, b.prevRetries = 0, 0
+	case elapsed >= retryBudgetWindow:
+		b.prevRequests, b.prevRetries = b.requests, b.retries
+	default:
+		return
+	}
+	b.start, b.requests, b.retries = now, 0, 0
+}
+
+// request counts an attempt of a request.
+func (b *retryBudget) request(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(now)
+	b.requests++
+	atomic.AddInt64(&b.metrics.Requests, 1)
+}
+
+// allowRetry reports whether a retry is allowed by the budget at now, and starts the backoff if not.
+func (b *retryBudget) allowRetry(ctx context.Context, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(now)
+	requests, retries := b.prevRequests+b.requests, b.prevRetries+b.retries
+	if b.allow(now) && (requests < retryBudgetMinRequests || float64(retries+1) <= b.ratio*float64(requests)) {
+		b.retries++
+		atomic.AddInt64(&b.metrics.Retries, 1)
+		return true
+	}
+	atomic.AddInt64(&b.metrics.Rejected, 1)
+	if b.allow(now) {
+		until := now.Add(b.backoff)
+		b.backoffUntil.Store(until.UnixNano())
+		atomic.AddInt64(&b.metrics.Backoffs, 1)
+		slog.WarnContext(ctx, "retry budget is exhausted. stop uploading until the backoff expires",
+			"requests", requests,
+			"retries", retries,
+			"until", until,
+		)
+	}
+	return false
+}
+
+// allow reports whether uploads are allowed at now, not backing off.
+func (b *retryBudget) allow(now time.Time) bool {
+	return b == nil || now.UnixNano() >= b.backoffUntil.Load()
+}
+
+// budgetRetryer is the retryer of the SDK limited by the retry budget.
+type budgetRetryer struct {
+	aws.RetryerV2
+	budget *retryBudget
+}
+
+func (r *budgetRetryer) GetAttemptToken(ctx context.Context) (func(error) error, error) {
+	r.budget.request(time.Now())
+	return r.RetryerV2.GetAttemptToken(ctx)
+}
+
+func (r *budgetRetryer) GetRetryToken(ctx context.Context, opErr error) (func(error) error, error) {
+	if !r.budget.allowRetry(ctx, time.Now()) {
+		return nil, fmt.Errorf("%w: %w", errRetryBackoff, opErr)
+	}
+	return r.RetryerV2.GetRetryToken(ctx, opErr)
+}
+
+// retryerV2 adapts the retryer to aws.RetryerV2.
+func retryerV2(r aws.Retryer) aws.RetryerV2 {
+	if v2, ok := r.(aws.RetryerV2); ok {
+		return v2
+	}
+	return &retryerV1{Retryer: r}
+}
+
+type retryerV1 struct {
+	aws.Retryer
+}
+
+func (r *retryerV1) GetAttemptToken(ctx context.Context) (func(error) error, error) {
+	return r.Retryer.GetInitialToken(), nil
+}
+
+// setRetryBudget sets the retry budget shared by the S3 clients.
+func (tr *Transporter) setRetryBudget(b *retryBudget) {
+	if b == nil {
+		return
+	}
+	tr.budget = b
+	tr.metrics.RetryBudget = &b.metrics
+}
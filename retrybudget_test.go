@@ -0,0 +1,70 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+)
+
+func TestRetryBudget(t *testing.T) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`))
+	}))
+	defer server.Close()
+
+	config := &s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/budget", RetryBudget: 0.2}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	budget := s3mover.NewRetryBudget(config)
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("test", "test", ""),
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = 3
+			o.RateLimiter = ratelimit.None
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+	}, budget.S3Options)
+
+	// the retries are allowed until the requests reach the minimum to evaluate the budget
+	for i := 0; i < 5; i++ {
+		if _, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: aws.String("testbucket"),
+			Key:    aws.String("test/budget/foo"),
+			Body:   bytes.NewReader([]byte("foo")),
+		}); err == nil {
+			t.Fatal("must fail")
+		}
+	}
+	if n := hits.Load(); n != 11 {
+		t.Errorf("unexpected requests: %d", n)
+	}
+	m := budget.Metrics()
+	if m.Requests != 11 || m.Retries != 6 || m.Rejected != 2 || m.Backoffs != 1 {
+		t.Errorf("unexpected metrics: %+v", m)
+	}
+	now := time.Now()
+	if budget.Allow(now) {
+		t.Error("uploading must be stopped by the backoff")
+	}
+	if !budget.Allow(now.Add(config.RetryBudgetBackoff)) {
+		t.Error("uploading must be allowed after the backoff")
+	}
+}
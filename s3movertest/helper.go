@@ -0,0 +1,60 @@
+package s3movertest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// LocalStackEndpointEnv is the environment variable of the endpoint of LocalStack (e.g. http://127.0.0.1:4566).
+const LocalStackEndpointEnv = "S3MOVER_TEST_LOCALSTACK_ENDPOINT"
+
+// WriteFile writes a file into dir in the way that s3mover expects.
+// The content is written to a dot file, then the file is renamed to name.
+func WriteFile(t testing.TB, dir, name string, content []byte) string {
+	t.Helper()
+	tmp := filepath.Join(dir, "."+name)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// NewLocalStackClient returns an S3 client for LocalStack and a new bucket created in it.
+// The test is skipped unless the LocalStackEndpointEnv environment variable is set.
+func NewLocalStackClient(t testing.TB) (*s3.Client, string) {
+	t.Helper()
+	endpoint := os.Getenv(LocalStackEndpointEnv)
+	if endpoint == "" {
+		t.Skipf("%s is not set", LocalStackEndpointEnv)
+	}
+	ctx := context.Background()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion("us-east-1"),
+		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("test", "test", "")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = true
+	})
+	bucket := fmt.Sprintf("s3mover-test-%d", time.Now().UnixNano())
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: &bucket}); err != nil {
+		t.Fatalf("failed to create bucket %s: %s", bucket, err)
+	}
+	return client, bucket
+}
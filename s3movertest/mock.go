@@ -0,0 +1,347 @@
+// Package s3movertest provides utilities for testing programs embedding s3mover.
+package s3movertest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/fujiwara/s3mover"
+)
+
+// NewMockS3Client creates a new in-memory S3 client.
+func NewMockS3Client() *MockS3Client {
+	return &MockS3Client{
+		mu:      sync.Mutex{},
+		Objects: make(map[string]*MockS3Object),
+		uploads: make(map[string]*mockUpload),
+	}
+}
+
+// MockS3Client is an in-memory implementation of s3mover.S3Client, s3mover.MultipartS3Client, s3mover.RestoreS3Client,
+// s3mover.ListPartsS3Client, s3mover.ListUploadsS3Client and s3mover.ProtectionS3Client.
+// The test objects put by s3mover are not stored in Objects but counted in TestObjects.
+type MockS3Client struct {
+	mu          sync.Mutex
+	Objects     map[string]*MockS3Object
+	TestObjects int
+
+	// MultipartUploads is the number of completed multipart uploads.
+	MultipartUploads int
+	// AbortedUploads is the number of aborted multipart uploads.
+	AbortedUploads int
+	// UploadedParts is the number of uploaded parts.
+	UploadedParts int
+
+	// Versioning is the versioning status of the buckets.
+	Versioning types.BucketVersioningStatus
+	// Replication is the replication configuration of the buckets. nil means not configured.
+	Replication *types.ReplicationConfiguration
+
+	uploads  map[string]*mockUpload
+	uploadID int
+}
+
+type mockUpload struct {
+	bucket      string
+	key         string
+	metadata    map[string]string
+	contentType string
+	tagging     string
+	parts       map[int32][]byte
+	initiated   time.Time
+}
+
+// MockS3Object represents an object stored in MockS3Client.
+type MockS3Object struct {
+	Bucket   string
+	Key      string
+	Size     int64
+	Content  []byte
+	Metadata map[string]string
+	// ContentType is the Content-Type of the object, empty if not specified.
+	ContentType string
+	// Tagging is the tag-set of the object encoded as URL query parameters, empty if not specified.
+	Tagging string
+	// LastModified is the time when the object is stored.
+	LastModified time.Time
+}
+
+var (
+	_ s3mover.S3Client            = (*MockS3Client)(nil)
+	_ s3mover.MultipartS3Client   = (*MockS3Client)(nil)
+	_ s3mover.RestoreS3Client     = (*MockS3Client)(nil)
+	_ s3mover.ListPartsS3Client   = (*MockS3Client)(nil)
+	_ s3mover.ListUploadsS3Client = (*MockS3Client)(nil)
+	_ s3mover.ProtectionS3Client  = (*MockS3Client)(nil)
+)
+
+func (c *MockS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if strings.Contains(*input.Key, s3mover.TestObjectKey) {
+		// ignore test object
+		c.TestObjects++
+		return &s3.PutObjectOutput{}, nil
+	}
+
+	b, _ := io.ReadAll(input.Body)
+	obj := MockS3Object{
+		Bucket:       *input.Bucket,
+		Key:          *input.Key,
+		Size:         *input.ContentLength,
+		Content:      b,
+		Metadata:     input.Metadata,
+		ContentType:  aws.ToString(input.ContentType),
+		Tagging:      aws.ToString(input.Tagging),
+		LastModified: time.Now(),
+	}
+	c.Objects[obj.Key] = &obj
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *MockS3Client) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if strings.Contains(*input.Key, s3mover.TestObjectKey) {
+		c.TestObjects--
+		return &s3.DeleteObjectOutput{}, nil
+	}
+	delete(c.Objects, *input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (c *MockS3Client) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.Objects[*input.Key]
+	if !ok || obj.Bucket != *input.Bucket {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(obj.Size),
+		Metadata:      obj.Metadata,
+	}, nil
+}
+
+func (c *MockS3Client) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.uploadID++
+	id := strconv.Itoa(c.uploadID)
+	c.uploads[id] = &mockUpload{
+		bucket:      *input.Bucket,
+		key:         *input.Key,
+		metadata:    input.Metadata,
+		contentType: aws.ToString(input.ContentType),
+		tagging:     aws.ToString(input.Tagging),
+		parts:       make(map[int32][]byte),
+		initiated:   time.Now(),
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (c *MockS3Client) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	b, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	up, ok := c.uploads[*input.UploadId]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	n := aws.ToInt32(input.PartNumber)
+	up.parts[n] = b
+	c.UploadedParts++
+	return &s3.UploadPartOutput{ETag: aws.String(partETag(b))}, nil
+}
+
+// partETag returns the ETag of the part as S3 does, the quoted MD5 of the content.
+func partETag(b []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(b))
+}
+
+func (c *MockS3Client) ListParts(ctx context.Context, input *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	up, ok := c.uploads[*input.UploadId]
+	if !ok || up.bucket != *input.Bucket || up.key != *input.Key {
+		return nil, &types.NoSuchUpload{}
+	}
+	out := &s3.ListPartsOutput{}
+	for n, b := range up.parts {
+		out.Parts = append(out.Parts, types.Part{
+			PartNumber: aws.Int32(n),
+			ETag:       aws.String(partETag(b)),
+			Size:       aws.Int64(int64(len(b))),
+		})
+	}
+	sort.Slice(out.Parts, func(i, j int) bool {
+		return aws.ToInt32(out.Parts[i].PartNumber) < aws.ToInt32(out.Parts[j].PartNumber)
+	})
+	return out, nil
+}
+
+func (c *MockS3Client) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	up, ok := c.uploads[*input.UploadId]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	var content []byte
+	for _, p := range input.MultipartUpload.Parts {
+		b, ok := up.parts[aws.ToInt32(p.PartNumber)]
+		if !ok {
+			return nil, fmt.Errorf("part %d is not uploaded", aws.ToInt32(p.PartNumber))
+		}
+		content = append(content, b...)
+	}
+	delete(c.uploads, *input.UploadId)
+	c.Objects[up.key] = &MockS3Object{
+		Bucket:       up.bucket,
+		Key:          up.key,
+		Size:         int64(len(content)),
+		Content:      content,
+		Metadata:     up.metadata,
+		ContentType:  up.contentType,
+		Tagging:      up.tagging,
+		LastModified: time.Now(),
+	}
+	c.MultipartUploads++
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c *MockS3Client) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.uploads[*input.UploadId]; !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	delete(c.uploads, *input.UploadId)
+	c.AbortedUploads++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (c *MockS3Client) GetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.Objects[*input.Key]
+	if !ok || obj.Bucket != *input.Bucket {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(obj.Content)),
+		ContentLength: aws.Int64(obj.Size),
+		Metadata:      obj.Metadata,
+		LastModified:  aws.Time(obj.LastModified),
+	}, nil
+}
+
+// ListObjectsV2 lists the objects in the order of the keys. The continuation token is the last key of the previous page.
+func (c *MockS3Client) ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	maxKeys := int(aws.ToInt32(input.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	var keys []string
+	for key, obj := range c.Objects {
+		if obj.Bucket == *input.Bucket && strings.HasPrefix(key, aws.ToString(input.Prefix)) && key > aws.ToString(input.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(len(keys) > maxKeys)}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		out.NextContinuationToken = aws.String(keys[maxKeys-1])
+	}
+	for _, key := range keys {
+		obj := c.Objects[key]
+		out.Contents = append(out.Contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(obj.Size),
+			LastModified: aws.Time(obj.LastModified),
+		})
+	}
+	out.KeyCount = aws.Int32(int32(len(out.Contents)))
+	return out, nil
+}
+
+// ListMultipartUploads lists the incomplete multipart uploads in the order of the keys and the upload IDs, in a page.
+func (c *MockS3Client) ListMultipartUploads(ctx context.Context, input *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := &s3.ListMultipartUploadsOutput{IsTruncated: aws.Bool(false)}
+	for id, up := range c.uploads {
+		if up.bucket == *input.Bucket && strings.HasPrefix(up.key, aws.ToString(input.Prefix)) {
+			out.Uploads = append(out.Uploads, types.MultipartUpload{
+				Key:       aws.String(up.key),
+				UploadId:  aws.String(id),
+				Initiated: aws.Time(up.initiated),
+			})
+		}
+	}
+	sort.Slice(out.Uploads, func(i, j int) bool {
+		a, b := out.Uploads[i], out.Uploads[j]
+		if *a.Key != *b.Key {
+			return *a.Key < *b.Key
+		}
+		return *a.UploadId < *b.UploadId
+	})
+	return out, nil
+}
+
+// Keys returns the keys of the stored objects.
+func (c *MockS3Client) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.Objects))
+	for k := range c.Objects {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (c *MockS3Client) GetBucketVersioning(ctx context.Context, input *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &s3.GetBucketVersioningOutput{Status: c.Versioning}, nil
+}
+
+func (c *MockS3Client) GetBucketReplication(ctx context.Context, input *s3.GetBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Replication == nil {
+		return nil, &smithy.GenericAPIError{Code: "ReplicationConfigurationNotFoundError", Message: "The replication configuration was not found"}
+	}
+	return &s3.GetBucketReplicationOutput{ReplicationConfiguration: c.Replication}, nil
+}
@@ -0,0 +1,276 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+)
+
+// ScheduleWindow is a time window of a day with its own parallelism.
+type ScheduleWindow struct {
+	// Days are the days of the week the window starts on.
+	Days [7]bool
+	// Start and End are the offsets from midnight. The window wraps midnight when End < Start.
+	Start, End time.Duration
+	// MaxParallels is the max parallels in the window. 0 pauses transporting.
+	MaxParallels int64
+	// BandwidthLimit is the bytes per second in the window. 0 means unlimited, negative means the default.
+	BandwidthLimit int64
+}
+
+// Schedule is a list of windows. The first window that contains the time wins.
+type Schedule []ScheduleWindow
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses the schedule such as "Mon-Fri 09:00-18:00=1/1MB; 01:00-05:00=8".
+// Windows are separated by ";". Days are optional and separated by ",". e.g. "Sat,Sun", "Mon-Fri".
+// The value is the max parallels and the optional bandwidth limit per second separated by "/".
+func ParseSchedule(s string) (Schedule, error) {
+	var sc Schedule
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		w, err := parseScheduleWindow(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", entry, err)
+		}
+		sc = append(sc, w)
+	}
+	return sc, nil
+}
+
+func parseScheduleWindow(entry string) (ScheduleWindow, error) {
+	w := ScheduleWindow{BandwidthLimit: -1}
+	spec, value, ok := strings.Cut(entry, "=")
+	if !ok {
+		return w, fmt.Errorf("=max-parallels is required")
+	}
+	value, bw, hasBandwidth := strings.Cut(value, "/")
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return w, fmt.Errorf("max parallels must be a non-negative integer")
+	}
+	w.MaxParallels = n
+	if hasBandwidth {
+		if w.BandwidthLimit, err = parseBytes(strings.TrimSpace(bw)); err != nil {
+			return w, err
+		}
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		for i := range w.Days {
+			w.Days[i] = true
+		}
+	case 2:
+		if w.Days, err = parseDays(fields[0]); err != nil {
+			return w, err
+		}
+		fields = fields[1:]
+	default:
+		return w, fmt.Errorf("format must be [days ]HH:MM-HH:MM=N")
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return w, fmt.Errorf("time range must be HH:MM-HH:MM")
+	}
+	if w.Start, err = parseClock(start); err != nil {
+		return w, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		f, ok := weekdays[strings.ToLower(from)]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q", from)
+		}
+		t := f
+		if isRange {
+			if t, ok = weekdays[strings.ToLower(to)]; !ok {
+				return days, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for d := f; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == t {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+var byteUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseBytes parses the size such as "512K", "10MB" and "1G". The units are 1024 based.
+func parseBytes(s string) (int64, error) {
+	num, unit := s, int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(strings.ToUpper(s), u.suffix) {
+			num, unit = s[:len(s)-len(u.suffix)], u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n * unit, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("time must be HH:MM: %q", s)
+	}
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hh < 0 || mm < 0 || mm > 59 || hh*60+mm > 24*60 {
+		return 0, fmt.Errorf("time must be between 00:00 and 24:00: %q", s)
+	}
+	return time.Duration(hh)*time.Hour + time.Duration(mm)*time.Minute, nil
+}
+
+// contains reports whether the window contains t.
+func (w ScheduleWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	today := w.Days[t.Weekday()]
+	switch {
+	case w.Start == w.End:
+		return today
+	case w.Start < w.End:
+		return today && w.Start <= offset && offset < w.End
+	default: // wraps midnight
+		yesterday := w.Days[(t.Weekday()+6)%7]
+		return (today && w.Start <= offset) || (yesterday && offset < w.End)
+	}
+}
+
+// At returns the window that contains t.
+func (sc Schedule) At(t time.Time) (ScheduleWindow, bool) {
+	for _, w := range sc {
+		if w.contains(t) {
+			return w, true
+		}
+	}
+	return ScheduleWindow{}, false
+}
+
+// MaxParallels returns the max parallels of the window that contains t, or the default.
+func (sc Schedule) MaxParallels(t time.Time, defaultParallels int64) int64 {
+	if w, ok := sc.At(t); ok {
+		return w.MaxParallels
+	}
+	return defaultParallels
+}
+
+// BandwidthLimit returns the bandwidth limit of the window that contains t, or the default.
+func (sc Schedule) BandwidthLimit(t time.Time, defaultLimit int64) int64 {
+	if w, ok := sc.At(t); ok && w.BandwidthLimit >= 0 {
+		return w.BandwidthLimit
+	}
+	return defaultLimit
+}
+
+// capacity returns the max parallels of all windows and the default.
+func (sc Schedule) capacity(defaultParallels int64) int64 {
+	c := defaultParallels
+	for _, w := range sc {
+		if w.MaxParallels > c {
+			c = w.MaxParallels
+		}
+	}
+	return c
+}
+
+// runSchedule applies the schedule and the adaptive mode to the parallelism periodically.
+func (tr *Transporter) runSchedule(ctx context.Context) error {
+	if len(tr.schedule) == 0 && tr.adaptive == nil {
+		return nil
+	}
+	ctx = slogcontext.WithValue(ctx, "component", "schedule")
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := tr.applySchedule(ctx, time.Now()); err != nil {
+			return err
+		}
+	}
+}
+
+const scheduleInterval = 10 * time.Second
+
+// applySchedule sets the parallelism and the bandwidth limit of the window at now.
+// The parallelism is limited further by the adaptive mode.
+// The unused capacity of the semaphore is held to limit the parallelism.
+func (tr *Transporter) applySchedule(ctx context.Context, now time.Time) error {
+	if bw := tr.schedule.BandwidthLimit(now, tr.config.BandwidthLimit); bw != tr.bandwidth.limit() {
+		tr.bandwidth.setLimit(bw)
+		slog.InfoContext(ctx, "bandwidth limit changed by schedule", "bandwidth_limit", bw)
+	}
+	n := tr.schedule.MaxParallels(now, tr.config.MaxParallels)
+	if n == 0 {
+		if tr.schedulePaused.CompareAndSwap(false, true) {
+			slog.InfoContext(ctx, "paused by schedule")
+		}
+		return nil
+	}
+	if tr.schedulePaused.CompareAndSwap(true, false) {
+		slog.InfoContext(ctx, "resumed by schedule")
+	}
+	if n = tr.adaptive.adjust(ctx, n); n == 0 {
+		tr.adaptivePaused.Store(true)
+		return nil
+	}
+	tr.adaptivePaused.Store(false)
+	if n == tr.parallels {
+		return nil
+	}
+	want := tr.capacity - n
+	switch {
+	case want > tr.reserved:
+		// waits for the in-flight uploads to finish
+		if err := tr.sem.Acquire(ctx, want-tr.reserved); err != nil {
+			return err
+		}
+	case want < tr.reserved:
+		tr.sem.Release(tr.reserved - want)
+	}
+	tr.reserved = want
+	tr.parallels = n
+	tr.metrics.setMaxParallels(n)
+	slog.InfoContext(ctx, "max parallels changed", "max_parallels", n)
+	return nil
+}
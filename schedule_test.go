@@ -0,0 +1,131 @@
+package s3mover_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestParseSchedule(t *testing.T) {
+	sc, err := s3mover.ParseSchedule("Mon-Fri 09:00-18:00=0; Sat,Sun 22:00-06:00=2; 01:00-05:00=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc) != 3 {
+		t.Fatalf("unexpected windows: %v", sc)
+	}
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	cases := []struct {
+		time string
+		want int64
+	}{
+		{"2024-06-03 10:00", 0}, // Mon
+		{"2024-06-03 18:00", 4}, // Mon, end is exclusive
+		{"2024-06-04 02:00", 8}, // Tue
+		{"2024-06-08 10:00", 4}, // Sat
+		{"2024-06-08 23:00", 2}, // Sat
+		{"2024-06-09 03:00", 2}, // Sun, wrapped from Sat
+		{"2024-06-10 03:00", 2}, // Mon, wrapped from Sun
+		{"2024-06-11 03:00", 8}, // Tue
+	}
+	for _, c := range cases {
+		if got := sc.MaxParallels(at(c.time), 4); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.time, got, c.want)
+		}
+	}
+}
+
+func TestParseScheduleError(t *testing.T) {
+	for _, s := range []string{
+		"09:00-18:00",
+		"09:00-18:00=-1",
+		"Foo 09:00-18:00=1",
+		"09:00-25:00=1",
+		"0900-1800=1",
+	} {
+		if _, err := s3mover.ParseSchedule(s); err == nil {
+			t.Errorf("%q must be invalid", s)
+		}
+	}
+}
+
+func TestApplySchedule(t *testing.T) {
+	ctx := context.Background()
+	tr, err := s3mover.New(ctx, &s3mover.Config{
+		MaxParallels: 1,
+		Schedule:     "Sat,Sun 00:00-00:00=0; 01:00-05:00=8",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sat := time.Date(2024, 6, 8, 10, 0, 0, 0, time.Local)
+	if err := tr.ApplySchedule(ctx, sat); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.Paused() {
+		t.Error("must be paused on Saturday")
+	}
+	mon := time.Date(2024, 6, 10, 2, 0, 0, 0, time.Local)
+	if err := tr.ApplySchedule(ctx, mon); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Paused() {
+		t.Error("must not be paused on Monday")
+	}
+	// back to the default max parallels
+	if err := tr.ApplySchedule(ctx, mon.Add(4*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseScheduleBandwidth(t *testing.T) {
+	sc, err := s3mover.ParseSchedule("Mon-Fri 09:00-18:00=1/512K; Sat,Sun 00:00-00:00=4/0; 18:00-09:00=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		time time.Time
+		want int64
+	}{
+		{time.Date(2024, 6, 3, 10, 0, 0, 0, time.Local), 512 * 1024}, // Mon
+		{time.Date(2024, 6, 8, 10, 0, 0, 0, time.Local), 0},          // Sat, unlimited
+		{time.Date(2024, 6, 3, 20, 0, 0, 0, time.Local), 1000},       // Mon night, default
+	}
+	for _, c := range cases {
+		if got := sc.BandwidthLimit(c.time, 1000); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.time, got, c.want)
+		}
+	}
+	if _, err := s3mover.ParseSchedule("09:00-18:00=1/10XB"); err == nil {
+		t.Error("invalid size must be an error")
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := s3mover.NewBandwidthLimiter(100 * 1000)
+	start := time.Now()
+	// the first 100KB is allowed as a burst
+	if err := l.Wait(ctx, 150*1000); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("must be limited: %s", elapsed)
+	}
+
+	start = time.Now()
+	if err := s3mover.NewBandwidthLimiter(0).Wait(ctx, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("must not be limited: %s", elapsed)
+	}
+}
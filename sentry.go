@@ -0,0 +1,96 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	// DefaultSentryErrorThreshold is the default number of consecutive failures of a file before reporting.
+	DefaultSentryErrorThreshold = 3
+
+	sentryFlushTimeout = 2 * time.Second
+)
+
+// errorReporter reports persistent upload errors and panics to a Sentry-compatible endpoint.
+type errorReporter struct {
+	config *Config
+	hub    *sentry.Hub
+}
+
+func newErrorReporter(config *Config) (*errorReporter, error) {
+	if config.SentryDSN == "" {
+		return nil, nil
+	}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         config.SentryDSN,
+		Environment: config.SentryEnvironment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize sentry client: %w", err)
+	}
+	hub := sentry.NewHub(client, sentry.NewScope())
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTag("bucket", config.Bucket)
+		scope.SetTag("prefix", config.KeyPrefix)
+		scope.SetTag("src", config.SrcDir)
+	})
+	return &errorReporter{
+		config: config,
+		hub:    hub,
+	}, nil
+}
+
+// failed reports the error of path when the file has failed
+// SentryErrorThreshold times in a row. It returns true if the error is reported.
+func (r *errorReporter) failed(ctx context.Context, path string, err error, count int) bool {
+	if count != r.config.SentryErrorThreshold {
+		return false
+	}
+	hub := r.hub.Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("file", path)
+		scope.SetExtra("failures", count)
+		hub.CaptureException(err)
+	})
+	slog.DebugContext(ctx, "reported error to sentry", "path", path, "failures", count)
+	return true
+}
+
+func (r *errorReporter) flush() {
+	r.hub.Flush(sentryFlushTimeout)
+}
+
+// onFailure records a failure of path and reports it to the error reporter if enabled.
+// It returns the number of consecutive failures of path.
+func (tr *Transporter) onFailure(ctx context.Context, path string, err error) int {
+	n := tr.failures.failed(path, err, time.Now())
+	if IsAuthError(err) {
+		tr.authFailed.Store(true)
+	}
+	if tr.reporter != nil {
+		tr.reporter.failed(ctx, path, err, n)
+	}
+	return n
+}
+
+// onSuccess forgets the failures of path.
+func (tr *Transporter) onSuccess(path string) {
+	tr.failures.succeeded(path)
+}
+
+// recoverPanic reports a panic to the error reporter if enabled. It must be called with defer.
+func (tr *Transporter) recoverPanic() {
+	if tr.reporter == nil {
+		return
+	}
+	if v := recover(); v != nil {
+		tr.reporter.hub.Recover(v)
+		tr.reporter.flush()
+		panic(v)
+	}
+}
@@ -0,0 +1,40 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestErrorReporter(t *testing.T) {
+	r, err := s3mover.NewErrorReporter(&s3mover.Config{
+		SentryDSN:            "http://public@127.0.0.1:1/1",
+		SentryErrorThreshold: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	e := errors.New("failed")
+	if r.Failed(ctx, "foo", e, 1) {
+		t.Error("must not be reported at the first failure")
+	}
+	if !r.Failed(ctx, "foo", e, 2) {
+		t.Error("must be reported at the threshold")
+	}
+	if r.Failed(ctx, "foo", e, 3) {
+		t.Error("must not be reported again")
+	}
+}
+
+func TestErrorReporterDisabled(t *testing.T) {
+	r, err := s3mover.NewErrorReporter(&s3mover.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != nil {
+		t.Error("reporter must be nil without DSN")
+	}
+}
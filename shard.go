@@ -0,0 +1,145 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ShardDirName is the hidden directory in SrcDir where the files are moved into the shards with Shards.
+const ShardDirName = ".s3mover-shards"
+
+// MaxShards is the max number of the shards.
+const MaxShards = 65536
+
+func (c *Config) validateShards() error {
+	if c.Shards == 0 {
+		return nil
+	}
+	if c.Shards < 2 || c.Shards > MaxShards {
+		return fmt.Errorf("shards must be between 2 and %d", MaxShards)
+	}
+	switch {
+	case c.Recursive:
+		return errors.New("shards can't be used with recursive")
+	case c.Mirror:
+		return errors.New("shards can't be used with mirror, which keeps the files in place")
+	case c.SQSQueueURL != "" || c.PathsFrom != "":
+		return errors.New("shards can't be used with sqs-queue-url and paths-from, which don't scan src")
+	}
+	return nil
+}
+
+// shardDir returns the shard directory of the file name, such as SrcDir/.s3mover-shards/1f.
+func (tr *Transporter) shardDir(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	width := len(fmt.Sprintf("%x", tr.config.Shards-1))
+	return filepath.Join(tr.config.SrcDir, ShardDirName, fmt.Sprintf("%0*x", width, h.Sum32()%uint32(tr.config.Shards)))
+}
+
+// intake moves the files discovered in the source directory into the shards, not to list a huge flat directory
+// on every scan. The sidecars are moved with the files. It returns the files left in the source directory,
+// failed to move such as of the same name already in the shard, to upload them from there.
+func (tr *Transporter) intake(ctx context.Context, paths []string) []string {
+	left := paths[:0]
+	for _, path := range paths {
+		if tr.isSidecar(path) {
+			// moved with the file. the orphans are left in src
+			if _, err := os.Lstat(strings.TrimSuffix(path, SidecarSuffix)); errors.Is(err, os.ErrNotExist) {
+				if _, err := os.Lstat(path); err == nil {
+					left = append(left, path)
+				}
+			}
+			continue
+		}
+		dst, err := tr.moveToShard(path)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to move the file into the shard. upload it from src", "path", path, "error", err.Error())
+			left = append(left, path)
+			continue
+		}
+		slog.DebugContext(ctx, "moved the file into the shard", "path", path, "shard", dst)
+	}
+	return left
+}
+
+func (tr *Transporter) moveToShard(path string) (string, error) {
+	dir := tr.shardDir(filepath.Base(path))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(path))
+	// rename overwrites the file of the same name silently
+	if _, err := os.Lstat(dst); err == nil {
+		return "", fmt.Errorf("%s already exists", dst)
+	}
+	if tr.config.Sidecar {
+		if _, err := os.Lstat(path + SidecarSuffix); err == nil {
+			if err := os.Rename(path+SidecarSuffix, dst+SidecarSuffix); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := os.Rename(path, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// scanSrc lists the files in the source directory. With Shards, the new files are moved into the shards,
+// and the files in the shards are listed together.
+func (tr *Transporter) scanSrc(ctx context.Context) ([]string, int64, error) {
+	paths, hidden, err := scanFiles(tr.config.SrcDir, tr.config.Recursive)
+	if err != nil || tr.config.Shards == 0 {
+		return paths, hidden, err
+	}
+	if !tr.config.Observe {
+		paths = tr.intake(ctx, paths)
+	}
+	sharded, err := listShards(filepath.Join(tr.config.SrcDir, ShardDirName))
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(paths, sharded...), hidden, nil
+}
+
+// listSrc lists the files in the source directory and the shards without moving them.
+func (tr *Transporter) listSrc() ([]string, error) {
+	paths, err := listFiles(tr.config.SrcDir, tr.config.Recursive)
+	if err != nil || tr.config.Shards == 0 {
+		return paths, err
+	}
+	sharded, err := listShards(filepath.Join(tr.config.SrcDir, ShardDirName))
+	if err != nil {
+		return nil, err
+	}
+	return append(paths, sharded...), nil
+}
+
+// listShards lists the files in the shard directories under dir.
+func listShards(dir string) ([]string, error) {
+	shards, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		files, err := listFiles(filepath.Join(dir, shard.Name()), false)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		paths = append(paths, files...)
+	}
+	return paths, nil
+}
@@ -0,0 +1,139 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestShards(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		s3movertest.WriteFile(t, dir, fmt.Sprintf("foo%02d.log", i), []byte("foo"))
+	}
+	s3movertest.WriteFile(t, dir, "bar.log", []byte("bar"))
+	s3movertest.WriteFile(t, dir, "bar.log"+s3mover.SidecarSuffix, []byte(`{"content_type":"text/plain"}`))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/shards",
+		MaxParallels: 1,
+		TimeFormat:   "2006",
+		Shards:       4,
+		Sidecar:      true,
+	}
+	tr, client := newTestTransporter(t, config)
+	// the first upload fails to keep the files in the shards
+	tr.SetRemoveFile(func(string) error { return errors.New("crashed") })
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("%s must be removed into the shards", e.Name())
+		}
+	}
+	shards, err := os.ReadDir(filepath.Join(dir, s3mover.ShardDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shards) < 2 || len(shards) > 4 {
+		t.Errorf("unexpected shards: %v", shards)
+	}
+	bar, _ := filepath.Glob(filepath.Join(dir, s3mover.ShardDirName, "*", "bar.log"))
+	if len(bar) != 1 {
+		t.Fatalf("bar.log must be removed into a shard: %v", bar)
+	}
+	if _, err := os.Stat(bar[0] + s3mover.SidecarSuffix); err != nil {
+		t.Errorf("the sidecar must be removed into the shard of the file: %v", err)
+	}
+	if len(client.Objects) != 21 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+	for _, key := range client.Keys() {
+		if strings.Contains(key, s3mover.ShardDirName) {
+			t.Errorf("the key must not contain the shard: %s", key)
+		}
+	}
+
+	// the files in the shards are uploaded and reremoved
+	tr, _ = newTestTransporter(t, config)
+	tr.SetS3Client(client)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, shard := range shards {
+		files, err := os.ReadDir(filepath.Join(dir, s3mover.ShardDirName, shard.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 0 {
+			t.Errorf("the files in the shard %s must be reremoved: %v", shard.Name(), files)
+		}
+	}
+}
+
+func TestShardsCollision(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/shards",
+		MaxParallels: 1,
+		Shards:       2,
+	}
+	tr, client := newTestTransporter(t, config)
+	tr.SetRemoveFile(func(string) error { return errors.New("crashed") })
+	s3movertest.WriteFile(t, dir, "foo.log", []byte("foo"))
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the file of the same name is uploaded from src, not overwriting the file in the shard
+	s3movertest.WriteFile(t, dir, "foo.log", []byte("foo2"))
+	var removed []string
+	tr.SetRemoveFile(func(path string) error {
+		removed = append(removed, path)
+		return os.Remove(path)
+	})
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || removed[0] == removed[1] {
+		t.Errorf("both files must be reremoved: %v", removed)
+	}
+	if len(client.Objects) != 1 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+	for _, obj := range client.Objects {
+		if string(obj.Content) != "foo2" {
+			t.Errorf("the file of the same name must be uploaded: %q", obj.Content)
+		}
+	}
+}
+
+func TestShardsValidate(t *testing.T) {
+	for _, c := range []s3mover.Config{
+		{Shards: 1},
+		{Shards: s3mover.MaxShards + 1},
+		{Shards: 16, Recursive: true},
+		{Shards: 16, Mirror: true},
+	} {
+		c.SrcDir, c.Bucket, c.KeyPrefix, c.MaxParallels = t.TempDir(), "testbucket", "test/shards", 1
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v must be invalid", c)
+		}
+	}
+}
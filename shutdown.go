@@ -0,0 +1,65 @@
+package s3mover
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// ShutdownSummary is the summary of a run logged at the shutdown.
+type ShutdownSummary struct {
+	Uploaded       int64   `json:"uploaded"`
+	UploadedBytes  int64   `json:"uploaded_bytes"`
+	Errored        int64   `json:"errored"`
+	DeadLettered   int64   `json:"dead_lettered"`
+	Remaining      int64   `json:"remaining"`
+	RemainingBytes int64   `json:"remaining_bytes"`
+	DrainSeconds   float64 `json:"drain_seconds"`
+	UptimeSeconds  float64 `json:"uptime_seconds"`
+}
+
+// shutdownSummary summarizes the run started at start. The drain is the time from the cancellation
+// of the run to the end of the in-flight uploads.
+func (tr *Transporter) shutdownSummary(start, drainStart, now time.Time) *ShutdownSummary {
+	m := tr.metrics.Snapshot()
+	s := &ShutdownSummary{
+		Uploaded:      m.Objects.Uploaded,
+		UploadedBytes: m.Objects.UploadedBytes,
+		Errored:       m.Objects.Errored,
+		DeadLettered:  m.Objects.DeadLettered,
+		UptimeSeconds: now.Sub(start).Seconds(),
+	}
+	if !drainStart.IsZero() {
+		s.DrainSeconds = now.Sub(drainStart).Seconds()
+	}
+	// the files left in the source directory, including the files kept after uploading
+	paths, _ := tr.listSrc()
+	for _, path := range paths {
+		if st, err := os.Stat(path); err == nil {
+			s.Remaining++
+			s.RemainingBytes += st.Size()
+		}
+	}
+	return s
+}
+
+// logShutdown logs the summary of the run, and records it to the audit log if AuditShutdown.
+func (tr *Transporter) logShutdown(ctx context.Context, s *ShutdownSummary) {
+	slog.InfoContext(ctx, "shutdown summary",
+		slog.Int64("uploaded", s.Uploaded),
+		slog.Int64("uploaded_bytes", s.UploadedBytes),
+		slog.Int64("errored", s.Errored),
+		slog.Int64("dead_lettered", s.DeadLettered),
+		slog.Int64("remaining", s.Remaining),
+		slog.Int64("remaining_bytes", s.RemainingBytes),
+		slog.Float64("drain_seconds", s.DrainSeconds),
+		slog.Float64("uptime_seconds", s.UptimeSeconds),
+	)
+	if !tr.config.AuditShutdown {
+		return
+	}
+	if err := tr.audit.shutdown(s); err != nil {
+		slog.WarnContext(ctx, err.Error())
+	}
+}
@@ -0,0 +1,71 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestShutdownSummary(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	config := &s3mover.Config{
+		SrcDir:        dir,
+		Bucket:        "testbucket",
+		KeyPrefix:     "test/shutdown",
+		MaxParallels:  1,
+		AuditLogPath:  auditLog,
+		AuditShutdown: true,
+	}
+	tr, _ := newTestTransporter(t, config)
+	done := make(chan error, 1)
+	go func() {
+		done <- tr.Run(ctx)
+	}()
+	for tr.Metrics().Snapshot().Objects.Uploaded == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// left in the source directory
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("barbar"))
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	var rec struct {
+		Event string `json:"event"`
+		s3mover.ShutdownSummary
+	}
+	if err := json.Unmarshal(lines[len(lines)-1], &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Event != s3mover.AuditEventShutdown || rec.Uploaded != 1 || rec.UploadedBytes != 3 || rec.Remaining > 1 {
+		t.Errorf("unexpected shutdown record: %s", lines[len(lines)-1])
+	}
+}
+
+func TestAuditShutdownValidate(t *testing.T) {
+	config := &s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/shutdown", AuditShutdown: true}
+	if err := config.Validate(); err == nil {
+		t.Error("audit-log-shutdown without audit-log must be invalid")
+	}
+}
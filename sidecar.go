@@ -0,0 +1,98 @@
+package s3mover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// SidecarSuffix is the suffix of the sidecar metadata files. The sidecar of foo.log is foo.log.meta.json.
+const SidecarSuffix = ".meta.json"
+
+// Sidecar represents the attributes of the object provided by the producer of the file.
+type Sidecar struct {
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+
+	// Key is the exact key of the object, and KeySuffix is the key under the prefix.
+	// They replace the key generated by the time format and the name.
+	Key       string `json:"key,omitempty"`
+	KeySuffix string `json:"key_suffix,omitempty"`
+}
+
+// isSidecar reports whether the file is a sidecar, which is not uploaded by itself.
+func (tr *Transporter) isSidecar(path string) bool {
+	return tr.config.Sidecar && strings.HasSuffix(path, SidecarSuffix)
+}
+
+// readSidecar reads the sidecar of the file. It returns nil if disabled or the sidecar doesn't exist.
+func (tr *Transporter) readSidecar(path string) (*Sidecar, error) {
+	if !tr.config.Sidecar {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path + SidecarSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var sc Sidecar
+	if err := json.Unmarshal(b, &sc); err != nil {
+		// the producer may be writing it. retried later
+		return nil, fmt.Errorf("failed to parse sidecar %s: %w", path+SidecarSuffix, err)
+	}
+	return &sc, nil
+}
+
+// mergeMetadata returns the metadata merged with the metadata of the sidecar.
+// The metadata of s3mover, such as MetadataMtime, takes precedence.
+func (sc *Sidecar) mergeMetadata(md map[string]string) map[string]string {
+	if sc == nil || len(sc.Metadata) == 0 {
+		return md
+	}
+	merged := make(map[string]string, len(sc.Metadata)+len(md))
+	for k, v := range sc.Metadata {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return merged
+}
+
+// tagging returns the tags encoded as URL query parameters, or nil if no tags.
+func (sc *Sidecar) tagging() *string {
+	if sc == nil || len(sc.Tags) == 0 {
+		return nil
+	}
+	v := url.Values{}
+	for k, t := range sc.Tags {
+		v.Set(k, t)
+	}
+	s := v.Encode()
+	return &s
+}
+
+// contentType returns the content type, or nil if not specified.
+func (sc *Sidecar) contentType() *string {
+	if sc == nil || sc.ContentType == "" {
+		return nil
+	}
+	return &sc.ContentType
+}
+
+// removeSidecar removes the sidecar of the file removed after uploading.
+func (tr *Transporter) removeSidecar(ctx context.Context, path string) {
+	if !tr.config.Sidecar {
+		return
+	}
+	if err := tr.removeFile(path + SidecarSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.WarnContext(ctx, "failed to remove sidecar", "path", path+SidecarSuffix, "error", err.Error())
+	}
+}
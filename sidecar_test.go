@@ -0,0 +1,50 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestSidecar(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	sidecar := s3movertest.WriteFile(t, dir, "foo.txt"+s3mover.SidecarSuffix,
+		[]byte(`{"metadata":{"producer":"app1"},"tags":{"team":"data","env":"prod"},"content_type":"text/plain"}`))
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	bar := s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/sidecar",
+		MaxParallels: 1,
+		Sidecar:      true,
+	}
+	tr, client := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 2 {
+		t.Fatalf("the sidecar must not be uploaded: %v", client.Keys())
+	}
+	for _, obj := range client.Objects {
+		switch string(obj.Content) {
+		case "foo":
+			if obj.Metadata["producer"] != "app1" || obj.ContentType != "text/plain" || obj.Tagging != "env=prod&team=data" {
+				t.Errorf("unexpected attributes of %s: %+v", obj.Key, obj)
+			}
+		case "bar":
+			if len(obj.Metadata) != 0 || obj.ContentType != "" || obj.Tagging != "" {
+				t.Errorf("unexpected attributes of %s: %+v", obj.Key, obj)
+			}
+		}
+	}
+	for _, path := range []string{foo, bar, sidecar} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s must be removed: %v", path, err)
+		}
+	}
+}
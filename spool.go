@@ -0,0 +1,152 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// SpoolOverflowDrain drains the spool ignoring the buffer conditions and the bandwidth limits, and alerts.
+	SpoolOverflowDrain = "drain"
+	// SpoolOverflowReject also rejects the files ingested by /ingest and gRPC.
+	SpoolOverflowReject = "reject"
+	// SpoolOverflowRemoveNewest also removes the newest files not uploaded yet to fit in MaxSpoolBytes.
+	SpoolOverflowRemoveNewest = "remove-newest"
+)
+
+// errSpoolFull is returned by ingest while the spool exceeds MaxSpoolBytes with SpoolOverflowReject.
+var errSpoolFull = errors.New("spool is full")
+
+// SpoolMetrics represents the total size of the files in the source directory by the last scan.
+type SpoolMetrics struct {
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+	Over     bool  `json:"over"`
+	// Removed is the number of files removed without uploading by SpoolOverflowRemoveNewest.
+	Removed int64 `json:"removed"`
+}
+
+// setSpool records the size of the spool, keeping the number of the removed files.
+func (m *Metrics) setSpool(s SpoolMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Spool != nil {
+		s.Removed += m.Spool.Removed
+	}
+	m.Spool = &s
+}
+
+// spoolFile is a file in the spool.
+type spoolFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// spoolFiles returns the files in the spool with the total size. It returns nil if MaxSpoolBytes is disabled.
+// The files kept after uploading are also counted because they occupy the disk.
+func (tr *Transporter) spoolFiles(paths []string) ([]spoolFile, int64) {
+	if tr.config.MaxSpoolBytes <= 0 {
+		return nil, 0
+	}
+	files := make([]spoolFile, 0, len(paths))
+	var total int64
+	for _, path := range paths {
+		st, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{path: path, size: st.Size(), modTime: st.ModTime()})
+		total += st.Size()
+	}
+	return files, total
+}
+
+// enforceSpool checks the spool against MaxSpoolBytes and returns the pending paths to upload.
+// While the spool exceeds the budget, s3mover drains it ignoring the buffer conditions and the bandwidth limits.
+func (tr *Transporter) enforceSpool(ctx context.Context, files []spoolFile, total int64, pending []string) []string {
+	limit := tr.config.MaxSpoolBytes
+	if limit <= 0 {
+		return pending
+	}
+	over := total > limit
+	if was := tr.spoolOver.Swap(over); was && !over {
+		slog.InfoContext(ctx, "spool fits in max-spool-bytes", slog.Int64("bytes", total), slog.Int64("max_spool_bytes", limit))
+	}
+	s := SpoolMetrics{Bytes: total, MaxBytes: limit, Over: over}
+	if !over {
+		tr.metrics.setSpool(s)
+		return pending
+	}
+	msg := fmt.Sprintf("CRITICAL: spool %s is %d bytes, exceeds max-spool-bytes %d", tr.config.SrcDir, total, limit)
+	slog.ErrorContext(ctx, "spool exceeds max-spool-bytes. draining", slog.Int64("bytes", total), slog.Int64("max_spool_bytes", limit))
+	if tr.alerter != nil {
+		tr.alerter.fire(ctx, "spool", msg, float64(total), float64(limit))
+	}
+	if tr.config.SpoolOverflowPolicy == SpoolOverflowRemoveNewest && !tr.config.Observe {
+		var removed map[string]bool
+		removed, total = tr.removeNewest(ctx, files, total, pending)
+		s.Removed, s.Bytes = int64(len(removed)), total
+		if len(removed) > 0 {
+			rest := pending[:0]
+			for _, path := range pending {
+				if !removed[path] {
+					rest = append(rest, path)
+				}
+			}
+			pending = rest
+		}
+	}
+	tr.metrics.setSpool(s)
+	return pending
+}
+
+// removeNewest removes the newest files not uploaded yet until the spool fits in MaxSpoolBytes.
+// It returns the removed paths and the total size after removing.
+func (tr *Transporter) removeNewest(ctx context.Context, files []spoolFile, total int64, pending []string) (map[string]bool, int64) {
+	isPending := make(map[string]bool, len(pending))
+	for _, path := range pending {
+		isPending[path] = true
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	removed := make(map[string]bool)
+	for _, f := range files {
+		if total <= tr.config.MaxSpoolBytes {
+			break
+		}
+		if !isPending[f.path] {
+			continue
+		}
+		if err := tr.removeFile(f.path); err != nil {
+			slog.WarnContext(ctx, "failed to remove file for max-spool-bytes", "path", f.path, "error", err.Error())
+			continue
+		}
+		tr.fanout.clear(f.path)
+		tr.removeSidecar(ctx, f.path)
+		removed[f.path] = true
+		total -= f.size
+		slog.ErrorContext(ctx, "removed file without uploading for max-spool-bytes", "path", f.path, "size", f.size)
+	}
+	return removed, total
+}
+
+// spoolRejecting reports whether the new files are rejected by SpoolOverflowReject.
+func (tr *Transporter) spoolRejecting() bool {
+	return tr.config.SpoolOverflowPolicy == SpoolOverflowReject && tr.spoolOver.Load()
+}
+
+// waitBandwidth blocks until n bytes are allowed to be sent by BandwidthLimit.
+// It doesn't block while draining the spool over MaxSpoolBytes.
+func (tr *Transporter) waitBandwidth(ctx context.Context, n int64) error {
+	if tr.spoolOver.Load() {
+		return nil
+	}
+	return tr.bandwidth.wait(ctx, n)
+}
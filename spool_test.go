@@ -0,0 +1,105 @@
+package s3mover_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestSpoolRemoveNewest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now()
+	var paths []string
+	for i, name := range []string{"old.txt", "mid.txt", "new.txt"} {
+		path := s3movertest.WriteFile(t, dir, name, []byte("0123456789"))
+		mtime := now.Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	config := &s3mover.Config{
+		SrcDir:              dir,
+		Bucket:              "testbucket",
+		KeyPrefix:           "test/spool",
+		MaxParallels:        1,
+		MaxSpoolBytes:       25,
+		SpoolOverflowPolicy: s3mover.SpoolOverflowRemoveNewest,
+	}
+	tr, client := newTestTransporter(t, config)
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Objects) != 2 {
+		t.Errorf("unexpected objects: %v", client.Keys())
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s must be removed: %v", path, err)
+		}
+	}
+	for key := range client.Objects {
+		if strings.HasSuffix(key, "/new.txt") {
+			t.Errorf("the newest file must not be uploaded: %s", key)
+		}
+	}
+	sp := tr.Metrics().Snapshot().Spool
+	if sp == nil || !sp.Over || sp.Bytes != 20 || sp.Removed != 1 {
+		t.Errorf("unexpected spool metrics: %+v", sp)
+	}
+}
+
+func TestSpoolReject(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	foo := s3movertest.WriteFile(t, dir, "foo.txt", []byte("0123456789"))
+	config := &s3mover.Config{
+		SrcDir:              dir,
+		Bucket:              "testbucket",
+		KeyPrefix:           "test/spool",
+		MaxParallels:        1,
+		IngestToken:         "secret",
+		StatsServerPort:     9898,
+		FaultErrorRate:      1,
+		MaxSpoolBytes:       5,
+		SpoolOverflowPolicy: s3mover.SpoolOverflowReject,
+	}
+	tr, _ := newTestTransporter(t, config)
+	srv := httptest.NewServer(tr.IngestHandler())
+	defer srv.Close()
+	post := func() int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/ingest?name=bar.txt", strings.NewReader("bar"))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// foo.txt fails to upload and stays in the spool
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code := post(); code != http.StatusInsufficientStorage {
+		t.Errorf("unexpected status %d while the spool is full", code)
+	}
+	if err := os.Remove(foo); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code := post(); code != http.StatusCreated {
+		t.Errorf("unexpected status %d after draining", code)
+	}
+}
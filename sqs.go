@@ -0,0 +1,141 @@
+package s3mover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	sqsWaitTimeSeconds = 20
+	sqsMaxMessages     = 10
+)
+
+// SQSClient is an interface for the SQS client.
+type SQSClient interface {
+	ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, input *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// sqsMessage is the JSON form of the message body. A plain text body is treated as a path.
+type sqsMessage struct {
+	Path string `json:"path"`
+}
+
+// runSQS receives messages containing the paths of local files from the SQS queue and transports them.
+// The message is deleted only after the file is uploaded and removed.
+func (tr *Transporter) runSQS(ctx context.Context) error {
+	ctx = slogcontext.WithValue(ctx, "queue", tr.config.SQSQueueURL)
+	slog.InfoContext(ctx, "receiving messages from SQS")
+	tr.setHealth(HealthStatusOK, "")
+	max := int32(sqsMaxMessages)
+	if tr.config.MaxParallels < int64(max) {
+		max = int32(tr.config.MaxParallels)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if err := tr.waitResumed(ctx); err != nil {
+			return err
+		}
+		if err := tr.waitCircuit(ctx); err != nil {
+			return err
+		}
+		out, err := tr.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            &tr.config.SQSQueueURL,
+			MaxNumberOfMessages: max,
+			WaitTimeSeconds:     sqsWaitTimeSeconds,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.WarnContext(ctx, fmt.Sprintf("failed to receive messages. retry after %s", RetryWait), "error", err.Error())
+			tr.sleep(ctx, RetryWait)
+			continue
+		}
+		tr.processMessages(ctx, out.Messages)
+	}
+}
+
+func (tr *Transporter) processMessages(ctx context.Context, msgs []types.Message) int64 {
+	var processed int64
+	var wg sync.WaitGroup
+	for _, msg := range msgs {
+		msg := msg
+		release, err := tr.acquireWorker(ctx)
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer release()
+			defer wg.Done()
+			if err := tr.processMessage(ctx, msg); err != nil {
+				slog.WarnContext(ctx, err.Error(), "message_id", msg.MessageId)
+				return
+			}
+			atomic.AddInt64(&processed, 1)
+		}()
+	}
+	wg.Wait()
+	tr.putBatchMarkers(ctx)
+	return processed
+}
+
+func (tr *Transporter) processMessage(ctx context.Context, msg types.Message) error {
+	path, err := tr.messagePath(msg)
+	if err != nil {
+		// keep the message to move it to the dead-letter queue by the redrive policy
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		// the file was already processed by a previous delivery of the message
+		slog.WarnContext(ctx, "file does not exist. deleting the message", "path", path)
+	} else if err := tr.transport(ctx, path); err != nil {
+		// keep the message to be visible again, e.g. for the other instances
+		return err
+	}
+	if _, err := tr.sqs.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &tr.config.SQSQueueURL,
+		ReceiptHandle: msg.ReceiptHandle,
+	}); err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return nil
+}
+
+// messagePath returns the path of the file in the message.
+// A relative path is resolved from the source directory. The path must be in the source directory.
+func (tr *Transporter) messagePath(msg types.Message) (string, error) {
+	if msg.Body == nil {
+		return "", errors.New("empty message body")
+	}
+	body := strings.TrimSpace(*msg.Body)
+	path := body
+	if strings.HasPrefix(body, "{") {
+		var m sqsMessage
+		if err := json.Unmarshal([]byte(body), &m); err != nil {
+			return "", fmt.Errorf("failed to parse message body: %w", err)
+		}
+		path = m.Path
+	}
+	if path == "" {
+		return "", errors.New("no path in message body")
+	}
+	return tr.srcPath(path)
+}
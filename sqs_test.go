@@ -0,0 +1,93 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+type mockSQSClient struct {
+	mu      sync.Mutex
+	deleted []string
+}
+
+func (c *mockSQSClient) ReceiveMessage(ctx context.Context, input *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *mockSQSClient) DeleteMessage(ctx context.Context, input *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deleted = append(c.deleted, *input.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestProcessMessages(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	outside := s3movertest.WriteFile(t, t.TempDir(), "secret.txt", []byte("secret"))
+	hidden := filepath.Join(dir, ".s3mover-journal")
+	if err := os.WriteFile(hidden, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s3movertest.WriteFile(t, dir, "qux.txt"+s3mover.SidecarSuffix, []byte("{}"))
+
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/sqs",
+		MaxParallels: 2,
+		SQSQueueURL:  "https://sqs.ap-northeast-1.amazonaws.com/123456789012/test",
+		Sidecar:      true,
+	}
+	tr, client := newTestTransporter(t, config)
+	sqsClient := &mockSQSClient{}
+	tr.SetSQSClient(sqsClient)
+
+	msgs := []types.Message{
+		{ReceiptHandle: aws.String("foo"), Body: aws.String(filepath.Join(dir, "foo.txt"))},
+		{ReceiptHandle: aws.String("bar"), Body: aws.String(`{"path":"bar.txt"}`)},
+		{ReceiptHandle: aws.String("gone"), Body: aws.String("gone.txt")},
+		{ReceiptHandle: aws.String("outside"), Body: aws.String(outside)},
+		{ReceiptHandle: aws.String("traversal"), Body: aws.String("../secret.txt")},
+		{ReceiptHandle: aws.String("hidden"), Body: aws.String(".s3mover-journal")},
+		// skipped by the policy, not uploaded
+		{ReceiptHandle: aws.String("sidecar"), Body: aws.String("qux.txt" + s3mover.SidecarSuffix)},
+	}
+	if n := tr.ProcessMessages(ctx, msgs); n != 3 {
+		t.Errorf("expected 3 processed messages, got %d", n)
+	}
+	if len(client.Objects) != 2 {
+		t.Errorf("expected 2 objects, got %v", client.Keys())
+	}
+	deleted := map[string]bool{}
+	for _, h := range sqsClient.deleted {
+		deleted[h] = true
+	}
+	for _, h := range []string{"foo", "bar", "gone"} {
+		if !deleted[h] {
+			t.Errorf("message %s must be deleted", h)
+		}
+	}
+	for _, h := range []string{"outside", "traversal", "hidden", "sidecar"} {
+		if deleted[h] {
+			t.Errorf("message %s must not be deleted", h)
+		}
+	}
+	for _, path := range []string{outside, hidden} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s must not be removed", path)
+		}
+	}
+}
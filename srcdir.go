@@ -0,0 +1,59 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+const (
+	// MissingSrcWait waits for the source directory to be created or remounted, with the degraded health.
+	MissingSrcWait = "wait"
+	// MissingSrcExit stops the agent.
+	MissingSrcExit = "exit"
+)
+
+// srcDirMissing reports whether the source directory is removed, unmounted or stale.
+func (tr *Transporter) srcDirMissing() bool {
+	st, err := os.Stat(tr.config.SrcDir)
+	if err == nil {
+		return !st.IsDir()
+	}
+	return errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, syscall.ENOTDIR) ||
+		errors.Is(err, syscall.ESTALE) || // NFS
+		errors.Is(err, syscall.ENOTCONN) || // FUSE
+		errors.Is(err, syscall.EIO)
+}
+
+// handleScanError counts the error of scanning the source directory, and applies MissingSrcPolicy
+// if the source directory disappears. It returns an error to stop the agent.
+func (tr *Transporter) handleScanError(ctx context.Context, err error) error {
+	tr.metrics.scanError()
+	if !tr.srcDirMissing() {
+		slog.WarnContext(ctx, fmt.Sprintf("retry after %s", RetryWait), "error", err.Error())
+		return nil
+	}
+	if tr.config.MissingSrcPolicy == MissingSrcExit {
+		return fmt.Errorf("source directory %s is missing: %w", tr.config.SrcDir, err)
+	}
+	if !tr.srcDirGone.Swap(true) {
+		slog.ErrorContext(ctx, "source directory is missing. waiting for it to be remounted", "src", tr.config.SrcDir, "error", err.Error())
+		tr.setHealth(HealthStatusDegraded, fmt.Sprintf("source directory %s is missing", tr.config.SrcDir))
+	} else {
+		slog.DebugContext(ctx, "source directory is still missing", "src", tr.config.SrcDir)
+	}
+	return nil
+}
+
+// srcDirScanned recovers the health after the source directory comes back.
+func (tr *Transporter) srcDirScanned(ctx context.Context) {
+	if tr.srcDirGone.Swap(false) {
+		slog.InfoContext(ctx, "source directory is back", "src", tr.config.SrcDir)
+		tr.setHealth(HealthStatusOK, "")
+	}
+}
@@ -0,0 +1,87 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func waitHealth(ctx context.Context, t *testing.T, tr *s3mover.Transporter, status string) {
+	t.Helper()
+	for tr.Health().Status != status {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("health must be %s: %+v", status, tr.Health())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestMissingSrcWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := filepath.Join(t.TempDir(), "src")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/missing",
+		MaxParallels: 1,
+	}
+	tr, _ := newTestTransporter(t, config)
+	done := make(chan error, 1)
+	go func() {
+		done <- tr.Run(ctx)
+	}()
+	waitHealth(ctx, t, tr, s3mover.HealthStatusOK)
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	waitHealth(ctx, t, tr, s3mover.HealthStatusDegraded)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitHealth(ctx, t, tr, s3mover.HealthStatusOK)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if sc := tr.Metrics().Snapshot().Scan; sc == nil || sc.Errors == 0 {
+		t.Errorf("the scan errors must be counted: %+v", sc)
+	}
+}
+
+func TestMissingSrcExit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := filepath.Join(t.TempDir(), "src")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := &s3mover.Config{
+		SrcDir:           dir,
+		Bucket:           "testbucket",
+		KeyPrefix:        "test/missing",
+		MaxParallels:     1,
+		MissingSrcPolicy: s3mover.MissingSrcExit,
+	}
+	tr, _ := newTestTransporter(t, config)
+	done := make(chan error, 1)
+	go func() {
+		done <- tr.Run(ctx)
+	}()
+	waitHealth(ctx, t, tr, s3mover.HealthStatusOK)
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "is missing") {
+		t.Errorf("must exit by the missing source directory: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package s3mover
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// errShortRead is the error of reading fewer bytes than the size of the file without an error,
+// which happens on NFS and FUSE file systems.
+var errShortRead = errors.New("short read")
+
+// stagedFiles maps the source files to their copies in StageDir being uploaded.
+type stagedFiles struct {
+	mu    sync.Mutex
+	files map[string]string // source path -> staged path
+}
+
+func (s *stagedFiles) put(path, staged string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string]string)
+	}
+	s.files[path] = staged
+}
+
+func (s *stagedFiles) remove(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, path)
+}
+
+// source returns the path to read the content of the file from, the staged copy if exists.
+func (s *stagedFiles) source(path string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if staged, ok := s.files[path]; ok {
+		return staged
+	}
+	return path
+}
+
+// stage copies the file into StageDir and fsyncs it, then the content is uploaded from the copy.
+// It fails unless the copy has the same size as st, so a short read of the source is not uploaded.
+// With TruncateUpload, the file is copied into TempDir without StageDir as the snapshot, and the content
+// read before the truncation is staged. It reports whether the file is truncated while copying.
+// The returned function removes the copy.
+func (tr *Transporter) stage(path string, st os.FileInfo) (func(), bool, error) {
+	snapshot := tr.config.TruncatePolicy == TruncateUpload
+	dir := tr.config.StageDir
+	if dir == "" {
+		if !snapshot {
+			return func() {}, false, nil
+		}
+		dir = tr.config.TempDir
+	}
+	staged, truncated, err := copyToStage(path, st, dir, snapshot)
+	if err != nil {
+		return nil, false, err
+	}
+	tr.staged.put(path, staged)
+	return func() {
+		tr.staged.remove(path)
+		os.Remove(staged)
+	}, truncated, nil
+}
+
+// copyToStage copies the file into dir. If the file is truncated while copying, the content read
+// before the truncation is kept with acceptTruncated, or it fails with errTruncated.
+func copyToStage(path string, st os.FileInfo, dir string, acceptTruncated bool) (string, bool, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", false, asLocalReadError(path, err)
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return "", false, err
+	}
+	staged := out.Name()
+	var truncated bool
+	if err := func() error {
+		defer out.Close()
+		n, err := io.Copy(out, in)
+		if err != nil {
+			return asLocalReadError(path, err)
+		}
+		if n != st.Size() {
+			cur, err := os.Stat(path)
+			switch {
+			case err == nil && cur.Size() < st.Size() && acceptTruncated:
+				truncated = true
+			case err == nil && cur.Size() < st.Size():
+				return fmt.Errorf("%s is %w while staging", path, errTruncated)
+			case err == nil && (cur.Size() != st.Size() || !cur.ModTime().Equal(st.ModTime())):
+				return fmt.Errorf("%s is modified while staging", path)
+			default:
+				return asLocalReadError(path, &fs.PathError{Op: "read", Path: path, Err: fmt.Errorf("%w: %d of %d bytes", errShortRead, n, st.Size())})
+			}
+		}
+		if err := out.Sync(); err != nil {
+			return err
+		}
+		return out.Close()
+	}(); err != nil {
+		os.Remove(staged)
+		return "", false, err
+	}
+	// the modification time is the timestamp of the object
+	if err := os.Chtimes(staged, st.ModTime(), st.ModTime()); err != nil {
+		os.Remove(staged)
+		return "", false, err
+	}
+	return staged, truncated, nil
+}
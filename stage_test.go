@@ -0,0 +1,61 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestStageDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	stage := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/stage",
+		MaxParallels: 1,
+		TimeFormat:   "2006/01/02",
+		StageDir:     stage,
+	}
+	tr, client := newTestTransporter(t, config)
+	path := s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	mtime := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	key := "test/stage/" + mtime.In(s3mover.TZ).Format("2006/01/02") + "/foo.txt"
+	obj, ok := client.Objects[key]
+	if !ok {
+		t.Fatalf("%s must be uploaded by the time of the source: %v", key, client.Keys())
+	}
+	if string(obj.Content) != "foo" {
+		t.Errorf("unexpected body: %q", obj.Content)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s must be removed: %v", path, err)
+	}
+	if entries, err := os.ReadDir(stage); err != nil || len(entries) != 0 {
+		t.Errorf("the staged copy must be removed: %v %v", entries, err)
+	}
+}
+
+func TestStageDirInSrc(t *testing.T) {
+	dir := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:    dir,
+		Bucket:    "testbucket",
+		KeyPrefix: "test/stage",
+		StageDir:  dir,
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("stage-dir must not be src")
+	}
+}
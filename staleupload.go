@@ -0,0 +1,175 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// DefaultAbortStaleUploadsInterval is the default interval of aborting the stale multipart uploads.
+const DefaultAbortStaleUploadsInterval = time.Hour
+
+const (
+	AbortUploadStatusAborted = "aborted"
+	AbortUploadStatusDryRun  = "dry_run"
+	AbortUploadStatusError   = "error"
+)
+
+// ListUploadsS3Client is an interface for the S3 client listing the incomplete multipart uploads.
+// When the S3Client implements it, the stale multipart uploads can be aborted.
+type ListUploadsS3Client interface {
+	ListMultipartUploads(ctx context.Context, input *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error)
+}
+
+// AbortUploadsOption represents options for AbortStaleUploads.
+type AbortUploadsOption struct {
+	// OlderThan aborts the multipart uploads initiated before the duration.
+	OlderThan time.Duration
+	// DryRun lists the stale multipart uploads without aborting them.
+	DryRun bool
+}
+
+// AbortUploadResult represents the result of aborting a stale multipart upload.
+type AbortUploadResult struct {
+	URL       string    `json:"url"`
+	UploadID  string    `json:"upload_id"`
+	Initiated time.Time `json:"initiated"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AbortStaleUploads aborts the incomplete multipart uploads under the key prefix of the primary bucket initiated
+// before opt.OlderThan. The parts of the uploads left by crashes are invisible but charged as storage.
+// The uploads in progress and the uploads to be resumed by the resume journal are not aborted.
+// The results are returned in the order of the keys.
+func (tr *Transporter) AbortStaleUploads(ctx context.Context, opt AbortUploadsOption) ([]AbortUploadResult, error) {
+	return tr.abortStaleUploads(ctx, opt, time.Now())
+}
+
+func (tr *Transporter) abortStaleUploads(ctx context.Context, opt AbortUploadsOption, now time.Time) ([]AbortUploadResult, error) {
+	if opt.OlderThan <= 0 {
+		return nil, fmt.Errorf("older-than must be positive")
+	}
+	mc, ok := multipartClient(tr.s3)
+	if !ok {
+		return nil, fmt.Errorf("the S3 client does not support multipart uploads")
+	}
+	lc, ok := listUploadsClient(tr.s3)
+	if !ok {
+		return nil, fmt.Errorf("the S3 client does not support listing multipart uploads")
+	}
+	bucket := tr.config.Bucket
+	uploads, err := listUploads(ctx, lc, bucket, strings.Trim(tr.config.KeyPrefix, "/")+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads of %s: %w", bucket, err)
+	}
+	keep := tr.resumableUploads()
+	var results []AbortUploadResult
+	for _, u := range uploads {
+		uploadID := aws.ToString(u.UploadId)
+		initiated := aws.ToTime(u.Initiated)
+		if !initiated.Before(now.Add(-opt.OlderThan)) || keep[uploadID] {
+			continue
+		}
+		if _, ok := tr.uploading.Load(uploadID); ok {
+			continue
+		}
+		key := aws.ToString(u.Key)
+		r := AbortUploadResult{
+			URL:       fmt.Sprintf("s3://%s/%s", bucket, key),
+			UploadID:  uploadID,
+			Initiated: initiated,
+			Status:    AbortUploadStatusAborted,
+		}
+		if opt.DryRun {
+			r.Status = AbortUploadStatusDryRun
+		} else if _, err := mc.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   &bucket,
+			Key:      &key,
+			UploadId: &uploadID,
+		}); err != nil {
+			r.Status, r.Error = AbortUploadStatusError, err.Error()
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// listUploadsClient returns the client as ListUploadsS3Client when listing the multipart uploads is available.
+func listUploadsClient(client S3Client) (ListUploadsS3Client, bool) {
+	if c, ok := client.(*faultS3Client); ok {
+		client = c.S3Client
+	}
+	lc, ok := client.(ListUploadsS3Client)
+	return lc, ok
+}
+
+// listUploads returns the incomplete multipart uploads under the prefix.
+func listUploads(ctx context.Context, client ListUploadsS3Client, bucket, prefix string) ([]types.MultipartUpload, error) {
+	var uploads []types.MultipartUpload
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}
+	for {
+		out, err := client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, out.Uploads...)
+		if !aws.ToBool(out.IsTruncated) {
+			return uploads, nil
+		}
+		input.KeyMarker, input.UploadIdMarker = out.NextKeyMarker, out.NextUploadIdMarker
+	}
+}
+
+// resumableUploads returns the upload IDs recorded in the resume journal.
+func (tr *Transporter) resumableUploads() map[string]bool {
+	ids := make(map[string]bool)
+	if tr.resume == nil {
+		return ids
+	}
+	for _, e := range tr.resume.list() {
+		if e.UploadID != "" {
+			ids[e.UploadID] = true
+		}
+	}
+	return ids
+}
+
+// runAbortStaleUploads aborts the stale multipart uploads every AbortStaleUploadsInterval.
+func (tr *Transporter) runAbortStaleUploads(ctx context.Context) error {
+	if tr.config.AbortStaleUploadsAfter <= 0 || tr.config.Observe {
+		return nil
+	}
+	ctx = slogcontext.WithValue(ctx, "component", "abort-stale-uploads")
+	ticker := time.NewTicker(tr.config.AbortStaleUploadsInterval)
+	defer ticker.Stop()
+	for {
+		results, err := tr.AbortStaleUploads(ctx, AbortUploadsOption{OlderThan: tr.config.AbortStaleUploadsAfter})
+		if err != nil {
+			// the next run may succeed
+			slog.WarnContext(ctx, err.Error())
+		}
+		for _, r := range results {
+			if r.Status == AbortUploadStatusError {
+				slog.WarnContext(ctx, "failed to abort stale multipart upload", "s3url", r.URL, "upload_id", r.UploadID, "error", r.Error)
+			} else {
+				slog.InfoContext(ctx, "aborted stale multipart upload", "s3url", r.URL, "upload_id", r.UploadID, "initiated", r.Initiated)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
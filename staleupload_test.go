@@ -0,0 +1,82 @@
+package s3mover_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestAbortStaleUploads(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal := filepath.Join(t.TempDir(), "resume")
+	for _, dryRun := range []bool{true, false} {
+		tr := newResumeTransporter(t, dir, journal)
+		client := s3movertest.NewMockS3Client()
+		tr.SetS3Client(client)
+		create := func(key string) string {
+			out, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("testbucket"), Key: aws.String(key)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return aws.ToString(out.UploadId)
+		}
+		stale := create("test/resume/2024/01/01/00/stale.txt")
+		create("other/2024/01/01/00/other.txt")
+
+		results, err := tr.AbortStaleUploadsAt(ctx, s3mover.AbortUploadsOption{OlderThan: time.Hour, DryRun: dryRun}, time.Now().Add(30*time.Minute))
+		if err != nil || len(results) != 0 {
+			t.Fatalf("the uploads must not be stale yet: %v %v", results, err)
+		}
+		results, err = tr.AbortStaleUploadsAt(ctx, s3mover.AbortUploadsOption{OlderThan: time.Hour, DryRun: dryRun}, time.Now().Add(2*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := map[bool]string{true: s3mover.AbortUploadStatusDryRun, false: s3mover.AbortUploadStatusAborted}[dryRun]
+		if len(results) != 1 || results[0].UploadID != stale || results[0].Status != status {
+			t.Errorf("unexpected results with dry-run %v: %+v", dryRun, results)
+		}
+		if expected := map[bool]int{true: 0, false: 1}[dryRun]; client.AbortedUploads != expected {
+			t.Errorf("unexpected aborted uploads with dry-run %v: %d", dryRun, client.AbortedUploads)
+		}
+	}
+}
+
+func TestAbortStaleUploadsResumable(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal := filepath.Join(t.TempDir(), "resume")
+	large := make([]byte, s3mover.MinMultipartPartSize*2)
+	s3movertest.WriteFile(t, dir, "large.txt", large)
+
+	// the upload interrupted by the shutdown is kept to be resumed
+	client := s3movertest.NewMockS3Client()
+	cctx, cancel := context.WithCancel(ctx)
+	tr := newResumeTransporter(t, dir, journal)
+	tr.SetS3Client(&crashingS3Client{MockS3Client: client, part: 2, cancel: cancel})
+	tr.Flush(cctx)
+
+	tr = newResumeTransporter(t, dir, journal)
+	tr.SetS3Client(client)
+	results, err := tr.AbortStaleUploadsAt(ctx, s3mover.AbortUploadsOption{OlderThan: time.Hour}, time.Now().Add(2*time.Hour))
+	if err != nil || len(results) != 0 || client.AbortedUploads != 0 {
+		t.Errorf("the resumable upload must not be aborted: %+v %v", results, err)
+	}
+}
+
+func TestAbortStaleUploadsIAMPolicy(t *testing.T) {
+	config := s3mover.Config{Bucket: "testbucket", KeyPrefix: "test/abort", AbortStaleUploadsAfter: 24 * time.Hour}
+	doc := config.IAMPolicy(s3mover.IAMPolicyOption{})
+	if actions := doc.Statement[0].Action; len(actions) != 2 || actions[1] != "s3:AbortMultipartUpload" {
+		t.Errorf("unexpected actions: %v", actions)
+	}
+	if s := doc.Statement[len(doc.Statement)-1]; s.Action[0] != "s3:ListBucketMultipartUploads" || s.Resource[0] != "arn:aws:s3:::testbucket" {
+		t.Errorf("unexpected statement: %+v", s)
+	}
+}
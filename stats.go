@@ -0,0 +1,189 @@
+package s3mover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultStatsEndpoint is the default endpoint of the stats server of the running agent.
+const DefaultStatsEndpoint = "http://127.0.0.1:9898"
+
+const statsClientTimeout = 10 * time.Second
+
+// Stats represents the stats fetched from the stats server.
+type Stats struct {
+	Metrics  *Metrics  `json:"metrics"`
+	Failures []Failure `json:"failures"`
+}
+
+// FetchStats fetches the metrics and the failures from the stats server at endpoint.
+func FetchStats(ctx context.Context, endpoint string) (*Stats, error) {
+	client := &http.Client{Timeout: statsClientTimeout}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	st := &Stats{}
+	if err := getJSON(ctx, client, endpoint+"/stats/metrics", &st.Metrics); err != nil {
+		return nil, err
+	}
+	if err := getJSON(ctx, client, endpoint+"/stats/failures", &st.Failures); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", u, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", u, err)
+	}
+	return nil
+}
+
+// Print pretty-prints the stats to w.
+func (st *Stats) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Objects:")
+	fmt.Fprintf(tw, "  uploaded\t%d\n", st.Metrics.Objects.Uploaded)
+	fmt.Fprintf(tw, "  errored\t%d\n", st.Metrics.Objects.Errored)
+	fmt.Fprintf(tw, "  queued\t%d\n", st.Metrics.Objects.Queued)
+	if n := st.Metrics.Objects.UploadedFallback; n > 0 {
+		fmt.Fprintf(tw, "  uploaded to fallback\t%d\n", n)
+	}
+	if n := st.Metrics.Objects.DeadLettered; n > 0 {
+		fmt.Fprintf(tw, "  dead-lettered\t%d\n", n)
+	}
+	if n := st.Metrics.Objects.TimedOut; n > 0 {
+		fmt.Fprintf(tw, "  timed out\t%d\n", n)
+	}
+	if n := st.Metrics.Objects.KeyCollisions; n > 0 {
+		fmt.Fprintf(tw, "  key collisions\t%d\n", n)
+	}
+	if n := st.Metrics.Objects.DuplicatesSuppressed; n > 0 {
+		fmt.Fprintf(tw, "  duplicates suppressed\t%d\n", n)
+	}
+	if n := st.Metrics.Objects.Truncated; n > 0 {
+		fmt.Fprintf(tw, "  truncated\t%d\n", n)
+	}
+	if n := st.Metrics.Objects.Locked; n > 0 {
+		fmt.Fprintf(tw, "  locked\t%d\n", n)
+	}
+	if n := st.Metrics.Objects.Observed; n > 0 {
+		fmt.Fprintf(tw, "  observed\t%d, %d bytes\n", n, st.Metrics.Objects.ObservedBytes)
+	}
+	if n := st.Metrics.Objects.CredentialErrors; n > 0 {
+		fmt.Fprintf(tw, "  credential errors\t%d\n", n)
+	}
+	if le := st.Metrics.Objects.LocalErrors; le != (LocalErrorMetrics{}) {
+		fmt.Fprintf(tw, "  local errors\tnot found %d, permission %d, io %d, other %d\n", le.NotFound, le.Permission, le.IO, le.Other)
+	}
+	wm := st.Metrics.Workers
+	fmt.Fprintln(tw, "Workers:")
+	fmt.Fprintf(tw, "  active\t%d / %d\n", wm.Active, wm.MaxParallels)
+	if wm.Acquired > 0 {
+		fmt.Fprintf(tw, "  average wait\t%s\n", time.Duration(wm.WaitSeconds/float64(wm.Acquired)*float64(time.Second)))
+	}
+	if sc := st.Metrics.Scan; sc != nil {
+		fmt.Fprintln(tw, "Scan:")
+		fmt.Fprintf(tw, "  count\t%d\n", sc.Count)
+		if sc.Errors > 0 {
+			fmt.Fprintf(tw, "  errors\t%d\n", sc.Errors)
+		}
+		fmt.Fprintf(tw, "  last duration\t%s\n", time.Duration(sc.DurationSeconds*float64(time.Second)))
+		fmt.Fprintf(tw, "  last discovered\t%d\n", sc.Discovered)
+		fmt.Fprintf(tw, "  last skipped\thidden %d, kept %d, policy %d, owner %d, observed %d\n", sc.Skipped.Hidden, sc.Skipped.Kept, sc.Skipped.Policy, sc.Skipped.Owner, sc.Skipped.Observed)
+	}
+	if sp := st.Metrics.Spool; sp != nil {
+		fmt.Fprintln(tw, "Spool:")
+		fmt.Fprintf(tw, "  bytes\t%d / %d\n", sp.Bytes, sp.MaxBytes)
+		if sp.Over {
+			fmt.Fprintln(tw, "  over\tdraining")
+		}
+		if sp.Removed > 0 {
+			fmt.Fprintf(tw, "  removed\t%d\n", sp.Removed)
+		}
+	}
+	if b := st.Metrics.Backlog; b != nil {
+		fmt.Fprintln(tw, "Backlog at startup:")
+		fmt.Fprintf(tw, "  files\t%d\n", b.Files)
+		fmt.Fprintf(tw, "  bytes\t%d\n", b.Bytes)
+		fmt.Fprintf(tw, "  oldest age\t%s\n", time.Duration(b.OldestAgeSeconds*float64(time.Second)).Truncate(time.Second))
+	}
+	if len(st.Metrics.Destinations) > 0 {
+		fmt.Fprintln(tw, "Destinations:")
+		urls := make([]string, 0, len(st.Metrics.Destinations))
+		for url := range st.Metrics.Destinations {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		for _, url := range urls {
+			d := st.Metrics.Destinations[url]
+			fmt.Fprintf(tw, "  %s\tuploaded %d, errored %d, %d bytes\n", url, d.Uploaded, d.Errored, d.Bytes)
+		}
+	}
+	if len(st.Metrics.Directories) > 0 {
+		fmt.Fprintln(tw, "Directories:")
+		dirs := make([]string, 0, len(st.Metrics.Directories))
+		for dir := range st.Metrics.Directories {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			d := st.Metrics.Directories[dir]
+			if d.Throttled > 0 {
+				fmt.Fprintf(tw, "  %s\tuploaded %d, errored %d, queued %d, %d bytes, throttled %d\n", dir, d.Uploaded, d.Errored, d.Queued, d.Bytes, d.Throttled)
+			} else {
+				fmt.Fprintf(tw, "  %s\tuploaded %d, errored %d, queued %d, %d bytes\n", dir, d.Uploaded, d.Errored, d.Queued, d.Bytes)
+			}
+		}
+	}
+	if len(st.Metrics.Priorities) > 0 {
+		fmt.Fprintln(tw, "Priorities:")
+		classes := make([]string, 0, len(st.Metrics.Priorities))
+		for class := range st.Metrics.Priorities {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			pm := st.Metrics.Priorities[class]
+			fmt.Fprintf(tw, "  %s\tuploaded %d, errored %d, queued %d\n", class, pm.Uploaded, pm.Errored, pm.Queued)
+		}
+	}
+	if r := st.Metrics.Runtime; r != nil {
+		fmt.Fprintln(tw, "Runtime:")
+		fmt.Fprintf(tw, "  goroutines\t%d\n", r.Goroutines)
+		fmt.Fprintf(tw, "  heap in use\t%d bytes\n", r.HeapInUse)
+		fmt.Fprintf(tw, "  gc\t%d times, %s total pause\n", r.GC.Count, time.Duration(r.GC.PauseTotalNs))
+		fmt.Fprintf(tw, "  open fds\t%d\n", r.OpenFDs)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Failures: %d\n", len(st.Failures))
+	if len(st.Failures) == 0 {
+		return nil
+	}
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  PATH\tCOUNT\tSINCE\tLAST ERROR")
+	for _, f := range st.Failures {
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\n", f.Path, f.Count, f.FirstFailedAt.Format(time.RFC3339), f.LastError)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,42 @@
+package s3mover_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestFetchStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"objects":{"uploaded":10,"errored":2,"queued":3},"runtime":{"goroutines":5}}`))
+	})
+	mux.HandleFunc("/stats/failures", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"path":"/tmp/foo.log","count":2,"last_error":"access denied","first_failed_at":"2024-06-01T00:00:00Z"}]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	st, err := s3mover.FetchStats(context.Background(), srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Metrics.Objects.Uploaded != 10 || len(st.Failures) != 1 {
+		t.Errorf("unexpected stats: %#v", st)
+	}
+	var b strings.Builder
+	if err := st.Print(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, s := range []string{`uploaded\s+10\n`, `goroutines\s+5\n`, `Failures: 1\n`, `/tmp/foo.log\s+2\s+2024-06-01T00:00:00Z\s+access denied\n`} {
+		if !regexp.MustCompile(s).MatchString(out) {
+			t.Errorf("%q is not found in output:\n%s", s, out)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package s3mover
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// tenantQuota limits the parallelism and the bandwidth of each top-level subdirectory (tenant) in the recursive mode,
+// so a noisy tenant cannot starve the uploads of the others.
+type tenantQuota struct {
+	maxParallels   int64
+	bandwidthLimit int64
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+}
+
+type tenant struct {
+	inflight  atomic.Int64
+	bandwidth *bandwidthLimiter
+}
+
+// newTenantQuota returns nil if neither TenantMaxParallels nor TenantBandwidthLimit is specified (disabled).
+func newTenantQuota(config *Config) *tenantQuota {
+	if !config.Recursive || (config.TenantMaxParallels <= 0 && config.TenantBandwidthLimit <= 0) {
+		return nil
+	}
+	return &tenantQuota{
+		maxParallels:   config.TenantMaxParallels,
+		bandwidthLimit: config.TenantBandwidthLimit,
+		tenants:        make(map[string]*tenant),
+	}
+}
+
+func (q *tenantQuota) get(dir string) *tenant {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tenants[dir]
+	if !ok {
+		t = &tenant{bandwidth: newBandwidthLimiter(q.bandwidthLimit)}
+		q.tenants[dir] = t
+	}
+	return t
+}
+
+// acquireTenant reserves an upload slot of the tenant of path without blocking.
+// It reports false if the tenant is uploading TenantMaxParallels files, to leave the file for the next scan.
+func (tr *Transporter) acquireTenant(path string) (func(), bool) {
+	q := tr.tenants
+	if q == nil || q.maxParallels <= 0 {
+		return func() {}, true
+	}
+	t := q.get(tr.topDirectory(path))
+	if t.inflight.Add(1) > q.maxParallels {
+		t.inflight.Add(-1)
+		tr.metrics.directory(tr.topDirectory(path)).Throttle()
+		return nil, false
+	}
+	return func() { t.inflight.Add(-1) }, true
+}
+
+// waitTenantBandwidth blocks until n bytes of the tenant of path are allowed to be sent.
+func (tr *Transporter) waitTenantBandwidth(ctx context.Context, path string, n int64) error {
+	if tr.tenants == nil || tr.spoolOver.Load() {
+		return nil
+	}
+	return tr.tenants.get(tr.topDirectory(path)).bandwidth.wait(ctx, n)
+}
@@ -0,0 +1,26 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errUploadTimeout is the cause of the upload requests canceled by UploadTimeout.
+var errUploadTimeout = errors.New("upload timed out")
+
+// uploadContext returns the context of an upload request with the deadline of UploadTimeout, if specified.
+func (tr *Transporter) uploadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if tr.config.UploadTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, tr.config.UploadTimeout, errUploadTimeout)
+}
+
+// uploadTimedOut wraps err with errUploadTimeout if the request is canceled by UploadTimeout.
+func (tr *Transporter) uploadTimedOut(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), errUploadTimeout) {
+		return fmt.Errorf("%w after %s: %w", errUploadTimeout, tr.config.UploadTimeout, err)
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package s3mover_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// hangingS3Client blocks PutObject until the context is done, like a hung connection.
+type hangingS3Client struct {
+	*s3movertest.MockS3Client
+}
+
+func (c *hangingS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if strings.Contains(*input.Key, s3mover.TestObjectKey) {
+		return c.MockS3Client.PutObject(ctx, input, optFns...)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestUploadTimeout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	config := &s3mover.Config{
+		SrcDir:        dir,
+		Bucket:        "testbucket",
+		KeyPrefix:     "test/timeout",
+		MaxParallels:  1,
+		UploadTimeout: 50 * time.Millisecond,
+	}
+	tr, _ := newTestTransporter(t, config)
+	tr.SetS3Client(&hangingS3Client{s3movertest.NewMockS3Client()})
+	start := time.Now()
+	if processed, total, err := tr.Flush(ctx); err != nil || processed != 0 || total != 1 {
+		t.Errorf("unexpected result: processed=%d total=%d err=%v", processed, total, err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the upload must time out: %s", d)
+	}
+	if m := tr.Metrics().Snapshot(); m.Objects.TimedOut != 1 || m.Objects.Errored != 1 {
+		t.Errorf("unexpected metrics: %+v", m.Objects)
+	}
+}
@@ -0,0 +1,18 @@
+package s3mover
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetTimezone sets the time zone of the keys of the objects, the batch manifests and the schedule,
+// instead of the local time zone (TZ environment variable).
+func SetTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	TZ = loc
+	time.Local = loc
+	return nil
+}
@@ -0,0 +1,25 @@
+package s3mover_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestSetTimezone(t *testing.T) {
+	tz, local := s3mover.TZ, time.Local
+	defer func() {
+		s3mover.TZ, time.Local = tz, local
+	}()
+	if err := s3mover.SetTimezone("Asia/Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2022, time.January, 1, 15, 0, 0, 0, time.UTC)
+	if key := s3mover.GenKey("test", "foo.txt", ts, false, "2006/01/02/15"); key != "test/2022/01/02/00/foo.txt" {
+		t.Errorf("unexpected key: %s", key)
+	}
+	if err := s3mover.SetTimezone("Asia/Nowhere"); err == nil {
+		t.Error("must be invalid")
+	}
+}
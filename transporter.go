@@ -2,12 +2,14 @@ package s3mover
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -16,11 +18,20 @@ import (
 
 	slogcontext "github.com/PumpkinSeed/slog-context"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"golang.org/x/sync/semaphore"
 )
 
+const (
+	// PathLayoutTimeDir places the preserved directories after the time. e.g. <prefix>/<time>/a/b/c.log
+	PathLayoutTimeDir = "time/dir"
+	// PathLayoutDirTime places the preserved directories before the time. e.g. <prefix>/a/b/<time>/c.log
+	PathLayoutDirTime = "dir/time"
+)
+
 const (
 	// DefaultMaxParallels is the default value of the maximum number of concurrent executions of the transfer process to S3.
 	DefaultMaxParallels = 1
@@ -43,82 +54,408 @@ func init() {
 	TZ = time.Local
 }
 
-// pool of bytes.Buffer
-// reuse buffer for gzip compression
-var pool = sync.Pool{
-	New: func() interface{} {
-		return new(bytes.Buffer)
-	},
-}
-
-func getBufferFromPool() (*bytes.Buffer, func()) {
-	buf := pool.Get().(*bytes.Buffer)
-	return buf, func() {
-		buf.Reset()
-		pool.Put(buf)
-	}
-}
-
 // S3Client is an interface for the S3 client.
 type S3Client interface {
 	PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 }
 
 // Transporter represents a file transfer process to S3.
 type Transporter struct {
 	s3        S3Client
+	sqs       SQSClient
+	awsConfig aws.Config
 	config    *Config
 	sem       *semaphore.Weighted
 	startFile string
 	stopFile  string
 	metrics   *Metrics
+	alerter   *alerter
+	reporter  *errorReporter
+	failures  *failureTracker
+	health    atomic.Pointer[Health]
+	paused    atomic.Bool
+	scanMu    sync.Mutex
+	inFlight  *inFlight
+
+	backlogOnce sync.Once
+
+	// schedule limits the parallelism by holding the unused capacity of sem.
+	schedule       Schedule
+	capacity       int64
+	reserved       int64
+	parallels      int64
+	schedulePaused atomic.Bool
+	adaptive       *adaptiveLimiter
+	adaptivePaused atomic.Bool
+	summary        *uploadSummary
+	uploaded       *uploadedKeys
+	manifest       *batchManifest
+	tenants        *tenantQuota
+	spoolOver      atomic.Bool // the spool exceeds MaxSpoolBytes
+	srcDirGone     atomic.Bool // the source directory is missing
+	authFailed     atomic.Bool // any upload failed by the credentials
+	dedupe         *startupDedupe
+	recent         *recentUploads
+	bandwidth      *bandwidthLimiter
+	journal        *journal
+	audit          *auditLog
+	fallback       *fallback
+	destinations   []*destinationClient
+	fanout         fanoutState
+	staged         stagedFiles
+	hashes         fileHashes
+	breaker        *circuitBreaker
+	cancel         context.CancelCauseFunc
+
+	// unremoved records the files uploaded but failed to remove, to retry only the removal.
+	unremoved  *journal
+	resume     *journal
+	uploading  sync.Map // the upload IDs of the multipart uploads in progress
+	removeFile func(string) error
+	locked     func(error) bool
+	skipped    skippedFiles
+	unreadable skippedFiles // by LocalErrorSkip
+	observed   skippedFiles // by Observe
+
+	ownership *ownershipFilter
+
+	// batchMarkers collects the directories to put the _SUCCESS markers with -done-marker=batch.
+	batchMarkers batchMarkers
+
+	converter *converter
+	validator *recordValidator
+
+	consecutiveErrors int64
+
+	budget *retryBudget
 }
 
 // New creates a new Transporter.
 func New(ctx context.Context, config *Config) (*Transporter, error) {
-	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	opts, err := config.awsConfigOptions()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	cfg = withCredentialsLogging(cfg, config.Profile)
+	vars := newKeyVarResolver(cfg, config.imdsOptions)
+	if config.KeyPrefix, err = vars.expand(ctx, config.KeyPrefix); err != nil {
+		return nil, err
+	}
+	if config.HeartbeatKey, err = vars.expand(ctx, config.HeartbeatKey); err != nil {
+		return nil, err
+	}
+	budget := newRetryBudget(config)
+	tr, err := newTransporter(config, s3.NewFromConfig(cfg, config.s3Options, budget.s3Options), cfg)
+	if err != nil {
+		return nil, err
+	}
+	tr.setRetryBudget(budget)
+	if config.SQSQueueURL != "" {
+		tr.sqs = sqs.NewFromConfig(cfg)
+	}
+	for _, s := range config.Destinations {
+		s, err := vars.expand(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		d, err := ParseDestination(s, config.KeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		client, credentials, err := d.newS3Client(ctx, cfg, opts...)
+		if err != nil {
+			return nil, err
+		}
+		tr.addDestination(d, client, credentials)
+	}
+	if config.FallbackBucket != "" {
+		fcfg := cfg.Copy()
+		if config.FallbackRegion != "" {
+			fcfg.Region = config.FallbackRegion
+		}
+		tr.fallback = &fallback{
+			s3:     s3.NewFromConfig(fcfg, budget.s3Options),
+			bucket: config.FallbackBucket,
+			after:  config.FallbackAfter,
+		}
+	}
+	return tr, nil
+}
+
+func newTransporter(config *Config, client S3Client, cfg aws.Config) (*Transporter, error) {
+	reporter, err := newErrorReporter(config)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := ParseSchedule(config.Schedule)
 	if err != nil {
 		return nil, err
 	}
+	capacity := schedule.capacity(config.MaxParallels)
 	tr := &Transporter{
-		s3:        s3.NewFromConfig(cfg),
-		config:    config,
-		sem:       semaphore.NewWeighted(config.MaxParallels),
-		stopFile:  filepath.Join(config.SrcDir, ".stop"),
-		startFile: filepath.Join(config.SrcDir, ".start"),
-		metrics:   &Metrics{},
+		s3:         newFaultS3Client(client, config),
+		awsConfig:  cfg,
+		config:     config,
+		sem:        semaphore.NewWeighted(capacity),
+		stopFile:   filepath.Join(config.SrcDir, ".stop"),
+		startFile:  filepath.Join(config.SrcDir, ".start"),
+		metrics:    NewMetrics(),
+		alerter:    newAlerter(config),
+		reporter:   reporter,
+		failures:   newFailureTracker(),
+		inFlight:   newInFlight(),
+		schedule:   schedule,
+		capacity:   capacity,
+		reserved:   capacity - config.MaxParallels,
+		parallels:  config.MaxParallels,
+		bandwidth:  newBandwidthLimiter(config.BandwidthLimit),
+		breaker:    newCircuitBreaker(config),
+		adaptive:   newAdaptiveLimiter(config),
+		summary:    newUploadSummary(config),
+		uploaded:   newUploadedKeys(config),
+		manifest:   newBatchManifest(config, time.Now()),
+		tenants:    newTenantQuota(config),
+		dedupe:     newStartupDedupe(config, time.Now()),
+		recent:     newRecentUploads(config),
+		unremoved:  newMemoryJournal(),
+		removeFile: removeFile,
+		locked:     isFileLocked,
+	}
+	tr.sem.TryAcquire(tr.reserved)
+	tr.metrics.setMaxParallels(tr.parallels)
+	if tr.ownership, err = newOwnershipFilter(config); err != nil {
+		return nil, err
+	}
+	if len(config.HighPriority) > 0 {
+		tr.metrics.Priorities = map[string]*PriorityMetrics{
+			PriorityHigh:   {},
+			PriorityNormal: {},
+		}
+	}
+	if config.Convert == ConvertParquet {
+		columns, err := ParseParquetSchema(config.ParquetSchema)
+		if err != nil {
+			return nil, err
+		}
+		tr.converter = newConverter(config.ConvertInput, columns)
+	}
+	if config.ValidateRecords != "" {
+		if tr.validator, err = newRecordValidator(config); err != nil {
+			return nil, err
+		}
+	}
+	if tr.audit, err = openAuditLog(config.AuditLogPath); err != nil {
+		return nil, err
+	}
+	if config.KeepAfterUpload > 0 || config.Mirror {
+		path := config.JournalPath
+		if path == "" {
+			path = filepath.Join(config.SrcDir, DefaultJournalName)
+		}
+		if tr.journal, err = openJournal(path); err != nil {
+			return nil, err
+		}
+	}
+	if config.ResumeJournalPath != "" {
+		if tr.resume, err = openJournal(config.ResumeJournalPath); err != nil {
+			return nil, err
+		}
 	}
 	return tr, nil
 }
 
+// SetS3Client replaces the S3 client of the Transporter. e.g. s3movertest.MockS3Client for testing.
+func (tr *Transporter) SetS3Client(client S3Client) {
+	tr.s3 = newFaultS3Client(client, tr.config)
+}
+
 // Run starts the Transporter.
 func (tr *Transporter) Run(ctx context.Context) error {
+	statsListener, grpcListener, err := tr.listen(ctx)
+	if err != nil {
+		return err
+	}
 	if err := tr.init(ctx); err != nil {
+		closeListeners(statsListener, grpcListener)
 		return err
 	}
 	ctx = slogcontext.WithValue(ctx, "component", "transporter")
 	slog.InfoContext(ctx, "starting up")
+	start := time.Now()
+	if _, ok := tr.s3.(*faultS3Client); ok {
+		slog.WarnContext(ctx, "fault injection is enabled. DO NOT use in production",
+			"error_rate", tr.config.FaultErrorRate,
+			"error_code", tr.config.FaultErrorCode,
+			"latency", tr.config.FaultLatency,
+		)
+	}
+	if tr.reporter != nil {
+		defer tr.reporter.flush()
+	}
+	defer tr.audit.close()
+	if err := tr.applySchedule(ctx, time.Now()); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	tr.cancel = cancel
+	var drainStart atomic.Int64
+	context.AfterFunc(ctx, func() {
+		drainStart.Store(time.Now().UnixNano())
+	})
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(9)
 	go func() {
 		defer wg.Done()
-		if err := tr.run(ctx); err != nil && err != context.Canceled {
+		defer cancel(nil) // stop the stats server when the main loop is finished
+		defer tr.recoverPanic()
+		run := tr.run
+		switch {
+		case tr.sqs != nil:
+			run = tr.runSQS
+		case tr.config.PathsFrom != "":
+			run = tr.runPathsFrom
+		}
+		if err := run(ctx); err != nil && err != context.Canceled {
 			slog.ErrorContext(ctx, err.Error())
 		}
 	}()
 	go func() {
 		defer wg.Done()
-		if err := tr.runStatsServer(ctx); err != nil && err != context.Canceled {
+		if err := tr.runStatsServer(ctx, statsListener); err != nil && err != context.Canceled {
+			slog.ErrorContext(ctx, err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := tr.runRetention(ctx); err != nil && err != context.Canceled {
+			slog.ErrorContext(ctx, err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := tr.runSchedule(ctx); err != nil && err != context.Canceled {
+			slog.ErrorContext(ctx, err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := tr.runLogSummary(ctx); err != nil && err != context.Canceled {
+			slog.ErrorContext(ctx, err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := tr.runBatchManifest(ctx); err != nil && err != context.Canceled {
+			slog.ErrorContext(ctx, err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := tr.runHeartbeat(ctx); err != nil && err != context.Canceled {
+			slog.ErrorContext(ctx, err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := tr.runAbortStaleUploads(ctx); err != nil && err != context.Canceled {
+			slog.ErrorContext(ctx, err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := tr.runGRPCServer(ctx, grpcListener); err != nil && err != context.Canceled {
 			slog.ErrorContext(ctx, err.Error())
 		}
 	}()
 	wg.Wait()
 	slog.InfoContext(ctx, "shutdown")
+	var drainStarted time.Time
+	if n := drainStart.Load(); n > 0 {
+		drainStarted = time.Unix(0, n)
+	}
+	tr.logShutdown(ctx, tr.shutdownSummary(start, drainStarted, time.Now()))
+	if err := context.Cause(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
 	return nil
 }
 
+// listen opens the listeners of the stats server and the gRPC server, and then drops the privileges.
+// The listeners are nil if the servers are disabled.
+func (tr *Transporter) listen(ctx context.Context) (stats, grpc net.Listener, err error) {
+	defer func() {
+		if err != nil {
+			closeListeners(stats, grpc)
+		}
+	}()
+	if stats, err = tr.listenStats(); err != nil {
+		return nil, nil, err
+	}
+	if grpc, err = grpcListen(tr.config.GRPCListen); err != nil {
+		return stats, nil, err
+	}
+	if err = tr.dropPrivileges(ctx); err != nil {
+		return stats, grpc, err
+	}
+	return stats, grpc, nil
+}
+
+func closeListeners(ls ...net.Listener) {
+	for _, l := range ls {
+		if l != nil {
+			l.Close()
+		}
+	}
+}
+
 // init initializes the Transporter. checks the source directory and S3 bucket.
 func (tr *Transporter) init(ctx context.Context) error {
+	if err := tr.checkSrcDir(); err != nil {
+		return err
+	}
+	if dir := tr.config.DeadLetterDir; dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create dead-letter directory %s: %w", dir, err)
+		}
+	}
+	if dir := tr.config.StageDir; dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create stage directory %s: %w", dir, err)
+		}
+	}
+	if dir := tr.config.DeleteArchiveDir; dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create delete archive directory %s: %w", dir, err)
+		}
+	}
+	if err := tr.checkIdentity(ctx); err != nil {
+		return err
+	}
+	if tr.config.Observe {
+		// the test object and the replay of the resume journal upload and remove the objects and the files
+		slog.InfoContext(ctx, "observe mode. the files are neither uploaded nor removed")
+		return tr.checkProtection(ctx)
+	}
+	// check if the bucket exists and the user has permission to write
+	if _, err := tr.putTestObject(ctx); err != nil {
+		return err
+	}
+	if err := tr.checkProtection(ctx); err != nil {
+		return err
+	}
+	tr.replayResumeJournal(ctx)
+	return nil
+}
+
+// checkSrcDir checks that the source directory exists and is writable.
+func (tr *Transporter) checkSrcDir() error {
 	if s, err := os.Stat(tr.config.SrcDir); err != nil {
 		return fmt.Errorf("failed to stat %s: %w", tr.config.SrcDir, err)
 	} else if !s.IsDir() {
@@ -132,17 +469,21 @@ func (tr *Transporter) init(ctx context.Context) error {
 			return fmt.Errorf("failed to remove %s: %w", tr.startFile, err)
 		}
 	}
+	return nil
+}
 
-	// check if the bucket exists and the user has permission to write
+// putTestObject puts the test object to the bucket and returns the key of the object.
+func (tr *Transporter) putTestObject(ctx context.Context) (string, error) {
+	key := genKey(tr.config.KeyPrefix, TestObjectKey, time.Now(), false, tr.config.TimeFormat)
 	if _, err := tr.s3.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:        &tr.config.Bucket,
-		Key:           aws.String(genKey(tr.config.KeyPrefix, TestObjectKey, time.Now(), false, tr.config.TimeFormat)),
+		Key:           &key,
 		Body:          bytes.NewReader([]byte("test")),
 		ContentLength: aws.Int64(4),
 	}); err != nil {
-		return fmt.Errorf("failed to put object to %s: %w", tr.config.Bucket, err)
+		return "", fmt.Errorf("failed to put object to %s: %w", tr.config.Bucket, err)
 	}
-	return nil
+	return key, nil
 }
 
 // sleep sleeps for d duration. It differs from time.Sleep in that it interrupts sleep when ctx is canceled.
@@ -156,18 +497,38 @@ func (tr *Transporter) sleep(ctx context.Context, d time.Duration) {
 }
 
 func (tr *Transporter) run(ctx context.Context) error {
+	tr.setHealth(HealthStatusOK, "")
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
-		processed, total, err := tr.runOnce(ctx)
+		if err := tr.waitResumed(ctx); err != nil {
+			return err
+		}
+		processed, total, err := tr.runOnce(ctx, false)
+		if errors.Is(err, errCircuitOpen) {
+			slog.DebugContext(ctx, "waiting for the circuit breaker to close", "queued", total)
+			tr.sleep(ctx, RetryWait)
+			continue
+		}
+		if errors.Is(err, errRetryBackoff) {
+			slog.DebugContext(ctx, "waiting for the backoff of the retry budget", "queued", total)
+			tr.sleep(ctx, RetryWait)
+			continue
+		}
 		if err != nil {
-			slog.WarnContext(ctx, fmt.Sprintf("retry after %s", RetryWait), "error", err.Error())
+			if err := tr.handleScanError(ctx, err); err != nil {
+				if tr.cancel != nil {
+					tr.cancel(err)
+				}
+				return err
+			}
 			tr.sleep(ctx, RetryWait)
 			continue
 		}
+		tr.srcDirScanned(ctx)
 		if total == 0 {
 			slog.DebugContext(ctx, "no files to upload")
 			tr.sleep(ctx, RetryWait)
@@ -188,135 +549,593 @@ func (tr *Transporter) run(ctx context.Context) error {
 	}
 }
 
-func (tr *Transporter) runOnce(ctx context.Context) (int64, int64, error) {
-	paths, err := listFiles(tr.config.SrcDir)
+// runOnce transports the files in the source directory. force uploads them ignoring the buffer conditions.
+func (tr *Transporter) runOnce(ctx context.Context, force bool) (int64, int64, error) {
+	// serialize with Flush not to transport the same file twice
+	tr.scanMu.Lock()
+	defer tr.scanMu.Unlock()
+	start := time.Now()
+	paths, hidden, err := tr.scanSrc(ctx)
 	if err != nil {
 		return 0, 0, err
 	}
+	tr.skipped.retain(paths)
+	tr.unreadable.retain(paths)
+	tr.observed.retain(paths)
+	tr.failures.retain(paths)
+	scan := ScanMetrics{Discovered: int64(len(paths))}
+	scan.Skipped.Hidden = hidden
+	spool, spoolBytes := tr.spoolFiles(paths)
+	// skip the files of the other owners, kept after uploading, or skipped by the policy
+	pending := paths[:0]
+	for _, path := range paths {
+		if !tr.owned(path) {
+			scan.Skipped.Owner++
+		} else if tr.kept(path) {
+			scan.Skipped.Kept++
+		} else if tr.skip(ctx, path) {
+			scan.Skipped.Policy++
+		} else if tr.alreadyObserved(path) {
+			scan.Skipped.Observed++
+		} else {
+			pending = append(pending, path)
+		}
+	}
+	paths = tr.enforceSpool(ctx, spool, spoolBytes, pending)
+	scan.DurationSeconds = time.Since(start).Seconds()
+	tr.metrics.setScan(scan)
+	tr.setQueued(paths)
+	now := time.Now()
+	tr.reportBacklog(ctx, paths, now)
+	if tr.alerter != nil {
+		// check even if no files are queued, to notice that nothing is flowing
+		tr.alerter.check(ctx, alertStatus{
+			Queued:            int64(len(paths)),
+			OldestAge:         oldestAge(paths, now),
+			ConsecutiveErrors: atomic.LoadInt64(&tr.consecutiveErrors),
+			SinceLastUpload:   now.Sub(time.Unix(0, atomic.LoadInt64(&tr.metrics.lastUploaded))),
+		})
+	}
 	if len(paths) == 0 {
 		// no need to process
 		return 0, 0, nil
 	}
+	if ok, reason := tr.bufferReady(paths, now); !ok && !force && !tr.spoolOver.Load() {
+		slog.DebugContext(ctx, "buffering files", "queued", len(paths))
+		return 0, 0, nil
+	} else if reason != "" {
+		slog.InfoContext(ctx, "flushing buffered files", "queued", len(paths), "reason", reason)
+	}
 
+	paths = tr.order(paths)
 	total := int64(len(paths))
+	if !tr.breaker.allow(now) {
+		return 0, total, errCircuitOpen
+	}
+	if !tr.budget.allow(now) {
+		return 0, total, errRetryBackoff
+	}
+	if tr.breaker.halfOpen(now) {
+		// try only one file
+		paths = paths[:1]
+		total = 1
+	}
 	var processed int64
 	var wg sync.WaitGroup
 	for _, path := range paths {
 		path := path
+		releaseWorker, err := tr.acquireWorker(ctx)
+		if err != nil {
+			break
+		}
+		release, ok := tr.acquireTenant(path)
+		if !ok {
+			// the tenant is at the quota. left for the next scan
+			releaseWorker()
+			total--
+			continue
+		}
 		wg.Add(1)
-		tr.sem.Acquire(ctx, 1)
 		go func() {
-			defer tr.sem.Release(1)
+			defer releaseWorker()
+			defer release()
 			defer wg.Done()
-			if err := tr.process(ctx, path); err != nil {
-				tr.metrics.PutObject(false)
-				slog.WarnContext(ctx, err.Error())
-			} else {
-				tr.metrics.PutObject(true)
+			if tr.transport(ctx, path) == nil {
 				atomic.AddInt64(&processed, 1)
 			}
 		}()
 	}
 	wg.Wait()
+	tr.putBatchMarkers(ctx)
 	return processed, total, nil
 }
 
+// transport processes the file and records the result to the metrics.
+// It returns errLeft (or errInFlight) if the file is not transported, to keep the message of SQS.
+func (tr *Transporter) transport(ctx context.Context, path string) error {
+	defer tr.recoverPanic()
+	if !tr.inFlight.acquire(path) {
+		slog.DebugContext(ctx, "already in flight. skip", "path", path)
+		return errInFlight
+	}
+	defer tr.inFlight.release(path)
+	if !tr.owned(path) {
+		slog.DebugContext(ctx, "not owned by the owners. left for the other instances", "path", path)
+		return fmt.Errorf("%s is %w: not owned", path, errLeft)
+	}
+	if tr.kept(path) {
+		slog.DebugContext(ctx, "already uploaded. kept until the grace period expires", "path", path)
+		return fmt.Errorf("%s is %w: kept after uploading", path, errLeft)
+	}
+	if tr.skip(ctx, path) {
+		return fmt.Errorf("%s is %w: skipped", path, errLeft)
+	}
+	if tr.config.Observe {
+		if err := tr.observe(ctx, path); err != nil {
+			slog.WarnContext(ctx, "failed to observe", "path", path, "error", err.Error())
+			return err
+		}
+		return nil
+	}
+	err := tr.retryLocked(ctx, path, tr.process(ctx, path))
+	if err != nil && tr.vanished(ctx, path, err) {
+		return nil
+	}
+	if errors.Is(err, errTruncated) {
+		return tr.leaveTruncated(ctx, path, err)
+	}
+	if tr.isLocked(err) {
+		return tr.leaveLocked(ctx, path, err)
+	}
+	if d := tr.directoryMetrics(path); d != nil {
+		d.PutObject(err == nil)
+	}
+	if pm := tr.priorityMetrics(path); pm != nil {
+		pm.PutObject(err == nil)
+	}
+	if err != nil {
+		tr.metrics.PutObject(false)
+		if errors.Is(err, errUploadTimeout) {
+			tr.metrics.TimedOut()
+		}
+		atomic.AddInt64(&tr.consecutiveErrors, 1)
+		n := tr.onFailure(ctx, path, err)
+		if tr.failFast(ctx, path, err) {
+			return err
+		}
+		if IsLocalReadError(err) {
+			reason := localErrorReason(err)
+			tr.metrics.LocalError(reason)
+			slog.WarnContext(ctx, err.Error(), "local_error", reason)
+			tr.onLocalError(ctx, path, err, n)
+			return err
+		}
+		slog.WarnContext(ctx, err.Error())
+		if IsPermanentError(err) {
+			tr.onPermanentError(ctx, path, err)
+		}
+		return err
+	}
+	tr.metrics.PutObject(true)
+	atomic.StoreInt64(&tr.consecutiveErrors, 0)
+	tr.onSuccess(path)
+	return nil
+}
+
 func (tr *Transporter) process(ctx context.Context, path string) error {
 	slog.DebugContext(ctx, "processing", "path", path)
-	if err := tr.upload(ctx, path); err != nil {
-		return fmt.Errorf("failed to upload %s: %w", path, err)
+	st, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, asLocalReadError(path, err))
+	}
+	if handled, err := tr.applyFilePolicy(ctx, path, st); handled {
+		return err
+	}
+	if invalid, err := tr.validateRecords(ctx, path); invalid || err != nil {
+		return err
 	}
-	slog.DebugContext(ctx, "uploaded successfully", "path", path)
+	if e, ok := tr.unremoved.get(path); ok {
+		if e.matches(st) {
+			slog.InfoContext(ctx, "already uploaded. retry removing only", "path", path, "key", e.Key)
+			return tr.remove(ctx, path)
+		}
+		// modified after the upload
+		tr.unremoved.remove(path)
+	}
+	if tr.recent.uploaded(tr.objectName(tr.config.SrcDir, path), st, time.Now()) {
+		slog.InfoContext(ctx, "the same file was uploaded recently. remove it without uploading", "path", path)
+		tr.metrics.DuplicateSuppressed()
+		return tr.remove(ctx, path)
+	}
+	revision := 0
+	if tr.config.Mirror && tr.config.RevisionSuffix {
+		if e, ok := tr.journal.get(path); ok {
+			revision = e.Revision + 1
+		}
+	}
+	var truncated bool
+	up := tr.uploadedBefore(ctx, path, st)
+	if up == nil {
+		unstage, snapshotTruncated, err := tr.stage(path, st)
+		if err != nil {
+			return fmt.Errorf("failed to stage %s: %w", path, err)
+		}
+		defer unstage()
+		truncated = snapshotTruncated
+		if !truncated && tr.shrunk(path, st) {
+			return fmt.Errorf("%s is %w before uploading", path, errTruncated)
+		}
+		sum, forget, err := tr.hashContent(path)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+		defer forget()
+		if same, err := tr.uploadedSameContent(ctx, path, sum, st); same || err != nil {
+			return err
+		}
+		if up, err = tr.uploadAll(ctx, path, tr.objectName(tr.config.SrcDir, path), revision); err != nil {
+			if !truncated && tr.shrunk(path, st) {
+				return fmt.Errorf("%s is %w while uploading: %w", path, errTruncated, err)
+			}
+			return fmt.Errorf("failed to upload %s: %w", path, err)
+		}
+		slog.DebugContext(ctx, "uploaded successfully", "path", path)
+		now := time.Now()
+		tr.metrics.uploadedAt(now)
+		tr.metrics.AddUploadedBytes(up.Size)
+		if d := tr.directoryMetrics(path); d != nil {
+			d.AddBytes(up.Size)
+			d.uploadedAt(now)
+		}
+		tr.recordUploaded(ctx, path, up, st, revision)
+		tr.recent.add(tr.objectName(tr.config.SrcDir, path), st, now)
+	}
+	if truncated || tr.shrunk(path, st) {
+		return tr.uploadedTruncated(ctx, path, up)
+	}
+	if tr.journal != nil {
+		if err := tr.keep(path, up, st, revision); err != nil {
+			return fmt.Errorf("failed to keep file %s: %w", path, err)
+		}
+		tr.forgetResume(ctx, path)
+		if tr.config.Mirror {
+			slog.DebugContext(ctx, "kept in mirror mode", "path", path)
+		} else {
+			slog.DebugContext(ctx, "kept until the grace period expires", "path", path, "keep", tr.config.KeepAfterUpload)
+		}
+		return nil
+	}
+	if err := tr.remove(ctx, path); err != nil {
+		tr.unremoved.put(&JournalEntry{
+			Path:       path,
+			Key:        up.Key,
+			Size:       st.Size(),
+			ModTime:    st.ModTime(),
+			UploadedAt: time.Now(),
+		})
+		return fmt.Errorf("uploaded but %w", err)
+	}
+	return nil
+}
+
+func (tr *Transporter) remove(ctx context.Context, path string) error {
 	slog.DebugContext(ctx, "removing...", "path", path)
-	if err := os.Remove(path); err != nil {
+	if err := tr.discard(path); err != nil {
 		return fmt.Errorf("failed to remove file %s: %w", path, err)
 	}
+	tr.unremoved.remove(path)
+	tr.forgetResume(ctx, path)
+	tr.fanout.clear(path)
+	tr.removeSidecar(ctx, path)
 	slog.DebugContext(ctx, "removed successfully", "path", path)
 	return nil
 }
 
-func (tr *Transporter) upload(ctx context.Context, path string) error {
-	body, length, ts, err := loadFile(path, tr.config.Gzip, tr.config.GzipLevel)
+// uploadResult represents the uploaded object.
+type uploadResult struct {
+	Bucket    string
+	Key       string
+	Size      int64
+	VersionID string
+	RequestID string // x-amz-request-id
+	HostID    string // x-amz-id-2, the extended request ID
+}
+
+// upload uploads the file to the primary bucket, or the fallback bucket while the primary bucket is failing.
+// A positive revision is appended to the name of the object as ".r<revision>".
+func (tr *Transporter) upload(ctx context.Context, path, name string, revision int) (*uploadResult, error) {
+	client, bucket, isFallback := tr.primaryDestination(time.Now())
+	up, err := tr.put(ctx, client, bucket, tr.config.KeyPrefix, path, name, revision)
+	if tr.refreshCredentials(ctx, tr.awsConfig.Credentials, err) {
+		up, err = tr.put(ctx, client, bucket, tr.config.KeyPrefix, path, name, revision)
+	}
+	if !isFallback {
+		tr.primaryResult(ctx, err, time.Now())
+	}
+	tr.recordCircuit(ctx, err, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, err
+	}
+	if isFallback {
+		tr.metrics.UploadedFallback()
+	}
+	return up, nil
+}
+
+// put uploads the file to the bucket with the key prefix as the object name.
+func (tr *Transporter) put(ctx context.Context, client S3Client, bucket, prefix, path, name string, revision int) (*uploadResult, error) {
+	sidecar, err := tr.readSidecar(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sidecar: %w", asLocalReadError(path, err))
+	}
+	override, err := tr.readKeyOverride(path, sidecar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directive: %w", asLocalReadError(path, err))
+	}
+	body, length, ts, name, err := tr.load(path, name, override.skip())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", asLocalReadError(path, err))
 	}
 	defer body.Close()
-	key := genKey(tr.config.KeyPrefix, filepath.Base(path), ts, tr.config.Gzip, tr.config.TimeFormat)
+	if name, err = tr.keyName(path, name); err != nil {
+		return nil, fmt.Errorf("failed to hash content: %w", err)
+	}
+	if revision > 0 {
+		name = fmt.Sprintf("%s.r%d", name, revision)
+	}
+	key, err := tr.fitKey(ctx, override.apply(prefix, tr.objectKey(prefix, path, name, ts), revision))
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := tr.fileMetadata(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file attributes: %w", asLocalReadError(path, err))
+	}
+	metadata = sidecar.mergeMetadata(metadata)
 
-	slog.DebugContext(ctx, "uploading",
-		"s3url", fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key),
-		slog.Int64("size", length),
-	)
-	if _, err := tr.s3.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:        &tr.config.Bucket,
-		Key:           &key,
-		Body:          body,
-		ContentLength: aws.Int64(length),
-	}); err != nil {
-		return fmt.Errorf("failed to put object: %w", err)
+	if err := tr.waitTenantBandwidth(ctx, path, length); err != nil {
+		return nil, err
+	}
+	var up *uploadResult
+	if mc, ra, ok := tr.useMultipart(client, body, length); ok {
+		slog.DebugContext(ctx, "uploading by multipart upload",
+			"s3url", fmt.Sprintf("s3://%s/%s", bucket, key),
+			slog.Int64("size", length),
+		)
+		if up, err = tr.putMultipart(ctx, mc, path, bucket, key, metadata, sidecar, ra, length); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := tr.waitBandwidth(ctx, length); err != nil {
+			return nil, err
+		}
+		slog.DebugContext(ctx, "uploading",
+			"s3url", fmt.Sprintf("s3://%s/%s", bucket, key),
+			slog.Int64("size", length),
+		)
+		start := time.Now()
+		uctx, cancel := tr.uploadContext(ctx)
+		out, err := client.PutObject(uctx, &s3.PutObjectInput{
+			Bucket:        &bucket,
+			Key:           &key,
+			Body:          body,
+			ContentLength: aws.Int64(length),
+			Metadata:      metadata,
+			ContentType:   sidecar.contentType(),
+			Tagging:       sidecar.tagging(),
+		})
+		err = tr.uploadTimedOut(uctx, err)
+		cancel()
+		tr.adaptive.observe(time.Since(start), err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to put object: %w", err)
+		}
+		up = &uploadResult{Bucket: bucket, Key: key, Size: length, VersionID: aws.ToString(out.VersionId)}
+		up.RequestID, _ = awsmiddleware.GetRequestIDMetadata(out.ResultMetadata)
+		up.HostID, _ = s3.GetHostIDMetadata(out.ResultMetadata)
 	}
-	slog.InfoContext(ctx, "upload completed",
-		"s3url", fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key),
+	if err := tr.markDone(ctx, client, up); err != nil {
+		return nil, err
+	}
+	if tr.uploaded.add(bucket, key, time.Now()) {
+		tr.metrics.KeyCollision()
+		slog.WarnContext(ctx, "the key was already uploaded recently. the object may be overwritten",
+			"s3url", fmt.Sprintf("s3://%s/%s", bucket, key),
+			"path", path,
+		)
+	}
+	slog.Log(ctx, tr.summary.uploadLogLevel(length), "upload completed",
+		"s3url", fmt.Sprintf("s3://%s/%s", bucket, key),
 		slog.Int64("size", length),
+		"version_id", up.VersionID,
+		"request_id", up.RequestID,
+		"host_id", up.HostID,
 	)
-	return nil
+	return up, nil
+}
+
+// objectName returns the object name of the file in dir.
+// It is the relative path from dir when the path is preserved, or the base name.
+func (tr *Transporter) objectName(dir, path string) string {
+	if tr.config.PreservePath {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(path)
+}
+
+// objectKey returns the object key for the name of the file by the path layout, with the suffix of the compression codec.
+func (tr *Transporter) objectKey(prefix, file, name string, ts time.Time) string {
+	if tr.config.PreservePathLayout == PathLayoutDirTime {
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			prefix, name = path.Join(prefix, name[:i]), name[i+1:]
+		}
+	}
+	key := genKey(prefix, name, roundTime(ts, tr.config.TimeRound), false, tr.config.TimeFormat)
+	return key + tr.config.compressSuffix(tr.codec(file))
+}
+
+// roundTime rounds down the time to the boundaries of the duration in TZ.
+// The boundaries are aligned to the midnight when the duration divides a day.
+func roundTime(ts time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return ts
+	}
+	t := ts.In(TZ)
+	_, offset := t.Zone()
+	off := time.Duration(offset) * time.Second
+	return t.Add(off).Truncate(d).Add(-off)
 }
 
 func genKey(prefix, name string, ts time.Time, gz bool, format string) string {
 	if format == "" {
 		format = DefaultTimeFormat
 	}
-	key := filepath.Join(prefix, ts.In(TZ).Format(format), name)
+	// the keys are always separated by slashes regardless of the OS
+	key := path.Join(prefix, ts.In(TZ).Format(format), name)
 	if gz {
 		return key + ".gz"
 	}
 	return key
 }
 
-func loadFile(path string, gz bool, gzipLevel int) (io.ReadCloser, int64, time.Time, error) {
+// loadFile opens the file as the body, skipping the first offset bytes.
+func loadFile(path string, offset int64, codec string, gzipLevel int, maxInMemory int64, tempDir string) (io.ReadCloser, int64, time.Time, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, 0, time.Time{}, err
 	}
 	stat, err := f.Stat()
 	if err != nil {
+		f.Close()
+		return nil, 0, time.Time{}, err
+	}
+	if offset > stat.Size() {
+		f.Close()
+		return nil, 0, time.Time{}, fmt.Errorf("%s is truncated", path)
+	}
+	if codec == "" {
+		if offset > 0 {
+			return &sectionFile{SectionReader: io.NewSectionReader(f, offset, stat.Size()-offset), f: f}, stat.Size() - offset, stat.ModTime(), nil
+		}
+		return f, stat.Size(), stat.ModTime(), nil
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
 		return nil, 0, time.Time{}, err
 	}
 
-	var length int64
-	var body io.ReadCloser
-	if gz {
-		buf, returnToPool := getBufferFromPool()
-		defer returnToPool() // bufferをpoolに戻す
-		gw, err := gzip.NewWriterLevel(buf, gzipLevel)
+	body, length, err := compressBody(f, codec, stat, gzipLevel, maxInMemory, tempDir)
+	if err != nil {
+		return nil, 0, time.Time{}, fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	return body, length, stat.ModTime(), nil
+}
+
+// sectionFile is a part of the file as the body. It's io.ReaderAt for the multipart uploads.
+type sectionFile struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (s *sectionFile) Close() error {
+	return s.f.Close()
+}
+
+// oldestAge returns the age of the oldest file in paths.
+func oldestAge(paths []string, now time.Time) time.Duration {
+	var age time.Duration
+	for _, path := range paths {
+		st, err := os.Stat(path)
 		if err != nil {
-			return nil, 0, time.Time{}, err
+			continue
 		}
-		if _, err := io.Copy(gw, f); err != nil {
-			return nil, 0, time.Time{}, err
+		if d := now.Sub(st.ModTime()); d > age {
+			age = d
 		}
-		gw.Close()
-		length = int64(buf.Len())
-		body = io.NopCloser(bytes.NewReader(buf.Bytes()))
-	} else {
-		body = f
-		length = stat.Size()
 	}
-	return body, length, stat.ModTime(), nil
+	return age
+}
+
+func listFiles(dir string, recursive bool) ([]string, error) {
+	paths, _, err := scanFiles(dir, recursive)
+	return paths, err
 }
 
-func listFiles(dir string) ([]string, error) {
+// scanFiles lists the files in dir. It also returns the number of the ignored hidden files and directories.
+func scanFiles(dir string, recursive bool) ([]string, int64, error) {
+	if recursive {
+		return walkFiles(dir)
+	}
 	files, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	var paths []string
+	var hidden int64
 	for _, file := range files {
 		// ignore directories and hidden files
-		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(file.Name(), ".") {
+			hidden++
 			continue
 		}
 		paths = append(paths, filepath.Join(dir, file.Name()))
 	}
-	return paths, nil
+	return paths, hidden, nil
+}
+
+// srcPath resolves the path notified by SQS or PathsFrom in the source directory.
+// A relative path is resolved from the source directory. The path out of the source directory, and the hidden
+// files (and the files in the hidden directories), such as the files being written or the journal, are rejected
+// like the files not listed by the scan.
+func (tr *Transporter) srcPath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(tr.config.SrcDir, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(filepath.Clean(tr.config.SrcDir), path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not in %s", path, tr.config.SrcDir)
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(name, ".") {
+			return "", fmt.Errorf("%s is a hidden file", path)
+		}
+	}
+	return path, nil
+}
+
+// walkFiles lists the files in dir and its subdirectories.
+func walkFiles(dir string) ([]string, int64, error) {
+	var paths []string
+	var hidden int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path != dir && errors.Is(err, os.ErrNotExist) {
+				// removed while walking
+				return nil
+			}
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		// ignore hidden files and directories
+		if strings.HasPrefix(d.Name(), ".") {
+			hidden++
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, hidden, err
 }
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
 	"github.com/samber/lo"
 )
 
@@ -41,8 +42,34 @@ func TestGenKey(t *testing.T) {
 	}
 }
 
+func TestRoundTime(t *testing.T) {
+	tz := s3mover.TZ
+	defer func() { s3mover.TZ = tz }()
+	s3mover.TZ = time.FixedZone("JST", 9*60*60)
+	ts := time.Date(2022, time.January, 2, 3, 4, 5, 6, s3mover.TZ)
+	cases := []struct {
+		d    time.Duration
+		want time.Time
+	}{
+		{0, ts},
+		{5 * time.Minute, time.Date(2022, time.January, 2, 3, 0, 0, 0, s3mover.TZ)},
+		{time.Hour, time.Date(2022, time.January, 2, 3, 0, 0, 0, s3mover.TZ)},
+		{6 * time.Hour, time.Date(2022, time.January, 2, 0, 0, 0, 0, s3mover.TZ)},
+		{24 * time.Hour, time.Date(2022, time.January, 2, 0, 0, 0, 0, s3mover.TZ)},
+	}
+	for _, c := range cases {
+		if got := s3mover.RoundTime(ts, c.d); !got.Equal(c.want) {
+			t.Errorf("%s: got %s, want %s", c.d, got, c.want)
+		}
+	}
+	config := &s3mover.Config{SrcDir: ".", Bucket: "testbucket", KeyPrefix: "test/round", TimeRound: 7 * time.Minute}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "time-round") {
+		t.Errorf("time-round not dividing a day must be an error: %v", err)
+	}
+}
+
 func TestListFiles(t *testing.T) {
-	files, err := s3mover.ListFiles("./testdata")
+	files, err := s3mover.ListFiles("./testdata", false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -64,7 +91,7 @@ func TestRun(t *testing.T) {
 }
 
 func testRun(t *testing.T, gzip bool) {
-	client := s3mover.NewMockS3Client()
+	client := s3movertest.NewMockS3Client()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	config := &s3mover.Config{
@@ -82,7 +109,7 @@ func testRun(t *testing.T, gzip bool) {
 	if err != nil {
 		t.Error(err)
 	}
-	tr.SetMockS3(client)
+	tr.SetS3Client(client)
 
 	testModTimes := make(map[string]time.Time, len(testFileNames))
 
@@ -153,7 +180,7 @@ func testRun(t *testing.T, gzip bool) {
 }
 
 func TestLoadFileRaw(t *testing.T) {
-	body, size, _, err := s3mover.LoadFile("./testdata/raw.txt", false, 0)
+	body, size, _, err := s3mover.LoadFile("./testdata/raw.txt", false, 0, 0, "")
 	if err != nil {
 		t.Error(err)
 	}
@@ -171,7 +198,7 @@ func TestLoadFileRaw(t *testing.T) {
 }
 
 func TestLoadFileGz(t *testing.T) {
-	body, size, _, err := s3mover.LoadFile("./testdata/raw.txt", true, 6)
+	body, size, _, err := s3mover.LoadFile("./testdata/raw.txt", true, 6, 0, "")
 	if err != nil {
 		t.Error(err)
 	}
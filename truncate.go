@@ -0,0 +1,50 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const (
+	// TruncateSkip leaves the file truncated after the discovery without uploading, treating the content
+	// before the truncation as lost. The content written after the truncation is uploaded at the next scan.
+	TruncateSkip = "skip"
+	// TruncateUpload uploads the content read before the truncation from the snapshot of the file,
+	// and leaves the file for the content written after the truncation.
+	TruncateUpload = "upload"
+)
+
+// errTruncated is the error of the file truncated after the discovery, such as by copytruncate of logrotate.
+var errTruncated = errors.New("truncated")
+
+// shrunk reports whether the file is smaller than st at the discovery. A file only appended never shrinks.
+func (tr *Transporter) shrunk(path string, st os.FileInfo) bool {
+	cur, err := os.Stat(path)
+	return err == nil && cur.Size() < st.Size()
+}
+
+// leaveTruncated leaves the file truncated before it's uploaded, for the next scan.
+func (tr *Transporter) leaveTruncated(ctx context.Context, path string, err error) error {
+	tr.metrics.Truncated()
+	tr.failures.succeeded(path)
+	slog.WarnContext(ctx, "the file is truncated after the discovery. the content before the truncation is lost, and the file is left for the next scan",
+		"path", path,
+		"error", err.Error(),
+	)
+	return fmt.Errorf("%s is %w: truncated", path, errLeft)
+}
+
+// uploadedTruncated leaves the file truncated after the content is read, not to remove the content
+// written after the truncation. It's uploaded at the next scan.
+func (tr *Transporter) uploadedTruncated(ctx context.Context, path string, up *uploadResult) error {
+	tr.metrics.Truncated()
+	slog.WarnContext(ctx, "the file is truncated after the discovery. uploaded the content read before the truncation, and the file is left for the next scan",
+		"path", path,
+		"s3url", fmt.Sprintf("s3://%s/%s", up.Bucket, up.Key),
+		slog.Int64("size", up.Size),
+	)
+	return nil
+}
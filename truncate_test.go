@@ -0,0 +1,112 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// copytruncateS3Client truncates the file like copytruncate of logrotate while reading the body of PutObject.
+type copytruncateS3Client struct {
+	*s3movertest.MockS3Client
+	path string
+}
+
+func (c *copytruncateS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if strings.Contains(*input.Key, s3mover.TestObjectKey) || c.path == "" {
+		return c.MockS3Client.PutObject(ctx, input, optFns...)
+	}
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(input.Body, head)
+	if err := os.WriteFile(c.path, []byte("new"), 0644); err != nil {
+		return nil, err
+	}
+	c.path = ""
+	rest, _ := io.ReadAll(input.Body)
+	b := append(head[:n], rest...)
+	if int64(len(b)) != aws.ToInt64(input.ContentLength) {
+		return nil, fmt.Errorf("read %d bytes, expected %d bytes", len(b), aws.ToInt64(input.ContentLength))
+	}
+	input.Body = bytes.NewReader(b)
+	return c.MockS3Client.PutObject(ctx, input, optFns...)
+}
+
+func TestTruncate(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		policy   string
+		uploaded string
+	}{
+		{s3mover.TruncateSkip, ""},
+		{s3mover.TruncateUpload, "0123456789"},
+	} {
+		dir := t.TempDir()
+		foo := s3movertest.WriteFile(t, dir, "foo.log", []byte("0123456789"))
+		config := &s3mover.Config{
+			SrcDir:         dir,
+			Bucket:         "testbucket",
+			KeyPrefix:      "test/truncate",
+			MaxParallels:   1,
+			TruncatePolicy: c.policy,
+			TempDir:        t.TempDir(),
+		}
+		tr, mock := newTestTransporter(t, config)
+		tr.SetS3Client(&copytruncateS3Client{MockS3Client: mock, path: foo})
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var objects []string
+		for _, obj := range mock.Objects {
+			objects = append(objects, string(obj.Content))
+		}
+		if c.uploaded == "" && len(objects) != 0 || c.uploaded != "" && (len(objects) != 1 || objects[0] != c.uploaded) {
+			t.Errorf("%s: unexpected objects %q", c.policy, objects)
+		}
+		if b, err := os.ReadFile(foo); err != nil || string(b) != "new" {
+			t.Errorf("%s: the content after the truncation must be left: %q %v", c.policy, b, err)
+		}
+		if m := tr.Metrics().Snapshot(); m.Objects.Truncated != 1 || m.Objects.Errored != 0 {
+			t.Errorf("%s: unexpected metrics: %+v", c.policy, m.Objects)
+		}
+		if len(tr.Failures()) != 0 {
+			t.Errorf("%s: the truncated file must not be a failure: %v", c.policy, tr.Failures())
+		}
+
+		// the content after the truncation is uploaded at the next scan
+		if _, _, err := tr.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(foo); !os.IsNotExist(err) {
+			t.Errorf("%s: %s must be removed: %v", c.policy, foo, err)
+		}
+		var found bool
+		for _, obj := range mock.Objects {
+			found = found || string(obj.Content) == "new"
+		}
+		if !found {
+			t.Errorf("%s: the content after the truncation must be uploaded", c.policy)
+		}
+	}
+}
+
+func TestTruncateValidate(t *testing.T) {
+	config := &s3mover.Config{
+		SrcDir:         t.TempDir(),
+		Bucket:         "testbucket",
+		KeyPrefix:      "test/truncate",
+		MaxParallels:   1,
+		TruncatePolicy: "lost",
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("unknown truncate policy must be invalid")
+	}
+}
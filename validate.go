@@ -0,0 +1,100 @@
+package s3mover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// CheckResult represents the result of a check performed by Validate.
+// Warning reports that the check is not required to run the agent, so its failure doesn't fail the validation.
+type CheckResult struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Warning bool   `json:"warning,omitempty"`
+	Message string `json:"message"`
+}
+
+// Validate checks the permissions of the source directory, the AWS credentials,
+// and the permission to write to the bucket without starting the agent.
+// The test object written to the bucket is removed after the check.
+func (tr *Transporter) Validate(ctx context.Context) []CheckResult {
+	ctx = slogcontext.WithValue(ctx, "component", "validate")
+	var results []CheckResult
+	record := func(name string, err error, okMsg, hint string, warning bool) bool {
+		r := CheckResult{Name: name, OK: err == nil, Warning: warning, Message: okMsg}
+		if err != nil {
+			r.Message = fmt.Sprintf("%s. %s", err, hint)
+			if warning {
+				slog.WarnContext(ctx, "check failed", "check", name, "message", r.Message)
+			} else {
+				slog.ErrorContext(ctx, "check failed", "check", name, "message", r.Message)
+			}
+		} else {
+			slog.InfoContext(ctx, "check passed", "check", name, "message", r.Message)
+		}
+		results = append(results, r)
+		return r.OK
+	}
+	add := func(name string, err error, okMsg, hint string) bool {
+		return record(name, err, okMsg, hint, false)
+	}
+
+	err := tr.checkSrcDir()
+	if err == nil {
+		_, err = os.ReadDir(tr.config.SrcDir)
+	}
+	add("src", err,
+		fmt.Sprintf("%s is readable and writable", tr.config.SrcDir),
+		"s3mover requires read and write permissions on the source directory to list and remove files.",
+	)
+
+	credsMsg := "AWS credentials are resolved"
+	if tr.awsConfig.Credentials == nil {
+		err = fmt.Errorf("no credentials provider is configured")
+	} else {
+		var creds aws.Credentials
+		creds, err = tr.awsConfig.Credentials.Retrieve(ctx)
+		if err == nil {
+			credsMsg = fmt.Sprintf("AWS credentials are resolved from %s", creds.Source)
+		}
+	}
+	if !add("credentials", err, credsMsg,
+		"Set credentials via environment variables (AWS_ACCESS_KEY_ID, AWS_PROFILE), a shared credentials file, or an IAM role.",
+	) {
+		return results
+	}
+
+	key, err := tr.putTestObject(ctx)
+	if !add("bucket", err,
+		fmt.Sprintf("s3://%s/%s is writable", tr.config.Bucket, key),
+		fmt.Sprintf("Check that the bucket exists in the region and s3:PutObject is allowed on %s*.", objectARN(tr.config.Bucket, tr.config.KeyPrefix)),
+	) {
+		return results
+	}
+
+	if tr.config.Paranoid {
+		protection, err := bucketProtection(ctx, tr.s3, tr.config.Bucket)
+		add("protection", err,
+			fmt.Sprintf("%s of %s is enabled", protection, tr.config.Bucket),
+			"-paranoid requires the versioning or the replication of the bucket enabled, and s3:GetBucketVersioning and s3:GetReplicationConfiguration allowed.",
+		)
+	}
+
+	_, err = tr.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &tr.config.Bucket,
+		Key:    &key,
+	})
+	// the agent never deletes the objects, so the failure of cleanup is only a warning
+	record("cleanup", err,
+		fmt.Sprintf("s3://%s/%s is removed", tr.config.Bucket, key),
+		"s3:DeleteObject is required only to clean up the test object of validate. Remove the test object manually.",
+		true,
+	)
+	return results
+}
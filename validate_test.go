@@ -0,0 +1,80 @@
+package s3mover_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+// denyDeleteS3Client fails DeleteObject as without s3:DeleteObject.
+type denyDeleteS3Client struct {
+	*s3movertest.MockS3Client
+}
+
+func (c *denyDeleteS3Client) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestValidate(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/validate",
+		MaxParallels: 1,
+	}
+	tr, err := s3mover.New(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := s3movertest.NewMockS3Client()
+	tr.SetS3Client(client)
+
+	results := tr.Validate(ctx)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %v", results)
+	}
+	for _, r := range results {
+		if !r.OK {
+			t.Errorf("check %s failed: %s", r.Name, r.Message)
+		}
+	}
+	if client.TestObjects != 0 {
+		t.Errorf("test object must be removed: %d", client.TestObjects)
+	}
+
+	// the failure of cleanup is only a warning
+	tr.SetS3Client(&denyDeleteS3Client{client})
+	for _, r := range tr.Validate(ctx) {
+		switch {
+		case r.Name == "cleanup" && (r.OK || !r.Warning):
+			t.Errorf("cleanup check must fail as a warning: %v", r)
+		case r.Name != "cleanup" && (!r.OK || r.Warning):
+			t.Errorf("check %s must pass: %v", r.Name, r)
+		}
+	}
+
+	// src is not a directory
+	config.SrcDir = filepath.Join(dir, "file")
+	if err := os.WriteFile(config.SrcDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tr, err = s3mover.New(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.SetS3Client(client)
+	results = tr.Validate(ctx)
+	if results[0].Name != "src" || results[0].OK {
+		t.Errorf("src check must fail: %v", results[0])
+	}
+}
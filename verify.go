@@ -0,0 +1,130 @@
+package s3mover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	slogcontext "github.com/PumpkinSeed/slog-context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	VerifyStatusOK           = "ok"
+	VerifyStatusMissing      = "missing"
+	VerifyStatusSizeMismatch = "size_mismatch"
+	VerifyStatusError        = "error"
+)
+
+// VerifyOption represents options for Verify.
+type VerifyOption struct {
+	// Dir is the directory of the local files to verify. e.g. an archive directory.
+	Dir string
+}
+
+// VerifyResult represents the result of verifying a file.
+type VerifyResult struct {
+	Path       string `json:"path"`
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	LocalSize  int64  `json:"local_size"`
+	RemoteSize int64  `json:"remote_size,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Verify checks that the objects corresponding to the files in opt.Dir exist in S3 with the expected size.
+// The results are returned in the order of the file names.
+func (tr *Transporter) Verify(ctx context.Context, opt VerifyOption) ([]VerifyResult, error) {
+	ctx = slogcontext.WithValue(ctx, "component", "verify")
+	if opt.Dir == "" {
+		return nil, fmt.Errorf("dir is required")
+	}
+	paths, err := listFiles(opt.Dir, tr.config.Recursive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files in %s: %w", opt.Dir, err)
+	}
+	slog.InfoContext(ctx, "verifying", "dir", opt.Dir, "files", len(paths))
+
+	results := make([]VerifyResult, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		i, path := i, path
+		results[i].Path = path
+		if err := tr.sem.Acquire(ctx, 1); err != nil {
+			results[i].Status = VerifyStatusError
+			results[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer tr.sem.Release(1)
+			defer wg.Done()
+			results[i] = tr.verify(ctx, path, tr.objectName(opt.Dir, path))
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (tr *Transporter) verify(ctx context.Context, path, name string) VerifyResult {
+	r := VerifyResult{Path: path}
+	sidecar, err := tr.readSidecar(path)
+	if err != nil {
+		r.Status = VerifyStatusError
+		r.Error = fmt.Sprintf("failed to read sidecar: %s", err)
+		return r
+	}
+	override, err := tr.readKeyOverride(path, sidecar)
+	if err != nil {
+		r.Status = VerifyStatusError
+		r.Error = fmt.Sprintf("failed to read key directive: %s", err)
+		return r
+	}
+	body, length, ts, name, err := tr.load(path, name, override.skip())
+	if err != nil {
+		r.Status = VerifyStatusError
+		r.Error = fmt.Sprintf("failed to open file: %s", err)
+		return r
+	}
+	body.Close()
+	if name, err = tr.keyName(path, name); err != nil {
+		r.Status = VerifyStatusError
+		r.Error = fmt.Sprintf("failed to hash content: %s", err)
+		return r
+	}
+	key, err := tr.fitKey(ctx, override.apply(tr.config.KeyPrefix, tr.objectKey(tr.config.KeyPrefix, path, name, ts), 0))
+	if err != nil {
+		r.Status = VerifyStatusError
+		r.Error = err.Error()
+		return r
+	}
+	r.URL = fmt.Sprintf("s3://%s/%s", tr.config.Bucket, key)
+	r.LocalSize = length
+
+	out, err := tr.s3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &tr.config.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
+			r.Status = VerifyStatusMissing
+		} else {
+			r.Status = VerifyStatusError
+			r.Error = fmt.Sprintf("failed to head object: %s", err)
+		}
+		return r
+	}
+	r.RemoteSize = aws.ToInt64(out.ContentLength)
+	if r.RemoteSize != r.LocalSize {
+		r.Status = VerifyStatusSizeMismatch
+	} else {
+		r.Status = VerifyStatusOK
+	}
+	slog.DebugContext(ctx, "verified", "path", path, "url", r.URL, "status", r.Status)
+	return r
+}
@@ -0,0 +1,59 @@
+package s3mover_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fujiwara/s3mover"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/verify",
+		MaxParallels: 1,
+		Gzip:         true,
+	}
+	tr, client := newTestTransporter(t, config)
+
+	// upload all files, then break b.txt and remove c.txt in S3
+	if _, err := tr.Replay(ctx, s3mover.ReplayOption{Dir: dir, Keep: true}); err != nil {
+		t.Fatal(err)
+	}
+	for key, obj := range client.Objects {
+		switch filepath.Base(key) {
+		case "b.txt.gz":
+			obj.Size++
+		case "c.txt.gz":
+			delete(client.Objects, key)
+		}
+	}
+
+	results, err := tr.Verify(ctx, s3mover.VerifyOption{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"a.txt": s3mover.VerifyStatusOK,
+		"b.txt": s3mover.VerifyStatusSizeMismatch,
+		"c.txt": s3mover.VerifyStatusMissing,
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), results)
+	}
+	for _, r := range results {
+		if s := expected[filepath.Base(r.Path)]; s != r.Status {
+			t.Errorf("%s: expected %s, got %s", r.Path, s, r.Status)
+		}
+	}
+}
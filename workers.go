@@ -0,0 +1,55 @@
+package s3mover
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerMetrics represents the metrics of the workers uploading the files, to tune MaxParallels by the data.
+type WorkerMetrics struct {
+	// Active is the number of the workers uploading now.
+	Active int64 `json:"active"`
+	// MaxParallels is the current max parallels, limited by the schedule and the adaptive mode.
+	MaxParallels int64 `json:"max_parallels"`
+	// Acquired is the number of the uploads started, and WaitSeconds is the total time they waited for a worker.
+	Acquired    int64   `json:"acquired"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+func (m *Metrics) workerAcquired(wait time.Duration) {
+	atomic.AddInt64(&m.Workers.Active, 1)
+	atomic.AddInt64(&m.Workers.Acquired, 1)
+	atomic.AddInt64(&m.workerWait, int64(wait))
+}
+
+func (m *Metrics) workerReleased() {
+	atomic.AddInt64(&m.Workers.Active, -1)
+}
+
+func (m *Metrics) setMaxParallels(n int64) {
+	atomic.StoreInt64(&m.Workers.MaxParallels, n)
+}
+
+func (m *Metrics) workersSnapshot() WorkerMetrics {
+	return WorkerMetrics{
+		Active:       atomic.LoadInt64(&m.Workers.Active),
+		MaxParallels: atomic.LoadInt64(&m.Workers.MaxParallels),
+		Acquired:     atomic.LoadInt64(&m.Workers.Acquired),
+		WaitSeconds:  time.Duration(atomic.LoadInt64(&m.workerWait)).Seconds(),
+	}
+}
+
+// acquireWorker waits for a worker to upload a file, and returns the function to release it.
+// The time waited is recorded to the metrics.
+func (tr *Transporter) acquireWorker(ctx context.Context) (func(), error) {
+	start := time.Now()
+	if err := tr.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	tr.metrics.workerAcquired(time.Since(start))
+	return func() {
+		tr.metrics.workerReleased()
+		tr.sem.Release(1)
+	}, nil
+}
@@ -0,0 +1,65 @@
+package s3mover_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/s3mover"
+	"github.com/fujiwara/s3mover/s3movertest"
+)
+
+func TestWorkerMetrics(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s3movertest.WriteFile(t, dir, "foo.txt", []byte("foo"))
+	s3movertest.WriteFile(t, dir, "bar.txt", []byte("bar"))
+	config := &s3mover.Config{
+		SrcDir:       dir,
+		Bucket:       "testbucket",
+		KeyPrefix:    "test/workers",
+		MaxParallels: 1,
+	}
+	tr, _ := newTestTransporter(t, config)
+	client := &blockingS3Client{
+		MockS3Client: s3movertest.NewMockS3Client(),
+		started:      make(chan struct{}),
+		unblock:      make(chan struct{}),
+	}
+	tr.SetS3Client(client)
+	done := make(chan error)
+	go func() {
+		_, _, err := tr.Flush(ctx)
+		done <- err
+	}()
+
+	<-client.started
+	if w := tr.Metrics().Snapshot().Workers; w.Active != 1 || w.MaxParallels != 1 || w.Acquired != 1 {
+		t.Errorf("unexpected workers while uploading: %+v", w)
+	}
+	// the second file waits for the worker
+	wait := 50 * time.Millisecond
+	time.Sleep(wait)
+	client.unblock <- struct{}{}
+	<-client.started
+	client.unblock <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	w := tr.Metrics().Snapshot().Workers
+	if w.Active != 0 || w.Acquired != 2 || w.WaitSeconds < wait.Seconds() {
+		t.Errorf("unexpected workers after uploading: %+v", w)
+	}
+
+	var buf bytes.Buffer
+	if err := tr.Metrics().Snapshot().WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"s3mover_workers_active 0\n", "s3mover_workers_max_parallels 1\n", "s3mover_workers_acquired_total 2\n"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("%q is not found in %s", s, buf.String())
+		}
+	}
+}